@@ -16,6 +16,7 @@ import (
 
 	"github.com/savegress/platform/backend/internal/config"
 	"github.com/savegress/platform/backend/internal/handlers"
+	"github.com/savegress/platform/backend/internal/metrics"
 	appMiddleware "github.com/savegress/platform/backend/internal/middleware"
 	"github.com/savegress/platform/backend/internal/repository"
 	"github.com/savegress/platform/backend/internal/services"
@@ -67,12 +68,45 @@ func main() {
 
 	billingService := services.NewBillingService(cfg.StripeSecretKey, cfg.StripeWebhookSecret)
 	billingService.SetDB(db)
+	billingService.SetPriceIDs(cfg.StripeProPriceID, cfg.StripeEntPriceID)
+	billingService.RegisterProvider(services.NewManualProvider(db))
 	userService := services.NewUserService(db)
+	apiKeyService := services.NewAPIKeyService(db)
 	telemetryService := services.NewTelemetryService(db, redis)
+	telemetryService.SetSignatureEnforcement(cfg.TelemetrySignaturesRequiredAfter)
+	telemetryService.SetRetention(cfg.TelemetryRetentionMonths)
 	earlyAccessService := services.NewEarlyAccessService(db, cfg.AdminEmail, cfg.ResendAPIKey)
 	connectionService := services.NewConnectionService(db, cfg.EncryptionKey)
+	retiredKeys := make(map[string][]byte)
+	for id, key := range cfg.EncryptionRetiredKeys {
+		retiredKeys[id] = key
+	}
+	// Credentials from before envelope encryption may use the former default key
+	hasLegacy, err := connectionService.HasLegacyCredentials(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to check for legacy credentials: %v", err)
+	}
+	if _, ok := retiredKeys[services.LegacyDefaultKeyID]; hasLegacy && !ok {
+		retiredKeys[services.LegacyDefaultKeyID] = services.LegacyDefaultKey()
+	}
+	keyring, err := services.NewKeyring(cfg.EncryptionKeyID, []byte(cfg.EncryptionKey), retiredKeys)
+	if err != nil {
+		log.Fatalf("Invalid encryption keys: %v", err)
+	}
+	connectionService.SetKeyring(keyring)
+	connectionService.SetRedis(redis)
+	connectionService.SetEmailService(emailService)
 	pipelineService := services.NewPipelineService(db)
+	telemetryService.SetPipelineService(pipelineService)
+	eventService := services.NewEventService(db, redis)
+	telemetryService.SetEventService(eventService)
+	pipelineService.SetEventService(eventService)
+	anomalyService := services.NewAnomalyService(db)
+	anomalyService.SetEventService(eventService)
 	configService := services.NewConfigGeneratorService(connectionService, pipelineService)
+	contractService := services.NewContractService(db, licenseService, emailService, cfg.SalesEmail)
+	usageStatementService := services.NewUsageStatementService(db, emailService)
+	alertService := services.NewAlertService(db, emailService)
 
 	// Initialize download service for personalized downloads
 	downloadService, err := services.NewDownloadService(context.Background(), services.DownloadConfig{
@@ -87,19 +121,39 @@ func main() {
 	if err != nil {
 		log.Printf("Warning: Download service not configured: %v", err)
 	}
+	fleetService := services.NewFleetService(db, emailService)
+	fleetService.SetDownloadService(downloadService)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, emailService)
 	authHandler.SetLicenseService(licenseService)
 	licenseHandler := handlers.NewLicenseHandler(licenseService, authService)
+	licenseHandler.SetContractService(contractService)
 	billingHandler := handlers.NewBillingHandler(billingService, licenseService, userService, emailService)
 	userHandler := handlers.NewUserHandler(userService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	eventHandler := handlers.NewEventHandler(eventService)
+	anomalyHandler := handlers.NewAnomalyHandler(anomalyService)
 	telemetryHandler := handlers.NewTelemetryHandler(telemetryService, licenseService)
+	telemetryHandler.SetConnectionService(connectionService)
 	healthHandler := handlers.NewHealthHandler(db, redis)
+
+	// Metrics computed at scrape time
+	metrics.Registry.MustRegister(
+		metrics.NewPoolCollector(db.Stat),
+		metrics.NewFleetCollector(telemetryService.FleetStats),
+	)
 	earlyAccessHandler := handlers.NewEarlyAccessHandler(earlyAccessService, cfg.TurnstileSecretKey)
 	connectionHandler := handlers.NewConnectionHandler(connectionService)
+	connectionBundleHandler := handlers.NewConnectionBundleHandler(services.NewConnectionBundleService(db, connectionService, pipelineService))
+	connectionBundleHandler.SetLicenseService(licenseService)
 	pipelineHandler := handlers.NewPipelineHandler(pipelineService, licenseService)
+	pipelineHandler.SetConnectionService(connectionService)
 	configHandler := handlers.NewConfigHandler(configService, licenseService)
+	contractHandler := handlers.NewContractHandler(contractService)
+	usageStatementHandler := handlers.NewUsageStatementHandler(usageStatementService)
+	alertHandler := handlers.NewAlertHandler(alertService)
+	fleetHandler := handlers.NewFleetHandler(fleetService)
 
 	// Personalized download handler (optional - only if download service is configured)
 	var personalizedDownloadHandler *handlers.PersonalizedDownloadHandler
@@ -113,9 +167,10 @@ func main() {
 	// Global middleware
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(appMiddleware.Metrics)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(appMiddleware.TimeoutExcept(60*time.Second, "/api/v1/events/stream"))
 
 	// CORS
 	r.Use(cors.Handler(cors.Options{
@@ -135,6 +190,13 @@ func main() {
 	r.Get("/health/ready", healthHandler.Ready)
 	r.Get("/health/detailed", healthHandler.Detailed)
 
+	// Prometheus metrics (bearer token)
+	if cfg.MetricsToken != "" {
+		r.With(appMiddleware.RequireMetricsToken(cfg.MetricsToken)).Handle("/metrics", metrics.Handler())
+	} else {
+		log.Println("METRICS_TOKEN not set, /metrics is disabled")
+	}
+
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
 		// Public routes
@@ -159,6 +221,15 @@ func main() {
 
 		// Telemetry (from CDC engines)
 		r.Post("/telemetry", telemetryHandler.Receive)
+		r.Post("/telemetry/batch", telemetryHandler.ReceiveBatch)
+		r.Post("/telemetry/connection-tests", telemetryHandler.ReceiveConnectionTest)
+
+		// Real-time dashboard stream (authenticated by a ticket from /events/ticket)
+		r.Get("/events/stream", eventHandler.Stream)
+
+		// Prometheus federation of the account's own engines (API key)
+		r.With(appMiddleware.APIKeyAuth(apiKeyService, services.APIKeyScopeMetricsRead)).
+			Get("/federate", telemetryHandler.Federate)
 
 		// Early access form (landing page)
 		r.Post("/early-access", earlyAccessHandler.Submit)
@@ -194,6 +265,11 @@ func main() {
 				r.Post("/payment-methods", billingHandler.AddPaymentMethod)
 				r.Delete("/payment-methods/{id}", billingHandler.RemovePaymentMethod)
 				r.Post("/portal-session", billingHandler.CreatePortalSession)
+				r.Get("/profile", billingHandler.GetBillingProfile)
+				r.Put("/profile", billingHandler.UpdateBillingProfile)
+				r.Get("/usage-statements/settings", usageStatementHandler.GetSettings)
+				r.Put("/usage-statements/settings", usageStatementHandler.UpdateSettings)
+				r.Get("/usage-statements/{period}", usageStatementHandler.Get)
 			})
 
 			// Dashboard / Analytics
@@ -203,6 +279,35 @@ func main() {
 				r.Get("/instances", telemetryHandler.GetInstances)
 			})
 
+			// Dashboard stream tickets
+			r.Post("/events/ticket", eventHandler.CreateTicket)
+
+			// API keys
+			r.Route("/api-keys", func(r chi.Router) {
+				r.Get("/", apiKeyHandler.List)
+				r.Post("/", apiKeyHandler.Create)
+				r.Delete("/{id}", apiKeyHandler.Revoke)
+			})
+
+			// Alerting
+			r.Route("/alerts", func(r chi.Router) {
+				r.Get("/", alertHandler.List)
+				r.Get("/metrics", alertHandler.ListMetrics)
+				r.Get("/rules", alertHandler.ListRules)
+				r.Post("/rules", alertHandler.CreateRule)
+				r.Get("/rules/{id}", alertHandler.GetRule)
+				r.Put("/rules/{id}", alertHandler.UpdateRule)
+				r.Delete("/rules/{id}", alertHandler.DeleteRule)
+				r.Get("/channels", alertHandler.ListChannels)
+				r.Post("/channels", alertHandler.CreateChannel)
+				r.Put("/channels/{id}", alertHandler.UpdateChannel)
+				r.Delete("/channels/{id}", alertHandler.DeleteChannel)
+				r.Post("/channels/{id}/test", alertHandler.TestChannel)
+			})
+
+			// Contracts (read-only for customers)
+			r.Get("/contracts", contractHandler.List)
+
 			// Downloads
 			r.Route("/downloads", func(r chi.Router) {
 				r.Get("/", handlers.ListDownloads)
@@ -221,10 +326,19 @@ func main() {
 				r.Get("/", connectionHandler.List)
 				r.Post("/", connectionHandler.Create)
 				r.Post("/test", connectionHandler.TestDirect)
+				r.Post("/export", connectionBundleHandler.Export)
+				r.Post("/import", connectionBundleHandler.Import)
 				r.Get("/{id}", connectionHandler.Get)
 				r.Put("/{id}", connectionHandler.Update)
 				r.Delete("/{id}", connectionHandler.Delete)
 				r.Post("/{id}/test", connectionHandler.Test)
+				r.Get("/{id}/tests", connectionHandler.ListTests)
+				r.Post("/{id}/clone", connectionHandler.Clone)
+				r.Get("/{id}/preflight", connectionHandler.Preflight)
+				r.Get("/{id}/schemas", connectionHandler.Schemas)
+				r.Get("/{id}/tables", connectionHandler.Tables)
+				r.Put("/{id}/certificates", connectionHandler.SetCertificates)
+				r.Delete("/{id}/certificates", connectionHandler.DeleteCertificates)
 			})
 
 			// Pipelines
@@ -236,8 +350,18 @@ func main() {
 				r.Delete("/{id}", pipelineHandler.Delete)
 				r.Get("/{id}/metrics", pipelineHandler.GetMetrics)
 				r.Get("/{id}/logs", pipelineHandler.GetLogs)
+				r.Get("/{id}/baselines", anomalyHandler.GetBaselines)
 			})
 
+			// Target types pipelines can deliver to
+			r.Get("/targets", pipelineHandler.ListTargets)
+
+			// Anomalies detected against pipeline baselines
+			r.Get("/anomalies", anomalyHandler.List)
+
+			// Engine versions the user's instances run
+			r.Get("/fleet/versions", fleetHandler.GetVersions)
+
 			// Config Generator
 			r.Route("/config", func(r chi.Router) {
 				r.Get("/generate", configHandler.Generate)
@@ -254,8 +378,40 @@ func main() {
 			r.Get("/users", userHandler.ListUsers)
 			r.Get("/users/{id}", userHandler.GetUser)
 			r.Put("/users/{id}", userHandler.UpdateUser)
+			r.Put("/users/{id}/payment-provider", billingHandler.AdminSetPaymentProvider)
+			r.Post("/users/{id}/invoices", billingHandler.AdminCreateInvoice)
+			r.Post("/users/{id}/subscription/end", billingHandler.AdminEndSubscription)
+			r.Post("/invoices/{id}/mark-paid", billingHandler.AdminMarkInvoicePaid)
+			r.Post("/invoices/{id}/void", billingHandler.AdminVoidInvoice)
 			r.Get("/licenses", licenseHandler.ListAll)
+			r.Get("/licenses/stats", licenseHandler.GetStats)
 			r.Post("/licenses/generate", licenseHandler.AdminGenerate)
+
+			r.Route("/analytics", func(r chi.Router) {
+				r.Get("/revenue", licenseHandler.AdminRevenue)
+				r.Get("/trials", licenseHandler.AdminTrialConversion)
+				r.Get("/tiers", licenseHandler.AdminTierDistribution)
+			})
+
+			r.Get("/telemetry/quarantine", telemetryHandler.AdminListQuarantine)
+
+			r.Route("/fleet", func(r chi.Router) {
+				r.Get("/versions", fleetHandler.AdminGetVersions)
+				r.Get("/advisories", fleetHandler.AdminListAdvisories)
+				r.Post("/advisories", fleetHandler.AdminCreateAdvisory)
+				r.Put("/advisories/{id}", fleetHandler.AdminUpdateAdvisory)
+				r.Delete("/advisories/{id}", fleetHandler.AdminDeleteAdvisory)
+			})
+
+			r.Route("/contracts", func(r chi.Router) {
+				r.Get("/", contractHandler.AdminList)
+				r.Post("/", contractHandler.AdminCreate)
+				r.Get("/{id}", contractHandler.AdminGet)
+				r.Put("/{id}", contractHandler.AdminUpdate)
+				r.Post("/{id}/terminate", contractHandler.AdminTerminate)
+				r.Post("/{id}/licenses", contractHandler.AdminAttachLicense)
+				r.Delete("/{id}/licenses/{licenseId}", contractHandler.AdminDetachLicense)
+			})
 		})
 	})
 
@@ -268,6 +424,21 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go contractService.Start(jobsCtx, time.Hour)
+	go usageStatementService.Start(jobsCtx, time.Hour)
+	go telemetryService.Start(jobsCtx, 15*time.Minute)
+	go alertService.Start(jobsCtx, time.Minute)
+	go eventService.Start(jobsCtx, 30*time.Second)
+	go eventService.Listen(jobsCtx)
+	go anomalyService.Start(jobsCtx, 5*time.Minute)
+	go fleetService.Start(jobsCtx, 6*time.Hour)
+	go connectionService.StartReencryption(jobsCtx, time.Hour)
+	go connectionService.StartCertificateExpiryCheck(jobsCtx, 24*time.Hour)
+	go connectionService.StartScheduledTests(jobsCtx, cfg.ConnectionTestInterval)
+
 	// Graceful shutdown
 	go func() {
 		log.Printf("Starting server on port %s", cfg.Port)
@@ -282,6 +453,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds all configuration for the API
@@ -56,14 +60,38 @@ type Config struct {
 
 	// Admin/Notifications
 	AdminEmail    string
+	SalesEmail    string // Receives contract renewal reminders
 	ResendAPIKey  string
 	EmailProvider string // "smtp", "resend", "sendgrid", or empty for noop
 	BaseURL       string // Base URL for email links (e.g., https://app.savegress.io)
 
 	// Encryption
-	EncryptionKey string
+	// Master key stored credentials are encrypted with; exactly 32 bytes
+	EncryptionKey   string
+	EncryptionKeyID string
+	// Previous master keys by ID, still used to decrypt until re-encryption
+	// has rewrapped everything
+	EncryptionRetiredKeys map[string][]byte
+
+	// Telemetry
+	// Unsigned telemetry is rejected after this time; zero keeps accepting it
+	// and is refused in production
+	TelemetrySignaturesRequiredAfter time.Time
+	// Raw telemetry partitions older than this many months are dropped
+	TelemetryRetentionMonths int
+
+	// Connections
+	// Connections are re-tested when their last test is older than this; zero disables it
+	ConnectionTestInterval time.Duration
+
+	// Metrics
+	// Bearer token required to scrape /metrics; the endpoint is disabled when empty
+	MetricsToken string
 }
 
+// devEncryptionKey encrypts credentials in development only
+const devEncryptionKey = "savegress-dev-encryption-key-32b"
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{
@@ -96,10 +124,63 @@ func Load() (*Config, error) {
 		S3UsePathStyle:     getEnv("S3_USE_PATH_STYLE", "") == "true",
 		TurnstileSecretKey: getEnv("TURNSTILE_SECRET_KEY", "1x0000000000000000000000000000000AA"), // Test key
 		AdminEmail:         getEnv("ADMIN_EMAIL", ""),
+		SalesEmail:         getEnv("SALES_EMAIL", ""),
 		ResendAPIKey:       getEnv("RESEND_API_KEY", ""),
 		EmailProvider:      getEnv("EMAIL_PROVIDER", ""), // smtp, resend, sendgrid
 		BaseURL:            getEnv("BASE_URL", "http://localhost:3000"),
-		EncryptionKey:      getEnv("ENCRYPTION_KEY", "savegress-dev-encryption-key32"), // Must be 32 bytes for AES-256
+		EncryptionKey:      getEnv("ENCRYPTION_KEY", devEncryptionKey), // Must be 32 bytes for AES-256
+		EncryptionKeyID:    getEnv("ENCRYPTION_KEY_ID", "primary"),
+		MetricsToken:       getEnv("METRICS_TOKEN", ""),
+	}
+
+	if v := getEnv("TELEMETRY_SIGNATURES_REQUIRED_AFTER", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("TELEMETRY_SIGNATURES_REQUIRED_AFTER must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+		}
+		cfg.TelemetrySignaturesRequiredAfter = t
+	}
+
+	cfg.TelemetryRetentionMonths = 13
+	if v := getEnv("TELEMETRY_RETENTION_MONTHS", ""); v != "" {
+		months, err := strconv.Atoi(v)
+		if err != nil || months < 1 {
+			return nil, fmt.Errorf("TELEMETRY_RETENTION_MONTHS must be a positive number of months")
+		}
+		cfg.TelemetryRetentionMonths = months
+	}
+
+	cfg.ConnectionTestInterval = time.Hour
+	if v := getEnv("CONNECTION_TEST_INTERVAL", ""); v != "" {
+		interval, err := time.ParseDuration(v)
+		if v == "0" {
+			interval, err = 0, nil
+		}
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("CONNECTION_TEST_INTERVAL must be a duration such as 30m, or 0 to disable")
+		}
+		cfg.ConnectionTestInterval = interval
+	}
+
+	if len(cfg.EncryptionKey) != 32 {
+		return nil, fmt.Errorf("ENCRYPTION_KEY must be exactly 32 bytes, got %d (list a previous key in ENCRYPTION_RETIRED_KEYS to keep decrypting with it)", len(cfg.EncryptionKey))
+	}
+	cfg.EncryptionRetiredKeys = make(map[string][]byte)
+	if v := getEnv("ENCRYPTION_RETIRED_KEYS", ""); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			id, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok || id == "" || key == "" {
+				return nil, fmt.Errorf("ENCRYPTION_RETIRED_KEYS must be a comma separated list of id:key pairs")
+			}
+			decoded, err := parseRetiredEncryptionKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("retired encryption key %q: %w", id, err)
+			}
+			cfg.EncryptionRetiredKeys[id] = decoded
+		}
 	}
 
 	// Validate required fields in production
@@ -107,17 +188,49 @@ func Load() (*Config, error) {
 		if cfg.JWTSecret == "dev-secret-change-in-production" {
 			return nil, fmt.Errorf("JWT_SECRET must be set in production")
 		}
+		if cfg.EncryptionKey == devEncryptionKey {
+			return nil, fmt.Errorf("ENCRYPTION_KEY must be set in production")
+		}
 		if cfg.LicensePrivateKey == "" {
 			return nil, fmt.Errorf("LICENSE_PRIVATE_KEY must be set in production")
 		}
 		if cfg.StripeSecretKey == "" {
 			return nil, fmt.Errorf("STRIPE_SECRET_KEY must be set in production")
 		}
+		// Without a cutoff unsigned telemetry would be accepted forever
+		if cfg.TelemetrySignaturesRequiredAfter.IsZero() {
+			return nil, fmt.Errorf("TELEMETRY_SIGNATURES_REQUIRED_AFTER must be set in production")
+		}
 	}
 
 	return cfg, nil
 }
 
+// parseRetiredEncryptionKey decodes a retired master key given as base64:<key>
+// or hex:<key>. Other keys are raw bytes, zero-padded or truncated to 32 bytes
+// the way keys were used before keys had to be exactly 32 bytes.
+func parseRetiredEncryptionKey(key string) ([]byte, error) {
+	var decoded []byte
+	var err error
+	switch {
+	case strings.HasPrefix(key, "base64:"):
+		decoded, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(key, "base64:"))
+	case strings.HasPrefix(key, "hex:"):
+		decoded, err = hex.DecodeString(strings.TrimPrefix(key, "hex:"))
+	default:
+		decoded = make([]byte, 32)
+		copy(decoded, key)
+		return decoded, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoding: %w", err)
+	}
+	if len(decoded) != 32 {
+		return nil, fmt.Errorf("must decode to exactly 32 bytes, got %d", len(decoded))
+	}
+	return decoded, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// baselineEncrypt seals a password the way credentials were stored before
+// envelope encryption: with the ENCRYPTION_KEY string zero-padded or truncated
+// to 32 bytes
+func baselineEncrypt(t *testing.T, encryptionKey, password string) string {
+	key := make([]byte, 32)
+	copy(key, encryptionKey)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(password), nil))
+}
+
+func TestLoadProductionDecryptsBaselineCredentials(t *testing.T) {
+	// A 44 character key, e.g. from openssl rand -base64 32, was truncated
+	oldKey := "3q2+7wAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("JWT_SECRET", "production-jwt-secret")
+	t.Setenv("LICENSE_PRIVATE_KEY", "license-key")
+	t.Setenv("STRIPE_SECRET_KEY", "sk_live_test")
+	t.Setenv("TELEMETRY_SIGNATURES_REQUIRED_AFTER", "2026-01-01")
+	t.Setenv("ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("ENCRYPTION_KEY_ID", "k2")
+	t.Setenv("ENCRYPTION_RETIRED_KEYS", "k1:"+oldKey+", k0:hex:"+
+		"6161616161616161616161616161616161616161616161616161616161616161")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	require.Len(t, cfg.EncryptionRetiredKeys, 2)
+	assert.Equal(t, []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), cfg.EncryptionRetiredKeys["k0"])
+
+	// Deployments that never set ENCRYPTION_KEY used the zero-padded default;
+	// main registers it while such credentials remain
+	retired := map[string][]byte{services.LegacyDefaultKeyID: services.LegacyDefaultKey()}
+	for id, key := range cfg.EncryptionRetiredKeys {
+		retired[id] = key
+	}
+	keyring, err := services.NewKeyring(cfg.EncryptionKeyID, []byte(cfg.EncryptionKey), retired)
+	require.NoError(t, err)
+
+	for key, password := range map[string]string{
+		"savegress-dev-encryption-key32":   "default-pass",
+		oldKey:                             "custom-pass",
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa": "hex-pass",
+	} {
+		plaintext, err := keyring.Decrypt(baselineEncrypt(t, key, password))
+		require.NoError(t, err, password)
+		assert.Equal(t, password, plaintext)
+	}
+}
+
+func TestLoadProductionRequiresTelemetrySignatureCutoff(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("JWT_SECRET", "production-jwt-secret")
+	t.Setenv("LICENSE_PRIVATE_KEY", "license-key")
+	t.Setenv("STRIPE_SECRET_KEY", "sk_live_test")
+	t.Setenv("ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("TELEMETRY_SIGNATURES_REQUIRED_AFTER", "")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TELEMETRY_SIGNATURES_REQUIRED_AFTER")
+
+	t.Setenv("TELEMETRY_SIGNATURES_REQUIRED_AFTER", "2026-01-01")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 2026, cfg.TelemetrySignaturesRequiredAfter.Year())
+}
+
+func TestParseRetiredEncryptionKey(t *testing.T) {
+	key, err := parseRetiredEncryptionKey("base64:" + base64.StdEncoding.EncodeToString([]byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"), key)
+
+	key, err = parseRetiredEncryptionKey("short")
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte("short"), make([]byte, 27)...), key)
+
+	for _, bad := range []string{"base64:!!", "base64:c2hvcnQ=", "hex:zz", "hex:6161"} {
+		_, err := parseRetiredEncryptionKey(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// AlertHandler handles alert rule, channel and alert endpoints
+type AlertHandler struct {
+	alertService *services.AlertService
+}
+
+// NewAlertHandler creates a new alert handler
+func NewAlertHandler(alertService *services.AlertService) *AlertHandler {
+	return &AlertHandler{alertService: alertService}
+}
+
+// alertChannelRequest is the body of channel create and update requests; nil fields are kept
+type alertChannelRequest struct {
+	Name    *string `json:"name"`
+	Type    *string `json:"type"`
+	Target  *string `json:"target"`
+	Secret  *string `json:"secret"`
+	Enabled *bool   `json:"enabled"`
+}
+
+func (req *alertChannelRequest) apply(c *models.AlertChannel) {
+	if req.Name != nil {
+		c.Name = *req.Name
+	}
+	if req.Type != nil {
+		c.Type = *req.Type
+	}
+	if req.Target != nil {
+		c.Target = *req.Target
+	}
+	if req.Secret != nil {
+		c.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		c.Enabled = *req.Enabled
+	}
+}
+
+// List returns the user's alerts, newest first, optionally filtered by ?status=
+func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != services.AlertPending && status != services.AlertFiring && status != services.AlertResolved {
+		respondError(w, http.StatusBadRequest, "status must be pending, firing or resolved")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	alerts, err := h.alertService.ListAlerts(r.Context(), userID, status, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list alerts")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{"alerts": alerts})
+}
+
+// ListMetrics returns the metrics alert rules can watch
+func (h *AlertHandler) ListMetrics(w http.ResponseWriter, r *http.Request) {
+	respondSuccess(w, map[string]interface{}{"metrics": services.AlertMetrics()})
+}
+
+// ListRules returns the user's alert rules
+func (h *AlertHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	rules, err := h.alertService.ListRules(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list alert rules")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{"rules": rules})
+}
+
+// CreateRule creates an alert rule
+func (h *AlertHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	rule := models.AlertRule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	rule.ID = uuid.Nil
+	rule.UserID = userID
+
+	created, err := h.alertService.CreateRule(r.Context(), &rule)
+	if err != nil {
+		h.respondRuleError(w, err, "failed to create alert rule")
+		return
+	}
+
+	respondCreated(w, created)
+}
+
+// GetRule returns an alert rule
+func (h *AlertHandler) GetRule(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	ruleID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid alert rule ID")
+		return
+	}
+
+	rule, err := h.alertService.GetRule(r.Context(), userID, ruleID)
+	if err != nil {
+		h.respondRuleError(w, err, "failed to get alert rule")
+		return
+	}
+
+	respondSuccess(w, rule)
+}
+
+// UpdateRule updates an alert rule; fields missing from the body are kept
+func (h *AlertHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	ruleID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid alert rule ID")
+		return
+	}
+
+	rule, err := h.alertService.GetRule(r.Context(), userID, ruleID)
+	if err != nil {
+		h.respondRuleError(w, err, "failed to get alert rule")
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	rule.ID = ruleID
+	rule.UserID = userID
+
+	updated, err := h.alertService.UpdateRule(r.Context(), rule)
+	if err != nil {
+		h.respondRuleError(w, err, "failed to update alert rule")
+		return
+	}
+
+	respondSuccess(w, updated)
+}
+
+// DeleteRule deletes an alert rule
+func (h *AlertHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	ruleID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid alert rule ID")
+		return
+	}
+
+	if err := h.alertService.DeleteRule(r.Context(), userID, ruleID); err != nil {
+		h.respondRuleError(w, err, "failed to delete alert rule")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "alert rule deleted"})
+}
+
+func (h *AlertHandler) respondRuleError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrAlertRuleNotFound):
+		respondError(w, http.StatusNotFound, "alert rule not found")
+	case errors.Is(err, services.ErrInvalidAlertRule):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrAlertChannelNotFound):
+		respondError(w, http.StatusBadRequest, "unknown alert channel in channel_ids")
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// ListChannels returns the user's alert channels
+func (h *AlertHandler) ListChannels(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	channels, err := h.alertService.ListChannels(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list alert channels")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{"channels": channels})
+}
+
+// CreateChannel creates an alert channel
+func (h *AlertHandler) CreateChannel(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var req alertChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	channel := models.AlertChannel{UserID: userID, Enabled: true}
+	req.apply(&channel)
+
+	created, err := h.alertService.CreateChannel(r.Context(), &channel)
+	if err != nil {
+		h.respondChannelError(w, err, "failed to create alert channel")
+		return
+	}
+
+	respondCreated(w, created)
+}
+
+// UpdateChannel updates an alert channel; fields missing from the body are kept
+func (h *AlertHandler) UpdateChannel(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	channelID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid alert channel ID")
+		return
+	}
+
+	var req alertChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	channel, err := h.alertService.GetChannel(r.Context(), userID, channelID)
+	if err != nil {
+		h.respondChannelError(w, err, "failed to get alert channel")
+		return
+	}
+	req.apply(channel)
+
+	updated, err := h.alertService.UpdateChannel(r.Context(), channel)
+	if err != nil {
+		h.respondChannelError(w, err, "failed to update alert channel")
+		return
+	}
+
+	respondSuccess(w, updated)
+}
+
+// DeleteChannel deletes an alert channel
+func (h *AlertHandler) DeleteChannel(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	channelID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid alert channel ID")
+		return
+	}
+
+	if err := h.alertService.DeleteChannel(r.Context(), userID, channelID); err != nil {
+		h.respondChannelError(w, err, "failed to delete alert channel")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "alert channel deleted"})
+}
+
+// TestChannel sends a test notification through an alert channel
+func (h *AlertHandler) TestChannel(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	channelID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid alert channel ID")
+		return
+	}
+
+	err = h.alertService.TestChannel(r.Context(), userID, channelID)
+	if errors.Is(err, services.ErrAlertChannelNotFound) {
+		respondError(w, http.StatusNotFound, "alert channel not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadGateway, "test notification failed: "+err.Error())
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "test notification sent"})
+}
+
+func (h *AlertHandler) respondChannelError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrAlertChannelNotFound):
+		respondError(w, http.StatusNotFound, "alert channel not found")
+	case errors.Is(err, services.ErrInvalidAlertChannel):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// AnomalyHandler handles pipeline anomaly endpoints
+type AnomalyHandler struct {
+	anomalyService *services.AnomalyService
+}
+
+// NewAnomalyHandler creates a new anomaly handler
+func NewAnomalyHandler(anomalyService *services.AnomalyService) *AnomalyHandler {
+	return &AnomalyHandler{anomalyService: anomalyService}
+}
+
+// List returns the user's pipeline anomalies, optionally filtered by ?pipeline_id= and ?status=
+func (h *AnomalyHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var pipelineID *uuid.UUID
+	if v := r.URL.Query().Get("pipeline_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid pipeline ID")
+			return
+		}
+		pipelineID = &id
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != services.AnomalyOpen && status != services.AnomalyResolved {
+		respondError(w, http.StatusBadRequest, "status must be open or resolved")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	anomalies, err := h.anomalyService.ListAnomalies(r.Context(), userID, pipelineID, status, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list anomalies")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{"anomalies": anomalies})
+}
+
+// GetBaselines returns the learned hour-of-week baselines of a pipeline
+func (h *AnomalyHandler) GetBaselines(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	pipelineID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid pipeline ID")
+		return
+	}
+
+	baselines, err := h.anomalyService.GetBaselines(r.Context(), userID, pipelineID)
+	if err == services.ErrPipelineNotFound {
+		respondError(w, http.StatusNotFound, "pipeline not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to get baselines")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{"baselines": baselines})
+}
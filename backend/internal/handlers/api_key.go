@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// APIKeyHandler handles account API key endpoints
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// CreateAPIKeyRequest is the body of an API key creation request
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKeyResponse carries the new key; the plaintext key is only returned here
+type CreateAPIKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// List returns the user's API keys
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	keys, err := h.apiKeyService.ListKeys(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list API keys")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{"api_keys": keys})
+}
+
+// Create creates an API key
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, raw, err := h.apiKeyService.CreateKey(r.Context(), userID, req.Name, req.Scopes, req.ExpiresAt)
+	if errors.Is(err, services.ErrInvalidAPIKeyInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to create API key")
+		return
+	}
+
+	respondCreated(w, CreateAPIKeyResponse{APIKey: key, Key: raw})
+}
+
+// Revoke revokes an API key
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	keyID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid API key ID")
+		return
+	}
+
+	err = h.apiKeyService.RevokeKey(r.Context(), userID, keyID)
+	if err == services.ErrAPIKeyNotFound {
+		respondError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to revoke API key")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "API key revoked"})
+}
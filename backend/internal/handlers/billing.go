@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -10,9 +11,10 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/stripe/stripe-go/v76"
 
+	"github.com/savegress/platform/backend/internal/metrics"
 	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/models"
 	"github.com/savegress/platform/backend/internal/services"
 )
 
@@ -103,6 +105,10 @@ func (h *BillingHandler) CreateSubscription(w http.ResponseWriter, r *http.Reque
 	}
 
 	checkoutURL, err := h.billingService.CreateCheckoutSession(r.Context(), user, req.Plan, req.SuccessURL, req.CancelURL)
+	if err == services.ErrNotSupportedByProvider {
+		respondError(w, http.StatusBadRequest, "this account is billed by invoice - contact sales to change plans")
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to create checkout session")
 		return
@@ -225,7 +231,7 @@ func (h *BillingHandler) ListPaymentMethods(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	methods, err := h.billingService.ListPaymentMethods(r.Context(), user.StripeCustomerID)
+	methods, err := h.billingService.ListPaymentMethods(r.Context(), user)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to get payment methods")
 		return
@@ -255,7 +261,11 @@ func (h *BillingHandler) AddPaymentMethod(w http.ResponseWriter, r *http.Request
 	}
 
 	// Create a SetupIntent for the frontend to use with Stripe.js
-	clientSecret, err := h.billingService.CreateSetupIntent(r.Context(), user.StripeCustomerID)
+	clientSecret, err := h.billingService.CreateSetupIntent(r.Context(), user)
+	if err == services.ErrNotSupportedByProvider {
+		respondError(w, http.StatusBadRequest, "payment methods are not used for invoiced accounts")
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to create setup intent")
 		return
@@ -302,14 +312,14 @@ func (h *BillingHandler) AttachPaymentMethod(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Attach payment method to customer
-	if err := h.billingService.AttachPaymentMethod(r.Context(), user.StripeCustomerID, req.PaymentMethodID); err != nil {
+	if err := h.billingService.AttachPaymentMethod(r.Context(), user, req.PaymentMethodID); err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to attach payment method")
 		return
 	}
 
 	// Set as default if requested
 	if req.SetAsDefault {
-		if err := h.billingService.SetDefaultPaymentMethod(r.Context(), user.StripeCustomerID, req.PaymentMethodID); err != nil {
+		if err := h.billingService.SetDefaultPaymentMethod(r.Context(), user, req.PaymentMethodID); err != nil {
 			log.Printf("Failed to set default payment method: %v", err)
 		}
 	}
@@ -325,14 +335,26 @@ func (h *BillingHandler) RemovePaymentMethod(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
 	paymentMethodID := chi.URLParam(r, "id")
 	if paymentMethodID == "" {
 		respondError(w, http.StatusBadRequest, "payment method ID is required")
 		return
 	}
 
+	user, err := h.userService.GetByID(r.Context(), userID)
+	if err != nil || user.StripeCustomerID == "" {
+		respondError(w, http.StatusBadRequest, "no billing account found")
+		return
+	}
+
 	// Detach the payment method
-	if err := h.billingService.DetachPaymentMethod(r.Context(), paymentMethodID); err != nil {
+	if err := h.billingService.DetachPaymentMethod(r.Context(), user, paymentMethodID); err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to remove payment method")
 		return
 	}
@@ -368,7 +390,7 @@ func (h *BillingHandler) SetDefaultPaymentMethod(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if err := h.billingService.SetDefaultPaymentMethod(r.Context(), user.StripeCustomerID, req.PaymentMethodID); err != nil {
+	if err := h.billingService.SetDefaultPaymentMethod(r.Context(), user, req.PaymentMethodID); err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to set default payment method")
 		return
 	}
@@ -404,7 +426,11 @@ func (h *BillingHandler) CreatePortalSession(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	portalURL, err := h.billingService.CreatePortalSession(r.Context(), user.StripeCustomerID, req.ReturnURL)
+	portalURL, err := h.billingService.CreatePortalSession(r.Context(), user, req.ReturnURL)
+	if err == services.ErrNotSupportedByProvider {
+		respondError(w, http.StatusBadRequest, "billing portal is not available for invoiced accounts")
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to create portal session")
 		return
@@ -413,93 +439,166 @@ func (h *BillingHandler) CreatePortalSession(w http.ResponseWriter, r *http.Requ
 	respondSuccess(w, map[string]string{"portal_url": portalURL})
 }
 
-// HandleWebhook processes Stripe webhooks
-func (h *BillingHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
-	payload, err := io.ReadAll(r.Body)
+// GetBillingProfile returns the user's billing profile
+func (h *BillingHandler) GetBillingProfile(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "failed to read body")
+		respondError(w, http.StatusUnauthorized, "invalid user id")
 		return
 	}
 
-	signature := r.Header.Get("Stripe-Signature")
-	event, err := h.billingService.HandleWebhook(payload, signature)
+	profile, err := h.billingService.GetBillingProfile(r.Context(), userID)
+	if err == services.ErrBillingProfileNotFound {
+		respondSuccess(w, map[string]interface{}{"profile": nil})
+		return
+	}
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "invalid webhook signature")
+		respondError(w, http.StatusInternalServerError, "failed to get billing profile")
 		return
 	}
 
-	ctx := r.Context()
+	respondSuccess(w, map[string]interface{}{"profile": profile})
+}
 
-	// Handle different event types
-	switch event.Type {
-	case "checkout.session.completed":
-		h.handleCheckoutCompleted(ctx, event)
-	case "customer.subscription.updated":
-		h.handleSubscriptionUpdated(ctx, event)
-	case "customer.subscription.deleted":
-		h.handleSubscriptionDeleted(ctx, event)
-	case "invoice.paid":
-		h.handleInvoicePaid(ctx, event)
-	case "invoice.payment_failed":
-		h.handlePaymentFailed(ctx, event)
+// UpdateBillingProfile creates or replaces the user's billing profile and
+// syncs it to their Stripe customer
+func (h *BillingHandler) UpdateBillingProfile(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
 	}
 
-	respondSuccess(w, map[string]string{"received": "true"})
-}
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
 
-func (h *BillingHandler) handleCheckoutCompleted(ctx context.Context, event *stripe.Event) {
-	// Parse the checkout session from the event
-	var session stripe.CheckoutSession
-	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-		log.Printf("Error parsing checkout session: %v", err)
+	var req models.BillingProfile
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	req.UserID = userID
 
-	// Extract user ID from metadata
-	userIDStr, ok := session.Metadata["user_id"]
-	if !ok {
-		log.Printf("No user_id in checkout session metadata")
+	profile, err := h.billingService.SaveBillingProfile(r.Context(), &req)
+	if errors.Is(err, services.ErrInvalidBillingProfile) || errors.Is(err, services.ErrInvalidTaxID) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to save billing profile")
 		return
 	}
 
-	userID, err := uuid.Parse(userIDStr)
+	user, err := h.userService.GetByID(r.Context(), userID)
 	if err != nil {
-		log.Printf("Invalid user_id in metadata: %v", err)
+		respondError(w, http.StatusInternalServerError, "user not found")
 		return
 	}
 
-	plan, _ := session.Metadata["plan"]
-	if plan == "" {
-		plan = "pro" // Default
+	// Customers without a Stripe account pick the profile up when they are created
+	if user.StripeCustomerID != "" {
+		if err := h.billingService.SyncBillingProfile(r.Context(), user, profile); err != nil {
+			log.Printf("Error syncing billing profile for user %s: %v", userID, err)
+			respondError(w, http.StatusBadGateway, "billing profile saved but failed to sync with payment provider")
+			return
+		}
 	}
 
-	// Get subscription details from Stripe
-	if session.Subscription == nil {
-		log.Printf("No subscription in checkout session")
+	respondSuccess(w, map[string]interface{}{"profile": profile})
+}
+
+// HandleWebhook processes Stripe webhooks
+func (h *BillingHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "failed to read body")
 		return
 	}
 
-	subID := session.Subscription.ID
+	signature := r.Header.Get("Stripe-Signature")
+	event, err := h.billingService.HandleWebhook(payload, signature)
+	if err == services.ErrInvalidWebhook {
+		metrics.WebhookEvents.WithLabelValues("stripe", metrics.WebhookInvalidSignature).Inc()
+		respondError(w, http.StatusBadRequest, "invalid webhook signature")
+		return
+	}
+	if err != nil {
+		// Malformed events are acknowledged so Stripe does not retry them forever
+		log.Printf("Error parsing webhook: %v", err)
+		metrics.WebhookEvents.WithLabelValues("stripe", metrics.WebhookMalformed).Inc()
+		respondSuccess(w, map[string]string{"received": "true"})
+		return
+	}
 
-	// Create or update subscription in database
-	var priceID string
-	if len(session.LineItems.Data) > 0 && session.LineItems.Data[0].Price != nil {
-		priceID = session.LineItems.Data[0].Price.ID
+	if event != nil {
+		if err := h.applyBillingEvent(r.Context(), event); err != nil {
+			log.Printf("Error applying webhook event %s: %v", event.Type, err)
+			metrics.WebhookEvents.WithLabelValues("stripe", metrics.WebhookFailed).Inc()
+		} else {
+			metrics.WebhookEvents.WithLabelValues("stripe", metrics.WebhookProcessed).Inc()
+		}
+	} else {
+		metrics.WebhookEvents.WithLabelValues("stripe", metrics.WebhookIgnored).Inc()
 	}
 
-	err = h.billingService.CreateOrUpdateSubscription(
+	respondSuccess(w, map[string]string{"received": "true"})
+}
+
+// applyBillingEvent updates subscriptions, invoices and licenses for a billing
+// event. Every payment provider goes through here so licensing reacts the same
+// way whether Stripe or an admin reported the payment.
+func (h *BillingHandler) applyBillingEvent(ctx context.Context, event *services.BillingEvent) error {
+	switch event.Type {
+	case services.EventSubscriptionStarted:
+		return h.handleSubscriptionStarted(ctx, event)
+	case services.EventSubscriptionUpdated:
+		return h.handleSubscriptionUpdated(ctx, event)
+	case services.EventSubscriptionCanceled:
+		return h.handleSubscriptionCanceled(ctx, event)
+	case services.EventInvoicePaid:
+		h.handleInvoicePaid(ctx, event)
+	case services.EventInvoicePaymentFailed:
+		h.handlePaymentFailed(ctx, event)
+	}
+	return nil
+}
+
+// eventUser resolves the user a billing event belongs to
+func (h *BillingHandler) eventUser(ctx context.Context, event *services.BillingEvent) (*models.User, error) {
+	if event.UserID != uuid.Nil {
+		return h.userService.GetByID(ctx, event.UserID)
+	}
+	return h.billingService.GetUserByStripeCustomerID(ctx, event.CustomerID)
+}
+
+func (h *BillingHandler) handleSubscriptionStarted(ctx context.Context, event *services.BillingEvent) error {
+	userID := event.UserID
+	plan := event.Plan
+
+	// Create or update subscription in database
+	err := h.billingService.CreateOrUpdateSubscription(
 		ctx,
 		userID,
-		subID,
-		priceID,
+		event.Provider,
+		event.SubscriptionID,
+		event.PriceID,
 		plan,
-		"active",
-		session.Subscription.CurrentPeriodStart,
-		session.Subscription.CurrentPeriodEnd,
+		event.Status,
+		event.PeriodStart,
+		event.PeriodEnd,
 	)
 	if err != nil {
 		log.Printf("Error creating subscription: %v", err)
-		return
+		return err
 	}
 
 	// Upgrade existing license or create new one
@@ -519,9 +618,10 @@ func (h *BillingHandler) handleCheckoutCompleted(ctx context.Context, event *str
 	newLicense, err := h.licenseService.CreateLicense(ctx, userID, plan, 365, "")
 	if err != nil {
 		log.Printf("Error creating license: %v", err)
+		return err
 	}
 
-	log.Printf("Checkout completed for user %s, plan: %s", userID, plan)
+	log.Printf("Subscription started for user %s via %s, plan: %s", userID, event.Provider, plan)
 
 	// Send purchase confirmation email
 	if h.emailService != nil && newLicense != nil {
@@ -535,12 +635,6 @@ func (h *BillingHandler) handleCheckoutCompleted(ctx context.Context, event *str
 				amount = "$499.00"
 			}
 
-			// Get invoice URL if available
-			var invoiceURL string
-			if session.Invoice != nil {
-				invoiceURL = session.Invoice.HostedInvoiceURL
-			}
-
 			purchaseInfo := services.LicensePurchaseInfo{
 				UserName:        user.Name,
 				Email:           user.Email,
@@ -548,8 +642,8 @@ func (h *BillingHandler) handleCheckoutCompleted(ctx context.Context, event *str
 				LicenseKey:      newLicense.LicenseKey,
 				Amount:          amount,
 				BillingPeriod:   "month",
-				NextBillingDate: time.Unix(session.Subscription.CurrentPeriodEnd, 0),
-				InvoiceURL:      invoiceURL,
+				NextBillingDate: time.Unix(event.PeriodEnd, 0),
+				InvoiceURL:      event.InvoiceURL,
 			}
 
 			if err := h.emailService.SendLicensePurchaseEmail(ctx, purchaseInfo); err != nil {
@@ -559,147 +653,256 @@ func (h *BillingHandler) handleCheckoutCompleted(ctx context.Context, event *str
 			}
 		}
 	}
+	return nil
 }
 
-func (h *BillingHandler) handleSubscriptionUpdated(ctx context.Context, event *stripe.Event) {
-	var sub stripe.Subscription
-	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-		log.Printf("Error parsing subscription: %v", err)
-		return
-	}
-
+func (h *BillingHandler) handleSubscriptionUpdated(ctx context.Context, event *services.BillingEvent) error {
 	// Update subscription status in database
 	err := h.billingService.UpdateSubscriptionStatus(
 		ctx,
-		sub.ID,
-		string(sub.Status),
-		sub.CancelAtPeriodEnd,
+		event.SubscriptionID,
+		event.Status,
+		event.CancelAtPeriodEnd,
+		event.PeriodStart,
+		event.PeriodEnd,
 	)
 	if err != nil {
 		log.Printf("Error updating subscription status: %v", err)
+		return err
 	}
 
-	log.Printf("Subscription %s updated: status=%s, cancel_at_period_end=%v", sub.ID, sub.Status, sub.CancelAtPeriodEnd)
+	log.Printf("Subscription %s updated: status=%s, cancel_at_period_end=%v", event.SubscriptionID, event.Status, event.CancelAtPeriodEnd)
+	return nil
 }
 
-func (h *BillingHandler) handleSubscriptionDeleted(ctx context.Context, event *stripe.Event) {
-	var sub stripe.Subscription
-	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-		log.Printf("Error parsing subscription: %v", err)
-		return
-	}
-
+func (h *BillingHandler) handleSubscriptionCanceled(ctx context.Context, event *services.BillingEvent) error {
 	// Mark subscription as canceled
-	err := h.billingService.DeleteSubscription(ctx, sub.ID)
+	err := h.billingService.DeleteSubscription(ctx, event.SubscriptionID)
 	if err != nil {
 		log.Printf("Error deleting subscription: %v", err)
+		return err
 	}
 
 	// Find user and downgrade to community
-	if sub.Customer != nil {
-		user, err := h.billingService.GetUserByStripeCustomerID(ctx, sub.Customer.ID)
-		if err == nil {
-			// Revoke paid license and create community license
-			existingLicenses, err := h.licenseService.GetUserLicenses(ctx, user.ID)
-			if err == nil {
-				for _, lic := range existingLicenses {
-					if lic.Status == "active" && (lic.Tier == "pro" || lic.Tier == "enterprise") {
-						_ = h.licenseService.RevokeLicense(ctx, lic.ID)
-						log.Printf("Revoked %s license %s for user %s (subscription canceled)", lic.Tier, lic.ID, user.ID)
-					}
-				}
-			}
-
-			// Create new community license
-			_, err = h.licenseService.CreateLicense(ctx, user.ID, "community", 365, "")
-			if err != nil {
-				log.Printf("Error creating community license after cancellation: %v", err)
-			} else {
-				log.Printf("Created community license for user %s after subscription cancellation", user.ID)
-			}
+	user, err := h.eventUser(ctx, event)
+	if err != nil {
+		log.Printf("User not found for canceled subscription %s: %v", event.SubscriptionID, err)
+		return err
+	}
 
-			// Send notification
-			if h.emailService != nil {
-				periodEnd := time.Unix(sub.CurrentPeriodEnd, 0)
-				_ = h.emailService.SendSubscriptionCanceledEmail(ctx, user.Email, user.Name, periodEnd)
+	// Revoke paid license and create community license
+	existingLicenses, err := h.licenseService.GetUserLicenses(ctx, user.ID)
+	if err == nil {
+		for _, lic := range existingLicenses {
+			if lic.Status == "active" && (lic.Tier == "pro" || lic.Tier == "enterprise") {
+				_ = h.licenseService.RevokeLicense(ctx, lic.ID)
+				log.Printf("Revoked %s license %s for user %s (subscription canceled)", lic.Tier, lic.ID, user.ID)
 			}
 		}
 	}
 
-	log.Printf("Subscription %s deleted", sub.ID)
+	// Create new community license
+	_, err = h.licenseService.CreateLicense(ctx, user.ID, "community", 365, "")
+	if err != nil {
+		log.Printf("Error creating community license after cancellation: %v", err)
+		return err
+	}
+	log.Printf("Created community license for user %s after subscription cancellation", user.ID)
+
+	// Send notification
+	if h.emailService != nil {
+		periodEnd := time.Unix(event.PeriodEnd, 0)
+		_ = h.emailService.SendSubscriptionCanceledEmail(ctx, user.Email, user.Name, periodEnd)
+	}
+
+	log.Printf("Subscription %s canceled", event.SubscriptionID)
+	return nil
 }
 
-func (h *BillingHandler) handleInvoicePaid(ctx context.Context, event *stripe.Event) {
-	var invoice stripe.Invoice
-	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
-		log.Printf("Error parsing invoice: %v", err)
+func (h *BillingHandler) handleInvoicePaid(ctx context.Context, event *services.BillingEvent) {
+	user, err := h.eventUser(ctx, event)
+	if err != nil {
+		log.Printf("User not found for customer %s: %v", event.CustomerID, err)
 		return
 	}
 
-	// Find user by customer ID
-	if invoice.Customer == nil {
-		log.Printf("No customer in invoice")
+	// Record invoice with tax and line item breakdown
+	err = h.billingService.RecordInvoice(ctx, user.ID, *event.Invoice)
+	if err != nil {
+		log.Printf("Error recording invoice: %v", err)
+	}
+
+	log.Printf("Invoice %s paid for user %s", event.Invoice.StripeInvoiceID, user.ID)
+}
+
+func (h *BillingHandler) handlePaymentFailed(ctx context.Context, event *services.BillingEvent) {
+	// Find user and send notification
+	user, err := h.eventUser(ctx, event)
+	if err != nil {
+		log.Printf("User not found for customer %s: %v", event.CustomerID, err)
 		return
 	}
 
-	user, err := h.billingService.GetUserByStripeCustomerID(ctx, invoice.Customer.ID)
+	// Send payment failed email
+	if h.emailService != nil {
+		if err := h.emailService.SendPaymentFailedEmail(ctx, user.Email, user.Name); err != nil {
+			log.Printf("Error sending payment failed email: %v", err)
+		}
+	}
+
+	log.Printf("Payment failed for user %s", user.ID)
+}
+
+// ============================================
+// MANUAL INVOICING (ADMIN)
+// ============================================
+
+// AdminSetPaymentProvider switches the payment provider a user is billed through (admin only)
+func (h *BillingHandler) AdminSetPaymentProvider(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		log.Printf("User not found for customer %s: %v", invoice.Customer.ID, err)
+		respondError(w, http.StatusBadRequest, "invalid user ID")
 		return
 	}
 
-	// Record invoice
-	var invoiceURL, invoicePDF string
-	if invoice.HostedInvoiceURL != "" {
-		invoiceURL = invoice.HostedInvoiceURL
+	var req struct {
+		Provider string `json:"provider"` // stripe, manual
 	}
-	if invoice.InvoicePDF != "" {
-		invoicePDF = invoice.InvoicePDF
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
 	}
 
-	err = h.billingService.RecordInvoice(
-		ctx,
-		user.ID,
-		invoice.ID,
-		invoice.AmountPaid,
-		string(invoice.Currency),
-		string(invoice.Status),
-		invoiceURL,
-		invoicePDF,
-		invoice.PeriodStart,
-		invoice.PeriodEnd,
-	)
+	err = h.billingService.SetUserProvider(r.Context(), userID, req.Provider)
+	if errors.Is(err, services.ErrUnknownProvider) {
+		respondError(w, http.StatusBadRequest, "unknown payment provider")
+		return
+	}
+	if err == services.ErrProviderSubscription {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
-		log.Printf("Error recording invoice: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to update payment provider")
+		return
 	}
 
-	log.Printf("Invoice %s paid for user %s", invoice.ID, user.ID)
+	respondSuccess(w, map[string]string{"message": "payment provider updated"})
 }
 
-func (h *BillingHandler) handlePaymentFailed(ctx context.Context, event *stripe.Event) {
-	var invoice stripe.Invoice
-	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
-		log.Printf("Error parsing invoice: %v", err)
+// AdminCreateInvoice issues a manual invoice to a user (admin only)
+func (h *BillingHandler) AdminCreateInvoice(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid user ID")
 		return
 	}
 
-	// Find user and send notification
-	if invoice.Customer == nil {
+	var req services.ManualInvoiceInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	user, err := h.billingService.GetUserByStripeCustomerID(ctx, invoice.Customer.ID)
+	user, err := h.userService.GetByID(r.Context(), userID)
 	if err != nil {
-		log.Printf("User not found for customer %s: %v", invoice.Customer.ID, err)
+		respondError(w, http.StatusNotFound, "user not found")
 		return
 	}
 
-	// Send payment failed email
-	if h.emailService != nil {
-		if err := h.emailService.SendPaymentFailedEmail(ctx, user.Email, user.Name); err != nil {
-			log.Printf("Error sending payment failed email: %v", err)
+	invoice, err := h.billingService.CreateManualInvoice(r.Context(), user, req)
+	if err == services.ErrNotSupportedByProvider {
+		respondError(w, http.StatusBadRequest, "user is not billed through manual invoicing")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "failed to create invoice: "+err.Error())
+		return
+	}
+
+	respondCreated(w, invoice)
+}
+
+// AdminMarkInvoicePaid marks a manual invoice as paid and applies the
+// resulting subscription and license changes (admin only)
+func (h *BillingHandler) AdminMarkInvoicePaid(w http.ResponseWriter, r *http.Request) {
+	invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid invoice ID")
+		return
+	}
+
+	// The license change is applied before the invoice is marked paid, so
+	// a failure leaves the invoice open to retry
+	err = h.billingService.MarkManualInvoicePaid(r.Context(), invoiceID, func(events []*services.BillingEvent) error {
+		for _, event := range events {
+			if err := h.applyBillingEvent(r.Context(), event); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err == services.ErrInvoiceNotFound {
+		respondError(w, http.StatusNotFound, "invoice not found")
+		return
+	}
+	if err == services.ErrInvoiceNotOpen {
+		respondError(w, http.StatusConflict, "invoice is not open")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to mark invoice paid")
+		return
 	}
 
-	log.Printf("Payment failed for user %s", user.ID)
+	respondSuccess(w, map[string]string{"message": "invoice marked as paid"})
+}
+
+// AdminVoidInvoice voids an open manual invoice (admin only)
+func (h *BillingHandler) AdminVoidInvoice(w http.ResponseWriter, r *http.Request) {
+	invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid invoice ID")
+		return
+	}
+
+	err = h.billingService.VoidManualInvoice(r.Context(), invoiceID)
+	if err == services.ErrInvoiceNotOpen {
+		respondError(w, http.StatusConflict, "invoice is not open")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to void invoice")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "invoice voided"})
+}
+
+// AdminEndSubscription ends a user's manually invoiced subscription and
+// downgrades their license (admin only)
+func (h *BillingHandler) AdminEndSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	event, err := h.billingService.EndManualSubscription(r.Context(), userID)
+	if err == services.ErrNoSubscription {
+		respondError(w, http.StatusNotFound, "no manually invoiced subscription found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to end subscription")
+		return
+	}
+
+	if err := h.applyBillingEvent(r.Context(), event); err != nil {
+		log.Printf("Error ending subscription of user %s: %v", userID, err)
+		respondError(w, http.StatusInternalServerError, "failed to end subscription")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "subscription ended"})
 }
@@ -548,26 +548,7 @@ func (h *testBillingHandler) handleInvoicePaid(ctx context.Context, event *strip
 		return
 	}
 
-	var invoiceURL, invoicePDF string
-	if invoice.HostedInvoiceURL != "" {
-		invoiceURL = invoice.HostedInvoiceURL
-	}
-	if invoice.InvoicePDF != "" {
-		invoicePDF = invoice.InvoicePDF
-	}
-
-	err = h.mockBilling.RecordInvoice(
-		ctx,
-		user.ID,
-		invoice.ID,
-		invoice.AmountPaid,
-		string(invoice.Currency),
-		string(invoice.Status),
-		invoiceURL,
-		invoicePDF,
-		invoice.PeriodStart,
-		invoice.PeriodEnd,
-	)
+	err = h.mockBilling.RecordInvoice(ctx, user.ID, services.InvoiceRecordFromStripe(&invoice))
 	if err != nil {
 		log.Printf("Error recording invoice: %v", err)
 	}
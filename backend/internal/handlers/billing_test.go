@@ -37,7 +37,7 @@ type MockBillingService struct {
 	CreateOrUpdateSubscriptionFunc func(ctx context.Context, userID uuid.UUID, stripeSubID, stripePriceID, plan, status string, periodStart, periodEnd int64) error
 	UpdateSubscriptionStatusFunc  func(ctx context.Context, stripeSubID, status string, cancelAtPeriodEnd bool) error
 	DeleteSubscriptionFunc        func(ctx context.Context, stripeSubID string) error
-	RecordInvoiceFunc             func(ctx context.Context, userID uuid.UUID, stripeInvoiceID string, amount int64, currency, status, invoiceURL, invoicePDF string, periodStart, periodEnd int64) error
+	RecordInvoiceFunc             func(ctx context.Context, userID uuid.UUID, rec services.InvoiceRecord) error
 	GetUserByStripeCustomerIDFunc func(ctx context.Context, stripeCustomerID string) (*models.User, error)
 }
 
@@ -153,9 +153,9 @@ func (m *MockBillingService) DeleteSubscription(ctx context.Context, stripeSubID
 	return nil
 }
 
-func (m *MockBillingService) RecordInvoice(ctx context.Context, userID uuid.UUID, stripeInvoiceID string, amount int64, currency, status, invoiceURL, invoicePDF string, periodStart, periodEnd int64) error {
+func (m *MockBillingService) RecordInvoice(ctx context.Context, userID uuid.UUID, rec services.InvoiceRecord) error {
 	if m.RecordInvoiceFunc != nil {
-		return m.RecordInvoiceFunc(ctx, userID, stripeInvoiceID, amount, currency, status, invoiceURL, invoicePDF, periodStart, periodEnd)
+		return m.RecordInvoiceFunc(ctx, userID, rec)
 	}
 	return nil
 }
@@ -1533,7 +1533,7 @@ func TestBillingHandler_HandleWebhook(t *testing.T) {
 				DeleteSubscriptionFunc: func(ctx context.Context, stripeSubID string) error {
 					return nil
 				},
-				RecordInvoiceFunc: func(ctx context.Context, userID uuid.UUID, stripeInvoiceID string, amount int64, currency, status, invoiceURL, invoicePDF string, periodStart, periodEnd int64) error {
+				RecordInvoiceFunc: func(ctx context.Context, userID uuid.UUID, rec services.InvoiceRecord) error {
 					return nil
 				},
 				GetUserByStripeCustomerIDFunc: func(ctx context.Context, stripeCustomerID string) (*models.User, error) {
@@ -3,7 +3,12 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -21,7 +26,13 @@ type ConnectionServiceInterface interface {
 	UpdateConnection(ctx context.Context, userID uuid.UUID, connID uuid.UUID, updates map[string]interface{}) (*models.Connection, error)
 	DeleteConnection(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error
 	TestConnection(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error
-	TestConnectionDirect(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error
+	TestConnectionDirect(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error
+	Preflight(ctx context.Context, userID uuid.UUID, connID uuid.UUID, tables []string) (*services.PreflightReport, error)
+	Discover(ctx context.Context, userID uuid.UUID, connID uuid.UUID, refresh bool) (*services.ConnectionCatalog, error)
+	SetCertificates(ctx context.Context, userID uuid.UUID, connID uuid.UUID, material *models.ConnectionTLS) (*models.ConnectionTLS, error)
+	DeleteCertificates(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error
+	ListConnectionTests(ctx context.Context, userID uuid.UUID, connID uuid.UUID, limit int) ([]models.ConnectionTest, error)
+	CloneConnection(ctx context.Context, userID uuid.UUID, connID uuid.UUID, overrides map[string]interface{}) (*models.Connection, error)
 }
 
 // ConnectionHandler handles connection endpoints
@@ -84,7 +95,11 @@ func (h *ConnectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Database string `json:"database"`
 		Username string `json:"username"`
 		Password string `json:"password"`
-		SSLMode  string `json:"ssl_mode"`
+		// PasswordRef replaces Password with a secret the engine resolves,
+		// e.g. env:PG_PASSWORD, file:/run/secrets/pg or vault:secret/pg#password
+		PasswordRef string            `json:"password_ref"`
+		SSLMode     string            `json:"ssl_mode"`
+		SSHTunnel   *sshTunnelRequest `json:"ssh_tunnel"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
@@ -97,14 +112,16 @@ func (h *ConnectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	conn := &models.Connection{
-		Name:     req.Name,
-		Type:     req.Type,
-		Host:     req.Host,
-		Port:     req.Port,
-		Database: req.Database,
-		Username: req.Username,
-		Password: req.Password,
-		SSLMode:  req.SSLMode,
+		Name:        req.Name,
+		Type:        req.Type,
+		Host:        req.Host,
+		Port:        req.Port,
+		Database:    req.Database,
+		Username:    req.Username,
+		Password:    req.Password,
+		PasswordRef: req.PasswordRef,
+		SSLMode:     req.SSLMode,
+		SSHTunnel:   req.SSHTunnel.model(),
 	}
 
 	if conn.SSLMode == "" {
@@ -112,6 +129,10 @@ func (h *ConnectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	created, err := h.connectionService.CreateConnection(r.Context(), userID, conn)
+	if errors.Is(err, services.ErrInvalidSecretRef) || errors.Is(err, services.ErrInvalidSSHTunnel) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to create connection: "+err.Error())
 		return
@@ -120,6 +141,76 @@ func (h *ConnectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	respondCreated(w, created)
 }
 
+// Clone copies a connection, with its credentials, under a new name. The
+// body overrides settings of the copy like an update does.
+func (h *ConnectionHandler) Clone(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	connID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid connection ID")
+		return
+	}
+
+	var overrides map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if name, _ := overrides["name"].(string); name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	clone, err := h.connectionService.CloneConnection(r.Context(), userID, connID, overrides)
+	switch {
+	case err == nil:
+		respondCreated(w, clone)
+	case err == services.ErrConnectionNotFound:
+		respondError(w, http.StatusNotFound, "connection not found")
+	case err == services.ErrConnectionNameTaken:
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidSecretRef), errors.Is(err, services.ErrInvalidSSHTunnel),
+		errors.Is(err, services.ErrInvalidCertificate):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to clone connection")
+	}
+}
+
+// sshTunnelRequest is the SSH tunnel of a request. Unlike models.SSHTunnel,
+// it reads the private key.
+type sshTunnelRequest struct {
+	Host               string `json:"host"`
+	Port               int    `json:"port"`
+	User               string `json:"user"`
+	PrivateKey         string `json:"private_key"`
+	HostKeyFingerprint string `json:"host_key_fingerprint"`
+}
+
+func (t *sshTunnelRequest) model() *models.SSHTunnel {
+	if t == nil {
+		return nil
+	}
+	return &models.SSHTunnel{
+		Host:               t.Host,
+		Port:               t.Port,
+		User:               t.User,
+		PrivateKey:         t.PrivateKey,
+		HostKeyFingerprint: t.HostKeyFingerprint,
+	}
+}
+
 // Get returns a specific connection
 func (h *ConnectionHandler) Get(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
@@ -184,6 +275,10 @@ func (h *ConnectionHandler) Update(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusNotFound, "connection not found")
 		return
 	}
+	if errors.Is(err, services.ErrInvalidSecretRef) || errors.Is(err, services.ErrInvalidSSHTunnel) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to update connection")
 		return
@@ -254,8 +349,18 @@ func (h *ConnectionHandler) Test(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusNotFound, "connection not found")
 		return
 	}
+	if err == services.ErrSecretResolvedByEngine {
+		// Only the engine can read the password, so it runs the test and
+		// reports the result back through telemetry
+		respondJSON(w, http.StatusAccepted, map[string]interface{}{
+			"success": false,
+			"pending": true,
+			"message": "the engine tests this connection and reports the result",
+		})
+		return
+	}
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "connection test failed: "+err.Error())
+		respondConnectionTestError(w, err)
 		return
 	}
 
@@ -268,13 +373,14 @@ func (h *ConnectionHandler) Test(w http.ResponseWriter, r *http.Request) {
 // TestDirect tests a connection without saving it
 func (h *ConnectionHandler) TestDirect(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Type     string `json:"type"`
-		Host     string `json:"host"`
-		Port     int    `json:"port"`
-		Database string `json:"database"`
-		Username string `json:"username"`
-		Password string `json:"password"`
-		SSLMode  string `json:"ssl_mode"`
+		Type      string            `json:"type"`
+		Host      string            `json:"host"`
+		Port      int               `json:"port"`
+		Database  string            `json:"database"`
+		Username  string            `json:"username"`
+		Password  string            `json:"password"`
+		SSLMode   string            `json:"ssl_mode"`
+		SSHTunnel *sshTunnelRequest `json:"ssh_tunnel"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
@@ -285,9 +391,9 @@ func (h *ConnectionHandler) TestDirect(w http.ResponseWriter, r *http.Request) {
 		req.SSLMode = "prefer"
 	}
 
-	err := h.connectionService.TestConnectionDirect(r.Context(), req.Type, req.Host, req.Port, req.Database, req.Username, req.Password, req.SSLMode)
+	err := h.connectionService.TestConnectionDirect(r.Context(), req.Type, req.Host, req.Port, req.Database, req.Username, req.Password, req.SSLMode, req.SSHTunnel.model())
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "connection test failed: "+err.Error())
+		respondConnectionTestError(w, err)
 		return
 	}
 
@@ -296,3 +402,288 @@ func (h *ConnectionHandler) TestDirect(w http.ResponseWriter, r *http.Request) {
 		"message": "connection successful",
 	})
 }
+
+// ListTests returns the health history of a connection, newest first
+func (h *ConnectionHandler) ListTests(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	connID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid connection ID")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	tests, err := h.connectionService.ListConnectionTests(r.Context(), userID, connID, limit)
+	if err == services.ErrConnectionNotFound {
+		respondError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list connection tests")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{"tests": tests})
+}
+
+// Preflight checks a source connection is configured for CDC. The tables query
+// parameter overrides the tables of the pipelines reading from it.
+func (h *ConnectionHandler) Preflight(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	connID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid connection ID")
+		return
+	}
+
+	var tables []string
+	for _, name := range strings.Split(r.URL.Query().Get("tables"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			tables = append(tables, name)
+		}
+	}
+
+	report, err := h.connectionService.Preflight(r.Context(), userID, connID, tables)
+	if err == services.ErrConnectionNotFound {
+		respondError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	if err == services.ErrPreflightNotSupported || err == services.ErrSecretResolvedByEngine {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrConnectionTestFail) {
+		respondConnectionTestError(w, err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to run preflight checks")
+		return
+	}
+
+	respondSuccess(w, report)
+}
+
+// Schemas lists the schemas of a source connection
+func (h *ConnectionHandler) Schemas(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := h.discover(w, r)
+	if !ok {
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"schemas":        catalog.Schemas,
+		"default_schema": catalog.DefaultSchema,
+		"discovered_at":  catalog.DiscoveredAt,
+	})
+}
+
+// Tables lists the tables of a source connection with their columns, primary
+// keys and row estimates, optionally limited to one schema
+func (h *ConnectionHandler) Tables(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := h.discover(w, r)
+	if !ok {
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"tables":        catalog.TablesInSchema(r.URL.Query().Get("schema")),
+		"discovered_at": catalog.DiscoveredAt,
+	})
+}
+
+// discover introspects the connection of the request, bypassing the cache
+// when refresh=true. It responds with an error and returns false on failure.
+func (h *ConnectionHandler) discover(w http.ResponseWriter, r *http.Request) (*services.ConnectionCatalog, bool) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return nil, false
+	}
+
+	connID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid connection ID")
+		return nil, false
+	}
+
+	refresh := r.URL.Query().Get("refresh") == "true"
+	catalog, err := h.connectionService.Discover(r.Context(), userID, connID, refresh)
+	switch {
+	case err == services.ErrConnectionNotFound:
+		respondError(w, http.StatusNotFound, "connection not found")
+	case err == services.ErrDiscoveryNotSupported, err == services.ErrSecretResolvedByEngine:
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrConnectionTestFail):
+		respondConnectionTestError(w, err)
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "failed to discover tables")
+	default:
+		return catalog, true
+	}
+	return nil, false
+}
+
+// maxCertificateUploadSize caps a certificate upload
+const maxCertificateUploadSize = 1 << 20
+
+// SetCertificates uploads the CA bundle and client certificate of a connection,
+// as PEM in a JSON body or as ca_cert, client_cert and client_key files of a
+// multipart form
+func (h *ConnectionHandler) SetCertificates(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	connID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid connection ID")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCertificateUploadSize)
+	material, err := readCertificateUpload(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	certs, err := h.connectionService.SetCertificates(r.Context(), userID, connID, material)
+	if err == services.ErrConnectionNotFound {
+		respondError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	if err == services.ErrCertificatesNotSupported || errors.Is(err, services.ErrInvalidCertificate) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to save certificates")
+		return
+	}
+
+	respondSuccess(w, certs)
+}
+
+// readCertificateUpload reads the PEM material of a certificate upload
+func readCertificateUpload(r *http.Request) (*models.ConnectionTLS, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		var req struct {
+			CACert     string `json:"ca_cert"`
+			ClientCert string `json:"client_cert"`
+			ClientKey  string `json:"client_key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		return &models.ConnectionTLS{CACert: req.CACert, ClientCert: req.ClientCert, ClientKey: req.ClientKey}, nil
+	}
+
+	if err := r.ParseMultipartForm(maxCertificateUploadSize); err != nil {
+		return nil, err
+	}
+	material := &models.ConnectionTLS{}
+	for field, dst := range map[string]*string{
+		"ca_cert":     &material.CACert,
+		"client_cert": &material.ClientCert,
+		"client_key":  &material.ClientKey,
+	} {
+		file, _, err := r.FormFile(field)
+		if err == http.ErrMissingFile {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		*dst = string(data)
+	}
+	return material, nil
+}
+
+// DeleteCertificates removes the certificates of a connection
+func (h *ConnectionHandler) DeleteCertificates(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	connID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid connection ID")
+		return
+	}
+
+	err = h.connectionService.DeleteCertificates(r.Context(), userID, connID)
+	if err == services.ErrConnectionNotFound {
+		respondError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to delete certificates")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "certificates deleted"})
+}
+
+// respondConnectionTestError reports a failed connection test with its category
+// (dns, network, tls, auth, permission, database, config or unknown)
+func respondConnectionTestError(w http.ResponseWriter, err error) {
+	respondJSON(w, http.StatusBadRequest, map[string]string{
+		"error":    "connection test failed: " + err.Error(),
+		"category": services.ConnectionTestCategory(err),
+	})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// ConnectionBundleServiceInterface defines the bundle operations the handler uses
+type ConnectionBundleServiceInterface interface {
+	Export(ctx context.Context, userID uuid.UUID, opts services.ExportOptions) (*services.ConnectionBundle, error)
+	Import(ctx context.Context, userID uuid.UUID, bundle *services.ConnectionBundle, opts services.ImportOptions) (*services.ImportResult, error)
+}
+
+// maxBundleSize caps an imported bundle
+const maxBundleSize = 10 << 20
+
+// ConnectionBundleHandler handles export and import of connections and pipelines
+type ConnectionBundleHandler struct {
+	bundleService  ConnectionBundleServiceInterface
+	licenseService *services.LicenseService
+}
+
+// NewConnectionBundleHandler creates a new connection bundle handler
+func NewConnectionBundleHandler(bundleService ConnectionBundleServiceInterface) *ConnectionBundleHandler {
+	return &ConnectionBundleHandler{bundleService: bundleService}
+}
+
+// SetLicenseService enables the pipeline limit and target features of the
+// user's plan on import
+func (h *ConnectionBundleHandler) SetLicenseService(licenseService *services.LicenseService) {
+	h.licenseService = licenseService
+}
+
+// Export returns connections, and optionally the pipelines between them, as
+// a JSON or YAML bundle. Credentials are included, encrypted, only with a
+// passphrase.
+func (h *ConnectionBundleHandler) Export(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var req struct {
+		ConnectionIDs    []string `json:"connection_ids"`
+		IncludePipelines bool     `json:"include_pipelines"`
+		Passphrase       string   `json:"passphrase"`
+		Format           string   `json:"format"` // json or yaml
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Format == "" {
+		req.Format = services.BundleFormatYAML
+	}
+	if req.Format != services.BundleFormatJSON && req.Format != services.BundleFormatYAML {
+		respondError(w, http.StatusBadRequest, "format must be json or yaml")
+		return
+	}
+
+	opts := services.ExportOptions{IncludePipelines: req.IncludePipelines, Passphrase: req.Passphrase}
+	for _, id := range req.ConnectionIDs {
+		connID, err := uuid.Parse(id)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid connection ID")
+			return
+		}
+		opts.ConnectionIDs = append(opts.ConnectionIDs, connID)
+	}
+
+	bundle, err := h.bundleService.Export(r.Context(), userID, opts)
+	if err == services.ErrConnectionNotFound {
+		respondError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	if err == services.ErrBundlePassphraseTooShort {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to export connections")
+		return
+	}
+
+	data, err := services.MarshalBundle(bundle, req.Format)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to export connections")
+		return
+	}
+
+	contentType := "application/yaml"
+	if req.Format == services.BundleFormatJSON {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="savegress-connections.`+req.Format+`"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// Import creates the connections and pipelines of a bundle, resolving names
+// that already exist as on_conflict says: skip (default), rename or overwrite
+func (h *ConnectionBundleHandler) Import(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleSize)
+	var req struct {
+		Bundle     string `json:"bundle"` // JSON or YAML
+		Passphrase string `json:"passphrase"`
+		OnConflict string `json:"on_conflict"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	bundle, err := services.ParseBundle([]byte(req.Bundle))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := services.ImportOptions{Passphrase: req.Passphrase, OnConflict: req.OnConflict}
+	if h.licenseService != nil && len(bundle.Pipelines) > 0 {
+		licenses, err := h.licenseService.GetUserLicenses(r.Context(), userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to check license")
+			return
+		}
+		if len(licenses) > 0 {
+			opts.MaxPipelines = maxPipelinesForLicenses(licenses)
+		}
+		opts.Features = services.LicensedFeatures(licenses)
+	}
+
+	result, err := h.bundleService.Import(r.Context(), userID, bundle, opts)
+	var notAllowed *services.TargetNotAllowedError
+	switch {
+	case err == nil:
+		respondSuccess(w, result)
+	case err == services.ErrPipelineLimitReached:
+		respondError(w, http.StatusForbidden, "pipeline limit reached for your plan")
+	case errors.As(err, &notAllowed):
+		respondError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrInvalidBundle),
+		err == services.ErrBundlePassphraseRequired,
+		err == services.ErrInvalidBundlePassphrase,
+		err == services.ErrInvalidConflictResolution,
+		errors.Is(err, services.ErrInvalidSecretRef),
+		errors.Is(err, services.ErrInvalidSSHTunnel),
+		errors.Is(err, services.ErrInvalidCertificate),
+		errors.Is(err, services.ErrInvalidPipelineTables),
+		errors.Is(err, services.ErrUnknownTargetType),
+		errors.Is(err, services.ErrInvalidTargetConfig),
+		errors.Is(err, services.ErrCertificatesNotSupported):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to import bundle: "+err.Error())
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// MockConnectionBundleService implements a mock for testing
+type MockConnectionBundleService struct {
+	ExportFunc func(ctx context.Context, userID uuid.UUID, opts services.ExportOptions) (*services.ConnectionBundle, error)
+	ImportFunc func(ctx context.Context, userID uuid.UUID, bundle *services.ConnectionBundle, opts services.ImportOptions) (*services.ImportResult, error)
+}
+
+func (m *MockConnectionBundleService) Export(ctx context.Context, userID uuid.UUID, opts services.ExportOptions) (*services.ConnectionBundle, error) {
+	if m.ExportFunc != nil {
+		return m.ExportFunc(ctx, userID, opts)
+	}
+	return &services.ConnectionBundle{Version: 1}, nil
+}
+
+func (m *MockConnectionBundleService) Import(ctx context.Context, userID uuid.UUID, bundle *services.ConnectionBundle, opts services.ImportOptions) (*services.ImportResult, error) {
+	if m.ImportFunc != nil {
+		return m.ImportFunc(ctx, userID, bundle, opts)
+	}
+	return &services.ImportResult{}, nil
+}
+
+func TestConnectionBundleHandler_Export(t *testing.T) {
+	connID := uuid.New()
+
+	tests := []struct {
+		name                string
+		body                string
+		err                 error
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{name: "yaml by default", body: `{}`, expectedStatus: http.StatusOK, expectedContentType: "application/yaml"},
+		{name: "json", body: `{"format": "json", "connection_ids": ["` + connID.String() + `"]}`, expectedStatus: http.StatusOK, expectedContentType: "application/json"},
+		{name: "unknown format", body: `{"format": "xml"}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid connection ID", body: `{"connection_ids": ["nope"]}`, expectedStatus: http.StatusBadRequest},
+		{name: "short passphrase", body: `{"passphrase": "short"}`, err: services.ErrBundlePassphraseTooShort, expectedStatus: http.StatusBadRequest},
+		{name: "not found", body: `{"connection_ids": ["` + connID.String() + `"]}`, err: services.ErrConnectionNotFound, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockConnectionBundleService{
+				ExportFunc: func(ctx context.Context, userID uuid.UUID, opts services.ExportOptions) (*services.ConnectionBundle, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &services.ConnectionBundle{Version: 1, Connections: []services.BundleConnection{{Name: "orders-db"}}}, nil
+				},
+			}
+			handler := NewConnectionBundleHandler(mock)
+
+			req := newRequestWithUser(http.MethodPost, "/api/v1/connections/export", []byte(tt.body), uuid.New())
+			rec := httptest.NewRecorder()
+			handler.Export(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedContentType != "" {
+				if got := rec.Header().Get("Content-Type"); got != tt.expectedContentType {
+					t.Errorf("expected content type %q, got %q", tt.expectedContentType, got)
+				}
+				if !strings.Contains(rec.Body.String(), "orders-db") {
+					t.Errorf("expected the bundle in the body, got %q", rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestConnectionBundleHandler_Import(t *testing.T) {
+	bundle := "version: 1\nconnections:\n  - name: orders-db\n    type: postgres\n    host: db\n    port: 5432\n"
+
+	tests := []struct {
+		name           string
+		bundle         string
+		err            error
+		expectedStatus int
+	}{
+		{name: "imported", bundle: bundle, expectedStatus: http.StatusOK},
+		{name: "unsupported version", bundle: "version: 9\n", expectedStatus: http.StatusBadRequest},
+		{name: "passphrase required", bundle: bundle, err: services.ErrBundlePassphraseRequired, expectedStatus: http.StatusBadRequest},
+		{name: "invalid bundle", bundle: bundle, err: fmt.Errorf("%w: duplicate connection %q", services.ErrInvalidBundle, "a"), expectedStatus: http.StatusBadRequest},
+		{name: "invalid tunnel", bundle: bundle, err: fmt.Errorf("connection %q: %w", "a", services.ErrInvalidSSHTunnel), expectedStatus: http.StatusBadRequest},
+		{name: "pipeline limit", bundle: bundle, err: services.ErrPipelineLimitReached, expectedStatus: http.StatusForbidden},
+		{name: "target not licensed", bundle: bundle, err: fmt.Errorf("pipeline %q: %w", "p", &services.TargetNotAllowedError{}), expectedStatus: http.StatusForbidden},
+		{name: "invalid target config", bundle: bundle, err: fmt.Errorf("pipeline %q: %w", "p", services.ErrInvalidTargetConfig), expectedStatus: http.StatusBadRequest},
+		{name: "service error", bundle: bundle, err: fmt.Errorf("db down"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOpts services.ImportOptions
+			mock := &MockConnectionBundleService{
+				ImportFunc: func(ctx context.Context, userID uuid.UUID, bundle *services.ConnectionBundle, opts services.ImportOptions) (*services.ImportResult, error) {
+					gotOpts = opts
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &services.ImportResult{Connections: []services.ImportItem{{Name: bundle.Connections[0].Name, Action: services.ImportCreated}}}, nil
+				},
+			}
+			handler := NewConnectionBundleHandler(mock)
+
+			body, _ := json.Marshal(map[string]string{"bundle": tt.bundle, "passphrase": "correct horse battery", "on_conflict": "rename"})
+			req := newRequestWithUser(http.MethodPost, "/api/v1/connections/import", body, uuid.New())
+			rec := httptest.NewRecorder()
+			handler.Import(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code == http.StatusOK && gotOpts.OnConflict != services.ConflictRename {
+				t.Errorf("expected on_conflict rename, got %q", gotOpts.OnConflict)
+			}
+		})
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -25,7 +28,13 @@ type MockConnectionService struct {
 	UpdateConnectionFunc     func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, updates map[string]interface{}) (*models.Connection, error)
 	DeleteConnectionFunc     func(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error
 	TestConnectionFunc       func(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error
-	TestConnectionDirectFunc func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error
+	TestConnectionDirectFunc func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error
+	PreflightFunc            func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, tables []string) (*services.PreflightReport, error)
+	DiscoverFunc             func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, refresh bool) (*services.ConnectionCatalog, error)
+	SetCertificatesFunc      func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, material *models.ConnectionTLS) (*models.ConnectionTLS, error)
+	DeleteCertificatesFunc   func(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error
+	ListConnectionTestsFunc  func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, limit int) ([]models.ConnectionTest, error)
+	CloneConnectionFunc      func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, overrides map[string]interface{}) (*models.Connection, error)
 }
 
 func (m *MockConnectionService) ListConnections(ctx context.Context, userID uuid.UUID) ([]models.Connection, error) {
@@ -70,13 +79,55 @@ func (m *MockConnectionService) TestConnection(ctx context.Context, userID uuid.
 	return nil
 }
 
-func (m *MockConnectionService) TestConnectionDirect(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error {
+func (m *MockConnectionService) TestConnectionDirect(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error {
 	if m.TestConnectionDirectFunc != nil {
-		return m.TestConnectionDirectFunc(ctx, connType, host, port, database, username, password, sslMode)
+		return m.TestConnectionDirectFunc(ctx, connType, host, port, database, username, password, sslMode, tunnel)
 	}
 	return nil
 }
 
+func (m *MockConnectionService) Preflight(ctx context.Context, userID uuid.UUID, connID uuid.UUID, tables []string) (*services.PreflightReport, error) {
+	if m.PreflightFunc != nil {
+		return m.PreflightFunc(ctx, userID, connID, tables)
+	}
+	return nil, nil
+}
+
+func (m *MockConnectionService) Discover(ctx context.Context, userID uuid.UUID, connID uuid.UUID, refresh bool) (*services.ConnectionCatalog, error) {
+	if m.DiscoverFunc != nil {
+		return m.DiscoverFunc(ctx, userID, connID, refresh)
+	}
+	return nil, nil
+}
+
+func (m *MockConnectionService) SetCertificates(ctx context.Context, userID uuid.UUID, connID uuid.UUID, material *models.ConnectionTLS) (*models.ConnectionTLS, error) {
+	if m.SetCertificatesFunc != nil {
+		return m.SetCertificatesFunc(ctx, userID, connID, material)
+	}
+	return nil, nil
+}
+
+func (m *MockConnectionService) DeleteCertificates(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error {
+	if m.DeleteCertificatesFunc != nil {
+		return m.DeleteCertificatesFunc(ctx, userID, connID)
+	}
+	return nil
+}
+
+func (m *MockConnectionService) ListConnectionTests(ctx context.Context, userID uuid.UUID, connID uuid.UUID, limit int) ([]models.ConnectionTest, error) {
+	if m.ListConnectionTestsFunc != nil {
+		return m.ListConnectionTestsFunc(ctx, userID, connID, limit)
+	}
+	return nil, nil
+}
+
+func (m *MockConnectionService) CloneConnection(ctx context.Context, userID uuid.UUID, connID uuid.UUID, overrides map[string]interface{}) (*models.Connection, error) {
+	if m.CloneConnectionFunc != nil {
+		return m.CloneConnectionFunc(ctx, userID, connID, overrides)
+	}
+	return nil, nil
+}
+
 // testConnectionHandler wraps ConnectionHandler for testing with mock service
 type testConnectionHandler struct {
 	mock *MockConnectionService
@@ -296,7 +347,7 @@ func (h *testConnectionHandler) Test(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "connection test failed: "+err.Error())
+		respondConnectionTestError(w, err)
 		return
 	}
 
@@ -325,9 +376,9 @@ func (h *testConnectionHandler) TestDirect(w http.ResponseWriter, r *http.Reques
 		req.SSLMode = "prefer"
 	}
 
-	err := h.mock.TestConnectionDirect(r.Context(), req.Type, req.Host, req.Port, req.Database, req.Username, req.Password, req.SSLMode)
+	err := h.mock.TestConnectionDirect(r.Context(), req.Type, req.Host, req.Port, req.Database, req.Username, req.Password, req.SSLMode, nil)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "connection test failed: "+err.Error())
+		respondConnectionTestError(w, err)
 		return
 	}
 
@@ -1045,7 +1096,7 @@ func TestConnectionHandler_TestDirect(t *testing.T) {
 	tests := []struct {
 		name                     string
 		requestBody              map[string]interface{}
-		mockTestConnectionDirect func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error
+		mockTestConnectionDirect func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error
 		expectedStatus           int
 		expectedError            string
 	}{
@@ -1060,7 +1111,7 @@ func TestConnectionHandler_TestDirect(t *testing.T) {
 				"password": "testpass",
 				"ssl_mode": "require",
 			},
-			mockTestConnectionDirect: func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error {
+			mockTestConnectionDirect: func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error {
 				return nil
 			},
 			expectedStatus: http.StatusOK,
@@ -1075,7 +1126,7 @@ func TestConnectionHandler_TestDirect(t *testing.T) {
 				"username": "testuser",
 				"password": "testpass",
 			},
-			mockTestConnectionDirect: func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error {
+			mockTestConnectionDirect: func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error {
 				if sslMode != "prefer" {
 					return errors.New("expected default ssl_mode to be 'prefer'")
 				}
@@ -1093,7 +1144,7 @@ func TestConnectionHandler_TestDirect(t *testing.T) {
 				"username": "testuser",
 				"password": "testpass",
 			},
-			mockTestConnectionDirect: func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error {
+			mockTestConnectionDirect: func(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error {
 				return errors.New("connection refused")
 			},
 			expectedStatus: http.StatusBadRequest,
@@ -1296,3 +1347,460 @@ func mustMarshal(v interface{}) []byte {
 	}
 	return b
 }
+
+func TestRespondConnectionTestError(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              error
+		expectedCategory string
+	}{
+		{
+			name:             "categorized failure",
+			err:              &services.ConnectionTestError{Category: services.ConnErrAuth, Message: "authentication failed"},
+			expectedCategory: "auth",
+		},
+		{
+			name:             "uncategorized failure",
+			err:              errors.New("connection refused"),
+			expectedCategory: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			respondConnectionTestError(rec, tt.err)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+			var response map[string]string
+			json.NewDecoder(rec.Body).Decode(&response)
+			if response["error"] != "connection test failed: "+tt.err.Error() {
+				t.Errorf("unexpected error %q", response["error"])
+			}
+			if response["category"] != tt.expectedCategory {
+				t.Errorf("expected category %q, got %q", tt.expectedCategory, response["category"])
+			}
+		})
+	}
+}
+
+func TestConnectionHandler_Preflight(t *testing.T) {
+	userID := uuid.New()
+	connID := uuid.New()
+
+	tests := []struct {
+		name           string
+		query          string
+		err            error
+		expectedStatus int
+		expectedTables []string
+	}{
+		{
+			name:           "tables from query",
+			query:          "?tables=public.orders,%20users,",
+			expectedStatus: http.StatusOK,
+			expectedTables: []string{"public.orders", "users"},
+		},
+		{
+			name:           "pipeline tables",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not found",
+			err:            services.ErrConnectionNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unsupported type",
+			err:            services.ErrPreflightNotSupported,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "connection failed",
+			err:            &services.ConnectionTestError{Category: services.ConnErrNetwork, Message: "cannot connect"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "password resolved by engine",
+			err:            services.ErrSecretResolvedByEngine,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotTables []string
+			mock := &MockConnectionService{
+				PreflightFunc: func(ctx context.Context, uid uuid.UUID, cid uuid.UUID, tables []string) (*services.PreflightReport, error) {
+					gotTables = tables
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &services.PreflightReport{ConnectionID: cid, Status: services.PreflightPass}, nil
+				},
+			}
+			handler := NewConnectionHandlerWithInterface(mock)
+
+			req := newRequestWithUser(http.MethodGet, "/api/v1/connections/"+connID.String()+"/preflight"+tt.query, nil, userID)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", connID.String())
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rec := httptest.NewRecorder()
+			handler.Preflight(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if strings.Join(gotTables, "|") != strings.Join(tt.expectedTables, "|") {
+				t.Errorf("expected tables %v, got %v", tt.expectedTables, gotTables)
+			}
+		})
+	}
+}
+
+func TestConnectionHandler_TestResolvedByEngine(t *testing.T) {
+	connID := uuid.New()
+	mock := &MockConnectionService{
+		TestConnectionFunc: func(ctx context.Context, userID uuid.UUID, connID uuid.UUID) error {
+			return services.ErrSecretResolvedByEngine
+		},
+	}
+	handler := NewConnectionHandlerWithInterface(mock)
+
+	req := newRequestWithUser(http.MethodPost, "/api/v1/connections/"+connID.String()+"/test", nil, uuid.New())
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", connID.String())
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rec := httptest.NewRecorder()
+	handler.Test(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	var response map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&response)
+	if response["pending"] != true {
+		t.Errorf("expected pending to be true, got %v", response["pending"])
+	}
+}
+
+func TestConnectionHandler_Discovery(t *testing.T) {
+	userID := uuid.New()
+	connID := uuid.New()
+	catalog := &services.ConnectionCatalog{
+		DefaultSchema: "public",
+		Schemas:       []services.DiscoveredSchema{{Name: "public", TableCount: 1}, {Name: "sales", TableCount: 1}},
+		Tables: []services.DiscoveredTable{
+			{Schema: "public", Name: "orders", PrimaryKey: []string{"id"}},
+			{Schema: "sales", Name: "invoices", PrimaryKey: []string{"id"}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		handler        func(*ConnectionHandler, http.ResponseWriter, *http.Request)
+		query          string
+		err            error
+		expectedStatus int
+		expectedItems  int
+		expectRefresh  bool
+	}{
+		{
+			name:           "schemas",
+			handler:        (*ConnectionHandler).Schemas,
+			expectedStatus: http.StatusOK,
+			expectedItems:  2,
+		},
+		{
+			name:           "tables in schema",
+			handler:        (*ConnectionHandler).Tables,
+			query:          "?schema=sales&refresh=true",
+			expectedStatus: http.StatusOK,
+			expectedItems:  1,
+			expectRefresh:  true,
+		},
+		{
+			name:           "not found",
+			handler:        (*ConnectionHandler).Tables,
+			err:            services.ErrConnectionNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unsupported type",
+			handler:        (*ConnectionHandler).Schemas,
+			err:            services.ErrDiscoveryNotSupported,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unreachable",
+			handler:        (*ConnectionHandler).Tables,
+			err:            &services.ConnectionTestError{Category: services.ConnErrNetwork, Message: "cannot connect"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRefresh bool
+			mock := &MockConnectionService{
+				DiscoverFunc: func(ctx context.Context, uid uuid.UUID, cid uuid.UUID, refresh bool) (*services.ConnectionCatalog, error) {
+					gotRefresh = refresh
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return catalog, nil
+				},
+			}
+			handler := NewConnectionHandlerWithInterface(mock)
+
+			req := newRequestWithUser(http.MethodGet, "/api/v1/connections/"+connID.String()+"/tables"+tt.query, nil, userID)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", connID.String())
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rec := httptest.NewRecorder()
+			tt.handler(handler, rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if gotRefresh != tt.expectRefresh {
+				t.Errorf("expected refresh %v, got %v", tt.expectRefresh, gotRefresh)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Schemas []json.RawMessage `json:"schemas"`
+				Tables  []json.RawMessage `json:"tables"`
+			}
+			json.NewDecoder(rec.Body).Decode(&response)
+			items := response.Tables
+			if items == nil {
+				items = response.Schemas
+			}
+			if len(items) != tt.expectedItems {
+				t.Errorf("expected %d items, got %d", tt.expectedItems, len(items))
+			}
+		})
+	}
+}
+
+func TestConnectionHandler_SetCertificates(t *testing.T) {
+	connID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           []byte
+		err            error
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "uploaded",
+			body:           []byte(`{"ca_cert": "-----BEGIN CERTIFICATE-----"}`),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid body",
+			body:           []byte(`{`),
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid request body",
+		},
+		{
+			name:           "invalid certificate",
+			body:           []byte(`{"ca_cert": "x"}`),
+			err:            fmt.Errorf("%w: ca_cert: no PEM certificates found", services.ErrInvalidCertificate),
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid certificate: ca_cert: no PEM certificates found",
+		},
+		{
+			name:           "unsupported type",
+			body:           []byte(`{"ca_cert": "x"}`),
+			err:            services.ErrCertificatesNotSupported,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  services.ErrCertificatesNotSupported.Error(),
+		},
+		{
+			name:           "not found",
+			body:           []byte(`{"ca_cert": "x"}`),
+			err:            services.ErrConnectionNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "connection not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockConnectionService{
+				SetCertificatesFunc: func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, material *models.ConnectionTLS) (*models.ConnectionTLS, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &models.ConnectionTLS{Certificates: []models.CertificateInfo{{Usage: services.CertificateCA}}}, nil
+				},
+			}
+			handler := NewConnectionHandlerWithInterface(mock)
+
+			req := newRequestWithUser(http.MethodPut, "/api/v1/connections/"+connID.String()+"/certificates", tt.body, uuid.New())
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", connID.String())
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rec := httptest.NewRecorder()
+			handler.SetCertificates(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedError != "" {
+				var response map[string]string
+				json.NewDecoder(rec.Body).Decode(&response)
+				if response["error"] != tt.expectedError {
+					t.Errorf("expected error %q, got %q", tt.expectedError, response["error"])
+				}
+			}
+		})
+	}
+}
+
+func TestConnectionHandler_SetCertificatesMultipart(t *testing.T) {
+	connID := uuid.New()
+	var got *models.ConnectionTLS
+	mock := &MockConnectionService{
+		SetCertificatesFunc: func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, material *models.ConnectionTLS) (*models.ConnectionTLS, error) {
+			got = material
+			return &models.ConnectionTLS{}, nil
+		},
+	}
+	handler := NewConnectionHandlerWithInterface(mock)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for field, content := range map[string]string{"client_cert": "CERT", "client_key": "KEY"} {
+		part, _ := form.CreateFormFile(field, field+".pem")
+		part.Write([]byte(content))
+	}
+	form.Close()
+
+	req := newRequestWithUser(http.MethodPut, "/api/v1/connections/"+connID.String()+"/certificates", body.Bytes(), uuid.New())
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", connID.String())
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rec := httptest.NewRecorder()
+	handler.SetCertificates(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if got.CACert != "" || got.ClientCert != "CERT" || got.ClientKey != "KEY" {
+		t.Errorf("unexpected material %+v", got)
+	}
+}
+
+func TestConnectionHandler_ListTests(t *testing.T) {
+	connID := uuid.New()
+
+	tests := []struct {
+		name           string
+		query          string
+		err            error
+		expectedStatus int
+		expectedLimit  int
+	}{
+		{name: "default limit", expectedStatus: http.StatusOK, expectedLimit: 100},
+		{name: "custom limit", query: "?limit=20", expectedStatus: http.StatusOK, expectedLimit: 20},
+		{name: "limit too large", query: "?limit=5000", expectedStatus: http.StatusOK, expectedLimit: 100},
+		{name: "not found", err: services.ErrConnectionNotFound, expectedStatus: http.StatusNotFound},
+		{name: "service error", err: errors.New("db down"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLimit int
+			mock := &MockConnectionService{
+				ListConnectionTestsFunc: func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, limit int) ([]models.ConnectionTest, error) {
+					gotLimit = limit
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return []models.ConnectionTest{{ConnectionID: connID, Status: services.ConnectionTestSuccess, Trigger: services.ConnectionTestScheduled}}, nil
+				},
+			}
+			handler := NewConnectionHandlerWithInterface(mock)
+
+			req := newRequestWithUser(http.MethodGet, "/api/v1/connections/"+connID.String()+"/tests"+tt.query, nil, uuid.New())
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", connID.String())
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rec := httptest.NewRecorder()
+			handler.ListTests(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedLimit != 0 && gotLimit != tt.expectedLimit {
+				t.Errorf("expected limit %d, got %d", tt.expectedLimit, gotLimit)
+			}
+			if rec.Code == http.StatusOK {
+				var response map[string][]models.ConnectionTest
+				json.NewDecoder(rec.Body).Decode(&response)
+				if len(response["tests"]) != 1 {
+					t.Errorf("expected 1 test, got %d", len(response["tests"]))
+				}
+			}
+		})
+	}
+}
+
+func TestConnectionHandler_Clone(t *testing.T) {
+	connID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "cloned", body: `{"name": "orders-prod", "host": "prod-db.internal"}`, expectedStatus: http.StatusCreated},
+		{name: "missing name", body: `{"host": "prod-db.internal"}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid body", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "not found", body: `{"name": "orders-prod"}`, err: services.ErrConnectionNotFound, expectedStatus: http.StatusNotFound},
+		{name: "name taken", body: `{"name": "orders-prod"}`, err: services.ErrConnectionNameTaken, expectedStatus: http.StatusConflict},
+		{name: "invalid password_ref", body: `{"name": "orders-prod", "password_ref": "x"}`, err: services.ErrInvalidSecretRef, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockConnectionService{
+				CloneConnectionFunc: func(ctx context.Context, userID uuid.UUID, connID uuid.UUID, overrides map[string]interface{}) (*models.Connection, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &models.Connection{ID: uuid.New(), Name: overrides["name"].(string), Host: overrides["host"].(string)}, nil
+				},
+			}
+			handler := NewConnectionHandlerWithInterface(mock)
+
+			req := newRequestWithUser(http.MethodPost, "/api/v1/connections/"+connID.String()+"/clone", []byte(tt.body), uuid.New())
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", connID.String())
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rec := httptest.NewRecorder()
+			handler.Clone(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
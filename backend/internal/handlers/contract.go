@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// ContractHandler handles enterprise contract endpoints
+type ContractHandler struct {
+	contractService *services.ContractService
+}
+
+// NewContractHandler creates a new contract handler
+func NewContractHandler(contractService *services.ContractService) *ContractHandler {
+	return &ContractHandler{contractService: contractService}
+}
+
+// List returns the current user's contracts
+func (h *ContractHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	contracts, err := h.contractService.ListContracts(r.Context(), &userID, "")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list contracts")
+		return
+	}
+
+	// Notes are internal to our sales team
+	for _, c := range contracts {
+		c.Notes = ""
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"contracts": contracts,
+	})
+}
+
+// AdminList returns all contracts, optionally filtered by user_id and status (admin only)
+func (h *ContractHandler) AdminList(w http.ResponseWriter, r *http.Request) {
+	var userID *uuid.UUID
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid user ID")
+			return
+		}
+		userID = &id
+	}
+
+	contracts, err := h.contractService.ListContracts(r.Context(), userID, r.URL.Query().Get("status"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list contracts")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"contracts": contracts,
+	})
+}
+
+// AdminCreate creates a contract (admin only)
+func (h *ContractHandler) AdminCreate(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	adminID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var req struct {
+		UserID        string    `json:"user_id"`
+		Name          string    `json:"name"`
+		PONumber      string    `json:"po_number"`
+		Tier          string    `json:"tier"`
+		StartDate     time.Time `json:"start_date"`
+		EndDate       time.Time `json:"end_date"`
+		MaxSources    int       `json:"max_sources"`
+		MaxTables     int       `json:"max_tables"`
+		MaxThroughput int64     `json:"max_throughput"`
+		ContractValue int64     `json:"contract_value"`
+		Currency      string    `json:"currency"`
+		AutoRenew     bool      `json:"auto_renew"`
+		Notes         string    `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	contract, err := h.contractService.CreateContract(r.Context(), &models.Contract{
+		UserID:        userID,
+		Name:          req.Name,
+		PONumber:      req.PONumber,
+		Tier:          req.Tier,
+		StartDate:     req.StartDate,
+		EndDate:       req.EndDate,
+		MaxSources:    req.MaxSources,
+		MaxTables:     req.MaxTables,
+		MaxThroughput: req.MaxThroughput,
+		ContractValue: req.ContractValue,
+		Currency:      req.Currency,
+		AutoRenew:     req.AutoRenew,
+		Notes:         req.Notes,
+		CreatedBy:     &adminID,
+	})
+	if err != nil {
+		h.respondContractError(w, err, "failed to create contract")
+		return
+	}
+
+	respondCreated(w, contract)
+}
+
+// AdminGet returns a contract (admin only)
+func (h *ContractHandler) AdminGet(w http.ResponseWriter, r *http.Request) {
+	contractID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid contract ID")
+		return
+	}
+
+	contract, err := h.contractService.GetContract(r.Context(), contractID)
+	if err != nil {
+		h.respondContractError(w, err, "failed to get contract")
+		return
+	}
+
+	respondSuccess(w, contract)
+}
+
+// AdminUpdate changes a contract's terms and reissues its licenses (admin only)
+func (h *ContractHandler) AdminUpdate(w http.ResponseWriter, r *http.Request) {
+	contractID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid contract ID")
+		return
+	}
+
+	var req services.ContractUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	contract, err := h.contractService.UpdateContract(r.Context(), contractID, req)
+	if err != nil {
+		h.respondContractError(w, err, "failed to update contract")
+		return
+	}
+
+	respondSuccess(w, contract)
+}
+
+// AdminTerminate ends a contract early and expires its licenses (admin only)
+func (h *ContractHandler) AdminTerminate(w http.ResponseWriter, r *http.Request) {
+	contractID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid contract ID")
+		return
+	}
+
+	contract, err := h.contractService.TerminateContract(r.Context(), contractID)
+	if err != nil {
+		h.respondContractError(w, err, "failed to terminate contract")
+		return
+	}
+
+	respondSuccess(w, contract)
+}
+
+// AdminAttachLicense attaches an existing license to a contract, or issues a
+// new one when no license_id is given (admin only)
+func (h *ContractHandler) AdminAttachLicense(w http.ResponseWriter, r *http.Request) {
+	contractID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid contract ID")
+		return
+	}
+
+	var req struct {
+		LicenseID  string `json:"license_id"`
+		HardwareID string `json:"hardware_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.LicenseID == "" {
+		license, err := h.contractService.IssueLicense(r.Context(), contractID, req.HardwareID)
+		if err != nil {
+			h.respondContractError(w, err, "failed to issue license")
+			return
+		}
+		respondCreated(w, license)
+		return
+	}
+
+	licenseID, err := uuid.Parse(req.LicenseID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid license ID")
+		return
+	}
+
+	contract, err := h.contractService.AttachLicense(r.Context(), contractID, licenseID)
+	if err != nil {
+		h.respondContractError(w, err, "failed to attach license")
+		return
+	}
+
+	respondSuccess(w, contract)
+}
+
+// AdminDetachLicense removes a license from a contract (admin only)
+func (h *ContractHandler) AdminDetachLicense(w http.ResponseWriter, r *http.Request) {
+	contractID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid contract ID")
+		return
+	}
+
+	licenseID, err := uuid.Parse(chi.URLParam(r, "licenseId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid license ID")
+		return
+	}
+
+	if err := h.contractService.DetachLicense(r.Context(), contractID, licenseID); err != nil {
+		h.respondContractError(w, err, "failed to detach license")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "license detached"})
+}
+
+func (h *ContractHandler) respondContractError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidContract):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err == services.ErrContractNotFound, err == services.ErrUserNotFound,
+		err == services.ErrLicenseNotFound, err == services.ErrLicenseNotAttached:
+		respondError(w, http.StatusNotFound, err.Error())
+	case err == services.ErrContractClosed, err == services.ErrContractNotStarted, err == services.ErrLicenseNotOwned,
+		err == services.ErrLicenseAlreadyAttached, err == services.ErrLicenseRevoked:
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
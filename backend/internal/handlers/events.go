@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// streamHeartbeatInterval keeps idle streams alive through proxies
+const streamHeartbeatInterval = 25 * time.Second
+
+// EventHandler handles the real-time dashboard stream
+type EventHandler struct {
+	eventService *services.EventService
+}
+
+// NewEventHandler creates a new event handler
+func NewEventHandler(eventService *services.EventService) *EventHandler {
+	return &EventHandler{eventService: eventService}
+}
+
+// CreateTicket issues a single-use ticket for opening the event stream
+func (h *EventHandler) CreateTicket(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	ticket, ttl, err := h.eventService.CreateStreamTicket(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to create stream ticket")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"ticket":     ticket,
+		"expires_in": int(ttl.Seconds()),
+	})
+}
+
+// Stream pushes the account's dashboard events as Server-Sent Events. Clients
+// authenticate with ?ticket= and fetch a new ticket before reconnecting.
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.eventService.RedeemStreamTicket(r.Context(), r.URL.Query().Get("ticket"))
+	if err == services.ErrInvalidStreamTicket {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to open stream")
+		return
+	}
+
+	sub, err := h.eventService.Subscribe(userID)
+	if err == services.ErrTooManyStreams {
+		respondError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, "event stream unavailable")
+		return
+	}
+	defer sub.Close()
+
+	serveEventStream(w, r, sub.C)
+}
+
+// serveEventStream writes messages to the response as Server-Sent Events until
+// the client goes away or messages is closed
+func serveEventStream(w http.ResponseWriter, r *http.Request, messages <-chan string) {
+	// Streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline for event stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprint(w, formatSSE(msg)); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// formatSSE renders a published stream event as an SSE message named after its type
+func formatSSE(payload string) string {
+	var event services.StreamEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil || event.Type == "" {
+		return "data: " + payload + "\n\n"
+	}
+	// Marshalled JSON never contains raw newlines, so one data line suffices
+	return "event: " + event.Type + "\ndata: " + payload + "\n\n"
+}
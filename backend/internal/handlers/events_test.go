@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSSE(t *testing.T) {
+	payload := `{"type":"instance.status","time":"2025-01-01T00:00:00Z","data":{"status":"offline"}}`
+	assert.Equal(t, "event: instance.status\ndata: "+payload+"\n\n", formatSSE(payload))
+
+	// Unknown payloads are passed through as unnamed messages
+	assert.Equal(t, "data: not-json\n\n", formatSSE("not-json"))
+}
+
+func TestServeEventStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest("GET", "/api/v1/events/stream", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	messages := make(chan string, 1)
+	payload := `{"type":"pipeline.stats","time":"2025-01-01T00:00:00Z","data":{"events_processed":42}}`
+	messages <- payload
+	close(messages)
+
+	serveEventStream(rec, req, messages)
+
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.True(t, strings.HasPrefix(body, "retry: 5000\n\n"), body)
+	assert.Contains(t, body, "event: pipeline.stats\ndata: "+payload+"\n\n")
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// FleetHandler handles engine fleet version and release advisory endpoints
+type FleetHandler struct {
+	fleetService *services.FleetService
+}
+
+// NewFleetHandler creates a new fleet handler
+func NewFleetHandler(fleetService *services.FleetService) *FleetHandler {
+	return &FleetHandler{fleetService: fleetService}
+}
+
+// GetVersions returns the user's instances grouped by engine version
+func (h *FleetHandler) GetVersions(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	fleet, err := h.fleetService.GetUserFleet(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to get fleet versions")
+		return
+	}
+
+	respondSuccess(w, fleet)
+}
+
+// AdminGetVersions returns instance and account counts per engine version (admin only)
+func (h *FleetHandler) AdminGetVersions(w http.ResponseWriter, r *http.Request) {
+	fleet, err := h.fleetService.GetFleet(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to get fleet versions")
+		return
+	}
+
+	respondSuccess(w, fleet)
+}
+
+// AdminListAdvisories returns release advisories, optionally filtered by product (admin only)
+func (h *FleetHandler) AdminListAdvisories(w http.ResponseWriter, r *http.Request) {
+	advisories, err := h.fleetService.ListAdvisories(r.Context(), r.URL.Query().Get("product"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list release advisories")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"advisories": advisories,
+	})
+}
+
+// AdminCreateAdvisory marks a release as deprecated or affected by a security issue (admin only)
+func (h *FleetHandler) AdminCreateAdvisory(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	adminID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var advisory models.ReleaseAdvisory
+	if err := json.NewDecoder(r.Body).Decode(&advisory); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	advisory.CreatedBy = &adminID
+
+	created, err := h.fleetService.CreateAdvisory(r.Context(), &advisory)
+	if err != nil {
+		h.respondAdvisoryError(w, err, "failed to create release advisory")
+		return
+	}
+
+	respondCreated(w, created)
+}
+
+// AdminUpdateAdvisory changes a release advisory (admin only)
+func (h *FleetHandler) AdminUpdateAdvisory(w http.ResponseWriter, r *http.Request) {
+	advisoryID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid advisory ID")
+		return
+	}
+
+	advisory, err := h.fleetService.GetAdvisory(r.Context(), advisoryID)
+	if err != nil {
+		h.respondAdvisoryError(w, err, "failed to get release advisory")
+		return
+	}
+
+	createdBy := advisory.CreatedBy
+	if err := json.NewDecoder(r.Body).Decode(advisory); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	advisory.ID = advisoryID
+	advisory.CreatedBy = createdBy
+
+	updated, err := h.fleetService.UpdateAdvisory(r.Context(), advisory)
+	if err != nil {
+		h.respondAdvisoryError(w, err, "failed to update release advisory")
+		return
+	}
+
+	respondSuccess(w, updated)
+}
+
+// AdminDeleteAdvisory removes a release advisory (admin only)
+func (h *FleetHandler) AdminDeleteAdvisory(w http.ResponseWriter, r *http.Request) {
+	advisoryID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid advisory ID")
+		return
+	}
+
+	if err := h.fleetService.DeleteAdvisory(r.Context(), advisoryID); err != nil {
+		h.respondAdvisoryError(w, err, "failed to delete release advisory")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"message": "release advisory deleted"})
+}
+
+func (h *FleetHandler) respondAdvisoryError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrReleaseAdvisoryNotFound):
+		respondError(w, http.StatusNotFound, "release advisory not found")
+	case errors.Is(err, services.ErrInvalidReleaseAdvisory):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -27,14 +29,18 @@ type LicenseServiceInterface interface {
 	GetLicenseActivations(ctx context.Context, licenseID uuid.UUID) ([]models.LicenseActivation, error)
 	GetAllLicensesPaginated(ctx context.Context, page, limit int, tier, status string) ([]models.License, int, error)
 	GetLicenseStats(ctx context.Context) (*services.LicenseStats, error)
+	GetRevenueReport(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error)
+	GetTrialConversion(ctx context.Context, from, to time.Time) (*services.TrialConversion, error)
+	GetTierDistribution(ctx context.Context, from, to time.Time, interval string) ([]services.TierDistributionPoint, error)
 	RecordUsage(ctx context.Context, record services.UsageRecord) error
 	GetUsageStats(ctx context.Context, licenseID uuid.UUID, days int) ([]services.UsageRecord, error)
 }
 
 // LicenseHandler handles license endpoints
 type LicenseHandler struct {
-	licenseService LicenseServiceInterface
-	authService    *services.AuthService
+	licenseService  LicenseServiceInterface
+	authService     *services.AuthService
+	contractService *services.ContractService
 }
 
 // NewLicenseHandler creates a new license handler
@@ -53,6 +59,11 @@ func NewLicenseHandlerWithInterface(licenseService LicenseServiceInterface, auth
 	}
 }
 
+// SetContractService enables issuing licenses under a contract from AdminGenerate
+func (h *LicenseHandler) SetContractService(contractService *services.ContractService) {
+	h.contractService = contractService
+}
+
 // Validate handles license validation (called by CDC engines)
 func (h *LicenseHandler) Validate(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -373,12 +384,46 @@ func (h *LicenseHandler) AdminGenerate(w http.ResponseWriter, r *http.Request) {
 		Tier       string `json:"tier"`
 		ValidDays  int    `json:"valid_days"`
 		HardwareID string `json:"hardware_id"`
+		ContractID string `json:"contract_id"` // optional; the license follows the contract's terms
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
+	if req.ContractID != "" && h.contractService != nil {
+		contractID, err := uuid.Parse(req.ContractID)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid contract ID")
+			return
+		}
+		contract, err := h.contractService.GetContract(r.Context(), contractID)
+		if err == services.ErrContractNotFound {
+			respondError(w, http.StatusNotFound, "contract not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to get contract")
+			return
+		}
+		if req.UserID != "" && req.UserID != contract.UserID.String() {
+			respondError(w, http.StatusBadRequest, "contract belongs to a different user")
+			return
+		}
+
+		license, err := h.contractService.IssueLicense(r.Context(), contractID, req.HardwareID)
+		if err == services.ErrContractClosed || err == services.ErrContractNotStarted {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to create license: "+err.Error())
+			return
+		}
+		respondCreated(w, license)
+		return
+	}
+
 	userID, err := uuid.Parse(req.UserID)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "invalid user ID")
@@ -424,6 +469,108 @@ func (h *LicenseHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	respondSuccess(w, stats)
 }
 
+// parseAnalyticsRange reads the from/to (YYYY-MM-DD, both inclusive) and interval
+// query parameters. It defaults to the last 12 months by month.
+func parseAnalyticsRange(r *http.Request) (time.Time, time.Time, string, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to := today.AddDate(0, 0, 1)
+	if v := r.URL.Query().Get("to"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+		to = d.AddDate(0, 0, 1)
+	}
+
+	from := to.AddDate(-1, 0, 0)
+	if v := r.URL.Query().Get("from"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+		from = d
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	return from, to, interval, nil
+}
+
+// AdminRevenue returns MRR, ARR, churn and net revenue retention (admin only)
+func (h *LicenseHandler) AdminRevenue(w http.ResponseWriter, r *http.Request) {
+	from, to, interval, err := parseAnalyticsRange(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currency := strings.ToLower(r.URL.Query().Get("currency"))
+	if currency == "" {
+		currency = "usd"
+	}
+
+	report, err := h.licenseService.GetRevenueReport(r.Context(), from, to, interval, currency)
+	if errors.Is(err, services.ErrInvalidAnalyticsRange) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to get revenue report")
+		return
+	}
+
+	respondSuccess(w, report)
+}
+
+// AdminTrialConversion returns the trial-to-paid conversion of trials started in a range (admin only)
+func (h *LicenseHandler) AdminTrialConversion(w http.ResponseWriter, r *http.Request) {
+	from, to, _, err := parseAnalyticsRange(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversion, err := h.licenseService.GetTrialConversion(r.Context(), from, to)
+	if errors.Is(err, services.ErrInvalidAnalyticsRange) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to get trial conversion")
+		return
+	}
+
+	respondSuccess(w, conversion)
+}
+
+// AdminTierDistribution returns active licenses per tier over time (admin only)
+func (h *LicenseHandler) AdminTierDistribution(w http.ResponseWriter, r *http.Request) {
+	from, to, interval, err := parseAnalyticsRange(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	distribution, err := h.licenseService.GetTierDistribution(r.Context(), from, to, interval)
+	if errors.Is(err, services.ErrInvalidAnalyticsRange) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to get tier distribution")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"from":         from,
+		"to":           to,
+		"interval":     interval,
+		"distribution": distribution,
+	})
+}
+
 // RecordTelemetry records usage telemetry from CDC engines
 func (h *LicenseHandler) RecordTelemetry(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -28,6 +28,10 @@ type MockLicenseServiceForHandler struct {
 	RevokeLicenseFunc           func(ctx context.Context, licenseID uuid.UUID) error
 	GetLicenseActivationsFunc   func(ctx context.Context, licenseID uuid.UUID) ([]models.LicenseActivation, error)
 	GetAllLicensesPaginatedFunc func(ctx context.Context, page, limit int, tier, status string) ([]models.License, int, error)
+	GetLicenseStatsFunc         func(ctx context.Context) (*services.LicenseStats, error)
+	GetRevenueReportFunc        func(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error)
+	GetTrialConversionFunc      func(ctx context.Context, from, to time.Time) (*services.TrialConversion, error)
+	GetTierDistributionFunc     func(ctx context.Context, from, to time.Time, interval string) ([]services.TierDistributionPoint, error)
 }
 
 func (m *MockLicenseServiceForHandler) ValidateLicense(ctx context.Context, licenseID string, hardwareID string) (*models.License, error) {
@@ -87,6 +91,30 @@ func (m *MockLicenseServiceForHandler) GetAllLicensesPaginated(ctx context.Conte
 }
 
 func (m *MockLicenseServiceForHandler) GetLicenseStats(ctx context.Context) (*services.LicenseStats, error) {
+	if m.GetLicenseStatsFunc != nil {
+		return m.GetLicenseStatsFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *MockLicenseServiceForHandler) GetRevenueReport(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error) {
+	if m.GetRevenueReportFunc != nil {
+		return m.GetRevenueReportFunc(ctx, from, to, interval, currency)
+	}
+	return nil, nil
+}
+
+func (m *MockLicenseServiceForHandler) GetTrialConversion(ctx context.Context, from, to time.Time) (*services.TrialConversion, error) {
+	if m.GetTrialConversionFunc != nil {
+		return m.GetTrialConversionFunc(ctx, from, to)
+	}
+	return nil, nil
+}
+
+func (m *MockLicenseServiceForHandler) GetTierDistribution(ctx context.Context, from, to time.Time, interval string) ([]services.TierDistributionPoint, error) {
+	if m.GetTierDistributionFunc != nil {
+		return m.GetTierDistributionFunc(ctx, from, to, interval)
+	}
 	return nil, nil
 }
 
@@ -1294,3 +1322,164 @@ func TestLicenseHandler_InvalidJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestLicenseHandler_AdminRevenue(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockReport     func(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:  "explicit range and currency",
+			query: "?from=2025-01-01&to=2025-03-31&interval=week&currency=EUR",
+			mockReport: func(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error) {
+				if !from.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("unexpected from %v", from)
+				}
+				// to is inclusive in the API and exclusive in the service
+				if !to.Equal(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("unexpected to %v", to)
+				}
+				if interval != "week" || currency != "eur" {
+					t.Errorf("unexpected interval %q or currency %q", interval, currency)
+				}
+				return &services.RevenueReport{MRR: 9900, ARR: 118800}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "defaults to last 12 months by month in usd",
+			query: "",
+			mockReport: func(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error) {
+				if !from.Equal(to.AddDate(-1, 0, 0)) {
+					t.Errorf("expected a one year range, got %v - %v", from, to)
+				}
+				if interval != "month" || currency != "usd" {
+					t.Errorf("unexpected interval %q or currency %q", interval, currency)
+				}
+				return &services.RevenueReport{}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid date",
+			query:          "?from=01/01/2025",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid from date, expected YYYY-MM-DD",
+		},
+		{
+			name:  "invalid range",
+			query: "?from=2025-03-01&to=2025-01-01",
+			mockReport: func(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error) {
+				return nil, services.ErrInvalidAnalyticsRange
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid analytics range",
+		},
+		{
+			name:  "service error",
+			query: "",
+			mockReport: func(ctx context.Context, from, to time.Time, interval, currency string) (*services.RevenueReport, error) {
+				return nil, errors.New("database error")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "failed to get revenue report",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockLicenseServiceForHandler{GetRevenueReportFunc: tt.mockReport}
+			handler := NewLicenseHandlerWithInterface(mock, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/analytics/revenue"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			handler.AdminRevenue(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			if tt.expectedError != "" {
+				var response map[string]string
+				json.NewDecoder(rec.Body).Decode(&response)
+				if response["error"] != tt.expectedError {
+					t.Errorf("expected error %q, got %q", tt.expectedError, response["error"])
+				}
+			}
+		})
+	}
+}
+
+func TestLicenseHandler_AdminTrialConversion(t *testing.T) {
+	mock := &MockLicenseServiceForHandler{
+		GetTrialConversionFunc: func(ctx context.Context, from, to time.Time) (*services.TrialConversion, error) {
+			return &services.TrialConversion{From: from, To: to, Trials: 10, Converted: 3, ConversionRate: 30}, nil
+		},
+	}
+	handler := NewLicenseHandlerWithInterface(mock, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/analytics/trials?from=2025-01-01&to=2025-01-31", nil)
+	rec := httptest.NewRecorder()
+
+	handler.AdminTrialConversion(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response services.TrialConversion
+	json.NewDecoder(rec.Body).Decode(&response)
+	if response.Trials != 10 || response.Converted != 3 || response.ConversionRate != 30 {
+		t.Errorf("unexpected response %+v", response)
+	}
+}
+
+func TestLicenseHandler_AdminTierDistribution(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockTiers      func(ctx context.Context, from, to time.Time, interval string) ([]services.TierDistributionPoint, error)
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			mockTiers: func(ctx context.Context, from, to time.Time, interval string) ([]services.TierDistributionPoint, error) {
+				return []services.TierDistributionPoint{{Date: from, Tiers: map[string]int{"pro": 2}, Total: 2}}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "too many points",
+			mockTiers: func(ctx context.Context, from, to time.Time, interval string) ([]services.TierDistributionPoint, error) {
+				return nil, services.ErrInvalidAnalyticsRange
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "service error",
+			mockTiers: func(ctx context.Context, from, to time.Time, interval string) ([]services.TierDistributionPoint, error) {
+				return nil, errors.New("database error")
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockLicenseServiceForHandler{GetTierDistributionFunc: tt.mockTiers}
+			handler := NewLicenseHandlerWithInterface(mock, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/analytics/tiers?interval=day", nil)
+			rec := httptest.NewRecorder()
+
+			handler.AdminTierDistribution(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -15,8 +16,9 @@ import (
 
 // PipelineHandler handles pipeline endpoints
 type PipelineHandler struct {
-	pipelineService *services.PipelineService
-	licenseService  *services.LicenseService
+	pipelineService   *services.PipelineService
+	licenseService    *services.LicenseService
+	connectionService *services.ConnectionService
 }
 
 // NewPipelineHandler creates a new pipeline handler
@@ -27,6 +29,49 @@ func NewPipelineHandler(pipelineService *services.PipelineService, licenseServic
 	}
 }
 
+// SetConnectionService enables checking pipeline tables against the source
+func (h *PipelineHandler) SetConnectionService(connectionService *services.ConnectionService) {
+	h.connectionService = connectionService
+}
+
+// validateTables checks tables exist in the source connection. It responds
+// with an error and returns false when they don't.
+func (h *PipelineHandler) validateTables(w http.ResponseWriter, r *http.Request, userID, sourceConnID uuid.UUID, tables []string) bool {
+	if h.connectionService == nil {
+		return true
+	}
+	err := h.connectionService.ValidatePipelineTables(r.Context(), userID, sourceConnID, tables)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrInvalidPipelineTables):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err == services.ErrConnectionNotFound:
+		respondError(w, http.StatusBadRequest, "source connection not found")
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to validate tables")
+	}
+	return false
+}
+
+// checkTarget validates the target config of a pipeline against the schema
+// of its target type, and that the licenses include the feature the target
+// requires. It responds with an error and returns false when they don't;
+// otherwise it returns the target type, whose Name is what pipelines store.
+func checkTarget(w http.ResponseWriter, targetType string, config map[string]string, licenses []models.License) (services.TargetType, bool) {
+	target, err := services.CheckTarget(targetType, config, services.LicensedFeatures(licenses))
+	var notAllowed *services.TargetNotAllowedError
+	if errors.As(err, &notAllowed) {
+		respondError(w, http.StatusForbidden, err.Error())
+		return target, false
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return target, false
+	}
+	return target, true
+}
+
 // List returns all pipelines for the user
 func (h *PipelineHandler) List(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
@@ -65,14 +110,14 @@ func (h *PipelineHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name               string            `json:"name"`
-		Description        string            `json:"description"`
-		SourceConnectionID string            `json:"source_connection_id"`
-		TargetConnectionID string            `json:"target_connection_id"`
-		TargetType         string            `json:"target_type"`
-		TargetConfig       map[string]string `json:"target_config"`
-		Tables             []string          `json:"tables"`
-		LicenseID          string            `json:"license_id"`
+		Name               string                 `json:"name"`
+		Description        string                 `json:"description"`
+		SourceConnectionID string                 `json:"source_connection_id"`
+		TargetConnectionID string                 `json:"target_connection_id"`
+		TargetType         string                 `json:"target_type"`
+		TargetConfig       map[string]interface{} `json:"target_config"`
+		Tables             []string               `json:"tables"`
+		LicenseID          string                 `json:"license_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
@@ -90,12 +135,18 @@ func (h *PipelineHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	targetConfig, err := services.TargetConfigValues(req.TargetConfig)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	pipeline := &models.Pipeline{
 		Name:         req.Name,
 		Description:  req.Description,
 		SourceConnID: sourceConnID,
 		TargetType:   req.TargetType,
-		TargetConfig: req.TargetConfig,
+		TargetConfig: targetConfig,
 		Tables:       req.Tables,
 	}
 
@@ -117,28 +168,25 @@ func (h *PipelineHandler) Create(w http.ResponseWriter, r *http.Request) {
 		pipeline.LicenseID = &licenseID
 	}
 
-	// Check pipeline limit based on user's license
+	if !h.validateTables(w, r, userID, sourceConnID, pipeline.Tables) {
+		return
+	}
+
 	licenses, err := h.licenseService.GetUserLicenses(r.Context(), userID)
-	if err == nil && len(licenses) > 0 {
-		// Find best active license
-		var maxPipelines int = 1 // community default
-		for _, lic := range licenses {
-			if lic.Status == "active" {
-				switch lic.Tier {
-				case "enterprise":
-					maxPipelines = 999999 // unlimited
-				case "pro":
-					if maxPipelines < 10 {
-						maxPipelines = 10
-					}
-				case "trial":
-					if maxPipelines < 5 {
-						maxPipelines = 5
-					}
-				}
-			}
-		}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to check license")
+		return
+	}
+	target, ok := checkTarget(w, pipeline.TargetType, pipeline.TargetConfig, licenses)
+	if !ok {
+		return
+	}
+	// Aliases like webhook are stored under the name the engine knows
+	pipeline.TargetType = target.Name
 
+	// Check pipeline limit based on user's license
+	if len(licenses) > 0 {
+		maxPipelines := maxPipelinesForLicenses(licenses)
 		currentCount, _ := h.pipelineService.CountUserPipelines(r.Context(), userID)
 		if currentCount >= maxPipelines {
 			respondError(w, http.StatusForbidden, "pipeline limit reached for your plan")
@@ -155,6 +203,28 @@ func (h *PipelineHandler) Create(w http.ResponseWriter, r *http.Request) {
 	respondCreated(w, created)
 }
 
+// maxPipelinesForLicenses returns the pipelines the best active license allows
+func maxPipelinesForLicenses(licenses []models.License) int {
+	var maxPipelines int = 1 // community default
+	for _, lic := range licenses {
+		if lic.Status == "active" {
+			switch lic.Tier {
+			case "enterprise":
+				maxPipelines = 999999 // unlimited
+			case "pro":
+				if maxPipelines < 10 {
+					maxPipelines = 10
+				}
+			case "trial":
+				if maxPipelines < 5 {
+					maxPipelines = 5
+				}
+			}
+		}
+	}
+	return maxPipelines
+}
+
 // Get returns a specific pipeline
 func (h *PipelineHandler) Get(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
@@ -214,11 +284,83 @@ func (h *PipelineHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, hasTables := updates["tables"]
+	_, hasTargetType := updates["target_type"]
+	_, hasTargetConfig := updates["target_config"]
+	var existing *models.Pipeline
+	if hasTables || hasTargetType || hasTargetConfig {
+		existing, err = h.pipelineService.GetPipeline(r.Context(), userID, pipelineID)
+		if err == services.ErrPipelineNotFound {
+			respondError(w, http.StatusNotFound, "pipeline not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to update pipeline")
+			return
+		}
+	}
+
+	if hasTargetType || hasTargetConfig {
+		targetType, targetConfig := existing.TargetType, existing.TargetConfig
+		if hasTargetType {
+			if targetType, _ = updates["target_type"].(string); targetType == "" {
+				respondError(w, http.StatusBadRequest, "target_type must be a non-empty string")
+				return
+			}
+		}
+		if hasTargetConfig {
+			raw, ok := updates["target_config"].(map[string]interface{})
+			if !ok {
+				respondError(w, http.StatusBadRequest, "target_config must be an object")
+				return
+			}
+			if targetConfig, err = services.TargetConfigValues(raw); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		licenses, err := h.licenseService.GetUserLicenses(r.Context(), userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to check license")
+			return
+		}
+		target, ok := checkTarget(w, targetType, targetConfig, licenses)
+		if !ok {
+			return
+		}
+		if hasTargetType {
+			updates["target_type"] = target.Name
+		}
+	}
+
+	if raw, ok := updates["tables"]; ok {
+		list, ok := raw.([]interface{})
+		if !ok {
+			respondError(w, http.StatusBadRequest, "tables must be a list of table names")
+			return
+		}
+		tables := make([]string, len(list))
+		for i, t := range list {
+			if tables[i], ok = t.(string); !ok {
+				respondError(w, http.StatusBadRequest, "tables must be a list of table names")
+				return
+			}
+		}
+		if !h.validateTables(w, r, userID, existing.SourceConnID, tables) {
+			return
+		}
+	}
+
 	pipeline, err := h.pipelineService.UpdatePipeline(r.Context(), userID, pipelineID, updates)
 	if err == services.ErrPipelineNotFound {
 		respondError(w, http.StatusNotFound, "pipeline not found")
 		return
 	}
+	if errors.Is(err, services.ErrInvalidTargetConfig) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to update pipeline")
 		return
@@ -336,3 +478,41 @@ func (h *PipelineHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 
 	respondSuccess(w, map[string]interface{}{"logs": logs})
 }
+
+// targetTypeResponse is a target type with whether the user's plan includes it
+type targetTypeResponse struct {
+	services.TargetType
+	Available bool `json:"available"`
+}
+
+// ListTargets returns the target types pipelines can deliver to, with the
+// JSON Schema of their target_config
+func (h *PipelineHandler) ListTargets(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var licenses []models.License
+	if h.licenseService != nil {
+		licenses, err = h.licenseService.GetUserLicenses(r.Context(), userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to check license")
+			return
+		}
+	}
+
+	features := services.LicensedFeatures(licenses)
+	targets := make([]targetTypeResponse, 0, len(services.TargetTypes()))
+	for _, t := range services.TargetTypes() {
+		targets = append(targets, targetTypeResponse{TargetType: t, Available: t.Allowed(features)})
+	}
+	respondSuccess(w, map[string]interface{}{"targets": targets})
+}
@@ -1524,3 +1524,100 @@ func TestPipelineHandler_InvalidUserID(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckTarget(t *testing.T) {
+	pro := []models.License{{Status: "active", Tier: "pro", Features: []string{"kafka_output", "webhook"}, ExpiresAt: time.Now().Add(time.Hour)}}
+	expired := []models.License{{Status: "active", Tier: "pro", Features: []string{"kafka_output"}, ExpiresAt: time.Now().Add(-time.Hour)}}
+
+	tests := []struct {
+		name           string
+		targetType     string
+		config         map[string]string
+		licenses       []models.License
+		expectedStatus int
+		expectedError  string
+	}{
+		{"community target", "postgres", nil, nil, http.StatusOK, ""},
+		{"licensed target", "kafka", map[string]string{"brokers": "kafka:9092"}, pro, http.StatusOK, ""},
+		{"unlicensed target", "kafka", map[string]string{"brokers": "kafka:9092"}, nil, http.StatusForbidden,
+			"the Apache Kafka target requires a plan with the kafka_output feature"},
+		{"invalid config", "kafka", map[string]string{"brokers": "kafka"}, pro, http.StatusBadRequest,
+			"invalid target_config: brokers must be a comma-separated host:port list"},
+		{"expired license", "kafka", map[string]string{"brokers": "kafka:9092"}, expired, http.StatusForbidden,
+			"the Apache Kafka target requires a plan with the kafka_output feature"},
+		{"unknown target", "snowflake", nil, pro, http.StatusBadRequest, `unknown target_type "snowflake"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			_, ok := checkTarget(rec, tt.targetType, tt.config, tt.licenses)
+
+			if ok != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("expected ok %v, got %v", tt.expectedStatus == http.StatusOK, ok)
+			}
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedError != "" {
+				var response map[string]string
+				json.NewDecoder(rec.Body).Decode(&response)
+				if response["error"] != tt.expectedError {
+					t.Errorf("expected error %q, got %q", tt.expectedError, response["error"])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTarget_Alias(t *testing.T) {
+	pro := []models.License{{Status: "active", Tier: "pro", Features: []string{"webhook"}, ExpiresAt: time.Now().Add(time.Hour)}}
+	target, ok := checkTarget(httptest.NewRecorder(), "webhook", map[string]string{"url": "https://hooks.example.com"}, pro)
+	if !ok || target.Name != "http" {
+		t.Errorf("expected the webhook alias to resolve to http, got %q (ok %v)", target.Name, ok)
+	}
+}
+
+func TestPipelineHandler_ListTargets(t *testing.T) {
+	handler := NewPipelineHandler(nil, nil)
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ListTargets(rec, newRequestWithoutUser(http.MethodGet, "/api/v1/targets", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("describes every target", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ListTargets(rec, newRequestWithUser(http.MethodGet, "/api/v1/targets", nil, uuid.New()))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		var response struct {
+			Targets []struct {
+				Name      string                 `json:"name"`
+				Feature   string                 `json:"feature"`
+				Available bool                   `json:"available"`
+				Schema    map[string]interface{} `json:"schema"`
+			} `json:"targets"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(response.Targets) != len(services.TargetTypes()) {
+			t.Fatalf("expected %d targets, got %d", len(services.TargetTypes()), len(response.Targets))
+		}
+		for _, target := range response.Targets {
+			if target.Schema["type"] != "object" {
+				t.Errorf("%s: expected an object schema, got %v", target.Name, target.Schema["type"])
+			}
+			// Without a license only community targets are available
+			if target.Available != (target.Feature == "") {
+				t.Errorf("%s: expected available %v, got %v", target.Name, target.Feature == "", target.Available)
+			}
+		}
+	})
+}
@@ -2,17 +2,23 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/savegress/platform/backend/internal/metrics"
 	"github.com/savegress/platform/backend/internal/middleware"
 	"github.com/savegress/platform/backend/internal/services"
 )
 
 // TelemetryHandler handles telemetry endpoints
 type TelemetryHandler struct {
-	telemetryService *services.TelemetryService
-	licenseService   *services.LicenseService
+	telemetryService  *services.TelemetryService
+	licenseService    *services.LicenseService
+	connectionService *services.ConnectionService
 }
 
 // NewTelemetryHandler creates a new telemetry handler
@@ -23,22 +29,55 @@ func NewTelemetryHandler(telemetryService *services.TelemetryService, licenseSer
 	}
 }
 
+// SetConnectionService enables connection test results reported by engines
+func (h *TelemetryHandler) SetConnectionService(connectionService *services.ConnectionService) {
+	h.connectionService = connectionService
+}
+
+// maxTelemetryBodySize caps a single telemetry submission
+const maxTelemetryBodySize = 1 << 20
+
 // Receive accepts telemetry data from CDC engines
 func (h *TelemetryHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	// The signature covers the raw body, so read it before decoding
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTelemetryBodySize))
+	if err != nil {
+		respondError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
 	var input services.TelemetryInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+	if err := json.Unmarshal(body, &input); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	// Validate license exists
-	_, err := h.licenseService.ValidateLicense(r.Context(), input.LicenseID, input.HardwareID)
-	if err != nil {
-		// Still accept telemetry but don't fail
-		// This allows collecting data even for expired licenses
+	sig := services.TelemetrySignature{
+		Timestamp: r.Header.Get(services.TelemetryTimestampHeader),
+		Nonce:     r.Header.Get(services.TelemetryNonceHeader),
+		Signature: r.Header.Get(services.TelemetrySignatureHeader),
+	}
+	if err := h.telemetryService.VerifyTelemetry(r.Context(), input.LicenseID, input.HardwareID, sig, body); err != nil {
+		if !isTelemetryAuthError(err) {
+			respondError(w, http.StatusInternalServerError, "failed to verify telemetry")
+			return
+		}
+		h.quarantine(r, input, services.QuarantineReason(err), body)
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if _, err := h.licenseService.ValidateLicense(r.Context(), input.LicenseID, input.HardwareID); err != nil {
+		h.quarantine(r, input, services.QuarantineInvalidLicense, body)
+		respondError(w, http.StatusForbidden, err.Error())
+		return
 	}
 
 	if err := h.telemetryService.RecordTelemetry(r.Context(), input); err != nil {
+		if errors.Is(err, services.ErrInvalidTelemetry) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "failed to record telemetry")
 		return
 	}
@@ -46,6 +85,190 @@ func (h *TelemetryHandler) Receive(w http.ResponseWriter, r *http.Request) {
 	respondSuccess(w, map[string]string{"status": "recorded"})
 }
 
+// ReceiveConnectionTest accepts the result of a connection test an engine ran
+// for a connection whose password only the engine can resolve
+func (h *TelemetryHandler) ReceiveConnectionTest(w http.ResponseWriter, r *http.Request) {
+	if h.connectionService == nil {
+		respondError(w, http.StatusServiceUnavailable, "connection tests are not enabled")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTelemetryBodySize))
+	if err != nil {
+		respondError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	var input struct {
+		LicenseID  string `json:"license_id"`
+		HardwareID string `json:"hardware_id"`
+		services.EngineTestResult
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	sig := services.TelemetrySignature{
+		Timestamp: r.Header.Get(services.TelemetryTimestampHeader),
+		Nonce:     r.Header.Get(services.TelemetryNonceHeader),
+		Signature: r.Header.Get(services.TelemetrySignatureHeader),
+	}
+	if err := h.telemetryService.VerifyTelemetry(r.Context(), input.LicenseID, input.HardwareID, sig, body); err != nil {
+		if !isTelemetryAuthError(err) {
+			respondError(w, http.StatusInternalServerError, "failed to verify telemetry")
+			return
+		}
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	license, err := h.licenseService.ValidateLicense(r.Context(), input.LicenseID, input.HardwareID)
+	if err != nil {
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// Engines can only report on connections of their license's owner
+	err = h.connectionService.RecordEngineTest(r.Context(), license.UserID, &input.EngineTestResult)
+	if err == services.ErrConnectionNotFound {
+		respondError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to record connection test")
+		return
+	}
+
+	respondSuccess(w, map[string]string{"status": "recorded"})
+}
+
+// maxTelemetryBatchBodySize caps a compressed telemetry batch
+const maxTelemetryBatchBodySize = 8 << 20
+
+// ReceiveBatch accepts NDJSON telemetry batches, optionally gzip or zstd
+// compressed, from CDC engines. All samples must belong to the instance that
+// signs the batch; the signature covers the decompressed body.
+func (h *TelemetryHandler) ReceiveBatch(w http.ResponseWriter, r *http.Request) {
+	release, err := h.telemetryService.AcquireIngestSlot(r.Context())
+	if err == services.ErrTelemetryIngestBusy {
+		w.Header().Set("Retry-After", strconv.Itoa(int(services.TelemetryRetryAfter.Seconds())))
+		respondError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to record telemetry")
+		return
+	}
+	defer release()
+
+	body, err := services.DecodeTelemetryBody(http.MaxBytesReader(w, r.Body, maxTelemetryBatchBodySize), r.Header.Get("Content-Encoding"))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr), err == services.ErrTelemetryBatchTooLarge:
+			respondError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		case err == services.ErrUnsupportedContentEncoding:
+			respondError(w, http.StatusUnsupportedMediaType, "content encoding must be gzip, zstd or identity")
+		default:
+			respondError(w, http.StatusBadRequest, "invalid request body")
+		}
+		return
+	}
+
+	inputs, results, err := services.ParseTelemetryBatch(body)
+	if err == services.ErrTelemetryBatchTooLarge {
+		respondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch exceeds %d samples", services.MaxTelemetryBatchItems))
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The batch belongs to the instance of its first well-formed sample
+	var instance services.TelemetryInput
+	for i, item := range results {
+		if item.Accepted {
+			instance = inputs[i]
+			break
+		}
+	}
+	if instance.LicenseID == "" {
+		respondError(w, http.StatusBadRequest, "batch contains no valid samples")
+		return
+	}
+
+	sig := services.TelemetrySignature{
+		Timestamp: r.Header.Get(services.TelemetryTimestampHeader),
+		Nonce:     r.Header.Get(services.TelemetryNonceHeader),
+		Signature: r.Header.Get(services.TelemetrySignatureHeader),
+	}
+	if err := h.telemetryService.VerifyTelemetry(r.Context(), instance.LicenseID, instance.HardwareID, sig, body); err != nil {
+		if !isTelemetryAuthError(err) {
+			respondError(w, http.StatusInternalServerError, "failed to verify telemetry")
+			return
+		}
+		h.quarantine(r, instance, services.QuarantineReason(err), body)
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if _, err := h.licenseService.ValidateLicense(r.Context(), instance.LicenseID, instance.HardwareID); err != nil {
+		h.quarantine(r, instance, services.QuarantineInvalidLicense, body)
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	result, err := h.telemetryService.RecordTelemetryBatch(r.Context(), instance.LicenseID, instance.HardwareID, inputs, results)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to record telemetry")
+		return
+	}
+
+	respondSuccess(w, result)
+}
+
+func (h *TelemetryHandler) quarantine(r *http.Request, input services.TelemetryInput, reason string, body []byte) {
+	if err := h.telemetryService.QuarantineTelemetry(r.Context(), input.LicenseID, input.HardwareID, reason, body, getClientIP(r)); err != nil {
+		log.Printf("Failed to quarantine telemetry from license %s: %v", input.LicenseID, err)
+	}
+}
+
+func isTelemetryAuthError(err error) bool {
+	switch err {
+	case services.ErrTelemetryUnsigned, services.ErrTelemetrySignatureInvalid, services.ErrTelemetryStale,
+		services.ErrTelemetryReplayed, services.ErrTelemetryUnknownInstance:
+		return true
+	}
+	return false
+}
+
+// AdminListQuarantine lists telemetry submissions rejected as suspicious (admin only)
+func (h *TelemetryHandler) AdminListQuarantine(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	items, total, err := h.telemetryService.ListQuarantinedTelemetry(r.Context(), r.URL.Query().Get("reason"), limit, offset)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list quarantined telemetry")
+		return
+	}
+
+	respondSuccess(w, map[string]interface{}{
+		"items":  items,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
 // GetStats returns dashboard stats for user
 func (h *TelemetryHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
@@ -119,3 +342,21 @@ func (h *TelemetryHandler) GetInstances(w http.ResponseWriter, r *http.Request)
 
 	respondSuccess(w, map[string]interface{}{"instances": instances})
 }
+
+// Federate renders the latest telemetry of the API key owner's instances and
+// pipelines in the Prometheus exposition format
+func (h *TelemetryHandler) Federate(w http.ResponseWriter, r *http.Request) {
+	key := middleware.GetAPIKeyFromContext(r.Context())
+	if key == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	snapshot, err := h.telemetryService.FederationSnapshot(r.Context(), key.UserID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load telemetry")
+		return
+	}
+
+	metrics.AccountHandler(snapshot).ServeHTTP(w, r)
+}
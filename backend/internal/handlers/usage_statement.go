@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/savegress/platform/backend/internal/middleware"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+// UsageStatementHandler handles monthly usage statement endpoints
+type UsageStatementHandler struct {
+	statementService *services.UsageStatementService
+}
+
+// NewUsageStatementHandler creates a new usage statement handler
+func NewUsageStatementHandler(statementService *services.UsageStatementService) *UsageStatementHandler {
+	return &UsageStatementHandler{statementService: statementService}
+}
+
+// Get returns the usage statement for a YYYY-MM period as JSON, or as CSV with ?format=csv
+func (h *UsageStatementHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		respondError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	stmt, err := h.statementService.GetStatement(r.Context(), userID, chi.URLParam(r, "period"))
+	if err == services.ErrInvalidStatementPeriod {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to build usage statement")
+		return
+	}
+
+	filename := "savegress-usage-" + stmt.Period + "." + format
+	if format == "json" {
+		if r.URL.Query().Get("download") == "true" {
+			w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+		}
+		respondSuccess(w, stmt)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteUsageStatementCSV(&buf, stmt); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to render usage statement")
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// GetSettings returns whether monthly statements are emailed to the user
+func (h *UsageStatementHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	enabled, err := h.statementService.GetEmailEnabled(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to get usage statement settings")
+		return
+	}
+
+	respondSuccess(w, map[string]bool{"email_enabled": enabled})
+}
+
+// UpdateSettings turns monthly statement emails on or off
+func (h *UsageStatementHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	userID, err := claims.GetUserUUID()
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	var req struct {
+		EmailEnabled bool `json:"email_enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.statementService.SetEmailEnabled(r.Context(), userID, req.EmailEnabled); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to update usage statement settings")
+		return
+	}
+
+	respondSuccess(w, map[string]bool{"email_enabled": req.EmailEnabled})
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// EngineInstance is the latest telemetry of one of a customer's engine instances
+type EngineInstance struct {
+	LicenseID    string
+	HardwareID   string
+	Hostname     string
+	Version      string
+	SourceType   string
+	Online       bool
+	LastSeenAt   time.Time
+	LastReportAt *time.Time // nil when the instance hasn't reported recently
+
+	// Values of the latest report; counters are deltas since the previous one
+	EventsProcessed int64
+	BytesProcessed  int64
+	ErrorCount      int64
+	AvgLatencyMs    float64
+	UptimeHours     float64
+	TablesTracked   int
+	SourcesActive   int
+}
+
+// EnginePipeline is the state of one of a customer's pipelines
+type EnginePipeline struct {
+	PipelineID string
+	Name       string
+	Status     string
+	LicenseID  string
+	HardwareID string
+
+	// Cumulative totals
+	EventsProcessed int64
+	BytesProcessed  int64
+
+	LagMs        int64
+	LastEventAt  *time.Time
+	LastReportAt *time.Time
+	ErrorCount   int64 // errors in the latest report
+	AvgLatencyMs float64
+}
+
+// AccountSnapshot is everything the federation endpoint exports for one account
+type AccountSnapshot struct {
+	Instances []EngineInstance
+	Pipelines []EnginePipeline
+}
+
+var (
+	instanceLabels = []string{"license", "instance", "hostname", "version", "source_type"}
+	pipelineLabels = []string{"pipeline", "name"}
+
+	engineUpDesc            = newEngineDesc("engine_up", "1 if the instance was seen in the last 5 minutes.", instanceLabels)
+	engineLastSeenDesc      = newEngineDesc("engine_last_seen_timestamp_seconds", "When the instance last contacted the platform.", instanceLabels)
+	engineLastReportDesc    = newEngineDesc("engine_last_report_timestamp_seconds", "When the instance last reported telemetry.", instanceLabels)
+	engineReportEventsDesc  = newEngineDesc("engine_report_events", "Events processed in the latest report interval.", instanceLabels)
+	engineReportBytesDesc   = newEngineDesc("engine_report_bytes", "Bytes processed in the latest report interval.", instanceLabels)
+	engineReportErrorsDesc  = newEngineDesc("engine_report_errors", "Errors in the latest report interval.", instanceLabels)
+	engineLatencyDesc       = newEngineDesc("engine_avg_latency_milliseconds", "Average replication latency in the latest report.", instanceLabels)
+	engineUptimeDesc        = newEngineDesc("engine_uptime_seconds", "Instance uptime at the latest report.", instanceLabels)
+	engineTablesDesc        = newEngineDesc("engine_tables_tracked", "Tables tracked by the instance.", instanceLabels)
+	engineSourcesDesc       = newEngineDesc("engine_sources_active", "Active sources on the instance.", instanceLabels)
+	pipelineInfoDesc        = newEngineDesc("pipeline_info", "Pipeline metadata; always 1.", []string{"pipeline", "name", "status", "license", "instance"})
+	pipelineEventsDesc      = newEngineDesc("pipeline_events_total", "Events processed by the pipeline.", pipelineLabels)
+	pipelineBytesDesc       = newEngineDesc("pipeline_bytes_total", "Bytes processed by the pipeline.", pipelineLabels)
+	pipelineLagDesc         = newEngineDesc("pipeline_lag_milliseconds", "Replication lag of the pipeline.", pipelineLabels)
+	pipelineLastEventDesc   = newEngineDesc("pipeline_last_event_timestamp_seconds", "When the pipeline last processed an event.", pipelineLabels)
+	pipelineLastReportDesc  = newEngineDesc("pipeline_last_report_timestamp_seconds", "When the pipeline last reported telemetry.", pipelineLabels)
+	pipelineReportErrorDesc = newEngineDesc("pipeline_report_errors", "Errors in the pipeline's latest report interval.", pipelineLabels)
+	pipelineLatencyDesc     = newEngineDesc("pipeline_avg_latency_milliseconds", "Average latency in the pipeline's latest report.", pipelineLabels)
+)
+
+func newEngineDesc(name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(namespace+"_"+name, help, labels, nil)
+}
+
+// accountCollector exports a fixed snapshot
+type accountCollector struct {
+	snapshot *AccountSnapshot
+}
+
+func (c accountCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c accountCollector) Collect(ch chan<- prometheus.Metric) {
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+
+	for _, in := range c.snapshot.Instances {
+		labels := []string{in.LicenseID, in.HardwareID, in.Hostname, in.Version, in.SourceType}
+		up := 0.0
+		if in.Online {
+			up = 1
+		}
+		gauge(engineUpDesc, up, labels...)
+		gauge(engineLastSeenDesc, unixSeconds(in.LastSeenAt), labels...)
+		if in.LastReportAt == nil {
+			continue
+		}
+		gauge(engineLastReportDesc, unixSeconds(*in.LastReportAt), labels...)
+		gauge(engineReportEventsDesc, float64(in.EventsProcessed), labels...)
+		gauge(engineReportBytesDesc, float64(in.BytesProcessed), labels...)
+		gauge(engineReportErrorsDesc, float64(in.ErrorCount), labels...)
+		gauge(engineLatencyDesc, in.AvgLatencyMs, labels...)
+		gauge(engineUptimeDesc, in.UptimeHours*3600, labels...)
+		gauge(engineTablesDesc, float64(in.TablesTracked), labels...)
+		gauge(engineSourcesDesc, float64(in.SourcesActive), labels...)
+	}
+
+	for _, p := range c.snapshot.Pipelines {
+		labels := []string{p.PipelineID, p.Name}
+		gauge(pipelineInfoDesc, 1, p.PipelineID, p.Name, p.Status, p.LicenseID, p.HardwareID)
+		ch <- prometheus.MustNewConstMetric(pipelineEventsDesc, prometheus.CounterValue, float64(p.EventsProcessed), labels...)
+		ch <- prometheus.MustNewConstMetric(pipelineBytesDesc, prometheus.CounterValue, float64(p.BytesProcessed), labels...)
+		gauge(pipelineLagDesc, float64(p.LagMs), labels...)
+		if p.LastEventAt != nil {
+			gauge(pipelineLastEventDesc, unixSeconds(*p.LastEventAt), labels...)
+		}
+		if p.LastReportAt != nil {
+			gauge(pipelineLastReportDesc, unixSeconds(*p.LastReportAt), labels...)
+			gauge(pipelineReportErrorDesc, float64(p.ErrorCount), labels...)
+			gauge(pipelineLatencyDesc, p.AvgLatencyMs, labels...)
+		}
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// AccountHandler serves an account snapshot in the Prometheus exposition format
+func AccountHandler(snapshot *AccountSnapshot) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(accountCollector{snapshot: snapshot})
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountHandler(t *testing.T) {
+	seen := time.Unix(1700000000, 0)
+	report := time.Unix(1700000060, 0)
+
+	snapshot := &AccountSnapshot{
+		Instances: []EngineInstance{
+			{LicenseID: "l1", HardwareID: "hw1", Hostname: "db-1", Version: "1.4.0", SourceType: "postgres",
+				Online: true, LastSeenAt: seen, LastReportAt: &report, EventsProcessed: 1200, UptimeHours: 2},
+			{LicenseID: "l1", HardwareID: "hw2", Hostname: "db-2", LastSeenAt: seen},
+		},
+		Pipelines: []EnginePipeline{
+			{PipelineID: "p1", Name: "orders", Status: "running", LicenseID: "l1", HardwareID: "hw1",
+				EventsProcessed: 5000, BytesProcessed: 1 << 20, LagMs: 250, LastReportAt: &report, ErrorCount: 3},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	AccountHandler(snapshot).ServeHTTP(rec, httptest.NewRequest("GET", "/federate", nil))
+	require.Equal(t, 200, rec.Code)
+	body, _ := io.ReadAll(rec.Body)
+	out := string(body)
+
+	assert.Contains(t, out, `savegress_engine_up{hostname="db-1",instance="hw1",license="l1",source_type="postgres",version="1.4.0"} 1`)
+	assert.Contains(t, out, `savegress_engine_up{hostname="db-2",instance="hw2",license="l1",source_type="",version=""} 0`)
+	assert.Contains(t, out, `savegress_engine_report_events{hostname="db-1",instance="hw1",license="l1",source_type="postgres",version="1.4.0"} 1200`)
+	assert.Contains(t, out, `savegress_engine_uptime_seconds{hostname="db-1",instance="hw1",license="l1",source_type="postgres",version="1.4.0"} 7200`)
+	assert.NotContains(t, out, `savegress_engine_report_events{hostname="db-2"`)
+
+	assert.Contains(t, out, `savegress_pipeline_info{instance="hw1",license="l1",name="orders",pipeline="p1",status="running"} 1`)
+	assert.Contains(t, out, "# TYPE savegress_pipeline_events_total counter")
+	assert.Contains(t, out, `savegress_pipeline_events_total{name="orders",pipeline="p1"} 5000`)
+	assert.Contains(t, out, `savegress_pipeline_lag_milliseconds{name="orders",pipeline="p1"} 250`)
+	assert.Contains(t, out, `savegress_pipeline_report_errors{name="orders",pipeline="p1"} 3`)
+	assert.NotContains(t, out, "savegress_pipeline_last_event_timestamp_seconds")
+}
+
+func TestAccountHandler_Empty(t *testing.T) {
+	rec := httptest.NewRecorder()
+	AccountHandler(&AccountSnapshot{}).ServeHTTP(rec, httptest.NewRequest("GET", "/federate", nil))
+	assert.Equal(t, 200, rec.Code)
+}
@@ -0,0 +1,189 @@
+// Package metrics defines the Prometheus metrics the platform exports on /metrics.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "savegress"
+
+// Registry holds every metric served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequestDuration is the latency of API requests by chi route pattern
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route pattern and status code.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route", "status"})
+
+	// WebhookEvents counts processed payment webhooks by outcome
+	WebhookEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_total",
+		Help:      "Payment provider webhooks received, by provider and outcome.",
+	}, []string{"provider", "outcome"})
+
+	// EmailsSent counts email deliveries by provider and result
+	EmailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_sent_total",
+		Help:      "Emails handed to the email provider, by provider and result.",
+	}, []string{"provider", "result"})
+)
+
+// Webhook outcomes
+const (
+	WebhookProcessed        = "processed"
+	WebhookFailed           = "failed"
+	WebhookIgnored          = "ignored"
+	WebhookInvalidSignature = "invalid_signature"
+	WebhookMalformed        = "malformed"
+)
+
+// Email results
+const (
+	EmailSent   = "sent"
+	EmailFailed = "failed"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		WebhookEvents,
+		EmailsSent,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// --- Database pool ---
+
+var (
+	dbMaxConnsDesc      = prometheus.NewDesc(namespace+"_db_pool_max_connections", "Maximum size of the database pool.", nil, nil)
+	dbTotalConnsDesc    = prometheus.NewDesc(namespace+"_db_pool_total_connections", "Connections currently in the database pool.", nil, nil)
+	dbIdleConnsDesc     = prometheus.NewDesc(namespace+"_db_pool_idle_connections", "Idle connections in the database pool.", nil, nil)
+	dbAcquiredConnsDesc = prometheus.NewDesc(namespace+"_db_pool_acquired_connections", "Connections currently checked out of the database pool.", nil, nil)
+	dbAcquiresDesc      = prometheus.NewDesc(namespace+"_db_pool_acquires_total", "Successful connection acquisitions from the database pool.", nil, nil)
+	dbEmptyAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total", "Acquisitions that had to wait for a connection.", nil, nil)
+	dbAcquireWaitDesc   = prometheus.NewDesc(namespace+"_db_pool_acquire_wait_seconds_total", "Total time spent acquiring connections.", nil, nil)
+)
+
+// PoolCollector exports database pool statistics at scrape time
+type PoolCollector struct {
+	stat func() *pgxpool.Stat
+}
+
+// NewPoolCollector creates a collector reading pool stats from stat
+func NewPoolCollector(stat func() *pgxpool.Stat) *PoolCollector {
+	return &PoolCollector{stat: stat}
+}
+
+// Describe implements prometheus.Collector
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxConnsDesc
+	ch <- dbTotalConnsDesc
+	ch <- dbIdleConnsDesc
+	ch <- dbAcquiredConnsDesc
+	ch <- dbAcquiresDesc
+	ch <- dbEmptyAcquiresDesc
+	ch <- dbAcquireWaitDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stat()
+	ch <- prometheus.MustNewConstMetric(dbMaxConnsDesc, prometheus.GaugeValue, float64(stats.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(dbTotalConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(dbIdleConnsDesc, prometheus.GaugeValue, float64(stats.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(dbAcquiredConnsDesc, prometheus.GaugeValue, float64(stats.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(dbAcquiresDesc, prometheus.CounterValue, float64(stats.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbEmptyAcquiresDesc, prometheus.CounterValue, float64(stats.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbAcquireWaitDesc, prometheus.CounterValue, stats.AcquireDuration().Seconds())
+}
+
+// --- Fleet ---
+
+// FleetStat is the state of one customer license's instances
+type FleetStat struct {
+	UserID          string
+	LicenseID       string
+	Tier            string
+	OnlineInstances int
+	ActiveInstances int
+	LastTelemetryAt *time.Time
+}
+
+// FleetSource loads fleet stats for all customers
+type FleetSource func(ctx context.Context) ([]FleetStat, error)
+
+var (
+	fleetLabels           = []string{"customer", "license", "tier"}
+	fleetOnlineDesc       = prometheus.NewDesc(namespace+"_fleet_instances_online", "Instances seen in the last 5 minutes.", fleetLabels, nil)
+	fleetActiveDesc       = prometheus.NewDesc(namespace+"_fleet_instances_active", "Activated instances.", fleetLabels, nil)
+	fleetTelemetryAgeDesc = prometheus.NewDesc(namespace+"_fleet_last_telemetry_age_seconds", "Seconds since the license last reported telemetry.", fleetLabels, nil)
+	fleetScrapeErrorDesc  = prometheus.NewDesc(namespace+"_fleet_scrape_error", "1 if loading fleet stats failed during this scrape.", nil, nil)
+)
+
+// fleetScrapeTimeout bounds the fleet query so a slow database can't stall scrapes
+const fleetScrapeTimeout = 5 * time.Second
+
+// FleetCollector exports per-customer fleet gauges, queried at scrape time
+type FleetCollector struct {
+	source FleetSource
+	now    func() time.Time
+}
+
+// NewFleetCollector creates a collector reading fleet stats from source
+func NewFleetCollector(source FleetSource) *FleetCollector {
+	return &FleetCollector{source: source, now: time.Now}
+}
+
+// Describe implements prometheus.Collector
+func (c *FleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fleetOnlineDesc
+	ch <- fleetActiveDesc
+	ch <- fleetTelemetryAgeDesc
+	ch <- fleetScrapeErrorDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *FleetCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), fleetScrapeTimeout)
+	defer cancel()
+
+	stats, err := c.source(ctx)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(fleetScrapeErrorDesc, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(fleetScrapeErrorDesc, prometheus.GaugeValue, 0)
+
+	now := c.now()
+	for _, s := range stats {
+		labels := []string{s.UserID, s.LicenseID, s.Tier}
+		ch <- prometheus.MustNewConstMetric(fleetOnlineDesc, prometheus.GaugeValue, float64(s.OnlineInstances), labels...)
+		ch <- prometheus.MustNewConstMetric(fleetActiveDesc, prometheus.GaugeValue, float64(s.ActiveInstances), labels...)
+		if s.LastTelemetryAt != nil {
+			age := now.Sub(*s.LastTelemetryAt).Seconds()
+			if age < 0 {
+				age = 0
+			}
+			ch <- prometheus.MustNewConstMetric(fleetTelemetryAgeDesc, prometheus.GaugeValue, age, labels...)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFleetCollector(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	last := now.Add(-90 * time.Second)
+
+	c := NewFleetCollector(func(ctx context.Context) ([]FleetStat, error) {
+		return []FleetStat{
+			{UserID: "u1", LicenseID: "l1", Tier: "pro", OnlineInstances: 2, ActiveInstances: 3, LastTelemetryAt: &last},
+			{UserID: "u2", LicenseID: "l2", Tier: "community", ActiveInstances: 1},
+		}, nil
+	})
+	c.now = func() time.Time { return now }
+
+	expected := `
+# HELP savegress_fleet_instances_online Instances seen in the last 5 minutes.
+# TYPE savegress_fleet_instances_online gauge
+savegress_fleet_instances_online{customer="u1",license="l1",tier="pro"} 2
+savegress_fleet_instances_online{customer="u2",license="l2",tier="community"} 0
+# HELP savegress_fleet_last_telemetry_age_seconds Seconds since the license last reported telemetry.
+# TYPE savegress_fleet_last_telemetry_age_seconds gauge
+savegress_fleet_last_telemetry_age_seconds{customer="u1",license="l1",tier="pro"} 90
+# HELP savegress_fleet_scrape_error 1 if loading fleet stats failed during this scrape.
+# TYPE savegress_fleet_scrape_error gauge
+savegress_fleet_scrape_error 0
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"savegress_fleet_instances_online", "savegress_fleet_last_telemetry_age_seconds", "savegress_fleet_scrape_error"))
+}
+
+func TestFleetCollector_SourceError(t *testing.T) {
+	c := NewFleetCollector(func(ctx context.Context) ([]FleetStat, error) {
+		return nil, errors.New("database unavailable")
+	})
+
+	expected := `
+# HELP savegress_fleet_scrape_error 1 if loading fleet stats failed during this scrape.
+# TYPE savegress_fleet_scrape_error gauge
+savegress_fleet_scrape_error 1
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
+
+func TestRegistryGathers(t *testing.T) {
+	WebhookEvents.WithLabelValues("stripe", WebhookProcessed).Inc()
+	EmailsSent.WithLabelValues("noop", EmailSent).Inc()
+
+	families, err := Registry.Gather()
+	require.NoError(t, err)
+
+	names := make(map[string]bool)
+	for _, f := range families {
+		names[f.GetName()] = true
+	}
+	assert.True(t, names["savegress_webhook_events_total"])
+	assert.True(t, names["savegress_emails_sent_total"])
+	assert.True(t, names["go_goroutines"])
+}
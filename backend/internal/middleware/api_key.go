@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/services"
+)
+
+const APIKeyContextKey contextKey = "api_key"
+
+// APIKeyAuth middleware authenticates requests with an account API key that grants scope
+func APIKeyAuth(apiKeyService *services.APIKeyService, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || raw == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				http.Error(w, `{"error": "missing API key"}`, http.StatusUnauthorized)
+				return
+			}
+
+			key, err := apiKeyService.Authenticate(r.Context(), raw, scope)
+			if err == services.ErrAPIKeyScope {
+				http.Error(w, `{"error": "API key lacks the required scope"}`, http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, `{"error": "invalid or revoked API key"}`, http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), APIKeyContextKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetAPIKeyFromContext returns the API key the request authenticated with
+func GetAPIKeyFromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(APIKeyContextKey).(*models.APIKey)
+	return key
+}
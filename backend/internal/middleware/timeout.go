@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// TimeoutExcept is chi's Timeout middleware for every path except the given
+// long-lived ones, such as event streams
+func TimeoutExcept(timeout time.Duration, paths ...string) func(http.Handler) http.Handler {
+	exempt := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		exempt[p] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		timed := chimiddleware.Timeout(timeout)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timed.ServeHTTP(w, r)
+		})
+	}
+}
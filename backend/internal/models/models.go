@@ -15,12 +15,26 @@ type User struct {
 	Company        string     `json:"company,omitempty" db:"company"`
 	Role           string     `json:"role" db:"role"` // user, admin
 	EmailVerified  bool       `json:"email_verified" db:"email_verified"`
-	StripeCustomerID string   `json:"-" db:"stripe_customer_id"`
+	StripeCustomerID string   `json:"-" db:"stripe_customer_id"` // customer ID at the payment provider
+	PaymentProvider  string   `json:"payment_provider" db:"payment_provider"` // stripe, manual
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
 	LastLoginAt    *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
 }
 
+// APIKey is a long-lived credential for machine access to an account
+type APIKey struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	KeyPrefix  string     `json:"key_prefix" db:"key_prefix"` // first characters of the key, for identification
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
 // License represents a software license
 type License struct {
 	ID           uuid.UUID  `json:"id" db:"id"`
@@ -51,12 +65,15 @@ type LicenseActivation struct {
 	ActivatedAt time.Time  `json:"activated_at" db:"activated_at"`
 	LastSeenAt  time.Time  `json:"last_seen_at" db:"last_seen_at"`
 	DeactivatedAt *time.Time `json:"deactivated_at,omitempty" db:"deactivated_at"`
+	// TelemetrySecret is only returned to the instance when it activates
+	TelemetrySecret string `json:"telemetry_secret,omitempty" db:"telemetry_secret"`
 }
 
-// Subscription represents a Stripe subscription
+// Subscription represents a paid subscription with a payment provider
 type Subscription struct {
 	ID                  uuid.UUID  `json:"id" db:"id"`
 	UserID              uuid.UUID  `json:"user_id" db:"user_id"`
+	PaymentProvider     string     `json:"payment_provider" db:"payment_provider"`
 	StripeSubscriptionID string    `json:"stripe_subscription_id" db:"stripe_subscription_id"`
 	StripePriceID       string     `json:"stripe_price_id" db:"stripe_price_id"`
 	Status              string     `json:"status" db:"status"` // active, past_due, canceled, trialing
@@ -90,6 +107,10 @@ type Invoice struct {
 	ID              uuid.UUID  `json:"id" db:"id"`
 	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
 	StripeInvoiceID string     `json:"stripe_invoice_id" db:"stripe_invoice_id"`
+	PaymentProvider string     `json:"payment_provider" db:"payment_provider"`
+	Plan            string     `json:"plan,omitempty" db:"plan"` // plan granted when paid (manual invoices)
+	Subtotal        int64      `json:"subtotal" db:"subtotal"` // in cents, before tax
+	Tax             int64      `json:"tax" db:"tax"`           // in cents
 	Amount          int64      `json:"amount" db:"amount"` // in cents
 	Currency        string     `json:"currency" db:"currency"`
 	Status          string     `json:"status" db:"status"` // draft, open, paid, void, uncollectible
@@ -97,9 +118,67 @@ type Invoice struct {
 	InvoicePDF      string     `json:"invoice_pdf" db:"invoice_pdf"`
 	PeriodStart     time.Time  `json:"period_start" db:"period_start"`
 	PeriodEnd       time.Time  `json:"period_end" db:"period_end"`
+	LineItems       []InvoiceLineItem `json:"line_items" db:"line_items"`
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 }
 
+// InvoiceLineItem represents a single line on an invoice
+type InvoiceLineItem struct {
+	Description string     `json:"description"`
+	Quantity    int64      `json:"quantity"`
+	UnitAmount  int64      `json:"unit_amount"` // in cents, excluding tax
+	Amount      int64      `json:"amount"`      // in cents, excluding tax
+	Tax         int64      `json:"tax"`         // in cents
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+}
+
+// BillingProfile represents the legal entity invoices are issued to
+type BillingProfile struct {
+	UserID        uuid.UUID `json:"user_id" db:"user_id"`
+	LegalName     string    `json:"legal_name" db:"legal_name"`
+	AddressLine1  string    `json:"address_line1" db:"address_line1"`
+	AddressLine2  string    `json:"address_line2" db:"address_line2"`
+	City          string    `json:"city" db:"city"`
+	State         string    `json:"state" db:"state"`
+	PostalCode    string    `json:"postal_code" db:"postal_code"`
+	Country       string    `json:"country" db:"country"` // ISO 3166-1 alpha-2
+	TaxIDs        []TaxID   `json:"tax_ids" db:"tax_ids"`
+	InvoiceEmails []string  `json:"invoice_emails" db:"invoice_emails"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TaxID represents a tax registration number attached to a billing profile
+type TaxID struct {
+	Type    string `json:"type"` // Stripe tax ID type, e.g. eu_vat, gb_vat, us_ein
+	Value   string `json:"value"`
+	Country string `json:"country,omitempty"`
+}
+
+// Contract represents an enterprise agreement signed outside the payment providers.
+// Licenses attached to a contract follow its dates and committed limits.
+type Contract struct {
+	ID            uuid.UUID   `json:"id" db:"id"`
+	UserID        uuid.UUID   `json:"user_id" db:"user_id"`
+	Name          string      `json:"name" db:"name"`
+	PONumber      string      `json:"po_number,omitempty" db:"po_number"`
+	Tier          string      `json:"tier" db:"tier"`     // pro, enterprise
+	Status        string      `json:"status" db:"status"` // pending, active, expired, terminated
+	StartDate     time.Time   `json:"start_date" db:"start_date"`
+	EndDate       time.Time   `json:"end_date" db:"end_date"`
+	MaxSources    int         `json:"max_sources" db:"max_sources"` // 0 = tier default
+	MaxTables     int         `json:"max_tables" db:"max_tables"`
+	MaxThroughput int64       `json:"max_throughput" db:"max_throughput"`
+	ContractValue int64       `json:"contract_value" db:"contract_value"` // in cents
+	Currency      string      `json:"currency" db:"currency"`
+	AutoRenew     bool        `json:"auto_renew" db:"auto_renew"`
+	Notes         string      `json:"notes,omitempty" db:"notes"`
+	LicenseIDs    []uuid.UUID `json:"license_ids" db:"-"`
+	CreatedBy     *uuid.UUID  `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at" db:"updated_at"`
+}
+
 // PasswordReset stores password reset tokens
 type PasswordReset struct {
 	ID        uuid.UUID `json:"id" db:"id"`
@@ -130,15 +209,61 @@ type Connection struct {
 	Port         int               `json:"port" db:"port"`
 	Database     string            `json:"database" db:"database"`
 	Username     string            `json:"username" db:"username"`
-	Password     string            `json:"-" db:"password"` // encrypted
+	Password     string            `json:"-" db:"password"`                          // encrypted
+	PasswordRef  string            `json:"password_ref,omitempty" db:"password_ref"` // resolved by the engine instead
 	SSLMode      string            `json:"ssl_mode" db:"ssl_mode"`
 	Options      map[string]string `json:"options,omitempty" db:"options"`
+	SSHTunnel    *SSHTunnel        `json:"ssh_tunnel,omitempty"` // bastion the database is reached through
+	TLS          *ConnectionTLS    `json:"tls,omitempty"`        // CA bundle and client certificate
 	LastTestedAt *time.Time        `json:"last_tested_at,omitempty" db:"last_tested_at"`
 	TestStatus   string            `json:"test_status,omitempty" db:"test_status"` // success, failed, pending
+	TestError    string            `json:"test_error,omitempty" db:"test_error"`
 	CreatedAt    time.Time         `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time         `json:"updated_at" db:"updated_at"`
 }
 
+// SSHTunnel is an SSH bastion a connection is reached through
+type SSHTunnel struct {
+	Host               string `json:"host" db:"ssh_host"`
+	Port               int    `json:"port" db:"ssh_port"`
+	User               string `json:"user" db:"ssh_user"`
+	PrivateKey         string `json:"-" db:"ssh_private_key"`                             // encrypted
+	HostKeyFingerprint string `json:"host_key_fingerprint" db:"ssh_host_key_fingerprint"` // SHA256:...
+}
+
+// ConnectionTLS is the certificate material of a connection: a CA bundle the
+// server is verified with and a client certificate for mutual TLS. The PEM
+// material is encrypted at rest and never returned.
+type ConnectionTLS struct {
+	CACert        string            `json:"-" db:"tls_ca_cert"`
+	ClientCert    string            `json:"-" db:"tls_client_cert"`
+	ClientKey     string            `json:"-" db:"tls_client_key"`
+	Certificates  []CertificateInfo `json:"certificates" db:"tls_certificates"`
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty" db:"tls_expires_at"` // of the first certificate to expire
+	ExpiryWarning string            `json:"expiry_warning,omitempty"`
+}
+
+// CertificateInfo describes an uploaded certificate
+type CertificateInfo struct {
+	Usage     string    `json:"usage"` // ca or client
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// ConnectionTest is one test of a connection in its health history
+type ConnectionTest struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	ConnectionID uuid.UUID `json:"connection_id" db:"connection_id"`
+	Status       string    `json:"status" db:"status"`   // success or failed
+	Trigger      string    `json:"trigger" db:"trigger"` // manual, scheduled or engine
+	LatencyMs    *int64    `json:"latency_ms,omitempty" db:"latency_ms"`
+	Category     string    `json:"category,omitempty" db:"category"` // error category of a failed test
+	Message      string    `json:"message,omitempty" db:"message"`
+	TestedAt     time.Time `json:"tested_at" db:"tested_at"`
+}
+
 // Pipeline represents a CDC replication pipeline configuration
 type Pipeline struct {
 	ID               uuid.UUID  `json:"id" db:"id"`
@@ -178,3 +303,84 @@ type PipelineLog struct {
 	Details    map[string]interface{} `json:"details,omitempty" db:"details"`
 	Timestamp  time.Time `json:"timestamp" db:"timestamp"`
 }
+
+// AlertChannel is a destination for alert notifications
+type AlertChannel struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	Type      string    `json:"type" db:"type"`     // email, webhook, slack
+	Target    string    `json:"target" db:"target"` // email address or webhook URL
+	Secret    string    `json:"-" db:"secret"`      // signs generic webhook payloads
+	HasSecret bool      `json:"has_secret" db:"-"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// AlertRule fires when a metric of a pipeline, instance or license crosses a
+// threshold for at least Duration seconds
+type AlertRule struct {
+	ID              uuid.UUID   `json:"id" db:"id"`
+	UserID          uuid.UUID   `json:"user_id" db:"user_id"`
+	Name            string      `json:"name" db:"name"`
+	Scope           string      `json:"scope" db:"scope"`                 // pipeline, instance, license
+	ScopeID         *string     `json:"scope_id,omitempty" db:"scope_id"` // nil matches every subject in scope
+	Metric          string      `json:"metric" db:"metric"`
+	Operator        string      `json:"operator" db:"operator"` // gt, gte, lt, lte
+	Threshold       float64     `json:"threshold" db:"threshold"`
+	DurationSeconds int         `json:"duration_seconds" db:"duration_seconds"`
+	ChannelIDs      []uuid.UUID `json:"channel_ids" db:"channel_ids"`
+	Enabled         bool        `json:"enabled" db:"enabled"`
+	CreatedAt       time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// Alert is the state of an alert rule for one subject
+type Alert struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	RuleID      uuid.UUID  `json:"rule_id" db:"rule_id"`
+	RuleName    string     `json:"rule_name" db:"-"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Subject     string     `json:"subject" db:"subject"`
+	SubjectName string     `json:"subject_name" db:"subject_name"`
+	Status      string     `json:"status" db:"status"` // pending, firing, resolved
+	Value       float64    `json:"value" db:"value"`
+	StartedAt   time.Time  `json:"started_at" db:"started_at"`
+	FiredAt     *time.Time `json:"fired_at,omitempty" db:"fired_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// PipelineAnomaly is a deviation of a pipeline's telemetry from its seasonal baseline
+type PipelineAnomaly struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	PipelineID   uuid.UUID  `json:"pipeline_id" db:"pipeline_id"`
+	PipelineName string     `json:"pipeline_name" db:"-"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	Kind         string     `json:"kind" db:"kind"`     // throughput_drop, latency_spike, error_rate_jump
+	Status       string     `json:"status" db:"status"` // open, resolved
+	Observed     float64    `json:"observed" db:"observed"`
+	Expected     float64    `json:"expected" db:"expected"`
+	StdDev       float64    `json:"stddev" db:"stddev"`
+	Score        float64    `json:"score" db:"score"`
+	DetectedAt   time.Time  `json:"detected_at" db:"detected_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+}
+
+// ReleaseAdvisory marks an engine release as deprecated or affected by a security issue
+type ReleaseAdvisory struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	Product     string     `json:"product" db:"product"`
+	Version     string     `json:"version" db:"version"`
+	Kind        string     `json:"kind" db:"kind"`         // deprecated, security
+	Severity    string     `json:"severity" db:"severity"` // low, medium, high, critical
+	Title       string     `json:"title" db:"title"`
+	Description string     `json:"description,omitempty" db:"description"`
+	URL         string     `json:"url,omitempty" db:"url"`
+	FixedIn     string     `json:"fixed_in,omitempty" db:"fixed_in"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
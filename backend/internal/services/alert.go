@@ -0,0 +1,882 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var (
+	ErrAlertRuleNotFound    = errors.New("alert rule not found")
+	ErrAlertChannelNotFound = errors.New("alert channel not found")
+	ErrInvalidAlertRule     = errors.New("invalid alert rule")
+	ErrInvalidAlertChannel  = errors.New("invalid alert channel")
+)
+
+// Alert rule scopes
+const (
+	AlertScopePipeline = "pipeline"
+	AlertScopeInstance = "instance"
+	AlertScopeLicense  = "license"
+)
+
+// Alert statuses
+const (
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert channel types
+const (
+	AlertChannelEmail   = "email"
+	AlertChannelWebhook = "webhook"
+	AlertChannelSlack   = "slack"
+)
+
+const (
+	maxAlertRuleDuration = 24 * time.Hour
+	maxAlertRuleChannels = 10
+)
+
+// AlertMetric describes a metric alert rules can watch
+type AlertMetric struct {
+	Name        string `json:"name"`
+	Scope       string `json:"scope"`
+	Unit        string `json:"unit"`
+	Description string `json:"description"`
+
+	// query returns (subject, subject name, value) rows for a user ($1)
+	query string
+}
+
+// Rate and error metrics are computed over the last five minutes of telemetry
+var alertMetrics = []AlertMetric{
+	{Name: "lag_ms", Scope: AlertScopePipeline, Unit: "ms", Description: "Replication lag reported by the engine",
+		query: `SELECT id::text, name, current_lag_ms::float8 FROM pipelines WHERE user_id = $1 AND status = 'running'`},
+	{Name: "failed", Scope: AlertScopePipeline, Unit: "bool", Description: "1 while the pipeline is in the error state",
+		query: `SELECT id::text, name, CASE WHEN status = 'error' THEN 1 ELSE 0 END::float8 FROM pipelines WHERE user_id = $1`},
+	{Name: "error_count", Scope: AlertScopePipeline, Unit: "errors", Description: "Errors in the last 5 minutes",
+		query: `SELECT p.id::text, p.name, COALESCE(SUM(t.error_count), 0)::float8
+			FROM pipelines p
+			LEFT JOIN telemetry t ON t.pipeline_id = p.id AND t.timestamp > NOW() - INTERVAL '5 minutes'
+			WHERE p.user_id = $1 GROUP BY p.id, p.name`},
+	{Name: "events_per_min", Scope: AlertScopePipeline, Unit: "events/min", Description: "Events per minute over the last 5 minutes",
+		query: `SELECT p.id::text, p.name, COALESCE(SUM(t.events_processed), 0)::float8 / 5
+			FROM pipelines p
+			LEFT JOIN telemetry t ON t.pipeline_id = p.id AND t.timestamp > NOW() - INTERVAL '5 minutes'
+			WHERE p.user_id = $1 AND p.status = 'running' GROUP BY p.id, p.name`},
+	{Name: "anomaly_score", Scope: AlertScopePipeline, Unit: "σ", Description: "Largest deviation from the seasonal baseline among open anomalies, 0 when none",
+		query: `SELECT p.id::text, p.name, COALESCE(MAX(ABS(a.score)), 0)::float8
+			FROM pipelines p
+			LEFT JOIN pipeline_anomalies a ON a.pipeline_id = p.id AND a.status = 'open'
+			WHERE p.user_id = $1 GROUP BY p.id, p.name`},
+
+	{Name: "offline_minutes", Scope: AlertScopeInstance, Unit: "min", Description: "Minutes since the instance was last seen",
+		query: `SELECT a.license_id::text || '/' || a.hardware_id, COALESCE(NULLIF(a.hostname, ''), a.hardware_id),
+				EXTRACT(EPOCH FROM NOW() - MAX(a.last_seen_at))::float8 / 60
+			FROM license_activations a JOIN licenses l ON a.license_id = l.id
+			WHERE l.user_id = $1 AND a.deactivated_at IS NULL
+			GROUP BY a.license_id, a.hardware_id, a.hostname`},
+	{Name: "error_count", Scope: AlertScopeInstance, Unit: "errors", Description: "Errors in the last 5 minutes",
+		query: instanceTelemetryMetricQuery("COALESCE(SUM(t.error_count), 0)::float8")},
+	{Name: "events_per_min", Scope: AlertScopeInstance, Unit: "events/min", Description: "Events per minute over the last 5 minutes",
+		query: instanceTelemetryMetricQuery("COALESCE(SUM(t.events_processed), 0)::float8 / 5")},
+	{Name: "avg_latency_ms", Scope: AlertScopeInstance, Unit: "ms", Description: "Average latency over the last 5 minutes",
+		query: instanceTelemetryMetricQuery("COALESCE(AVG(t.avg_latency_ms), 0)::float8")},
+
+	{Name: "error_count", Scope: AlertScopeLicense, Unit: "errors", Description: "Errors in the last 5 minutes across all instances",
+		query: licenseTelemetryMetricQuery("COALESCE(SUM(t.error_count), 0)::float8")},
+	{Name: "events_per_min", Scope: AlertScopeLicense, Unit: "events/min", Description: "Events per minute across all instances",
+		query: licenseTelemetryMetricQuery("COALESCE(SUM(t.events_processed), 0)::float8 / 5")},
+	{Name: "online_instances", Scope: AlertScopeLicense, Unit: "instances", Description: "Instances seen in the last 5 minutes",
+		query: `SELECT l.id::text, l.tier || ' license', COUNT(a.id)::float8
+			FROM licenses l
+			LEFT JOIN license_activations a ON a.license_id = l.id AND a.deactivated_at IS NULL
+				AND a.last_seen_at > NOW() - INTERVAL '5 minutes'
+			WHERE l.user_id = $1 AND l.status = 'active' GROUP BY l.id, l.tier`},
+	{Name: "days_to_expiry", Scope: AlertScopeLicense, Unit: "days", Description: "Days until the license expires",
+		query: `SELECT id::text, tier || ' license', EXTRACT(EPOCH FROM expires_at - NOW())::float8 / 86400
+			FROM licenses WHERE user_id = $1 AND status = 'active'`},
+}
+
+func instanceTelemetryMetricQuery(value string) string {
+	return `SELECT a.license_id::text || '/' || a.hardware_id, COALESCE(NULLIF(MAX(a.hostname), ''), a.hardware_id), ` + value + `
+		FROM license_activations a
+		JOIN licenses l ON a.license_id = l.id
+		LEFT JOIN telemetry t ON t.license_id = a.license_id AND t.hardware_id = a.hardware_id
+			AND t.pipeline_id IS NULL AND t.timestamp > NOW() - INTERVAL '5 minutes'
+		WHERE l.user_id = $1 AND a.deactivated_at IS NULL
+		GROUP BY a.license_id, a.hardware_id`
+}
+
+func licenseTelemetryMetricQuery(value string) string {
+	return `SELECT l.id::text, l.tier || ' license', ` + value + `
+		FROM licenses l
+		LEFT JOIN telemetry t ON t.license_id = l.id
+			AND t.pipeline_id IS NULL AND t.timestamp > NOW() - INTERVAL '5 minutes'
+		WHERE l.user_id = $1 AND l.status = 'active'
+		GROUP BY l.id, l.tier`
+}
+
+// AlertMetrics returns the metrics alert rules can watch
+func AlertMetrics() []AlertMetric {
+	return alertMetrics
+}
+
+func findAlertMetric(scope, name string) (AlertMetric, bool) {
+	for _, m := range alertMetrics {
+		if m.Scope == scope && m.Name == name {
+			return m, true
+		}
+	}
+	return AlertMetric{}, false
+}
+
+// alertSample is the current value of a metric for one subject
+type alertSample struct {
+	Subject string
+	Name    string
+	Value   float64
+}
+
+// AlertService manages alert rules and channels and evaluates rules against telemetry
+type AlertService struct {
+	db           *repository.PostgresDB
+	emailService *EmailService
+	httpClient   *http.Client
+}
+
+// NewAlertService creates a new alert service
+func NewAlertService(db *repository.PostgresDB, emailService *EmailService) *AlertService {
+	return &AlertService{
+		db:           db,
+		emailService: emailService,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			// Hostnames are checked again at dial time, against the address
+			// they resolved to, so DNS can't point a webhook at a private network
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout: 5 * time.Second,
+					Control: webhookDialControl,
+				}).DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConnsPerHost: 2,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 3 {
+					return errors.New("too many redirects")
+				}
+				return validateWebhookURL(req.URL.String())
+			},
+		},
+	}
+}
+
+// ValidateAlertRule normalizes a rule and checks it against the metric catalogue
+func ValidateAlertRule(r *models.AlertRule) error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Scope = strings.ToLower(strings.TrimSpace(r.Scope))
+	r.Metric = strings.ToLower(strings.TrimSpace(r.Metric))
+	r.Operator = strings.ToLower(strings.TrimSpace(r.Operator))
+	if r.ScopeID != nil {
+		id := strings.TrimSpace(*r.ScopeID)
+		r.ScopeID = &id
+		if id == "" {
+			r.ScopeID = nil
+		}
+	}
+	if r.ChannelIDs == nil {
+		r.ChannelIDs = []uuid.UUID{}
+	}
+
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAlertRule)
+	}
+	if r.Scope != AlertScopePipeline && r.Scope != AlertScopeInstance && r.Scope != AlertScopeLicense {
+		return fmt.Errorf("%w: scope must be pipeline, instance or license", ErrInvalidAlertRule)
+	}
+	if _, ok := findAlertMetric(r.Scope, r.Metric); !ok {
+		return fmt.Errorf("%w: unknown %s metric %q", ErrInvalidAlertRule, r.Scope, r.Metric)
+	}
+	if _, ok := alertOperators[r.Operator]; !ok {
+		return fmt.Errorf("%w: operator must be gt, gte, lt or lte", ErrInvalidAlertRule)
+	}
+	if r.DurationSeconds < 0 || time.Duration(r.DurationSeconds)*time.Second > maxAlertRuleDuration {
+		return fmt.Errorf("%w: duration_seconds must be between 0 and %d", ErrInvalidAlertRule, int(maxAlertRuleDuration.Seconds()))
+	}
+	if len(r.ChannelIDs) > maxAlertRuleChannels {
+		return fmt.Errorf("%w: at most %d channels per rule", ErrInvalidAlertRule, maxAlertRuleChannels)
+	}
+
+	if r.ScopeID != nil {
+		switch r.Scope {
+		case AlertScopePipeline, AlertScopeLicense:
+			if _, err := uuid.Parse(*r.ScopeID); err != nil {
+				return fmt.Errorf("%w: scope_id must be a %s ID", ErrInvalidAlertRule, r.Scope)
+			}
+		case AlertScopeInstance:
+			licenseID, hardwareID, ok := strings.Cut(*r.ScopeID, "/")
+			if _, err := uuid.Parse(licenseID); !ok || err != nil || hardwareID == "" {
+				return fmt.Errorf("%w: instance scope_id must be <license_id>/<hardware_id>", ErrInvalidAlertRule)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateAlertChannel normalizes a channel and checks its target
+func ValidateAlertChannel(c *models.AlertChannel) error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	c.Target = strings.TrimSpace(c.Target)
+
+	if c.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAlertChannel)
+	}
+	switch c.Type {
+	case AlertChannelEmail:
+		addr, err := mail.ParseAddress(c.Target)
+		if err != nil {
+			return fmt.Errorf("%w: target must be an email address", ErrInvalidAlertChannel)
+		}
+		c.Target = addr.Address
+	case AlertChannelWebhook, AlertChannelSlack:
+		if err := validateWebhookURL(c.Target); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAlertChannel, err)
+		}
+	default:
+		return fmt.Errorf("%w: type must be email, webhook or slack", ErrInvalidAlertChannel)
+	}
+	return nil
+}
+
+// validateWebhookURL accepts http(s) URLs that don't point at this host or a private network
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return errors.New("target must be an http(s) URL")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+		return errors.New("target must be a public URL")
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return errors.New("target must be a public URL")
+	}
+	return nil
+}
+
+// cgnatNet is the carrier-grade NAT range, shared address space that is not
+// publicly routable
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is a publicly routable unicast address. IPv4
+// addresses mapped into IPv6 are judged as IPv4.
+func publicIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnatNet.Contains(ip))
+}
+
+// webhookDialControl refuses connections to addresses that are not public
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return fmt.Errorf("webhook target %s is not a public address", host)
+	}
+	return nil
+}
+
+var alertOperators = map[string]string{
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// alertBreached reports whether value crosses the rule's threshold
+func alertBreached(operator string, value, threshold float64) bool {
+	switch operator {
+	case "gt":
+		return value > threshold
+	case "gte":
+		return value >= threshold
+	case "lt":
+		return value < threshold
+	case "lte":
+		return value <= threshold
+	}
+	return false
+}
+
+// alertAction is a state transition of an alert
+type alertAction int
+
+const (
+	alertNoop alertAction = iota
+	alertStartPending
+	alertFire
+	alertRefresh
+	alertResolve
+	alertDiscard
+)
+
+// nextAlertAction decides the transition of a rule for one subject. open is the
+// subject's pending or firing alert, if any. A breach must last for the rule's
+// duration before firing; a pending alert whose breach ends is discarded silently.
+func nextAlertAction(open *models.Alert, breached bool, duration time.Duration, now time.Time) alertAction {
+	switch {
+	case open == nil && !breached:
+		return alertNoop
+	case open == nil:
+		if duration <= 0 {
+			return alertFire
+		}
+		return alertStartPending
+	case !breached && open.Status == AlertFiring:
+		return alertResolve
+	case !breached:
+		return alertDiscard
+	case open.Status == AlertPending && now.Sub(open.StartedAt) >= duration:
+		return alertFire
+	default:
+		return alertRefresh
+	}
+}
+
+// matchesScope reports whether a subject is covered by a rule
+func matchesScope(rule *models.AlertRule, subject string) bool {
+	return rule.ScopeID == nil || *rule.ScopeID == subject
+}
+
+// --- Rules ---
+
+const alertRuleColumns = `id, user_id, name, scope, scope_id, metric, operator, threshold, duration_seconds,
+	channel_ids, enabled, created_at, updated_at`
+
+func scanAlertRule(row pgx.Row) (*models.AlertRule, error) {
+	var r models.AlertRule
+	err := row.Scan(&r.ID, &r.UserID, &r.Name, &r.Scope, &r.ScopeID, &r.Metric, &r.Operator, &r.Threshold,
+		&r.DurationSeconds, &r.ChannelIDs, &r.Enabled, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// checkChannelsOwned verifies every channel of a rule belongs to the rule's user
+func (s *AlertService) checkChannelsOwned(ctx context.Context, userID uuid.UUID, channelIDs []uuid.UUID) error {
+	if len(channelIDs) == 0 {
+		return nil
+	}
+	var count int
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT COUNT(DISTINCT id) FROM alert_channels WHERE user_id = $1 AND id = ANY($2)
+	`, userID, channelIDs).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != len(uniqueUUIDs(channelIDs)) {
+		return ErrAlertChannelNotFound
+	}
+	return nil
+}
+
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// CreateRule creates an alert rule
+func (s *AlertService) CreateRule(ctx context.Context, rule *models.AlertRule) (*models.AlertRule, error) {
+	if err := ValidateAlertRule(rule); err != nil {
+		return nil, err
+	}
+	rule.ChannelIDs = uniqueUUIDs(rule.ChannelIDs)
+	if err := s.checkChannelsOwned(ctx, rule.UserID, rule.ChannelIDs); err != nil {
+		return nil, err
+	}
+
+	return scanAlertRule(s.db.Pool().QueryRow(ctx, `
+		INSERT INTO alert_rules (user_id, name, scope, scope_id, metric, operator, threshold, duration_seconds, channel_ids, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+alertRuleColumns,
+		rule.UserID, rule.Name, rule.Scope, rule.ScopeID, rule.Metric, rule.Operator, rule.Threshold,
+		rule.DurationSeconds, rule.ChannelIDs, rule.Enabled))
+}
+
+// GetRule returns one of a user's alert rules
+func (s *AlertService) GetRule(ctx context.Context, userID, ruleID uuid.UUID) (*models.AlertRule, error) {
+	rule, err := scanAlertRule(s.db.Pool().QueryRow(ctx, `
+		SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = $1 AND user_id = $2
+	`, ruleID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAlertRuleNotFound
+	}
+	return rule, err
+}
+
+// ListRules returns a user's alert rules
+func (s *AlertService) ListRules(ctx context.Context, userID uuid.UUID) ([]*models.AlertRule, error) {
+	return s.queryRules(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules WHERE user_id = $1 ORDER BY name`, userID)
+}
+
+func (s *AlertService) queryRules(ctx context.Context, query string, args ...interface{}) ([]*models.AlertRule, error) {
+	rows, err := s.db.Pool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]*models.AlertRule, 0)
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// UpdateRule replaces the settings of an alert rule. Open alerts of the rule
+// are discarded so they are re-evaluated against the new condition.
+func (s *AlertService) UpdateRule(ctx context.Context, rule *models.AlertRule) (*models.AlertRule, error) {
+	if err := ValidateAlertRule(rule); err != nil {
+		return nil, err
+	}
+	rule.ChannelIDs = uniqueUUIDs(rule.ChannelIDs)
+	if err := s.checkChannelsOwned(ctx, rule.UserID, rule.ChannelIDs); err != nil {
+		return nil, err
+	}
+
+	updated, err := scanAlertRule(s.db.Pool().QueryRow(ctx, `
+		UPDATE alert_rules SET name = $1, scope = $2, scope_id = $3, metric = $4, operator = $5, threshold = $6,
+			duration_seconds = $7, channel_ids = $8, enabled = $9
+		WHERE id = $10 AND user_id = $11
+		RETURNING `+alertRuleColumns,
+		rule.Name, rule.Scope, rule.ScopeID, rule.Metric, rule.Operator, rule.Threshold,
+		rule.DurationSeconds, rule.ChannelIDs, rule.Enabled, rule.ID, rule.UserID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAlertRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Pool().Exec(ctx, `DELETE FROM alerts WHERE rule_id = $1 AND status = $2`, rule.ID, AlertPending)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.Pool().Exec(ctx, `
+		UPDATE alerts SET status = $1, resolved_at = NOW(), updated_at = NOW() WHERE rule_id = $2 AND status = $3
+	`, AlertResolved, rule.ID, AlertFiring)
+	return updated, err
+}
+
+// DeleteRule deletes an alert rule and its alerts
+func (s *AlertService) DeleteRule(ctx context.Context, userID, ruleID uuid.UUID) error {
+	result, err := s.db.Pool().Exec(ctx, `DELETE FROM alert_rules WHERE id = $1 AND user_id = $2`, ruleID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAlertRuleNotFound
+	}
+	return nil
+}
+
+// --- Channels ---
+
+const alertChannelColumns = `id, user_id, name, type, target, COALESCE(secret, ''), enabled, created_at, updated_at`
+
+func scanAlertChannel(row pgx.Row) (*models.AlertChannel, error) {
+	var c models.AlertChannel
+	if err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.Type, &c.Target, &c.Secret, &c.Enabled, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.HasSecret = c.Secret != ""
+	return &c, nil
+}
+
+// CreateChannel creates an alert notification channel
+func (s *AlertService) CreateChannel(ctx context.Context, channel *models.AlertChannel) (*models.AlertChannel, error) {
+	if err := ValidateAlertChannel(channel); err != nil {
+		return nil, err
+	}
+	return scanAlertChannel(s.db.Pool().QueryRow(ctx, `
+		INSERT INTO alert_channels (user_id, name, type, target, secret, enabled)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING `+alertChannelColumns,
+		channel.UserID, channel.Name, channel.Type, channel.Target, channel.Secret, channel.Enabled))
+}
+
+// GetChannel returns one of a user's alert channels
+func (s *AlertService) GetChannel(ctx context.Context, userID, channelID uuid.UUID) (*models.AlertChannel, error) {
+	channel, err := scanAlertChannel(s.db.Pool().QueryRow(ctx, `
+		SELECT `+alertChannelColumns+` FROM alert_channels WHERE id = $1 AND user_id = $2
+	`, channelID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAlertChannelNotFound
+	}
+	return channel, err
+}
+
+// ListChannels returns a user's alert channels
+func (s *AlertService) ListChannels(ctx context.Context, userID uuid.UUID) ([]*models.AlertChannel, error) {
+	return s.queryChannels(ctx, `SELECT `+alertChannelColumns+` FROM alert_channels WHERE user_id = $1 ORDER BY name`, userID)
+}
+
+func (s *AlertService) queryChannels(ctx context.Context, query string, args ...interface{}) ([]*models.AlertChannel, error) {
+	rows, err := s.db.Pool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := make([]*models.AlertChannel, 0)
+	for rows.Next() {
+		channel, err := scanAlertChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
+// UpdateChannel replaces the settings of an alert channel
+func (s *AlertService) UpdateChannel(ctx context.Context, channel *models.AlertChannel) (*models.AlertChannel, error) {
+	if err := ValidateAlertChannel(channel); err != nil {
+		return nil, err
+	}
+	updated, err := scanAlertChannel(s.db.Pool().QueryRow(ctx, `
+		UPDATE alert_channels SET name = $1, type = $2, target = $3, secret = NULLIF($4, ''), enabled = $5
+		WHERE id = $6 AND user_id = $7
+		RETURNING `+alertChannelColumns,
+		channel.Name, channel.Type, channel.Target, channel.Secret, channel.Enabled, channel.ID, channel.UserID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAlertChannelNotFound
+	}
+	return updated, err
+}
+
+// DeleteChannel deletes an alert channel and removes it from the user's rules
+func (s *AlertService) DeleteChannel(ctx context.Context, userID, channelID uuid.UUID) error {
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `DELETE FROM alert_channels WHERE id = $1 AND user_id = $2`, channelID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAlertChannelNotFound
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE alert_rules SET channel_ids = array_remove(channel_ids, $1) WHERE user_id = $2 AND $1 = ANY(channel_ids)
+	`, channelID, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// TestChannel sends a test notification through a channel
+func (s *AlertService) TestChannel(ctx context.Context, userID, channelID uuid.UUID) error {
+	channel, err := s.GetChannel(ctx, userID, channelID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	return s.sendNotification(ctx, channel, &AlertNotification{
+		Status: AlertFiring,
+		Test:   true,
+		Rule: &models.AlertRule{
+			Name:      "Test notification",
+			Scope:     AlertScopePipeline,
+			Metric:    "lag_ms",
+			Operator:  "gt",
+			Threshold: 60000,
+		},
+		Alert: &models.Alert{
+			Subject:     "test",
+			SubjectName: "example-pipeline",
+			Status:      AlertFiring,
+			Value:       90000,
+			StartedAt:   now,
+			FiredAt:     &now,
+		},
+	})
+}
+
+// --- Alerts ---
+
+// ListAlerts returns a user's alerts, newest first, optionally filtered by status
+func (s *AlertService) ListAlerts(ctx context.Context, userID uuid.UUID, status string, limit int) ([]*models.Alert, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT a.id, a.rule_id, r.name, a.user_id, a.subject, a.subject_name, a.status, a.value,
+			a.started_at, a.fired_at, a.resolved_at, a.updated_at
+		FROM alerts a
+		JOIN alert_rules r ON a.rule_id = r.id
+		WHERE a.user_id = $1 AND ($2 = '' OR a.status = $2)
+		ORDER BY a.started_at DESC
+		LIMIT $3
+	`, userID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]*models.Alert, 0)
+	for rows.Next() {
+		var a models.Alert
+		if err := rows.Scan(&a.ID, &a.RuleID, &a.RuleName, &a.UserID, &a.Subject, &a.SubjectName, &a.Status,
+			&a.Value, &a.StartedAt, &a.FiredAt, &a.ResolvedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &a)
+	}
+	return alerts, rows.Err()
+}
+
+// openAlerts returns the pending and firing alerts of a rule by subject
+func (s *AlertService) openAlerts(ctx context.Context, ruleID uuid.UUID) (map[string]*models.Alert, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT id, rule_id, user_id, subject, subject_name, status, value, started_at, fired_at, resolved_at, updated_at
+		FROM alerts WHERE rule_id = $1 AND status IN ('pending', 'firing')
+	`, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	open := make(map[string]*models.Alert)
+	for rows.Next() {
+		var a models.Alert
+		if err := rows.Scan(&a.ID, &a.RuleID, &a.UserID, &a.Subject, &a.SubjectName, &a.Status, &a.Value,
+			&a.StartedAt, &a.FiredAt, &a.ResolvedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		open[a.Subject] = &a
+	}
+	return open, rows.Err()
+}
+
+// metricSamples returns the current value of a metric for every subject of a user
+func (s *AlertService) metricSamples(ctx context.Context, userID uuid.UUID, metric AlertMetric) ([]alertSample, error) {
+	rows, err := s.db.Pool().Query(ctx, metric.query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []alertSample
+	for rows.Next() {
+		var sample alertSample
+		if err := rows.Scan(&sample.Subject, &sample.Name, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// EvaluateRules evaluates every enabled alert rule once
+func (s *AlertService) EvaluateRules(ctx context.Context) error {
+	rules, err := s.queryRules(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules WHERE enabled = true ORDER BY user_id`)
+	if err != nil {
+		return err
+	}
+
+	// Rules of the same user often watch the same metric
+	samples := make(map[string][]alertSample)
+	for _, rule := range rules {
+		metric, ok := findAlertMetric(rule.Scope, rule.Metric)
+		if !ok {
+			continue
+		}
+
+		key := rule.UserID.String() + "/" + rule.Scope + "/" + rule.Metric
+		if _, ok := samples[key]; !ok {
+			values, err := s.metricSamples(ctx, rule.UserID, metric)
+			if err != nil {
+				log.Printf("Failed to read %s %s for user %s: %v", rule.Scope, rule.Metric, rule.UserID, err)
+				continue
+			}
+			samples[key] = values
+		}
+
+		if err := s.evaluateRule(ctx, rule, samples[key], time.Now().UTC()); err != nil {
+			log.Printf("Failed to evaluate alert rule %s: %v", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// evaluateRule applies the transitions of one rule for all of its subjects
+func (s *AlertService) evaluateRule(ctx context.Context, rule *models.AlertRule, samples []alertSample, now time.Time) error {
+	open, err := s.openAlerts(ctx, rule.ID)
+	if err != nil {
+		return err
+	}
+	duration := time.Duration(rule.DurationSeconds) * time.Second
+
+	seen := make(map[string]bool)
+	for _, sample := range samples {
+		if !matchesScope(rule, sample.Subject) {
+			continue
+		}
+		seen[sample.Subject] = true
+		breached := alertBreached(rule.Operator, sample.Value, rule.Threshold)
+		action := nextAlertAction(open[sample.Subject], breached, duration, now)
+		if err := s.applyAlertAction(ctx, rule, open[sample.Subject], sample, action, now); err != nil {
+			return err
+		}
+	}
+
+	// Subjects that disappeared (deleted pipeline, deactivated instance) no longer breach
+	subjects := make([]string, 0, len(open))
+	for subject := range open {
+		if !seen[subject] {
+			subjects = append(subjects, subject)
+		}
+	}
+	sort.Strings(subjects)
+	for _, subject := range subjects {
+		alert := open[subject]
+		sample := alertSample{Subject: subject, Name: alert.SubjectName, Value: alert.Value}
+		if err := s.applyAlertAction(ctx, rule, alert, sample, nextAlertAction(alert, false, duration, now), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AlertService) applyAlertAction(ctx context.Context, rule *models.AlertRule, open *models.Alert, sample alertSample, action alertAction, now time.Time) error {
+	name := truncate(sample.Name, 255)
+
+	switch action {
+	case alertStartPending:
+		_, err := s.db.Pool().Exec(ctx, `
+			INSERT INTO alerts (rule_id, user_id, subject, subject_name, status, value, started_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+			ON CONFLICT (rule_id, subject) WHERE status IN ('pending', 'firing') DO NOTHING
+		`, rule.ID, rule.UserID, sample.Subject, name, AlertPending, sample.Value, now)
+		return err
+
+	case alertFire:
+		alert := &models.Alert{
+			RuleID: rule.ID, UserID: rule.UserID, Subject: sample.Subject, SubjectName: name,
+			Status: AlertFiring, Value: sample.Value, StartedAt: now, FiredAt: &now, UpdatedAt: now,
+		}
+		// Every replica evaluates the rules; only the one whose write moves
+		// the alert notifies
+		claimed := true
+		if open == nil {
+			err := s.db.Pool().QueryRow(ctx, `
+				INSERT INTO alerts (rule_id, user_id, subject, subject_name, status, value, started_at, fired_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $7)
+				ON CONFLICT (rule_id, subject) WHERE status IN ('pending', 'firing') DO NOTHING
+				RETURNING id
+			`, rule.ID, rule.UserID, sample.Subject, name, AlertFiring, sample.Value, now).Scan(&alert.ID)
+			if err == pgx.ErrNoRows {
+				claimed = false
+			} else if err != nil {
+				return err
+			}
+		} else {
+			alert.ID, alert.StartedAt = open.ID, open.StartedAt
+			result, err := s.db.Pool().Exec(ctx, `
+				UPDATE alerts SET status = $1, value = $2, subject_name = $3, fired_at = $4, updated_at = $4
+				WHERE id = $5 AND status = 'pending'
+			`, AlertFiring, sample.Value, name, now, open.ID)
+			if err != nil {
+				return err
+			}
+			claimed = result.RowsAffected() == 1
+		}
+		if claimed {
+			s.notify(ctx, rule, alert)
+		}
+		return nil
+
+	case alertResolve:
+		result, err := s.db.Pool().Exec(ctx, `
+			UPDATE alerts SET status = $1, value = $2, resolved_at = $3, updated_at = $3
+			WHERE id = $4 AND status <> 'resolved'
+		`, AlertResolved, sample.Value, now, open.ID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() != 1 {
+			return nil
+		}
+		resolved := *open
+		resolved.Status, resolved.Value, resolved.ResolvedAt = AlertResolved, sample.Value, &now
+		s.notify(ctx, rule, &resolved)
+		return nil
+
+	case alertDiscard:
+		_, err := s.db.Pool().Exec(ctx, `DELETE FROM alerts WHERE id = $1`, open.ID)
+		return err
+
+	case alertRefresh:
+		_, err := s.db.Pool().Exec(ctx, `
+			UPDATE alerts SET value = $1, subject_name = $2, updated_at = $3 WHERE id = $4
+		`, sample.Value, name, now, open.ID)
+		return err
+	}
+	return nil
+}
+
+// Start evaluates alert rules until ctx is cancelled
+func (s *AlertService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.EvaluateRules(ctx); err != nil {
+			log.Printf("Alert evaluation failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
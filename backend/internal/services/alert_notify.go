@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+// AlertNotification is an alert that started firing or was resolved
+type AlertNotification struct {
+	Status string // firing or resolved
+	Test   bool
+	Rule   *models.AlertRule
+	Alert  *models.Alert
+}
+
+// alertWebhookPayload is the JSON body posted to generic webhooks
+type alertWebhookPayload struct {
+	Event       string     `json:"event"` // alert.firing, alert.resolved or alert.test
+	AlertID     uuid.UUID  `json:"alert_id"`
+	RuleID      uuid.UUID  `json:"rule_id"`
+	RuleName    string     `json:"rule_name"`
+	Scope       string     `json:"scope"`
+	Subject     string     `json:"subject"`
+	SubjectName string     `json:"subject_name"`
+	Metric      string     `json:"metric"`
+	Operator    string     `json:"operator"`
+	Threshold   float64    `json:"threshold"`
+	Value       float64    `json:"value"`
+	StartedAt   time.Time  `json:"started_at"`
+	FiredAt     *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	Summary     string     `json:"summary"`
+}
+
+// alertSummary renders a one-line description of a notification, e.g.
+// "[FIRING] High lag: pipeline orders lag_ms is 90000 (> 60000)"
+func alertSummary(n *AlertNotification) string {
+	prefix := "[" + strings.ToUpper(n.Status) + "]"
+	if n.Test {
+		prefix = "[TEST]"
+	}
+	subject := n.Alert.SubjectName
+	if subject == "" {
+		subject = n.Alert.Subject
+	}
+	return fmt.Sprintf("%s %s: %s %s %s is %s (%s %s)", prefix, n.Rule.Name, n.Rule.Scope, subject, n.Rule.Metric,
+		formatAlertValue(n.Alert.Value), alertOperators[n.Rule.Operator], formatAlertValue(n.Rule.Threshold))
+}
+
+func formatAlertValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// alertScopeLabel capitalizes a scope for display
+func alertScopeLabel(scope string) string {
+	if scope == "" {
+		return scope
+	}
+	return strings.ToUpper(scope[:1]) + scope[1:]
+}
+
+func alertEvent(n *AlertNotification) string {
+	if n.Test {
+		return "alert.test"
+	}
+	return "alert." + n.Status
+}
+
+// signWebhookPayload returns the hex HMAC-SHA256 of a webhook body
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify sends an alert notification to the rule's enabled channels. Failures
+// are logged; they never block alert state transitions.
+func (s *AlertService) notify(ctx context.Context, rule *models.AlertRule, alert *models.Alert) {
+	if len(rule.ChannelIDs) == 0 {
+		return
+	}
+	channels, err := s.queryChannels(ctx, `
+		SELECT `+alertChannelColumns+` FROM alert_channels WHERE user_id = $1 AND id = ANY($2) AND enabled = true
+	`, rule.UserID, rule.ChannelIDs)
+	if err != nil {
+		log.Printf("Failed to load channels of alert rule %s: %v", rule.ID, err)
+		return
+	}
+
+	n := &AlertNotification{Status: alert.Status, Rule: rule, Alert: alert}
+	for _, channel := range channels {
+		if err := s.sendNotification(ctx, channel, n); err != nil {
+			log.Printf("Failed to send alert %s to channel %s: %v", alert.ID, channel.ID, err)
+		}
+	}
+}
+
+func (s *AlertService) sendNotification(ctx context.Context, channel *models.AlertChannel, n *AlertNotification) error {
+	switch channel.Type {
+	case AlertChannelEmail:
+		if s.emailService == nil {
+			return fmt.Errorf("email is not configured")
+		}
+		return s.emailService.SendAlertEmail(ctx, channel.Target, n)
+
+	case AlertChannelSlack:
+		body, _ := json.Marshal(map[string]string{"text": alertSummary(n)})
+		return s.postWebhook(ctx, channel.Target, body, nil)
+
+	case AlertChannelWebhook:
+		body, err := json.Marshal(alertWebhookPayload{
+			Event:       alertEvent(n),
+			AlertID:     n.Alert.ID,
+			RuleID:      n.Rule.ID,
+			RuleName:    n.Rule.Name,
+			Scope:       n.Rule.Scope,
+			Subject:     n.Alert.Subject,
+			SubjectName: n.Alert.SubjectName,
+			Metric:      n.Rule.Metric,
+			Operator:    n.Rule.Operator,
+			Threshold:   n.Rule.Threshold,
+			Value:       n.Alert.Value,
+			StartedAt:   n.Alert.StartedAt,
+			FiredAt:     n.Alert.FiredAt,
+			ResolvedAt:  n.Alert.ResolvedAt,
+			Summary:     alertSummary(n),
+		})
+		if err != nil {
+			return err
+		}
+		headers := map[string]string{"X-Savegress-Event": alertEvent(n)}
+		if channel.Secret != "" {
+			headers["X-Savegress-Signature"] = signWebhookPayload(channel.Secret, body)
+		}
+		return s.postWebhook(ctx, channel.Target, body, headers)
+	}
+	return fmt.Errorf("unknown channel type %q", channel.Type)
+}
+
+func (s *AlertService) postWebhook(ctx context.Context, target string, body []byte, headers map[string]string) error {
+	// Re-check in case the channel predates the current validation rules
+	if err := validateWebhookURL(target); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Savegress-Alerts/1.0")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestAlertBreached(t *testing.T) {
+	assert.True(t, alertBreached("gt", 11, 10))
+	assert.False(t, alertBreached("gt", 10, 10))
+	assert.True(t, alertBreached("gte", 10, 10))
+	assert.True(t, alertBreached("lt", 9, 10))
+	assert.False(t, alertBreached("lt", 10, 10))
+	assert.True(t, alertBreached("lte", 10, 10))
+	assert.False(t, alertBreached("eq", 10, 10))
+}
+
+func TestNextAlertAction(t *testing.T) {
+	now := time.Now()
+	pending := &models.Alert{Status: AlertPending, StartedAt: now.Add(-2 * time.Minute)}
+	firing := &models.Alert{Status: AlertFiring, StartedAt: now.Add(-time.Hour)}
+
+	tests := []struct {
+		name     string
+		open     *models.Alert
+		breached bool
+		duration time.Duration
+		want     alertAction
+	}{
+		{"healthy stays quiet", nil, false, time.Minute, alertNoop},
+		{"breach without duration fires", nil, true, 0, alertFire},
+		{"breach with duration starts pending", nil, true, time.Minute, alertStartPending},
+		{"pending past duration fires", pending, true, time.Minute, alertFire},
+		{"pending within duration refreshes", pending, true, 5 * time.Minute, alertRefresh},
+		{"pending recovers is discarded", pending, false, time.Minute, alertDiscard},
+		{"firing still breached refreshes", firing, true, time.Minute, alertRefresh},
+		{"firing recovers resolves", firing, false, time.Minute, alertResolve},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextAlertAction(tt.open, tt.breached, tt.duration, now))
+		})
+	}
+}
+
+func TestMatchesScope(t *testing.T) {
+	assert.True(t, matchesScope(&models.AlertRule{}, "anything"))
+	assert.True(t, matchesScope(&models.AlertRule{ScopeID: strPtr("a")}, "a"))
+	assert.False(t, matchesScope(&models.AlertRule{ScopeID: strPtr("a")}, "b"))
+}
+
+func TestValidateAlertRule(t *testing.T) {
+	valid := func() *models.AlertRule {
+		return &models.AlertRule{Name: " High lag ", Scope: "Pipeline", Metric: "lag_ms", Operator: "GT", Threshold: 60000}
+	}
+
+	rule := valid()
+	require.NoError(t, ValidateAlertRule(rule))
+	assert.Equal(t, "High lag", rule.Name)
+	assert.Equal(t, AlertScopePipeline, rule.Scope)
+	assert.Equal(t, "gt", rule.Operator)
+	assert.NotNil(t, rule.ChannelIDs)
+
+	tests := []struct {
+		name   string
+		modify func(r *models.AlertRule)
+	}{
+		{"missing name", func(r *models.AlertRule) { r.Name = " " }},
+		{"unknown scope", func(r *models.AlertRule) { r.Scope = "cluster" }},
+		{"metric of another scope", func(r *models.AlertRule) { r.Metric = "offline_minutes" }},
+		{"unknown operator", func(r *models.AlertRule) { r.Operator = "eq" }},
+		{"negative duration", func(r *models.AlertRule) { r.DurationSeconds = -1 }},
+		{"duration too long", func(r *models.AlertRule) { r.DurationSeconds = 2 * 24 * 3600 }},
+		{"pipeline scope_id not a UUID", func(r *models.AlertRule) { r.ScopeID = strPtr("orders") }},
+		{"too many channels", func(r *models.AlertRule) { r.ChannelIDs = make([]uuid.UUID, maxAlertRuleChannels+1) }},
+		{"instance scope_id without hardware", func(r *models.AlertRule) {
+			r.Scope, r.Metric, r.ScopeID = AlertScopeInstance, "offline_minutes", strPtr(uuid.NewString())
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(r)
+			err := ValidateAlertRule(r)
+			assert.True(t, errors.Is(err, ErrInvalidAlertRule), "got %v", err)
+		})
+	}
+
+	t.Run("instance scope_id", func(t *testing.T) {
+		r := valid()
+		r.Scope, r.Metric, r.ScopeID = AlertScopeInstance, "offline_minutes", strPtr(uuid.NewString()+"/hw-1")
+		assert.NoError(t, ValidateAlertRule(r))
+	})
+
+	t.Run("blank scope_id means all subjects", func(t *testing.T) {
+		r := valid()
+		r.ScopeID = strPtr("  ")
+		require.NoError(t, ValidateAlertRule(r))
+		assert.Nil(t, r.ScopeID)
+	})
+}
+
+func TestValidateAlertChannel(t *testing.T) {
+	email := &models.AlertChannel{Name: "Ops", Type: "Email", Target: "Ops Team <ops@example.com>"}
+	require.NoError(t, ValidateAlertChannel(email))
+	assert.Equal(t, "ops@example.com", email.Target)
+
+	assert.NoError(t, ValidateAlertChannel(&models.AlertChannel{Name: "Hook", Type: "webhook", Target: "https://hooks.example.com/x"}))
+	assert.NoError(t, ValidateAlertChannel(&models.AlertChannel{Name: "Slack", Type: "slack", Target: "https://hooks.slack.com/services/T/B/X"}))
+
+	invalid := []*models.AlertChannel{
+		{Name: "", Type: "email", Target: "ops@example.com"},
+		{Name: "Ops", Type: "email", Target: "not-an-address"},
+		{Name: "Ops", Type: "pager", Target: "https://example.com"},
+		{Name: "Hook", Type: "webhook", Target: "ftp://example.com"},
+		{Name: "Hook", Type: "webhook", Target: "http://127.0.0.1:8080/hook"},
+	}
+	for _, c := range invalid {
+		assert.ErrorIs(t, ValidateAlertChannel(c), ErrInvalidAlertChannel, "%+v", c)
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	assert.NoError(t, validateWebhookURL("https://example.com/hook"))
+
+	for _, raw := range []string{
+		"",
+		"example.com/hook",
+		"http://localhost/hook",
+		"http://api.localhost/hook",
+		"http://metadata.google.internal/",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+		"http://100.100.100.200/latest/meta-data",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://[::ffff:10.0.0.5]/hook",
+		"http://[::]/hook",
+	} {
+		assert.Error(t, validateWebhookURL(raw), raw)
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	assert.NoError(t, webhookDialControl("tcp4", "93.184.216.34:443", nil))
+	assert.NoError(t, webhookDialControl("tcp6", "[2606:2800:220:1::1]:443", nil))
+
+	for _, addr := range []string{
+		"127.0.0.1:80",
+		"10.1.2.3:443",
+		"169.254.169.254:80",
+		"100.64.0.1:80",
+		"0.0.0.0:80",
+		"[::1]:80",
+		"[::]:80",
+		"[::ffff:192.168.0.1]:80",
+		"[fe80::1]:80",
+		"[fd00::1]:80",
+	} {
+		assert.Error(t, webhookDialControl("tcp", addr, nil), addr)
+	}
+}
+
+func TestAlertHTTPClientRefusesPrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	s := NewAlertService(nil, nil)
+	_, err := s.httpClient.Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestAlertSummary(t *testing.T) {
+	n := &AlertNotification{
+		Status: AlertFiring,
+		Rule:   &models.AlertRule{Name: "High lag", Scope: AlertScopePipeline, Metric: "lag_ms", Operator: "gt", Threshold: 60000},
+		Alert:  &models.Alert{Subject: uuid.NewString(), SubjectName: "orders", Value: 90000.5},
+	}
+	assert.Equal(t, "[FIRING] High lag: pipeline orders lag_ms is 90000.5 (> 60000)", alertSummary(n))
+	assert.Equal(t, "alert.firing", alertEvent(n))
+
+	n.Test = true
+	assert.Equal(t, "[TEST] High lag: pipeline orders lag_ms is 90000.5 (> 60000)", alertSummary(n))
+	assert.Equal(t, "alert.test", alertEvent(n))
+
+	n.Test = false
+	n.Status = AlertResolved
+	n.Alert.SubjectName = ""
+	assert.Contains(t, alertSummary(n), "[RESOLVED] High lag: pipeline "+n.Alert.Subject)
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"event":"alert.firing"}`)
+	sig := signWebhookPayload("secret", body)
+	assert.Len(t, sig, 64)
+	assert.Equal(t, sig, signWebhookPayload("secret", body))
+	assert.NotEqual(t, sig, signWebhookPayload("other", body))
+}
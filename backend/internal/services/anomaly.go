@@ -0,0 +1,428 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+// Anomaly kinds
+const (
+	AnomalyThroughputDrop = "throughput_drop"
+	AnomalyLatencySpike   = "latency_spike"
+	AnomalyErrorRateJump  = "error_rate_jump"
+)
+
+// Anomaly statuses
+const (
+	AnomalyOpen     = "open"
+	AnomalyResolved = "resolved"
+)
+
+const (
+	// anomalyBaselineWeeks is how much history baselines are learned from
+	anomalyBaselineWeeks = 4
+	// anomalyMinSamples is how many weeks an hour of week needs data for before it is judged
+	anomalyMinSamples = 3
+	// anomalyScoreThreshold is how many deviations from the mean count as anomalous
+	anomalyScoreThreshold = 3.0
+	// anomalyMinStdDevRatio floors the deviation at a share of the mean so very
+	// steady pipelines don't flag tiny changes
+	anomalyMinStdDevRatio = 0.1
+	// anomalyWindow is the trailing window compared against the hourly baseline
+	anomalyWindow = time.Hour
+	// baselineRefreshInterval is how often baselines are relearned
+	baselineRefreshInterval = time.Hour
+)
+
+// anomalyDetector describes how one baseline metric is judged
+type anomalyDetector struct {
+	Metric    string
+	Kind      string
+	Direction float64 // -1 flags drops, +1 flags spikes
+	MinStdDev float64 // absolute deviation floor, in the metric's unit
+	// significant rejects deviations that are statistically unusual but too small to matter
+	significant func(observed, mean float64) bool
+}
+
+var anomalyDetectors = []anomalyDetector{
+	{Metric: "throughput", Kind: AnomalyThroughputDrop, Direction: -1, MinStdDev: 1,
+		significant: func(observed, mean float64) bool { return observed < mean*0.5 }},
+	{Metric: "latency", Kind: AnomalyLatencySpike, Direction: 1, MinStdDev: 1,
+		significant: func(observed, mean float64) bool { return observed > mean*1.5 }},
+	{Metric: "error_rate", Kind: AnomalyErrorRateJump, Direction: 1, MinStdDev: 0.005,
+		significant: func(observed, mean float64) bool { return observed > mean+0.01 }},
+}
+
+func findAnomalyDetector(metric string) (anomalyDetector, bool) {
+	for _, d := range anomalyDetectors {
+		if d.Metric == metric {
+			return d, true
+		}
+	}
+	return anomalyDetector{}, false
+}
+
+// PipelineBaseline is the learned behaviour of one pipeline metric in one hour of week
+type PipelineBaseline struct {
+	Metric     string  `json:"metric"`
+	HourOfWeek int     `json:"hour_of_week"`
+	Mean       float64 `json:"mean"`
+	StdDev     float64 `json:"stddev"`
+	Samples    int     `json:"samples"`
+}
+
+// hourOfWeek returns the baseline slot of t: 0 is Monday 00:00-01:00 UTC
+func hourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return (int(t.Weekday())+6)%7*24 + t.Hour()
+}
+
+// anomalyScore returns how many (floored) deviations observed is from the baseline mean
+func anomalyScore(d anomalyDetector, observed float64, b PipelineBaseline) float64 {
+	sd := math.Max(b.StdDev, math.Max(math.Abs(b.Mean)*anomalyMinStdDevRatio, d.MinStdDev))
+	return (observed - b.Mean) / sd
+}
+
+// isAnomalous reports whether observed deviates from the baseline in the
+// detector's direction, strongly and significantly enough
+func isAnomalous(d anomalyDetector, observed float64, b PipelineBaseline) (float64, bool) {
+	if b.Samples < anomalyMinSamples {
+		return 0, false
+	}
+	score := anomalyScore(d, observed, b)
+	return score, score*d.Direction >= anomalyScoreThreshold && d.significant(observed, b.Mean)
+}
+
+// AnomalyService learns pipeline baselines and detects deviations from them
+type AnomalyService struct {
+	db           *repository.PostgresDB
+	eventService *EventService
+
+	lastBaselineRefresh time.Time
+}
+
+// NewAnomalyService creates a new anomaly service
+func NewAnomalyService(db *repository.PostgresDB) *AnomalyService {
+	return &AnomalyService{db: db}
+}
+
+// SetEventService enables dashboard stream events for anomalies
+func (s *AnomalyService) SetEventService(eventService *EventService) {
+	s.eventService = eventService
+}
+
+// RefreshBaselines relearns every pipeline's hour-of-week baselines from the
+// complete hours of the last few weeks of telemetry
+func (s *AnomalyService) RefreshBaselines(ctx context.Context, now time.Time) error {
+	until := now.UTC().Truncate(time.Hour)
+	since := until.AddDate(0, 0, -7*anomalyBaselineWeeks)
+
+	_, err := s.db.Pool().Exec(ctx, `
+		WITH hourly AS (
+			SELECT pipeline_id, date_trunc('hour', timestamp AT TIME ZONE 'UTC') AS hour,
+				SUM(events_processed)::float8 AS throughput,
+				AVG(avg_latency_ms) AS latency,
+				SUM(error_count)::float8 / NULLIF(SUM(events_processed) + SUM(error_count), 0) AS error_rate
+			FROM telemetry
+			WHERE pipeline_id IS NOT NULL AND timestamp >= $1 AND timestamp < $2
+			GROUP BY 1, 2
+		)
+		INSERT INTO pipeline_baselines (pipeline_id, metric, hour_of_week, mean, stddev, samples, updated_at)
+		SELECT h.pipeline_id, m.metric,
+			((EXTRACT(ISODOW FROM h.hour)::int - 1) * 24 + EXTRACT(HOUR FROM h.hour)::int)::smallint,
+			AVG(m.value), COALESCE(STDDEV_SAMP(m.value), 0), COUNT(*), NOW()
+		FROM hourly h
+		CROSS JOIN LATERAL (VALUES ('throughput', h.throughput), ('latency', h.latency), ('error_rate', h.error_rate)) AS m(metric, value)
+		JOIN pipelines p ON p.id = h.pipeline_id
+		WHERE m.value IS NOT NULL
+		GROUP BY 1, 2, 3
+		ON CONFLICT (pipeline_id, metric, hour_of_week) DO UPDATE SET
+			mean = EXCLUDED.mean,
+			stddev = EXCLUDED.stddev,
+			samples = EXCLUDED.samples,
+			updated_at = EXCLUDED.updated_at
+	`, since, until)
+	if err != nil {
+		return fmt.Errorf("failed to refresh pipeline baselines: %w", err)
+	}
+
+	// Slots not refreshed for a whole baseline window have no data left in it
+	_, err = s.db.Pool().Exec(ctx, `DELETE FROM pipeline_baselines WHERE updated_at < $1`, since)
+	return err
+}
+
+// anomalyCandidate is one running pipeline metric with its baseline and observed value
+type anomalyCandidate struct {
+	PipelineID   uuid.UUID
+	UserID       uuid.UUID
+	PipelineName string
+	Baseline     PipelineBaseline
+	Observed     *float64
+}
+
+// DetectAnomalies compares the trailing hour of every running pipeline against
+// its baseline, opening anomalies for new deviations and resolving recovered ones
+func (s *AnomalyService) DetectAnomalies(ctx context.Context, now time.Time) error {
+	windowEnd := now.UTC()
+	windowStart := windowEnd.Add(-anomalyWindow)
+	slot := hourOfWeek(windowEnd.Add(-anomalyWindow / 2))
+
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT p.id, p.user_id, p.name, b.metric, b.hour_of_week, b.mean, b.stddev, b.samples,
+			CASE b.metric
+				WHEN 'throughput' THEN COALESCE(w.throughput, 0)
+				WHEN 'latency' THEN w.latency
+				ELSE w.error_rate
+			END
+		FROM pipelines p
+		JOIN pipeline_baselines b ON b.pipeline_id = p.id AND b.hour_of_week = $3
+		LEFT JOIN LATERAL (
+			SELECT SUM(events_processed)::float8 AS throughput,
+				AVG(avg_latency_ms) AS latency,
+				SUM(error_count)::float8 / NULLIF(SUM(events_processed) + SUM(error_count), 0) AS error_rate
+			FROM telemetry
+			WHERE pipeline_id = p.id AND timestamp >= $1 AND timestamp < $2
+		) w ON true
+		WHERE p.status = 'running' AND p.created_at < $1
+	`, windowStart, windowEnd, slot)
+	if err != nil {
+		return err
+	}
+	var candidates []anomalyCandidate
+	for rows.Next() {
+		var c anomalyCandidate
+		if err := rows.Scan(&c.PipelineID, &c.UserID, &c.PipelineName, &c.Baseline.Metric, &c.Baseline.HourOfWeek,
+			&c.Baseline.Mean, &c.Baseline.StdDev, &c.Baseline.Samples, &c.Observed); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	open, err := s.openAnomalies(ctx)
+	if err != nil {
+		return err
+	}
+
+	ongoing := make(map[string]bool)
+	for _, c := range candidates {
+		d, ok := findAnomalyDetector(c.Baseline.Metric)
+		if !ok || c.Observed == nil {
+			continue
+		}
+		score, anomalous := isAnomalous(d, *c.Observed, c.Baseline)
+		if !anomalous {
+			continue
+		}
+
+		key := anomalyKey(c.PipelineID, d.Kind)
+		ongoing[key] = true
+		if existing, ok := open[key]; ok {
+			_, err := s.db.Pool().Exec(ctx, `
+				UPDATE pipeline_anomalies SET observed = $1, expected = $2, stddev = $3, score = $4, last_seen_at = $5
+				WHERE id = $6
+			`, *c.Observed, c.Baseline.Mean, c.Baseline.StdDev, score, windowEnd, existing.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		anomaly := &models.PipelineAnomaly{
+			PipelineID:   c.PipelineID,
+			PipelineName: c.PipelineName,
+			UserID:       c.UserID,
+			Kind:         d.Kind,
+			Status:       AnomalyOpen,
+			Observed:     *c.Observed,
+			Expected:     c.Baseline.Mean,
+			StdDev:       c.Baseline.StdDev,
+			Score:        score,
+			DetectedAt:   windowEnd,
+			LastSeenAt:   windowEnd,
+		}
+		// Another replica may have opened it first; only the inserting one publishes
+		err := s.db.Pool().QueryRow(ctx, `
+			INSERT INTO pipeline_anomalies (pipeline_id, user_id, kind, status, observed, expected, stddev, score, detected_at, last_seen_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+			ON CONFLICT (pipeline_id, kind) WHERE status = 'open' DO NOTHING
+			RETURNING id
+		`, anomaly.PipelineID, anomaly.UserID, anomaly.Kind, anomaly.Status, anomaly.Observed,
+			anomaly.Expected, anomaly.StdDev, anomaly.Score, windowEnd).Scan(&anomaly.ID)
+		if err == pgx.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Anomaly %s on pipeline %s: observed %.3f, expected %.3f (score %.1f)",
+			anomaly.Kind, anomaly.PipelineID, anomaly.Observed, anomaly.Expected, anomaly.Score)
+		s.eventService.Publish(ctx, anomaly.UserID, EventPipelineAnomaly, anomaly)
+	}
+
+	for key, anomaly := range open {
+		if ongoing[key] {
+			continue
+		}
+		result, err := s.db.Pool().Exec(ctx, `
+			UPDATE pipeline_anomalies SET status = $1, resolved_at = $2 WHERE id = $3 AND status = $4
+		`, AnomalyResolved, windowEnd, anomaly.ID, AnomalyOpen)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			continue
+		}
+		anomaly.Status = AnomalyResolved
+		anomaly.ResolvedAt = &windowEnd
+		s.eventService.Publish(ctx, anomaly.UserID, EventPipelineAnomaly, anomaly)
+	}
+	return nil
+}
+
+func anomalyKey(pipelineID uuid.UUID, kind string) string {
+	return pipelineID.String() + "/" + kind
+}
+
+const anomalyColumns = `a.id, a.pipeline_id, p.name, a.user_id, a.kind, a.status, a.observed, a.expected,
+	a.stddev, a.score, a.detected_at, a.last_seen_at, a.resolved_at`
+
+func scanAnomaly(row pgx.Row) (*models.PipelineAnomaly, error) {
+	var a models.PipelineAnomaly
+	err := row.Scan(&a.ID, &a.PipelineID, &a.PipelineName, &a.UserID, &a.Kind, &a.Status, &a.Observed,
+		&a.Expected, &a.StdDev, &a.Score, &a.DetectedAt, &a.LastSeenAt, &a.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// openAnomalies returns all open anomalies keyed by pipeline and kind
+func (s *AnomalyService) openAnomalies(ctx context.Context) (map[string]*models.PipelineAnomaly, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT `+anomalyColumns+`
+		FROM pipeline_anomalies a JOIN pipelines p ON p.id = a.pipeline_id
+		WHERE a.status = 'open'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	open := make(map[string]*models.PipelineAnomaly)
+	for rows.Next() {
+		a, err := scanAnomaly(rows)
+		if err != nil {
+			return nil, err
+		}
+		open[anomalyKey(a.PipelineID, a.Kind)] = a
+	}
+	return open, rows.Err()
+}
+
+// ListAnomalies returns the user's anomalies, newest first, optionally for one pipeline and status
+func (s *AnomalyService) ListAnomalies(ctx context.Context, userID uuid.UUID, pipelineID *uuid.UUID, status string, limit int) ([]*models.PipelineAnomaly, error) {
+	query := `SELECT ` + anomalyColumns + `
+		FROM pipeline_anomalies a JOIN pipelines p ON p.id = a.pipeline_id
+		WHERE a.user_id = $1`
+	args := []interface{}{userID}
+	if pipelineID != nil {
+		args = append(args, *pipelineID)
+		query += fmt.Sprintf(" AND a.pipeline_id = $%d", len(args))
+	}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND a.status = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY a.detected_at DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Pool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalies := make([]*models.PipelineAnomaly, 0)
+	for rows.Next() {
+		a, err := scanAnomaly(rows)
+		if err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
+
+// GetBaselines returns a pipeline's learned baselines
+func (s *AnomalyService) GetBaselines(ctx context.Context, userID, pipelineID uuid.UUID) ([]PipelineBaseline, error) {
+	var owned bool
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM pipelines WHERE id = $1 AND user_id = $2)
+	`, pipelineID, userID).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, ErrPipelineNotFound
+	}
+
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT metric, hour_of_week, mean, stddev, samples
+		FROM pipeline_baselines WHERE pipeline_id = $1
+		ORDER BY metric, hour_of_week
+	`, pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	baselines := make([]PipelineBaseline, 0)
+	for rows.Next() {
+		var b PipelineBaseline
+		if err := rows.Scan(&b.Metric, &b.HourOfWeek, &b.Mean, &b.StdDev, &b.Samples); err != nil {
+			return nil, err
+		}
+		baselines = append(baselines, b)
+	}
+	return baselines, rows.Err()
+}
+
+// Start relearns baselines hourly and runs detection every interval until ctx is cancelled
+func (s *AnomalyService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if now.Sub(s.lastBaselineRefresh) >= baselineRefreshInterval {
+			if err := s.RefreshBaselines(ctx, now); err != nil {
+				log.Printf("Pipeline baseline refresh failed: %v", err)
+			} else {
+				s.lastBaselineRefresh = now
+			}
+		}
+		if err := s.DetectAnomalies(ctx, now); err != nil {
+			log.Printf("Anomaly detection failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHourOfWeek(t *testing.T) {
+	// 2025-03-03 is a Monday
+	assert.Equal(t, 0, hourOfWeek(time.Date(2025, 3, 3, 0, 30, 0, 0, time.UTC)))
+	assert.Equal(t, 14, hourOfWeek(time.Date(2025, 3, 3, 14, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 24, hourOfWeek(time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 167, hourOfWeek(time.Date(2025, 3, 9, 23, 59, 0, 0, time.UTC)))
+
+	// Converted to UTC first
+	berlin := time.FixedZone("CET", 3600)
+	assert.Equal(t, 0, hourOfWeek(time.Date(2025, 3, 3, 1, 15, 0, 0, berlin)))
+}
+
+func TestIsAnomalous_ThroughputDrop(t *testing.T) {
+	d, ok := findAnomalyDetector("throughput")
+	require.True(t, ok)
+	b := PipelineBaseline{Metric: "throughput", Mean: 10000, StdDev: 800, Samples: 4}
+
+	score, anomalous := isAnomalous(d, 0, b)
+	assert.True(t, anomalous)
+	assert.InDelta(t, -10, score, 0.001) // deviation floored at 10% of the mean
+
+	_, anomalous = isAnomalous(d, 9000, b)
+	assert.False(t, anomalous, "normal variation")
+
+	_, anomalous = isAnomalous(d, 20000, b)
+	assert.False(t, anomalous, "spikes are not drops")
+
+	_, anomalous = isAnomalous(d, 0, PipelineBaseline{Mean: 10000, StdDev: 800, Samples: 2})
+	assert.False(t, anomalous, "not enough history")
+}
+
+func TestIsAnomalous_LatencySpike(t *testing.T) {
+	d, _ := findAnomalyDetector("latency")
+	b := PipelineBaseline{Mean: 40, StdDev: 2, Samples: 4}
+
+	_, anomalous := isAnomalous(d, 200, b)
+	assert.True(t, anomalous)
+
+	// Many deviations above a very steady mean, but not a meaningful change
+	_, anomalous = isAnomalous(d, 55, b)
+	assert.False(t, anomalous)
+
+	_, anomalous = isAnomalous(d, 5, b)
+	assert.False(t, anomalous, "drops are not spikes")
+}
+
+func TestIsAnomalous_ErrorRateJump(t *testing.T) {
+	d, _ := findAnomalyDetector("error_rate")
+
+	// A pipeline that never errors has a zero baseline; the absolute floor keeps scores finite
+	b := PipelineBaseline{Mean: 0, StdDev: 0, Samples: 4}
+	score, anomalous := isAnomalous(d, 0.05, b)
+	assert.True(t, anomalous)
+	assert.InDelta(t, 10, score, 0.001)
+
+	_, anomalous = isAnomalous(d, 0.004, b)
+	assert.False(t, anomalous)
+}
+
+func TestAnomalyDetectorsCoverKinds(t *testing.T) {
+	kinds := make(map[string]bool)
+	for _, d := range anomalyDetectors {
+		kinds[d.Kind] = true
+	}
+	assert.True(t, kinds[AnomalyThroughputDrop])
+	assert.True(t, kinds[AnomalyLatencySpike])
+	assert.True(t, kinds[AnomalyErrorRateJump])
+
+	_, ok := findAnomalyDetector("bytes")
+	assert.False(t, ok)
+}
+
+func TestAnomalyScoreAlertMetric(t *testing.T) {
+	m, ok := findAlertMetric(AlertScopePipeline, "anomaly_score")
+	require.True(t, ok)
+	assert.Contains(t, m.query, "pipeline_anomalies")
+}
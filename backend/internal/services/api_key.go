@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("API key not found")
+	ErrInvalidAPIKey      = errors.New("invalid API key")
+	ErrAPIKeyScope        = errors.New("API key lacks the required scope")
+	ErrInvalidAPIKeyInput = errors.New("invalid API key request")
+)
+
+// API key scopes
+const (
+	APIKeyScopeMetricsRead = "metrics:read"
+)
+
+var apiKeyScopes = map[string]bool{
+	APIKeyScopeMetricsRead: true,
+}
+
+const (
+	// apiKeyPrefix marks platform API keys so they are recognizable in configs and secret scanners
+	apiKeyPrefix = "sgk_"
+	// apiKeyDisplayLength is how much of the key is kept in clear for identification
+	apiKeyDisplayLength = 12
+	maxAPIKeysPerUser   = 25
+	// apiKeyTouchInterval limits how often last_used_at is written for busy keys
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyService manages account API keys
+type APIKeyService struct {
+	db *repository.PostgresDB
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(db *repository.PostgresDB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// generateAPIKey returns a new random key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAPIKey returns the stored form of a key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeAPIKeyScopes deduplicates scopes and rejects unknown ones
+func normalizeAPIKeyScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyInput)
+	}
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !apiKeyScopes[scope] {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKeyInput, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+// hasScope reports whether a key grants scope
+func hasScope(key *models.APIKey, scope string) bool {
+	for _, s := range key.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+const apiKeyColumns = `id, user_id, name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var k models.APIKey
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.KeyPrefix, &k.Scopes, &k.ExpiresAt,
+		&k.LastUsedAt, &k.RevokedAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// CreateKey creates an API key and returns it with the plaintext key, which is not stored
+func (s *APIKeyService) CreateKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidAPIKeyInput)
+	}
+	scopes, err := normalizeAPIKeyScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKeyInput)
+	}
+
+	var count int
+	if err := s.db.Pool().QueryRow(ctx, `
+		SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID).Scan(&count); err != nil {
+		return nil, "", err
+	}
+	if count >= maxAPIKeysPerUser {
+		return nil, "", fmt.Errorf("%w: at most %d active keys per account", ErrInvalidAPIKeyInput, maxAPIKeysPerUser)
+	}
+
+	raw, err := generateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key, err := scanAPIKey(s.db.Pool().QueryRow(ctx, `
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+apiKeyColumns,
+		userID, name, raw[:apiKeyDisplayLength], hashAPIKey(raw), scopes, expiresAt))
+	if err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+// ListKeys returns the user's API keys, including revoked ones
+func (s *APIKeyService) ListKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeKey revokes one of the user's API keys
+func (s *APIKeyService) RevokeKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	result, err := s.db.Pool().Exec(ctx, `
+		UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, keyID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a presented key and checks it grants scope
+func (s *APIKeyService) Authenticate(ctx context.Context, raw, scope string) (*models.APIKey, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := scanAPIKey(s.db.Pool().QueryRow(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1
+	`, hashAPIKey(raw)))
+	if err == pgx.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+	if !hasScope(key, scope) {
+		return nil, ErrAPIKeyScope
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		s.db.Pool().Exec(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, now.UTC(), key.ID)
+	}
+	return key, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	a, err := generateAPIKey()
+	require.NoError(t, err)
+	b, err := generateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, apiKeyPrefix))
+	assert.Len(t, a, len(apiKeyPrefix)+43) // 32 bytes, unpadded base64url
+	assert.NotEqual(t, a, b)
+	assert.Greater(t, len(a), apiKeyDisplayLength)
+}
+
+func TestHashAPIKey(t *testing.T) {
+	h := hashAPIKey("sgk_example")
+	assert.Len(t, h, 64)
+	assert.Equal(t, h, hashAPIKey("sgk_example"))
+	assert.NotEqual(t, h, hashAPIKey("sgk_other"))
+}
+
+func TestNormalizeAPIKeyScopes(t *testing.T) {
+	scopes, err := normalizeAPIKeyScopes([]string{" Metrics:Read ", "metrics:read"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{APIKeyScopeMetricsRead}, scopes)
+
+	_, err = normalizeAPIKeyScopes(nil)
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyInput)
+
+	_, err = normalizeAPIKeyScopes([]string{"admin"})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyInput)
+}
+
+func TestHasScope(t *testing.T) {
+	key := &models.APIKey{Scopes: []string{APIKeyScopeMetricsRead}}
+	assert.True(t, hasScope(key, APIKeyScopeMetricsRead))
+	assert.False(t, hasScope(key, "billing:read"))
+	assert.False(t, hasScope(&models.APIKey{}, APIKeyScopeMetricsRead))
+}
@@ -216,9 +216,9 @@ func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
 func (s *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), created_at, updated_at, last_login_at
+		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), payment_provider, created_at, updated_at, last_login_at
 		FROM users WHERE id = $1
-	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.Company, &user.Role, &user.EmailVerified, &user.StripeCustomerID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
+	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.Company, &user.Role, &user.EmailVerified, &user.StripeCustomerID, &user.PaymentProvider, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
@@ -353,9 +353,9 @@ func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword stri
 func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), created_at, updated_at, last_login_at
+		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), payment_provider, created_at, updated_at, last_login_at
 		FROM users WHERE email = $1
-	`, email).Scan(&user.ID, &user.Email, &user.Name, &user.Company, &user.Role, &user.EmailVerified, &user.StripeCustomerID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
+	`, email).Scan(&user.ID, &user.Email, &user.Name, &user.Company, &user.Role, &user.EmailVerified, &user.StripeCustomerID, &user.PaymentProvider, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
@@ -2,19 +2,13 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stripe/stripe-go/v76"
-	portalsession "github.com/stripe/stripe-go/v76/billingportal/session"
-	checkoutsession "github.com/stripe/stripe-go/v76/checkout/session"
-	"github.com/stripe/stripe-go/v76/customer"
-	"github.com/stripe/stripe-go/v76/paymentmethod"
-	"github.com/stripe/stripe-go/v76/setupintent"
-	"github.com/stripe/stripe-go/v76/subscription"
-	"github.com/stripe/stripe-go/v76/webhook"
 
 	"github.com/savegress/platform/backend/internal/models"
 	"github.com/savegress/platform/backend/internal/repository"
@@ -26,21 +20,25 @@ var (
 	ErrInvalidPlan           = errors.New("invalid plan")
 	ErrSamePlan              = errors.New("already on this plan")
 	ErrPaymentMethodNotFound = errors.New("payment method not found")
+	ErrProviderSubscription  = errors.New("the subscription with the current payment provider must be canceled first")
 )
 
-// BillingService handles Stripe billing
+// BillingService handles subscriptions and invoices, delegating to the
+// payment provider each user is billed through
 type BillingService struct {
-	db                *repository.PostgresDB
-	webhookSecret     string
-	proPriceID        string
-	enterprisePriceID string
+	db        *repository.PostgresDB
+	stripe    *StripeProvider
+	providers map[string]PaymentProvider
 }
 
-// NewBillingService creates a new billing service
+// NewBillingService creates a new billing service with Stripe as the default provider
 func NewBillingService(secretKey, webhookSecret string) *BillingService {
-	stripe.Key = secretKey
+	stripeProvider := NewStripeProvider(secretKey, webhookSecret)
 	return &BillingService{
-		webhookSecret: webhookSecret,
+		stripe: stripeProvider,
+		providers: map[string]PaymentProvider{
+			ProviderStripe: stripeProvider,
+		},
 	}
 }
 
@@ -49,64 +47,98 @@ func (s *BillingService) SetDB(db *repository.PostgresDB) {
 	s.db = db
 }
 
-// CreateCustomer creates a Stripe customer for a user
-func (s *BillingService) CreateCustomer(ctx context.Context, user *models.User) (string, error) {
-	params := &stripe.CustomerParams{
-		Email: stripe.String(user.Email),
-		Name:  stripe.String(user.Name),
-		Metadata: map[string]string{
-			"user_id": user.ID.String(),
-		},
+// RegisterProvider makes an additional payment provider available
+func (s *BillingService) RegisterProvider(provider PaymentProvider) {
+	s.providers[provider.Name()] = provider
+}
+
+// Provider returns a registered payment provider by name
+func (s *BillingService) Provider(name string) (PaymentProvider, error) {
+	if name == "" {
+		name = ProviderStripe
+	}
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// SetUserProvider switches the payment provider a user is billed through.
+// The provider customer ID is cleared so a new customer is created on next use.
+// A subscription still running with another provider must be canceled first,
+// or the user would keep being charged there.
+func (s *BillingService) SetUserProvider(ctx context.Context, userID uuid.UUID, name string) error {
+	if _, err := s.Provider(name); err != nil {
+		return err
 	}
 
-	c, err := customer.New(params)
+	var running bool
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM subscriptions
+			WHERE user_id = $1 AND payment_provider <> $2 AND status IN ('active', 'trialing', 'past_due')
+		)
+	`, userID, name).Scan(&running)
 	if err != nil {
-		return "", fmt.Errorf("failed to create Stripe customer: %w", err)
+		return err
+	}
+	if running {
+		return ErrProviderSubscription
 	}
 
-	return c.ID, nil
+	_, err = s.db.Pool().Exec(ctx, `
+		UPDATE users SET payment_provider = $1, stripe_customer_id = NULL, updated_at = NOW()
+		WHERE id = $2 AND payment_provider <> $1
+	`, name, userID)
+	return err
 }
 
-// CreateCheckoutSession creates a Stripe checkout session for subscription
-func (s *BillingService) CreateCheckoutSession(ctx context.Context, user *models.User, plan, successURL, cancelURL string) (string, error) {
-	priceID := s.getPriceID(plan)
-	if priceID == "" {
-		return "", errors.New("invalid plan")
-	}
-
-	params := &stripe.CheckoutSessionParams{
-		Customer: stripe.String(user.StripeCustomerID),
-		Mode:     stripe.String(string(stripe.CheckoutSessionModeSubscription)),
-		LineItems: []*stripe.CheckoutSessionLineItemParams{
-			{
-				Price:    stripe.String(priceID),
-				Quantity: stripe.Int64(1),
-			},
-		},
-		SuccessURL: stripe.String(successURL),
-		CancelURL:  stripe.String(cancelURL),
-		Metadata: map[string]string{
-			"user_id": user.ID.String(),
-			"plan":    plan,
-		},
+// CreateCustomer registers a user with their payment provider, using their
+// billing profile for the invoiced name, address and tax IDs when one exists.
+func (s *BillingService) CreateCustomer(ctx context.Context, user *models.User) (string, error) {
+	provider, err := s.Provider(user.PaymentProvider)
+	if err != nil {
+		return "", err
 	}
 
-	sess, err := checkoutsession.New(params)
+	var profile *models.BillingProfile
+	if s.db != nil {
+		profile, err = s.GetBillingProfile(ctx, user.ID)
+		if err != nil && err != ErrBillingProfileNotFound {
+			return "", err
+		}
+	}
+
+	return provider.CreateCustomer(ctx, user, profile)
+}
+
+// SyncBillingProfile pushes a billing profile to the user's payment provider
+func (s *BillingService) SyncBillingProfile(ctx context.Context, user *models.User, profile *models.BillingProfile) error {
+	provider, err := s.Provider(user.PaymentProvider)
 	if err != nil {
-		return "", fmt.Errorf("failed to create checkout session: %w", err)
+		return err
 	}
+	return provider.UpdateCustomer(ctx, user, profile)
+}
 
-	return sess.URL, nil
+// CreateCheckoutSession creates a checkout session for subscription
+func (s *BillingService) CreateCheckoutSession(ctx context.Context, user *models.User, plan, successURL, cancelURL string) (string, error) {
+	provider, err := s.Provider(user.PaymentProvider)
+	if err != nil {
+		return "", err
+	}
+	return provider.CreateCheckoutSession(ctx, user, plan, successURL, cancelURL)
 }
 
 // GetSubscription returns the user's current subscription
 func (s *BillingService) GetSubscription(ctx context.Context, userID uuid.UUID) (*models.Subscription, error) {
 	var sub models.Subscription
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, user_id, stripe_subscription_id, stripe_price_id, status, plan,
+		SELECT id, user_id, payment_provider, stripe_subscription_id, stripe_price_id, status, plan,
 			   current_period_start, current_period_end, cancel_at_period_end, created_at, updated_at
 		FROM subscriptions WHERE user_id = $1 AND status IN ('active', 'trialing', 'past_due')
-	`, userID).Scan(&sub.ID, &sub.UserID, &sub.StripeSubscriptionID, &sub.StripePriceID,
+	`, userID).Scan(&sub.ID, &sub.UserID, &sub.PaymentProvider, &sub.StripeSubscriptionID, &sub.StripePriceID,
 		&sub.Status, &sub.Plan, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd,
 		&sub.CancelAtPeriodEnd, &sub.CreatedAt, &sub.UpdatedAt)
 	if err != nil {
@@ -117,113 +149,49 @@ func (s *BillingService) GetSubscription(ctx context.Context, userID uuid.UUID)
 
 // CancelSubscription cancels a subscription at period end
 func (s *BillingService) CancelSubscription(ctx context.Context, userID uuid.UUID) error {
-	sub, err := s.GetSubscription(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	params := &stripe.SubscriptionParams{
-		CancelAtPeriodEnd: stripe.Bool(true),
-	}
-
-	_, err = subscription.Update(sub.StripeSubscriptionID, params)
-	if err != nil {
-		return fmt.Errorf("failed to cancel subscription: %w", err)
-	}
-
-	// Update local record
-	_, err = s.db.Pool().Exec(ctx, `
-		UPDATE subscriptions SET cancel_at_period_end = true, updated_at = NOW()
-		WHERE id = $1
-	`, sub.ID)
-
-	return err
+	return s.setCancelAtPeriodEnd(ctx, userID, true)
 }
 
 // ReactivateSubscription reactivates a canceled subscription
 func (s *BillingService) ReactivateSubscription(ctx context.Context, userID uuid.UUID) error {
-	sub, err := s.GetSubscription(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	params := &stripe.SubscriptionParams{
-		CancelAtPeriodEnd: stripe.Bool(false),
-	}
-
-	_, err = subscription.Update(sub.StripeSubscriptionID, params)
-	if err != nil {
-		return fmt.Errorf("failed to reactivate subscription: %w", err)
-	}
-
-	_, err = s.db.Pool().Exec(ctx, `
-		UPDATE subscriptions SET cancel_at_period_end = false, updated_at = NOW()
-		WHERE id = $1
-	`, sub.ID)
-
-	return err
+	return s.setCancelAtPeriodEnd(ctx, userID, false)
 }
 
-// UpdateSubscription upgrades or downgrades a subscription to a new plan
-func (s *BillingService) UpdateSubscription(ctx context.Context, userID uuid.UUID, newPlan string) error {
+func (s *BillingService) setCancelAtPeriodEnd(ctx context.Context, userID uuid.UUID, cancel bool) error {
 	sub, err := s.GetSubscription(ctx, userID)
 	if err != nil {
 		return err
 	}
 
-	newPriceID := s.getPriceID(newPlan)
-	if newPriceID == "" {
-		return errors.New("invalid plan")
-	}
-
-	// Get the current subscription from Stripe
-	stripeSub, err := subscription.Get(sub.StripeSubscriptionID, nil)
+	provider, err := s.Provider(sub.PaymentProvider)
 	if err != nil {
-		return fmt.Errorf("failed to get subscription: %w", err)
-	}
-
-	if len(stripeSub.Items.Data) == 0 {
-		return errors.New("subscription has no items")
-	}
-
-	// Update the subscription item with new price
-	params := &stripe.SubscriptionParams{
-		Items: []*stripe.SubscriptionItemsParams{
-			{
-				ID:    stripe.String(stripeSub.Items.Data[0].ID),
-				Price: stripe.String(newPriceID),
-			},
-		},
-		ProrationBehavior: stripe.String(string(stripe.SubscriptionSchedulePhaseProrationBehaviorCreateProrations)),
+		return err
 	}
 
-	_, err = subscription.Update(sub.StripeSubscriptionID, params)
-	if err != nil {
-		return fmt.Errorf("failed to update subscription: %w", err)
+	if err := provider.SetCancelAtPeriodEnd(ctx, sub.StripeSubscriptionID, cancel); err != nil {
+		return err
 	}
 
 	// Update local record
 	_, err = s.db.Pool().Exec(ctx, `
-		UPDATE subscriptions SET plan = $1, stripe_price_id = $2, updated_at = NOW()
-		WHERE id = $3
-	`, newPlan, newPriceID, sub.ID)
+		UPDATE subscriptions SET cancel_at_period_end = $1, updated_at = NOW()
+		WHERE id = $2
+	`, cancel, sub.ID)
 
 	return err
 }
 
-// RemovePaymentMethod removes a payment method from a customer
-func (s *BillingService) RemovePaymentMethod(ctx context.Context, paymentMethodID string) error {
-	_, err := paymentmethod.Detach(paymentMethodID, nil)
-	if err != nil {
-		return fmt.Errorf("failed to detach payment method: %w", err)
-	}
-	return nil
+// UpdateSubscription upgrades or downgrades a subscription to a new plan
+func (s *BillingService) UpdateSubscription(ctx context.Context, userID uuid.UUID, newPlan string) error {
+	_, err := s.UpdateSubscriptionPlan(ctx, userID, newPlan)
+	return err
 }
 
 // ListInvoices returns invoices for a user
 func (s *BillingService) ListInvoices(ctx context.Context, userID uuid.UUID, limit int) ([]models.Invoice, error) {
 	rows, err := s.db.Pool().Query(ctx, `
-		SELECT id, user_id, stripe_invoice_id, amount, currency, status, invoice_url, invoice_pdf, period_start, period_end, created_at
+		SELECT id, user_id, stripe_invoice_id, payment_provider, COALESCE(plan, ''), subtotal, tax, amount, currency, status,
+		       COALESCE(invoice_url, ''), COALESCE(invoice_pdf, ''), period_start, period_end, line_items, created_at
 		FROM invoices WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2
 	`, userID, limit)
 	if err != nil {
@@ -234,71 +202,42 @@ func (s *BillingService) ListInvoices(ctx context.Context, userID uuid.UUID, lim
 	invoices := make([]models.Invoice, 0)
 	for rows.Next() {
 		var inv models.Invoice
-		if err := rows.Scan(&inv.ID, &inv.UserID, &inv.StripeInvoiceID, &inv.Amount,
-			&inv.Currency, &inv.Status, &inv.InvoiceURL, &inv.InvoicePDF,
-			&inv.PeriodStart, &inv.PeriodEnd, &inv.CreatedAt); err != nil {
+		var lineItems []byte
+		if err := rows.Scan(&inv.ID, &inv.UserID, &inv.StripeInvoiceID, &inv.PaymentProvider, &inv.Plan,
+			&inv.Subtotal, &inv.Tax, &inv.Amount, &inv.Currency, &inv.Status, &inv.InvoiceURL, &inv.InvoicePDF,
+			&inv.PeriodStart, &inv.PeriodEnd, &lineItems, &inv.CreatedAt); err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal(lineItems, &inv.LineItems); err != nil {
+			return nil, fmt.Errorf("failed to decode invoice line items: %w", err)
+		}
 		invoices = append(invoices, inv)
 	}
 	return invoices, nil
 }
 
-// ListPaymentMethods returns payment methods for a customer
-func (s *BillingService) ListPaymentMethods(ctx context.Context, stripeCustomerID string) ([]*stripe.PaymentMethod, error) {
-	params := &stripe.PaymentMethodListParams{
-		Customer: stripe.String(stripeCustomerID),
-		Type:     stripe.String("card"),
-	}
-
-	methods := make([]*stripe.PaymentMethod, 0)
-	iter := paymentmethod.List(params)
-	for iter.Next() {
-		methods = append(methods, iter.PaymentMethod())
-	}
-
-	return methods, iter.Err()
-}
-
-// CreatePortalSession creates a Stripe billing portal session
-func (s *BillingService) CreatePortalSession(ctx context.Context, stripeCustomerID, returnURL string) (string, error) {
-	params := &stripe.BillingPortalSessionParams{
-		Customer:  stripe.String(stripeCustomerID),
-		ReturnURL: stripe.String(returnURL),
-	}
-
-	sess, err := portalsession.New(params)
+// CreatePortalSession creates a self-service billing portal session
+func (s *BillingService) CreatePortalSession(ctx context.Context, user *models.User, returnURL string) (string, error) {
+	provider, err := s.Provider(user.PaymentProvider)
 	if err != nil {
-		return "", fmt.Errorf("failed to create portal session: %w", err)
+		return "", err
 	}
-
-	return sess.URL, nil
+	return provider.CreatePortalSession(ctx, user.StripeCustomerID, returnURL)
 }
 
-// HandleWebhook processes Stripe webhooks
-func (s *BillingService) HandleWebhook(payload []byte, signature string) (*stripe.Event, error) {
-	event, err := webhook.ConstructEvent(payload, signature, s.webhookSecret)
-	if err != nil {
-		return nil, ErrInvalidWebhook
-	}
-	return &event, nil
+// HandleWebhook verifies a Stripe webhook and converts it into a billing event.
+// A nil event means the webhook needs no action.
+func (s *BillingService) HandleWebhook(payload []byte, signature string) (*BillingEvent, error) {
+	return s.stripe.ParseWebhook(payload, signature)
 }
 
 func (s *BillingService) getPriceID(plan string) string {
-	switch plan {
-	case "pro":
-		return s.proPriceID
-	case "enterprise":
-		return s.enterprisePriceID
-	default:
-		return ""
-	}
+	return s.stripe.getPriceID(plan)
 }
 
 // SetPriceIDs sets the Stripe price IDs for subscription plans
 func (s *BillingService) SetPriceIDs(proPriceID, enterprisePriceID string) {
-	s.proPriceID = proPriceID
-	s.enterprisePriceID = enterprisePriceID
+	s.stripe.SetPriceIDs(proPriceID, enterprisePriceID)
 }
 
 // UpdateSubscriptionPlan changes a subscription to a different plan (upgrade/downgrade)
@@ -309,9 +248,7 @@ func (s *BillingService) UpdateSubscriptionPlan(ctx context.Context, userID uuid
 		return nil, err
 	}
 
-	// Validate new plan
-	newPriceID := s.getPriceID(newPlan)
-	if newPriceID == "" {
+	if newPlan != "pro" && newPlan != "enterprise" {
 		return nil, ErrInvalidPlan
 	}
 
@@ -320,31 +257,14 @@ func (s *BillingService) UpdateSubscriptionPlan(ctx context.Context, userID uuid
 		return nil, ErrSamePlan
 	}
 
-	// Get subscription items
-	stripeSub, err := subscription.Get(sub.StripeSubscriptionID, nil)
+	provider, err := s.Provider(sub.PaymentProvider)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get Stripe subscription: %w", err)
-	}
-
-	if len(stripeSub.Items.Data) == 0 {
-		return nil, fmt.Errorf("subscription has no items")
-	}
-
-	// Update the subscription item with new price
-	itemID := stripeSub.Items.Data[0].ID
-	params := &stripe.SubscriptionParams{
-		Items: []*stripe.SubscriptionItemsParams{
-			{
-				ID:    stripe.String(itemID),
-				Price: stripe.String(newPriceID),
-			},
-		},
-		ProrationBehavior: stripe.String(string(stripe.SubscriptionSchedulePhaseProrationBehaviorCreateProrations)),
+		return nil, err
 	}
 
-	updatedSub, err := subscription.Update(sub.StripeSubscriptionID, params)
+	updated, err := provider.ChangePlan(ctx, sub.StripeSubscriptionID, newPlan)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update subscription: %w", err)
+		return nil, err
 	}
 
 	// Update local record
@@ -352,73 +272,89 @@ func (s *BillingService) UpdateSubscriptionPlan(ctx context.Context, userID uuid
 		UPDATE subscriptions
 		SET plan = $1, stripe_price_id = $2, updated_at = NOW()
 		WHERE id = $3
-	`, newPlan, newPriceID, sub.ID)
+	`, newPlan, updated.PriceID, sub.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update local subscription: %w", err)
 	}
 
 	sub.Plan = newPlan
-	sub.StripePriceID = newPriceID
-	sub.CurrentPeriodEnd = time.Unix(updatedSub.CurrentPeriodEnd, 0)
+	sub.StripePriceID = updated.PriceID
+	if updated.PeriodEnd > 0 {
+		sub.CurrentPeriodEnd = time.Unix(updated.PeriodEnd, 0)
+	}
 
 	return sub, nil
 }
 
-// AttachPaymentMethod attaches a payment method to a customer
-func (s *BillingService) AttachPaymentMethod(ctx context.Context, stripeCustomerID, paymentMethodID string) error {
-	params := &stripe.PaymentMethodAttachParams{
-		Customer: stripe.String(stripeCustomerID),
+// paymentMethods returns the user's provider if it keeps payment methods on file
+func (s *BillingService) paymentMethods(user *models.User) (PaymentMethodProvider, error) {
+	provider, err := s.Provider(user.PaymentProvider)
+	if err != nil {
+		return nil, err
 	}
+	pm, ok := provider.(PaymentMethodProvider)
+	if !ok {
+		return nil, ErrNotSupportedByProvider
+	}
+	return pm, nil
+}
 
-	_, err := paymentmethod.Attach(paymentMethodID, params)
+// ListPaymentMethods returns payment methods for a user. Providers without
+// payment methods on file (manual invoicing) return an empty list.
+func (s *BillingService) ListPaymentMethods(ctx context.Context, user *models.User) ([]*stripe.PaymentMethod, error) {
+	pm, err := s.paymentMethods(user)
+	if err == ErrNotSupportedByProvider {
+		return []*stripe.PaymentMethod{}, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to attach payment method: %w", err)
+		return nil, err
 	}
-
-	return nil
+	return pm.ListPaymentMethods(ctx, user.StripeCustomerID)
 }
 
-// DetachPaymentMethod removes a payment method from a customer
-func (s *BillingService) DetachPaymentMethod(ctx context.Context, paymentMethodID string) error {
-	_, err := paymentmethod.Detach(paymentMethodID, nil)
+// AttachPaymentMethod attaches a payment method to a user's customer
+func (s *BillingService) AttachPaymentMethod(ctx context.Context, user *models.User, paymentMethodID string) error {
+	pm, err := s.paymentMethods(user)
 	if err != nil {
-		return fmt.Errorf("failed to detach payment method: %w", err)
+		return err
 	}
-	return nil
+	return pm.AttachPaymentMethod(ctx, user.StripeCustomerID, paymentMethodID)
 }
 
-// SetDefaultPaymentMethod sets the default payment method for a customer
-func (s *BillingService) SetDefaultPaymentMethod(ctx context.Context, stripeCustomerID, paymentMethodID string) error {
-	params := &stripe.CustomerParams{
-		InvoiceSettings: &stripe.CustomerInvoiceSettingsParams{
-			DefaultPaymentMethod: stripe.String(paymentMethodID),
-		},
+// DetachPaymentMethod removes a payment method from a user's customer
+func (s *BillingService) DetachPaymentMethod(ctx context.Context, user *models.User, paymentMethodID string) error {
+	pm, err := s.paymentMethods(user)
+	if err != nil {
+		return err
 	}
+	return pm.DetachPaymentMethod(ctx, paymentMethodID)
+}
+
+// RemovePaymentMethod removes a payment method from a user's customer
+func (s *BillingService) RemovePaymentMethod(ctx context.Context, user *models.User, paymentMethodID string) error {
+	return s.DetachPaymentMethod(ctx, user, paymentMethodID)
+}
 
-	_, err := customer.Update(stripeCustomerID, params)
+// SetDefaultPaymentMethod sets the default payment method for a user's customer
+func (s *BillingService) SetDefaultPaymentMethod(ctx context.Context, user *models.User, paymentMethodID string) error {
+	pm, err := s.paymentMethods(user)
 	if err != nil {
-		return fmt.Errorf("failed to set default payment method: %w", err)
+		return err
 	}
-	return nil
+	return pm.SetDefaultPaymentMethod(ctx, user.StripeCustomerID, paymentMethodID)
 }
 
 // CreateSetupIntent creates a SetupIntent for adding a new payment method via Stripe.js
-func (s *BillingService) CreateSetupIntent(ctx context.Context, stripeCustomerID string) (string, error) {
-	params := &stripe.SetupIntentParams{
-		Customer:           stripe.String(stripeCustomerID),
-		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
-	}
-
-	intent, err := setupintent.New(params)
+func (s *BillingService) CreateSetupIntent(ctx context.Context, user *models.User) (string, error) {
+	pm, err := s.paymentMethods(user)
 	if err != nil {
-		return "", fmt.Errorf("failed to create setup intent: %w", err)
+		return "", err
 	}
-
-	return intent.ClientSecret, nil
+	return pm.CreateSetupIntent(ctx, user.StripeCustomerID)
 }
 
-// CreateOrUpdateSubscription creates a subscription from a checkout session or updates existing
-func (s *BillingService) CreateOrUpdateSubscription(ctx context.Context, userID uuid.UUID, stripeSubID, stripePriceID, plan, status string, periodStart, periodEnd int64) error {
+// CreateOrUpdateSubscription creates a subscription from a billing event or updates existing
+func (s *BillingService) CreateOrUpdateSubscription(ctx context.Context, userID uuid.UUID, provider, subID, priceID, plan, status string, periodStart, periodEnd int64) error {
 	// Check if subscription exists
 	var existingID uuid.UUID
 	err := s.db.Pool().QueryRow(ctx, `
@@ -429,52 +365,88 @@ func (s *BillingService) CreateOrUpdateSubscription(ctx context.Context, userID
 		// Update existing
 		_, err = s.db.Pool().Exec(ctx, `
 			UPDATE subscriptions
-			SET stripe_subscription_id = $1, stripe_price_id = $2, plan = $3, status = $4,
-				current_period_start = to_timestamp($5), current_period_end = to_timestamp($6), updated_at = NOW()
-			WHERE id = $7
-		`, stripeSubID, stripePriceID, plan, status,
+			SET payment_provider = $1, stripe_subscription_id = $2, stripe_price_id = $3, plan = $4, status = $5,
+				current_period_start = to_timestamp($6), current_period_end = to_timestamp($7),
+				cancel_at_period_end = false, updated_at = NOW()
+			WHERE id = $8
+		`, provider, subID, priceID, plan, status,
 			periodStart, periodEnd, existingID)
 		return err
 	}
 
 	// Create new
-	subID := uuid.New()
+	id := uuid.New()
 	_, err = s.db.Pool().Exec(ctx, `
-		INSERT INTO subscriptions (id, user_id, stripe_subscription_id, stripe_price_id, plan, status,
+		INSERT INTO subscriptions (id, user_id, payment_provider, stripe_subscription_id, stripe_price_id, plan, status,
 			current_period_start, current_period_end, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, to_timestamp($7), to_timestamp($8), NOW(), NOW())
-	`, subID, userID, stripeSubID, stripePriceID, plan, status, periodStart, periodEnd)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, to_timestamp($8), to_timestamp($9), NOW(), NOW())
+	`, id, userID, provider, subID, priceID, plan, status, periodStart, periodEnd)
 	return err
 }
 
-// UpdateSubscriptionStatus updates subscription status in the database
-func (s *BillingService) UpdateSubscriptionStatus(ctx context.Context, stripeSubID, status string, cancelAtPeriodEnd bool) error {
+// UpdateSubscriptionStatus updates subscription status in the database.
+// Period bounds are only updated when the provider reported them.
+func (s *BillingService) UpdateSubscriptionStatus(ctx context.Context, subID, status string, cancelAtPeriodEnd bool, periodStart, periodEnd int64) error {
 	_, err := s.db.Pool().Exec(ctx, `
 		UPDATE subscriptions
-		SET status = $1, cancel_at_period_end = $2, updated_at = NOW()
+		SET status = $1, cancel_at_period_end = $2,
+			current_period_start = CASE WHEN $4::bigint > 0 THEN to_timestamp($4) ELSE current_period_start END,
+			current_period_end = CASE WHEN $5::bigint > 0 THEN to_timestamp($5) ELSE current_period_end END,
+			updated_at = NOW()
 		WHERE stripe_subscription_id = $3
-	`, status, cancelAtPeriodEnd, stripeSubID)
+	`, status, cancelAtPeriodEnd, subID, periodStart, periodEnd)
 	return err
 }
 
 // DeleteSubscription marks a subscription as canceled
-func (s *BillingService) DeleteSubscription(ctx context.Context, stripeSubID string) error {
+func (s *BillingService) DeleteSubscription(ctx context.Context, subID string) error {
 	_, err := s.db.Pool().Exec(ctx, `
 		UPDATE subscriptions
 		SET status = 'canceled', updated_at = NOW()
 		WHERE stripe_subscription_id = $1
-	`, stripeSubID)
+	`, subID)
 	return err
 }
 
-// RecordInvoice stores invoice information from Stripe webhook
-func (s *BillingService) RecordInvoice(ctx context.Context, userID uuid.UUID, stripeInvoiceID string, amount int64, currency, status, invoiceURL, invoicePDF string, periodStart, periodEnd int64) error {
+// InvoiceRecord holds the invoice fields reported by a payment provider
+type InvoiceRecord struct {
+	Provider        string
+	StripeInvoiceID string // provider invoice ID
+	Plan            string
+	Subtotal        int64 // in cents, before tax
+	Tax             int64 // in cents
+	Amount          int64 // in cents
+	Currency        string
+	Status          string
+	InvoiceURL      string
+	InvoicePDF      string
+	PeriodStart     int64
+	PeriodEnd       int64
+	LineItems       []models.InvoiceLineItem
+}
+
+// RecordInvoice stores invoice information reported by a payment provider
+func (s *BillingService) RecordInvoice(ctx context.Context, userID uuid.UUID, rec InvoiceRecord) error {
+	if rec.LineItems == nil {
+		rec.LineItems = []models.InvoiceLineItem{}
+	}
+	if rec.Provider == "" {
+		rec.Provider = ProviderStripe
+	}
+	lineItems, err := json.Marshal(rec.LineItems)
+	if err != nil {
+		return err
+	}
+
 	invoiceID := uuid.New()
-	_, err := s.db.Pool().Exec(ctx, `
-		INSERT INTO invoices (id, user_id, stripe_invoice_id, amount, currency, status, invoice_url, invoice_pdf, period_start, period_end, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, to_timestamp($9), to_timestamp($10), NOW())
-		ON CONFLICT (stripe_invoice_id) DO UPDATE SET status = $6, invoice_url = $7, invoice_pdf = $8
-	`, invoiceID, userID, stripeInvoiceID, amount, currency, status, invoiceURL, invoicePDF, periodStart, periodEnd)
+	_, err = s.db.Pool().Exec(ctx, `
+		INSERT INTO invoices (id, user_id, stripe_invoice_id, payment_provider, plan, subtotal, tax, amount, currency, status,
+			invoice_url, invoice_pdf, period_start, period_end, line_items, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, to_timestamp($13), to_timestamp($14), $15, NOW())
+		ON CONFLICT (stripe_invoice_id) DO UPDATE SET
+			subtotal = $6, tax = $7, amount = $8, status = $10, invoice_url = $11, invoice_pdf = $12, line_items = $15
+	`, invoiceID, userID, rec.StripeInvoiceID, rec.Provider, rec.Plan, rec.Subtotal, rec.Tax, rec.Amount, rec.Currency,
+		rec.Status, rec.InvoiceURL, rec.InvoicePDF, rec.PeriodStart, rec.PeriodEnd, lineItems)
 	return err
 }
 
@@ -482,8 +454,8 @@ func (s *BillingService) RecordInvoice(ctx context.Context, userID uuid.UUID, st
 func (s *BillingService) GetUserByStripeCustomerID(ctx context.Context, stripeCustomerID string) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, email, name, COALESCE(company, '') FROM users WHERE stripe_customer_id = $1
-	`, stripeCustomerID).Scan(&user.ID, &user.Email, &user.Name, &user.Company)
+		SELECT id, email, name, COALESCE(company, ''), payment_provider FROM users WHERE stripe_customer_id = $1
+	`, stripeCustomerID).Scan(&user.ID, &user.Email, &user.Name, &user.Company, &user.PaymentProvider)
 	if err != nil {
 		return nil, err
 	}
@@ -492,12 +464,5 @@ func (s *BillingService) GetUserByStripeCustomerID(ctx context.Context, stripeCu
 
 // GetPlanFromPriceID returns the plan name for a Stripe price ID
 func (s *BillingService) GetPlanFromPriceID(priceID string) string {
-	switch priceID {
-	case s.proPriceID:
-		return "pro"
-	case s.enterprisePriceID:
-		return "enterprise"
-	default:
-		return "unknown"
-	}
+	return s.stripe.GetPlanFromPriceID(priceID)
 }
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+var (
+	ErrBillingProfileNotFound = errors.New("billing profile not found")
+	ErrInvalidBillingProfile  = errors.New("invalid billing profile")
+	ErrInvalidTaxID           = errors.New("invalid tax ID")
+)
+
+// maxInvoiceEmails caps the number of invoice recipients per profile
+const maxInvoiceEmails = 5
+
+// taxIDFormat describes the expected format of a tax ID type
+type taxIDFormat struct {
+	country string // empty when the country is derived from the value (eu_vat)
+	pattern *regexp.Regexp
+}
+
+// taxIDFormats maps Stripe tax ID types to their country and format.
+// Values are normalized (upper-cased, spaces removed) before matching.
+var taxIDFormats = map[string]taxIDFormat{
+	"eu_vat":  {pattern: regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*]{2,13}$`)},
+	"gb_vat":  {country: "GB", pattern: regexp.MustCompile(`^GB(\d{9}|\d{12}|GD\d{3}|HA\d{3})$`)},
+	"ch_vat":  {country: "CH", pattern: regexp.MustCompile(`^CHE-?\d{3}\.?\d{3}\.?\d{3}(MWST|TVA|IVA)$`)},
+	"no_vat":  {country: "NO", pattern: regexp.MustCompile(`^\d{9}MVA$`)},
+	"us_ein":  {country: "US", pattern: regexp.MustCompile(`^\d{2}-\d{7}$`)},
+	"ca_bn":   {country: "CA", pattern: regexp.MustCompile(`^\d{9}$`)},
+	"au_abn":  {country: "AU", pattern: regexp.MustCompile(`^\d{11}$`)},
+	"nz_gst":  {country: "NZ", pattern: regexp.MustCompile(`^\d{8,9}$`)},
+	"in_gst":  {country: "IN", pattern: regexp.MustCompile(`^\d{2}[A-Z]{5}\d{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)},
+	"jp_cn":   {country: "JP", pattern: regexp.MustCompile(`^\d{13}$`)},
+	"sg_uen":  {country: "SG", pattern: regexp.MustCompile(`^(\d{8}[A-Z]|\d{9}[A-Z]|[TSR]\d{2}[A-Z]{2}\d{4}[A-Z])$`)},
+	"za_vat":  {country: "ZA", pattern: regexp.MustCompile(`^4\d{9}$`)},
+	"br_cnpj": {country: "BR", pattern: regexp.MustCompile(`^\d{2}\.\d{3}\.\d{3}/\d{4}-\d{2}$`)},
+	"mx_rfc":  {country: "MX", pattern: regexp.MustCompile(`^[A-ZÑ&]{3,4}\d{6}[A-Z0-9]{3}$`)},
+}
+
+// euVATFormats holds the per-member-state formats for eu_vat, keyed by VAT prefix
+var euVATFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^ATU\d{8}$`),
+	"BE": regexp.MustCompile(`^BE[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^BG\d{9,10}$`),
+	"CY": regexp.MustCompile(`^CY\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^CZ\d{8,10}$`),
+	"DE": regexp.MustCompile(`^DE\d{9}$`),
+	"DK": regexp.MustCompile(`^DK\d{8}$`),
+	"EE": regexp.MustCompile(`^EE\d{9}$`),
+	"EL": regexp.MustCompile(`^EL\d{9}$`),
+	"ES": regexp.MustCompile(`^ES[0-9A-Z]\d{7}[0-9A-Z]$`),
+	"FI": regexp.MustCompile(`^FI\d{8}$`),
+	"FR": regexp.MustCompile(`^FR[0-9A-Z]{2}\d{9}$`),
+	"HR": regexp.MustCompile(`^HR\d{11}$`),
+	"HU": regexp.MustCompile(`^HU\d{8}$`),
+	"IE": regexp.MustCompile(`^IE\d{7}[A-Z]{1,2}$|^IE\d[A-Z+*]\d{5}[A-Z]$`),
+	"IT": regexp.MustCompile(`^IT\d{11}$`),
+	"LT": regexp.MustCompile(`^LT(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^LU\d{8}$`),
+	"LV": regexp.MustCompile(`^LV\d{11}$`),
+	"MT": regexp.MustCompile(`^MT\d{8}$`),
+	"NL": regexp.MustCompile(`^NL\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^PL\d{10}$`),
+	"PT": regexp.MustCompile(`^PT\d{9}$`),
+	"RO": regexp.MustCompile(`^RO\d{2,10}$`),
+	"SE": regexp.MustCompile(`^SE\d{12}$`),
+	"SI": regexp.MustCompile(`^SI\d{8}$`),
+	"SK": regexp.MustCompile(`^SK\d{10}$`),
+	"XI": regexp.MustCompile(`^XI(\d{9}|\d{12})$`),
+}
+
+// SupportedTaxIDTypes returns the tax ID types accepted on billing profiles
+func SupportedTaxIDTypes() []string {
+	types := make([]string, 0, len(taxIDFormats))
+	for t := range taxIDFormats {
+		types = append(types, t)
+	}
+	return types
+}
+
+// ValidateTaxID normalizes and validates a tax ID against its type's format.
+// On success the returned TaxID carries the normalized value and its country.
+func ValidateTaxID(id models.TaxID) (models.TaxID, error) {
+	taxType := strings.ToLower(strings.TrimSpace(id.Type))
+	value := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(id.Value), " ", ""))
+
+	format, ok := taxIDFormats[taxType]
+	if !ok {
+		return id, fmt.Errorf("%w: unsupported type %q", ErrInvalidTaxID, id.Type)
+	}
+	if !format.pattern.MatchString(value) {
+		return id, fmt.Errorf("%w: %q is not a valid %s number", ErrInvalidTaxID, id.Value, taxType)
+	}
+
+	country := format.country
+	if taxType == "eu_vat" {
+		prefix := value[:2]
+		pattern, ok := euVATFormats[prefix]
+		if !ok {
+			return id, fmt.Errorf("%w: unknown EU VAT country prefix %q", ErrInvalidTaxID, prefix)
+		}
+		if !pattern.MatchString(value) {
+			return id, fmt.Errorf("%w: %q is not a valid %s VAT number", ErrInvalidTaxID, id.Value, prefix)
+		}
+		// Greece uses EL as its VAT prefix but GR as its ISO country code
+		country = prefix
+		if prefix == "EL" {
+			country = "GR"
+		}
+	}
+
+	return models.TaxID{Type: taxType, Value: value, Country: country}, nil
+}
+
+// ValidateBillingProfile normalizes and validates a billing profile in place
+func ValidateBillingProfile(profile *models.BillingProfile) error {
+	profile.LegalName = strings.TrimSpace(profile.LegalName)
+	if profile.LegalName == "" {
+		return fmt.Errorf("%w: legal_name is required", ErrInvalidBillingProfile)
+	}
+
+	profile.Country = strings.ToUpper(strings.TrimSpace(profile.Country))
+	if len(profile.Country) != 2 {
+		return fmt.Errorf("%w: country must be a two-letter ISO code", ErrInvalidBillingProfile)
+	}
+
+	taxIDs := make([]models.TaxID, 0, len(profile.TaxIDs))
+	seen := make(map[string]bool)
+	for _, id := range profile.TaxIDs {
+		normalized, err := ValidateTaxID(id)
+		if err != nil {
+			return err
+		}
+		key := normalized.Type + ":" + normalized.Value
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		taxIDs = append(taxIDs, normalized)
+	}
+	profile.TaxIDs = taxIDs
+
+	if len(profile.InvoiceEmails) > maxInvoiceEmails {
+		return fmt.Errorf("%w: at most %d invoice emails are allowed", ErrInvalidBillingProfile, maxInvoiceEmails)
+	}
+	emails := make([]string, 0, len(profile.InvoiceEmails))
+	seenEmail := make(map[string]bool)
+	for _, e := range profile.InvoiceEmails {
+		addr, err := mail.ParseAddress(strings.TrimSpace(e))
+		if err != nil {
+			return fmt.Errorf("%w: invalid invoice email %q", ErrInvalidBillingProfile, e)
+		}
+		normalized := strings.ToLower(addr.Address)
+		if seenEmail[normalized] {
+			continue
+		}
+		seenEmail[normalized] = true
+		emails = append(emails, normalized)
+	}
+	profile.InvoiceEmails = emails
+
+	return nil
+}
+
+// GetBillingProfile returns the billing profile for a user
+func (s *BillingService) GetBillingProfile(ctx context.Context, userID uuid.UUID) (*models.BillingProfile, error) {
+	var profile models.BillingProfile
+	var taxIDs []byte
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT user_id, legal_name, address_line1, address_line2, city, state, postal_code, country,
+		       tax_ids, invoice_emails, updated_at
+		FROM billing_profiles WHERE user_id = $1
+	`, userID).Scan(&profile.UserID, &profile.LegalName, &profile.AddressLine1, &profile.AddressLine2,
+		&profile.City, &profile.State, &profile.PostalCode, &profile.Country,
+		&taxIDs, &profile.InvoiceEmails, &profile.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrBillingProfileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(taxIDs, &profile.TaxIDs); err != nil {
+		return nil, fmt.Errorf("failed to decode tax IDs: %w", err)
+	}
+	return &profile, nil
+}
+
+// SaveBillingProfile validates and upserts the billing profile for a user
+func (s *BillingService) SaveBillingProfile(ctx context.Context, profile *models.BillingProfile) (*models.BillingProfile, error) {
+	if err := ValidateBillingProfile(profile); err != nil {
+		return nil, err
+	}
+
+	taxIDs, err := json.Marshal(profile.TaxIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Pool().QueryRow(ctx, `
+		INSERT INTO billing_profiles (user_id, legal_name, address_line1, address_line2, city, state, postal_code, country, tax_ids, invoice_emails)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id) DO UPDATE SET
+			legal_name = $2, address_line1 = $3, address_line2 = $4, city = $5, state = $6,
+			postal_code = $7, country = $8, tax_ids = $9, invoice_emails = $10
+		RETURNING updated_at
+	`, profile.UserID, profile.LegalName, profile.AddressLine1, profile.AddressLine2, profile.City,
+		profile.State, profile.PostalCode, profile.Country, taxIDs, profile.InvoiceEmails).Scan(&profile.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
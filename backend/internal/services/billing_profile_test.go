@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestValidateTaxID(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           models.TaxID
+		expectError     bool
+		expectedValue   string
+		expectedCountry string
+	}{
+		{"german VAT", models.TaxID{Type: "eu_vat", Value: "DE123456789"}, false, "DE123456789", "DE"},
+		{"french VAT with spaces", models.TaxID{Type: "eu_vat", Value: "fr 12 345678901"}, false, "FR12345678901", "FR"},
+		{"greek VAT maps to GR", models.TaxID{Type: "eu_vat", Value: "EL123456789"}, false, "EL123456789", "GR"},
+		{"german VAT too short", models.TaxID{Type: "eu_vat", Value: "DE12345678"}, true, "", ""},
+		{"unknown EU prefix", models.TaxID{Type: "eu_vat", Value: "US123456789"}, true, "", ""},
+		{"UK VAT", models.TaxID{Type: "gb_vat", Value: "GB123456789"}, false, "GB123456789", "GB"},
+		{"UK VAT missing prefix", models.TaxID{Type: "gb_vat", Value: "123456789"}, true, "", ""},
+		{"US EIN", models.TaxID{Type: "us_ein", Value: "12-3456789"}, false, "12-3456789", "US"},
+		{"US EIN without dash", models.TaxID{Type: "us_ein", Value: "123456789"}, true, "", ""},
+		{"Australian ABN", models.TaxID{Type: "au_abn", Value: "12 345 678 901"}, false, "12345678901", "AU"},
+		{"Indian GST", models.TaxID{Type: "in_gst", Value: "22AAAAA0000A1Z5"}, false, "22AAAAA0000A1Z5", "IN"},
+		{"type is case-insensitive", models.TaxID{Type: "EU_VAT", Value: "NL123456789B01"}, false, "NL123456789B01", "NL"},
+		{"unsupported type", models.TaxID{Type: "xx_tax", Value: "123"}, true, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateTaxID(tt.input)
+			if tt.expectError {
+				assert.True(t, errors.Is(err, ErrInvalidTaxID))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedValue, got.Value)
+			assert.Equal(t, tt.expectedCountry, got.Country)
+		})
+	}
+}
+
+func TestValidateBillingProfile(t *testing.T) {
+	t.Run("normalizes fields and dedupes", func(t *testing.T) {
+		profile := &models.BillingProfile{
+			LegalName: "  Acme GmbH ",
+			Country:   "de",
+			TaxIDs: []models.TaxID{
+				{Type: "eu_vat", Value: "DE123456789"},
+				{Type: "eu_vat", Value: "de 123456789"},
+			},
+			InvoiceEmails: []string{"AP@acme.example", "ap@acme.example", "Finance <finance@acme.example>"},
+		}
+
+		err := ValidateBillingProfile(profile)
+		assert.NoError(t, err)
+		assert.Equal(t, "Acme GmbH", profile.LegalName)
+		assert.Equal(t, "DE", profile.Country)
+		assert.Len(t, profile.TaxIDs, 1)
+		assert.Equal(t, []string{"ap@acme.example", "finance@acme.example"}, profile.InvoiceEmails)
+	})
+
+	t.Run("requires legal name", func(t *testing.T) {
+		err := ValidateBillingProfile(&models.BillingProfile{Country: "US"})
+		assert.True(t, errors.Is(err, ErrInvalidBillingProfile))
+	})
+
+	t.Run("requires two-letter country", func(t *testing.T) {
+		err := ValidateBillingProfile(&models.BillingProfile{LegalName: "Acme", Country: "USA"})
+		assert.True(t, errors.Is(err, ErrInvalidBillingProfile))
+	})
+
+	t.Run("rejects invalid invoice email", func(t *testing.T) {
+		err := ValidateBillingProfile(&models.BillingProfile{
+			LegalName:     "Acme",
+			Country:       "US",
+			InvoiceEmails: []string{"not-an-email"},
+		})
+		assert.True(t, errors.Is(err, ErrInvalidBillingProfile))
+	})
+
+	t.Run("rejects too many invoice emails", func(t *testing.T) {
+		err := ValidateBillingProfile(&models.BillingProfile{
+			LegalName:     "Acme",
+			Country:       "US",
+			InvoiceEmails: []string{"a@x.io", "b@x.io", "c@x.io", "d@x.io", "e@x.io", "f@x.io"},
+		})
+		assert.True(t, errors.Is(err, ErrInvalidBillingProfile))
+	})
+
+	t.Run("propagates tax ID errors", func(t *testing.T) {
+		err := ValidateBillingProfile(&models.BillingProfile{
+			LegalName: "Acme",
+			Country:   "US",
+			TaxIDs:    []models.TaxID{{Type: "us_ein", Value: "bad"}},
+		})
+		assert.True(t, errors.Is(err, ErrInvalidTaxID))
+	})
+}
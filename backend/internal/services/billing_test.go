@@ -116,7 +116,7 @@ func TestNewBillingService(t *testing.T) {
 	service := NewBillingService(secretKey, webhookSecret)
 
 	assert.NotNil(t, service)
-	assert.Equal(t, webhookSecret, service.webhookSecret)
+	assert.Equal(t, webhookSecret, service.stripe.webhookSecret)
 	// Verify Stripe key was set globally
 	assert.Equal(t, secretKey, stripe.Key)
 }
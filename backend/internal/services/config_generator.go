@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -58,6 +60,125 @@ func (s *ConfigGeneratorService) GenerateConfig(ctx context.Context, userID uuid
 	}
 }
 
+// setPasswordRef adds the secret reference of a connection to template data,
+// so configs point the engine at the secret instead of a password placeholder
+func setPasswordRef(data map[string]interface{}, conn *models.Connection) {
+	if conn.PasswordRef == "" {
+		return
+	}
+	data["PasswordRef"] = conn.PasswordRef
+	data["ConnectionID"] = conn.ID.String()
+	data["VaultRef"] = strings.HasPrefix(conn.PasswordRef, SecretRefVault+":")
+}
+
+// sshKeyFile is where generated configs have the engine read the private key
+// of an SSH tunnel
+const sshKeyFile = "/etc/savegress/ssh/id_key"
+
+// setSSHTunnel adds the SSH tunnel of a connection to template data. The
+// private key is never included; configs point the engine at a key file.
+func setSSHTunnel(data map[string]interface{}, conn *models.Connection) {
+	if conn.SSHTunnel == nil {
+		return
+	}
+	data["SSHTunnel"] = conn.SSHTunnel
+	data["SSHKeyFile"] = sshKeyFile
+}
+
+// certificateFile is a certificate the engine reads from a file, mounted from
+// a local file or a Kubernetes secret key
+type certificateFile struct {
+	Env       string
+	Path      string
+	Local     string
+	SecretKey string
+}
+
+// setCertificates adds the certificate files of a connection to template
+// data. PEM material is never included; configs mount it from files.
+func setCertificates(data map[string]interface{}, conn *models.Connection) {
+	if conn.TLS == nil {
+		return
+	}
+	var hasCA, hasClient bool
+	for _, c := range conn.TLS.Certificates {
+		hasCA = hasCA || c.Usage == CertificateCA
+		hasClient = hasClient || c.Usage == CertificateClient
+	}
+
+	var files []certificateFile
+	if hasCA {
+		files = append(files, certificateFile{"CDC_SOURCE_SSL_ROOT_CERT", "/etc/savegress/certs/ca.pem", "ca.pem", "ca.crt"})
+	}
+	if hasClient {
+		files = append(files,
+			certificateFile{"CDC_SOURCE_SSL_CERT", "/etc/savegress/certs/client.pem", "client.pem", "tls.crt"},
+			certificateFile{"CDC_SOURCE_SSL_KEY", "/etc/savegress/certs/client.key", "client.key", "tls.key"},
+		)
+	}
+	if len(files) > 0 {
+		data["CertificateFiles"] = files
+	}
+}
+
+// outputSetting is one target_config setting of a pipeline in generated configs
+type outputSetting struct {
+	Env     string // environment variable, e.g. CDC_OUTPUT_BATCH_SIZE
+	Compose string // quoted docker-compose environment entry
+	Key     string // Helm values key, e.g. batchSize
+	YAML    string // Helm value, quoted for strings
+	Value   string
+}
+
+// setOutput adds the target of a pipeline and every setting of its
+// target_config to template data, under the canonical target name
+func setOutput(data map[string]interface{}, pipeline *models.Pipeline) {
+	target, ok := FindTargetType(pipeline.TargetType)
+	if !ok {
+		data["OutputType"] = pipeline.TargetType
+		return
+	}
+	data["OutputType"] = target.Name
+
+	keys := make([]string, 0, len(pipeline.TargetConfig))
+	for key, value := range pipeline.TargetConfig {
+		if _, known := target.Schema.Properties[key]; known && value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	settings := make([]outputSetting, 0, len(keys))
+	for _, key := range keys {
+		value := pipeline.TargetConfig[key]
+		env := "CDC_OUTPUT_" + strings.ToUpper(key)
+		yamlValue := value
+		if target.Schema.Properties[key].Type == "string" {
+			yamlValue = strconv.Quote(value)
+		}
+		settings = append(settings, outputSetting{
+			Env: env,
+			// docker-compose would substitute ${...} templates meant for the engine
+			Compose: strconv.Quote(env + "=" + strings.ReplaceAll(value, "$", "$$")),
+			Key:     helmKey(key),
+			YAML:    yamlValue,
+			Value:   value,
+		})
+	}
+	data["OutputSettings"] = settings
+}
+
+// helmKey converts a snake_case setting to the camelCase of Helm values
+func helmKey(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
 func (s *ConfigGeneratorService) generateDockerCompose(pipeline *models.Pipeline, sourceConn *models.Connection, licenseKey string) (string, error) {
 	tmpl := `# Savegress CDC Engine - Docker Compose Configuration
 # Generated for your pipeline
@@ -81,13 +202,27 @@ services:
       - CDC_SOURCE_PORT={{.SourcePort}}
       - CDC_SOURCE_DATABASE={{.SourceDatabase}}
       - CDC_SOURCE_USER={{.SourceUser}}
-      - CDC_SOURCE_PASSWORD=${SOURCE_DB_PASSWORD}
+      {{if .PasswordRef}}# Resolved by the engine, which also reports connection tests for it
+      - CDC_SOURCE_PASSWORD_REF={{.PasswordRef}}
+      - CDC_SOURCE_CONNECTION_ID={{.ConnectionID}}{{if .VaultRef}}
+      - VAULT_ADDR=${VAULT_ADDR}
+      - VAULT_TOKEN=${VAULT_TOKEN}{{end}}{{else}}- CDC_SOURCE_PASSWORD=${SOURCE_DB_PASSWORD}{{end}}
       {{if .SourceSSL}}- CDC_SOURCE_SSL_MODE={{.SourceSSL}}{{end}}
-
+{{with .SSHTunnel}}
+      # SSH tunnel
+      - CDC_SOURCE_SSH_HOST={{.Host}}
+      - CDC_SOURCE_SSH_PORT={{.Port}}
+      - CDC_SOURCE_SSH_USER={{.User}}
+      - CDC_SOURCE_SSH_PRIVATE_KEY_FILE={{$.SSHKeyFile}}
+      - CDC_SOURCE_SSH_HOST_KEY_FINGERPRINT={{.HostKeyFingerprint}}
+{{end}}{{with .CertificateFiles}}
+      # Certificates
+{{range .}}      - {{.Env}}={{.Path}}
+{{end}}{{end}}
       # Output Configuration
       - CDC_OUTPUT_TYPE={{.OutputType}}
-      {{if .OutputURL}}- CDC_OUTPUT_URL={{.OutputURL}}{{end}}
-
+{{range .OutputSettings}}      - {{.Compose}}
+{{end}}
       # Tables to replicate (comma-separated)
       {{if .Tables}}- CDC_TABLES={{.Tables}}{{end}}
 
@@ -97,7 +232,9 @@ services:
 
     volumes:
       - savegress-data:/var/lib/savegress
-    ports:
+      {{if .SSHTunnel}}- ./ssh/id_key:{{.SSHKeyFile}}:ro{{end}}
+{{range .CertificateFiles}}      - ./certs/{{.Local}}:{{.Path}}:ro
+{{end}}    ports:
       - "9090:9090"  # Metrics endpoint
     healthcheck:
       test: ["CMD", "curl", "-f", "http://localhost:9090/health"]
@@ -109,10 +246,16 @@ volumes:
   savegress-data:
 
 # To run:
-# 1. Set environment variable: export SOURCE_DB_PASSWORD=your_password
-# 2. Run: docker-compose up -d
+{{if .PasswordRef}}{{if .VaultRef}}# 1. Set environment variables: export VAULT_ADDR=https://vault:8200 VAULT_TOKEN=your_token
+{{else}}# 1. Make {{.PasswordRef}} available to the container
+{{end}}{{else}}# 1. Set environment variable: export SOURCE_DB_PASSWORD=your_password
+{{end}}{{if .SSHTunnel}}# 2. Save the SSH private key of the tunnel as ./ssh/id_key (chmod 600)
+# 3. Run: docker-compose up -d
+# 4. Check logs: docker-compose logs -f savegress-engine
+{{else}}# 2. Run: docker-compose up -d
 # 3. Check logs: docker-compose logs -f savegress-engine
-`
+{{end}}{{with .CertificateFiles}}# Before running, save the database certificates as{{range .}} ./certs/{{.Local}}{{end}}
+{{end}}`
 
 	data := map[string]interface{}{
 		"LicenseKey":     licenseKey,
@@ -123,7 +266,6 @@ volumes:
 		"SourceUser":     "replication_user",
 		"SourceSSL":      "prefer",
 		"OutputType":     "http",
-		"OutputURL":      "",
 		"Tables":         "",
 	}
 
@@ -134,13 +276,13 @@ volumes:
 		data["SourceDatabase"] = sourceConn.Database
 		data["SourceUser"] = sourceConn.Username
 		data["SourceSSL"] = sourceConn.SSLMode
+		setPasswordRef(data, sourceConn)
+		setSSHTunnel(data, sourceConn)
+		setCertificates(data, sourceConn)
 	}
 
 	if pipeline != nil {
-		data["OutputType"] = pipeline.TargetType
-		if url, ok := pipeline.TargetConfig["url"]; ok {
-			data["OutputURL"] = url
-		}
+		setOutput(data, pipeline)
 		if len(pipeline.Tables) > 0 {
 			data["Tables"] = strings.Join(pipeline.Tables, ",")
 		}
@@ -182,16 +324,36 @@ source:
   port: {{.SourcePort}}
   database: {{.SourceDatabase}}
   username: {{.SourceUser}}
-  # Password from secret:
+{{if .PasswordRef}}  # Password resolved by the engine:
+  passwordRef: "{{.PasswordRef}}"
+  connectionId: "{{.ConnectionID}}"
+{{else}}  # Password from secret:
   existingSecret: "source-db-credentials"
   secretKey: "password"
-  sslMode: {{.SourceSSL}}
-
+{{end}}  sslMode: {{.SourceSSL}}
+{{with .SSHTunnel}}  # SSH tunnel to the database
+  sshTunnel:
+    enabled: true
+    host: {{.Host}}
+    port: {{.Port}}
+    user: {{.User}}
+    hostKeyFingerprint: "{{.HostKeyFingerprint}}"
+    # Private key from secret:
+    existingSecret: "source-ssh-key"
+    secretKey: "private-key"
+{{end}}{{with .CertificateFiles}}  # Certificates from secret, created with:
+  #   kubectl create secret generic source-db-tls{{range .}} --from-file={{.SecretKey}}={{.Local}}{{end}}
+  tls:
+    existingSecret: "source-db-tls"
+{{range .}}{{if eq .SecretKey "ca.crt"}}    caCertKey: "ca.crt"
+{{else if eq .SecretKey "tls.crt"}}    clientCertKey: "tls.crt"
+{{else}}    clientKeyKey: "tls.key"
+{{end}}{{end}}{{end}}
 # Output configuration
 output:
   type: {{.OutputType}}
-  {{if .OutputURL}}url: {{.OutputURL}}{{end}}
-
+{{range .OutputSettings}}  {{.Key}}: {{.YAML}}
+{{end}}
 # Tables to replicate
 tables:
 {{range .TablesList}}  - {{.}}
@@ -235,7 +397,6 @@ affinity: {}
 		"SourceUser":     "replication_user",
 		"SourceSSL":      "prefer",
 		"OutputType":     "http",
-		"OutputURL":      "",
 		"TablesList":     []string{"public.*"},
 	}
 
@@ -246,13 +407,13 @@ affinity: {}
 		data["SourceDatabase"] = sourceConn.Database
 		data["SourceUser"] = sourceConn.Username
 		data["SourceSSL"] = sourceConn.SSLMode
+		setPasswordRef(data, sourceConn)
+		setSSHTunnel(data, sourceConn)
+		setCertificates(data, sourceConn)
 	}
 
 	if pipeline != nil {
-		data["OutputType"] = pipeline.TargetType
-		if url, ok := pipeline.TargetConfig["url"]; ok {
-			data["OutputURL"] = url
-		}
+		setOutput(data, pipeline)
 		if len(pipeline.Tables) > 0 {
 			data["TablesList"] = pipeline.Tables
 		}
@@ -286,13 +447,27 @@ CDC_SOURCE_HOST={{.SourceHost}}
 CDC_SOURCE_PORT={{.SourcePort}}
 CDC_SOURCE_DATABASE={{.SourceDatabase}}
 CDC_SOURCE_USER={{.SourceUser}}
-CDC_SOURCE_PASSWORD=your_password_here
-CDC_SOURCE_SSL_MODE={{.SourceSSL}}
-
+{{if .PasswordRef}}CDC_SOURCE_PASSWORD_REF={{.PasswordRef}}
+CDC_SOURCE_CONNECTION_ID={{.ConnectionID}}
+{{if .VaultRef}}VAULT_ADDR=https://your-vault:8200
+VAULT_TOKEN=your_vault_token
+{{end}}{{else}}CDC_SOURCE_PASSWORD=your_password_here
+{{end}}CDC_SOURCE_SSL_MODE={{.SourceSSL}}
+{{with .SSHTunnel}}
+# SSH Tunnel
+CDC_SOURCE_SSH_HOST={{.Host}}
+CDC_SOURCE_SSH_PORT={{.Port}}
+CDC_SOURCE_SSH_USER={{.User}}
+CDC_SOURCE_SSH_PRIVATE_KEY_FILE={{$.SSHKeyFile}}
+CDC_SOURCE_SSH_HOST_KEY_FINGERPRINT={{.HostKeyFingerprint}}
+{{end}}{{with .CertificateFiles}}
+# Certificates
+{{range .}}{{.Env}}={{.Path}}
+{{end}}{{end}}
 # Output Configuration
 CDC_OUTPUT_TYPE={{.OutputType}}
-{{if .OutputURL}}CDC_OUTPUT_URL={{.OutputURL}}{{end}}
-
+{{range .OutputSettings}}{{.Env}}={{.Value}}
+{{end}}
 # Tables (comma-separated)
 {{if .Tables}}CDC_TABLES={{.Tables}}{{end}}
 
@@ -318,7 +493,6 @@ CDC_LOG_FORMAT=json
 		"SourceUser":     "replication_user",
 		"SourceSSL":      "prefer",
 		"OutputType":     "http",
-		"OutputURL":      "",
 		"Tables":         "",
 	}
 
@@ -329,13 +503,13 @@ CDC_LOG_FORMAT=json
 		data["SourceDatabase"] = sourceConn.Database
 		data["SourceUser"] = sourceConn.Username
 		data["SourceSSL"] = sourceConn.SSLMode
+		setPasswordRef(data, sourceConn)
+		setSSHTunnel(data, sourceConn)
+		setCertificates(data, sourceConn)
 	}
 
 	if pipeline != nil {
-		data["OutputType"] = pipeline.TargetType
-		if url, ok := pipeline.TargetConfig["url"]; ok {
-			data["OutputURL"] = url
-		}
+		setOutput(data, pipeline)
 		if len(pipeline.Tables) > 0 {
 			data["Tables"] = strings.Join(pipeline.Tables, ",")
 		}
@@ -363,9 +537,15 @@ func (s *ConfigGeneratorService) generateSystemdUnit(pipeline *models.Pipeline,
 # 1. Download binary: curl -L https://releases.savegress.io/cdc-engine/latest/cdc-engine-linux-amd64 -o /usr/local/bin/cdc-engine
 # 2. Make executable: chmod +x /usr/local/bin/cdc-engine
 # 3. Create config: cp savegress.env /etc/savegress/savegress.env
-# 4. Install service: cp savegress.service /etc/systemd/system/
+{{if .SSHTunnel}}# 4. Install the SSH tunnel key: install -D -m 600 -o savegress id_key {{.SSHKeyFile}}
+# 5. Install service: cp savegress.service /etc/systemd/system/
+# 6. Enable service: systemctl enable savegress && systemctl start savegress
+{{else}}# 4. Install service: cp savegress.service /etc/systemd/system/
 # 5. Enable service: systemctl enable savegress && systemctl start savegress
-
+{{end}}{{with .CertificateFiles}}#
+# Install the database certificates before starting:
+{{range .}}#   install -D -m 600 -o savegress {{.Local}} {{.Path}}
+{{end}}{{end}}
 [Unit]
 Description=Savegress CDC Engine
 Documentation=https://docs.savegress.io
@@ -399,7 +579,23 @@ MemoryMax=1G
 WantedBy=multi-user.target
 `
 
-	return tmpl, nil
+	data := map[string]interface{}{}
+	if sourceConn != nil {
+		setSSHTunnel(data, sourceConn)
+		setCertificates(data, sourceConn)
+	}
+
+	t, err := template.New("systemd").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
 }
 
 // GenerateQuickStart generates a quick start guide
@@ -2,15 +2,9 @@ package services
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"database/sql"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
-	"net"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,68 +22,147 @@ var (
 
 // ConnectionService handles database connection management
 type ConnectionService struct {
-	db            *repository.PostgresDB
-	encryptionKey []byte
+	db           *repository.PostgresDB
+	keyring      *Keyring
+	testers      map[string]ConnectionTester
+	redis        *repository.RedisClient
+	emailService *EmailService
 }
 
-// NewConnectionService creates a new connection service
+// NewConnectionService creates a new connection service. The key is padded or
+// truncated to 32 bytes; production keyrings are validated and set with SetKeyring.
 func NewConnectionService(db *repository.PostgresDB, encryptionKey string) *ConnectionService {
-	key := make([]byte, 32)
+	key := make([]byte, EncryptionKeySize)
 	copy(key, []byte(encryptionKey))
-	return &ConnectionService{
-		db:            db,
-		encryptionKey: key,
+	keyring, _ := NewKeyring(DefaultEncryptionKeyID, key, nil)
+	s := &ConnectionService{
+		db:      db,
+		keyring: keyring,
+		testers: make(map[string]ConnectionTester),
+	}
+	for _, tester := range defaultConnectionTesters() {
+		s.RegisterTester(tester)
+	}
+	return s
+}
+
+// SetKeyring replaces the keys credentials are encrypted with
+func (s *ConnectionService) SetKeyring(keyring *Keyring) {
+	s.keyring = keyring
+}
+
+// SetEmailService enables certificate expiry notices
+func (s *ConnectionService) SetEmailService(emailService *EmailService) {
+	s.emailService = emailService
+}
+
+// RegisterTester makes a connection tester available for the types it handles,
+// replacing any tester registered for them before
+func (s *ConnectionService) RegisterTester(tester ConnectionTester) {
+	for _, connType := range tester.Types() {
+		s.testers[connType] = tester
 	}
 }
 
 // CreateConnection creates a new database connection
 func (s *ConnectionService) CreateConnection(ctx context.Context, userID uuid.UUID, conn *models.Connection) (*models.Connection, error) {
+	return s.createConnection(ctx, s.db.Pool(), userID, conn)
+}
+
+func (s *ConnectionService) createConnection(ctx context.Context, q querier, userID uuid.UUID, conn *models.Connection) (*models.Connection, error) {
 	conn.ID = uuid.New()
 	conn.UserID = userID
 	conn.CreatedAt = time.Now().UTC()
 	conn.UpdatedAt = conn.CreatedAt
 
-	// Encrypt password
-	encryptedPass, err := s.encryptPassword(conn.Password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt password: %w", err)
+	// Encrypt password, unless only the engine knows it
+	encryptedPass := ""
+	if conn.PasswordRef != "" {
+		if conn.Password != "" {
+			return nil, fmt.Errorf("%w: set either password or password_ref", ErrInvalidSecretRef)
+		}
+		ref, err := ParseSecretRef(conn.PasswordRef)
+		if err != nil {
+			return nil, err
+		}
+		conn.PasswordRef = ref.String()
+	} else {
+		var err error
+		encryptedPass, err = s.encryptPassword(conn.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt password: %w", err)
+		}
+	}
+
+	// The SSH private key is encrypted like the password
+	var tunnel models.SSHTunnel
+	if conn.SSHTunnel != nil {
+		if conn.SSHTunnel.PrivateKey == "" {
+			return nil, fmt.Errorf("%w: private_key is required", ErrInvalidSSHTunnel)
+		}
+		if err := validateSSHTunnel(conn.SSHTunnel); err != nil {
+			return nil, err
+		}
+		tunnel = *conn.SSHTunnel
+		encryptedKey, err := s.encryptPassword(tunnel.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt SSH private key: %w", err)
+		}
+		tunnel.PrivateKey = encryptedKey
 	}
 
-	_, err = s.db.Pool().Exec(ctx, `
-		INSERT INTO connections (id, user_id, name, type, host, port, database, username, password, ssl_mode, options, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	_, err := q.Exec(ctx, `
+		INSERT INTO connections (id, user_id, name, type, host, port, database, username, password, password_ref, ssl_mode, options,
+			ssh_host, ssh_port, ssh_user, ssh_private_key, ssh_host_key_fingerprint, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12,
+			NULLIF($13, ''), NULLIF($14, 0), NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''), $18, $19)
 	`, conn.ID, conn.UserID, conn.Name, conn.Type, conn.Host, conn.Port, conn.Database,
-		conn.Username, encryptedPass, conn.SSLMode, conn.Options, conn.CreatedAt, conn.UpdatedAt)
+		conn.Username, encryptedPass, conn.PasswordRef, conn.SSLMode, conn.Options,
+		tunnel.Host, tunnel.Port, tunnel.User, tunnel.PrivateKey, tunnel.HostKeyFingerprint, conn.CreatedAt, conn.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection: %w", err)
 	}
 
 	conn.Password = "" // Don't return password
+	if conn.SSHTunnel != nil {
+		conn.SSHTunnel.PrivateKey = ""
+	}
 	return conn, nil
 }
 
 // GetConnection retrieves a connection by ID
 func (s *ConnectionService) GetConnection(ctx context.Context, userID, connID uuid.UUID) (*models.Connection, error) {
+	return s.getConnection(ctx, s.db.Pool(), userID, connID)
+}
+
+func (s *ConnectionService) getConnection(ctx context.Context, q querier, userID, connID uuid.UUID) (*models.Connection, error) {
 	var conn models.Connection
-	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, user_id, name, type, host, port, database, username, ssl_mode, options, last_tested_at, test_status, created_at, updated_at
+	var tunnel sshTunnelRow
+	var certs tlsRow
+	err := q.QueryRow(ctx, `
+		SELECT id, user_id, name, type, host, port, database, username, COALESCE(password_ref, ''), ssl_mode, options,
+			`+sshTunnelColumns+`, `+tlsColumns+`, last_tested_at, test_status, COALESCE(test_error, ''), created_at, updated_at
 		FROM connections WHERE id = $1 AND user_id = $2
 	`, connID, userID).Scan(&conn.ID, &conn.UserID, &conn.Name, &conn.Type, &conn.Host, &conn.Port,
-		&conn.Database, &conn.Username, &conn.SSLMode, &conn.Options, &conn.LastTestedAt, &conn.TestStatus,
-		&conn.CreatedAt, &conn.UpdatedAt)
+		&conn.Database, &conn.Username, &conn.PasswordRef, &conn.SSLMode, &conn.Options,
+		&tunnel.Host, &tunnel.Port, &tunnel.User, &tunnel.HostKeyFingerprint, &certs.Certificates, &certs.ExpiresAt,
+		&conn.LastTestedAt, &conn.TestStatus, &conn.TestError, &conn.CreatedAt, &conn.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrConnectionNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	conn.SSHTunnel = tunnel.orNil()
+	conn.TLS = certs.orNil(time.Now().UTC())
 	return &conn, nil
 }
 
 // ListConnections returns all connections for a user
 func (s *ConnectionService) ListConnections(ctx context.Context, userID uuid.UUID) ([]models.Connection, error) {
 	rows, err := s.db.Pool().Query(ctx, `
-		SELECT id, user_id, name, type, host, port, database, username, ssl_mode, options, last_tested_at, test_status, created_at, updated_at
+		SELECT id, user_id, name, type, host, port, database, username, COALESCE(password_ref, ''), ssl_mode, options,
+			`+sshTunnelColumns+`, `+tlsColumns+`, last_tested_at, test_status, COALESCE(test_error, ''), created_at, updated_at
 		FROM connections WHERE user_id = $1 ORDER BY created_at DESC
 	`, userID)
 	if err != nil {
@@ -97,15 +170,21 @@ func (s *ConnectionService) ListConnections(ctx context.Context, userID uuid.UUI
 	}
 	defer rows.Close()
 
+	now := time.Now().UTC()
 	connections := make([]models.Connection, 0)
 	for rows.Next() {
 		var conn models.Connection
+		var tunnel sshTunnelRow
+		var certs tlsRow
 		err := rows.Scan(&conn.ID, &conn.UserID, &conn.Name, &conn.Type, &conn.Host, &conn.Port,
-			&conn.Database, &conn.Username, &conn.SSLMode, &conn.Options, &conn.LastTestedAt, &conn.TestStatus,
-			&conn.CreatedAt, &conn.UpdatedAt)
+			&conn.Database, &conn.Username, &conn.PasswordRef, &conn.SSLMode, &conn.Options,
+			&tunnel.Host, &tunnel.Port, &tunnel.User, &tunnel.HostKeyFingerprint, &certs.Certificates, &certs.ExpiresAt,
+			&conn.LastTestedAt, &conn.TestStatus, &conn.TestError, &conn.CreatedAt, &conn.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		conn.SSHTunnel = tunnel.orNil()
+		conn.TLS = certs.orNil(now)
 		connections = append(connections, conn)
 	}
 	return connections, nil
@@ -113,8 +192,12 @@ func (s *ConnectionService) ListConnections(ctx context.Context, userID uuid.UUI
 
 // UpdateConnection updates a connection
 func (s *ConnectionService) UpdateConnection(ctx context.Context, userID, connID uuid.UUID, updates map[string]interface{}) (*models.Connection, error) {
+	return s.updateConnection(ctx, s.db.Pool(), userID, connID, updates)
+}
+
+func (s *ConnectionService) updateConnection(ctx context.Context, q querier, userID, connID uuid.UUID, updates map[string]interface{}) (*models.Connection, error) {
 	// Get existing connection
-	conn, err := s.GetConnection(ctx, userID, connID)
+	conn, err := s.getConnection(ctx, q, userID, connID)
 	if err != nil {
 		return nil, err
 	}
@@ -139,25 +222,53 @@ func (s *ConnectionService) UpdateConnection(ctx context.Context, userID, connID
 		conn.SSLMode = sslMode
 	}
 
+	// A null ssh_tunnel removes the tunnel
+	tunnelValue, tunnelUpdate := updates["ssh_tunnel"]
+	var tunnel *models.SSHTunnel
+	if tunnelUpdate {
+		tunnel, err = s.mergeSSHTunnel(conn.SSHTunnel, tunnelValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	conn.UpdatedAt = time.Now().UTC()
 
-	// Handle password update separately
+	// Handle password update separately. A password replaces a secret
+	// reference and the other way around.
 	passwordUpdate := ""
-	if password, ok := updates["password"].(string); ok && password != "" {
+	password, _ := updates["password"].(string)
+	passwordRef, refUpdate := updates["password_ref"].(string)
+	switch {
+	case refUpdate && passwordRef != "":
+		if password != "" {
+			return nil, fmt.Errorf("%w: set either password or password_ref", ErrInvalidSecretRef)
+		}
+		ref, err := ParseSecretRef(passwordRef)
+		if err != nil {
+			return nil, err
+		}
+		conn.PasswordRef = ref.String()
+	case password != "":
 		encryptedPass, err := s.encryptPassword(password)
 		if err != nil {
 			return nil, fmt.Errorf("failed to encrypt password: %w", err)
 		}
 		passwordUpdate = encryptedPass
-	}
-
-	if passwordUpdate != "" {
-		_, err = s.db.Pool().Exec(ctx, `
-			UPDATE connections SET name = $1, host = $2, port = $3, database = $4, username = $5, password = $6, ssl_mode = $7, updated_at = $8
-			WHERE id = $9 AND user_id = $10
-		`, conn.Name, conn.Host, conn.Port, conn.Database, conn.Username, passwordUpdate, conn.SSLMode, conn.UpdatedAt, connID, userID)
+		conn.PasswordRef = ""
+	case refUpdate && conn.PasswordRef != "":
+		return nil, fmt.Errorf("%w: a password is required to remove password_ref", ErrInvalidSecretRef)
+	}
+
+	if passwordUpdate != "" || conn.PasswordRef != "" {
+		_, err = q.Exec(ctx, `
+			UPDATE connections SET name = $1, host = $2, port = $3, database = $4, username = $5, password = $6,
+				password_ref = NULLIF($7, ''), ssl_mode = $8, updated_at = $9
+			WHERE id = $10 AND user_id = $11
+		`, conn.Name, conn.Host, conn.Port, conn.Database, conn.Username, passwordUpdate, conn.PasswordRef,
+			conn.SSLMode, conn.UpdatedAt, connID, userID)
 	} else {
-		_, err = s.db.Pool().Exec(ctx, `
+		_, err = q.Exec(ctx, `
 			UPDATE connections SET name = $1, host = $2, port = $3, database = $4, username = $5, ssl_mode = $6, updated_at = $7
 			WHERE id = $8 AND user_id = $9
 		`, conn.Name, conn.Host, conn.Port, conn.Database, conn.Username, conn.SSLMode, conn.UpdatedAt, connID, userID)
@@ -166,6 +277,17 @@ func (s *ConnectionService) UpdateConnection(ctx context.Context, userID, connID
 		return nil, fmt.Errorf("failed to update connection: %w", err)
 	}
 
+	if tunnelUpdate {
+		if err := s.saveSSHTunnel(ctx, q, userID, connID, tunnel); err != nil {
+			return nil, fmt.Errorf("failed to update connection: %w", err)
+		}
+		if tunnel != nil {
+			tunnel.PrivateKey = ""
+		}
+		conn.SSHTunnel = tunnel
+	}
+	s.invalidateCatalog(ctx, connID)
+
 	return conn, nil
 }
 
@@ -184,18 +306,33 @@ func (s *ConnectionService) DeleteConnection(ctx context.Context, userID, connID
 	}
 
 	_, err = s.db.Pool().Exec(ctx, `DELETE FROM connections WHERE id = $1 AND user_id = $2`, connID, userID)
-	return err
+	if err != nil {
+		return err
+	}
+	s.invalidateCatalog(ctx, connID)
+	return nil
 }
 
 // TestConnection tests a database connection
 func (s *ConnectionService) TestConnection(ctx context.Context, userID, connID uuid.UUID) error {
+	return s.runConnectionTest(ctx, userID, connID, ConnectionTestManual)
+}
+
+// runConnectionTest tests a stored connection and records the result in its
+// health history
+func (s *ConnectionService) runConnectionTest(ctx context.Context, userID, connID uuid.UUID, trigger string) error {
 	// Get connection with password
 	var conn models.Connection
 	var encryptedPass string
+	var tunnel sshTunnelRow
+	var certs tlsRow
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, type, host, port, database, username, password, ssl_mode
+		SELECT id, type, host, port, database, username, password, COALESCE(password_ref, ''), ssl_mode, options,
+			`+sshTunnelColumns+`, COALESCE(ssh_private_key, ''), `+tlsColumns+`, `+tlsMaterialColumns+`
 		FROM connections WHERE id = $1 AND user_id = $2
-	`, connID, userID).Scan(&conn.ID, &conn.Type, &conn.Host, &conn.Port, &conn.Database, &conn.Username, &encryptedPass, &conn.SSLMode)
+	`, connID, userID).Scan(&conn.ID, &conn.Type, &conn.Host, &conn.Port, &conn.Database, &conn.Username, &encryptedPass, &conn.PasswordRef, &conn.SSLMode, &conn.Options,
+		&tunnel.Host, &tunnel.Port, &tunnel.User, &tunnel.HostKeyFingerprint, &tunnel.PrivateKey,
+		&certs.Certificates, &certs.ExpiresAt, &certs.CACert, &certs.ClientCert, &certs.ClientKey)
 	if err == pgx.ErrNoRows {
 		return ErrConnectionNotFound
 	}
@@ -203,155 +340,254 @@ func (s *ConnectionService) TestConnection(ctx context.Context, userID, connID u
 		return err
 	}
 
+	// Only the engine can resolve the password, so it runs the test and
+	// reports the result with RecordEngineTest
+	if conn.PasswordRef != "" {
+		_, err := s.db.Pool().Exec(ctx, `
+			UPDATE connections SET test_status = 'pending', test_error = NULL WHERE id = $1
+		`, connID)
+		if err != nil {
+			return err
+		}
+		return ErrSecretResolvedByEngine
+	}
+
 	// Decrypt password
 	password, err := s.decryptPassword(encryptedPass)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt password: %w", err)
 	}
+	sshTunnel, err := s.decryptSSHTunnel(tunnel.orNil())
+	if err != nil {
+		return err
+	}
+	certificates, err := s.decryptTLS(certs.orNil(time.Now().UTC()))
+	if err != nil {
+		return err
+	}
 
 	// Test connection
-	testErr := s.doConnectionTest(ctx, conn.Type, conn.Host, conn.Port, conn.Database, conn.Username, password, conn.SSLMode)
-
-	// Update test status
-	now := time.Now().UTC()
-	status := "success"
-	if testErr != nil {
-		status = "failed"
+	start := time.Now()
+	testErr := s.doConnectionTest(ctx, &ConnectionParams{
+		Type:     conn.Type,
+		Host:     conn.Host,
+		Port:     conn.Port,
+		Database: conn.Database,
+		Username: conn.Username,
+		Password: password,
+		SSLMode:  conn.SSLMode,
+		Options:  conn.Options,
+
+		SSHTunnel:    sshTunnel,
+		Certificates: certificates,
+	})
+
+	test := newConnectionTest(connID, trigger, time.Since(start), testErr)
+	if err := s.recordConnectionTest(ctx, userID, test); err != nil {
+		log.Printf("Failed to record test of connection %s: %v", connID, err)
 	}
 
-	_, _ = s.db.Pool().Exec(ctx, `
-		UPDATE connections SET last_tested_at = $1, test_status = $2 WHERE id = $3
-	`, now, status, connID)
-
 	return testErr
 }
 
-// TestConnectionDirect tests a connection without saving
-func (s *ConnectionService) TestConnectionDirect(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error {
-	return s.doConnectionTest(ctx, connType, host, port, database, username, password, sslMode)
+// EngineTestResult is a connection test run by an engine
+type EngineTestResult struct {
+	ConnectionID uuid.UUID `json:"connection_id"`
+	Success      bool      `json:"success"`
+	Category     string    `json:"category,omitempty"` // as in ConnectionTestError
+	Message      string    `json:"message,omitempty"`
+	LatencyMs    *int64    `json:"latency_ms,omitempty"`
 }
 
-func (s *ConnectionService) doConnectionTest(ctx context.Context, connType, host string, port int, database, username, password, sslMode string) error {
-	// First, test TCP connectivity
-	address := fmt.Sprintf("%s:%d", host, port)
-	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
-	if err != nil {
-		return fmt.Errorf("cannot connect to %s: %w", address, err)
-	}
-	conn.Close()
-
-	// Then test database-specific connection
-	switch connType {
-	case "postgres", "postgresql":
-		return s.testPostgres(ctx, host, port, database, username, password, sslMode)
-	case "mysql", "mariadb":
-		return s.testMySQL(ctx, host, port, database, username, password, sslMode)
-	default:
-		// For other types, just TCP test is enough for now
-		return nil
-	}
+// RecordEngineTest stores the result of a connection test an engine of the
+// connection's owner ran, typically because the password is a secret reference
+func (s *ConnectionService) RecordEngineTest(ctx context.Context, userID uuid.UUID, result *EngineTestResult) error {
+	test := &models.ConnectionTest{
+		ConnectionID: result.ConnectionID,
+		Status:       ConnectionTestSuccess,
+		Trigger:      ConnectionTestEngine,
+		LatencyMs:    result.LatencyMs,
+	}
+	if !result.Success {
+		test.Status = ConnectionTestFailed
+		test.Category = result.Category
+		test.Message = result.Message
+	}
+	return s.recordConnectionTest(ctx, userID, test)
 }
 
-func (s *ConnectionService) testPostgres(ctx context.Context, host string, port int, database, username, password, sslMode string) error {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		username, password, host, port, database, sslMode)
-
-	db, err := sql.Open("pgx", dsn)
-	if err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
-	}
-	defer db.Close()
-
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	if err := db.PingContext(ctx); err != nil {
-		return fmt.Errorf("ping failed: %w", err)
+// TestConnectionDirect tests a connection without saving, through tunnel
+// when it isn't nil
+func (s *ConnectionService) TestConnectionDirect(ctx context.Context, connType, host string, port int, database, username, password, sslMode string, tunnel *models.SSHTunnel) error {
+	if tunnel != nil {
+		if err := validateSSHTunnel(tunnel); err != nil {
+			return newConnectionTestError(ConnErrConfig, nil, "%s", err.Error())
+		}
 	}
-
-	return nil
+	return s.doConnectionTest(ctx, &ConnectionParams{
+		Type:      connType,
+		Host:      host,
+		Port:      port,
+		Database:  database,
+		Username:  username,
+		Password:  password,
+		SSLMode:   sslMode,
+		SSHTunnel: tunnel,
+	})
 }
 
-func (s *ConnectionService) testMySQL(ctx context.Context, host string, port int, database, username, password, sslMode string) error {
-	// MySQL DSN format: username:password@tcp(host:port)/database
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", username, password, host, port, database)
-
-	db, err := sql.Open("mysql", dsn)
+func (s *ConnectionService) doConnectionTest(ctx context.Context, p *ConnectionParams) error {
+	tester, ok := s.testers[p.Type]
+	if !ok {
+		return newConnectionTestError(ConnErrConfig, nil, "unsupported connection type %q", p.Type)
+	}
+	sslMode, err := normalizeSSLMode(p.SSLMode)
 	if err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+		return err
 	}
-	defer db.Close()
-
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	if err := db.PingContext(ctx); err != nil {
-		return fmt.Errorf("ping failed: %w", err)
+	p.SSLMode = sslMode
+	if err := p.loadCertificates(); err != nil {
+		return err
 	}
-
-	return nil
+	return withSSHTunnel(ctx, p, func(p *ConnectionParams) error {
+		return tester.Test(ctx, p)
+	})
 }
 
 // Encryption helpers
 func (s *ConnectionService) encryptPassword(password string) (string, error) {
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return "", err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
+	return s.keyring.Encrypt(password)
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
+func (s *ConnectionService) decryptPassword(encrypted string) (string, error) {
+	return s.keyring.Decrypt(encrypted)
+}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(password), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+// HasLegacyCredentials reports whether any stored credential predates envelope
+// encryption. Those may be encrypted with the former default key.
+func (s *ConnectionService) HasLegacyCredentials(ctx context.Context) (bool, error) {
+	var exists bool
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM connections
+			WHERE (password <> '' AND password NOT LIKE $1)
+				OR (ssh_private_key <> '' AND ssh_private_key NOT LIKE $1)
+				OR (tls_ca_cert <> '' AND tls_ca_cert NOT LIKE $1)
+				OR (tls_client_cert <> '' AND tls_client_cert NOT LIKE $1)
+				OR (tls_client_key <> '' AND tls_client_key NOT LIKE $1)
+		)
+	`, envelopeVersion+":%").Scan(&exists)
+	return exists, err
 }
 
-func (s *ConnectionService) decryptPassword(encrypted string) (string, error) {
-	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
-	if err != nil {
-		return "", err
+// reencryptBatchSize bounds the rows re-encrypted per query
+const reencryptBatchSize = 100
+
+// ReencryptCredentials rewraps stored passwords, SSH private keys and
+// certificates that aren't wrapped by the primary key, so retired keys can be removed. Values
+// that fail are skipped and counted in failed.
+func (s *ConnectionService) ReencryptCredentials(ctx context.Context) (rewrapped, failed int, err error) {
+	for _, column := range []string{"password", "ssh_private_key", "tls_ca_cert", "tls_client_cert", "tls_client_key"} {
+		n, f, err := s.reencryptColumn(ctx, column)
+		rewrapped += n
+		failed += f
+		if err != nil {
+			return rewrapped, failed, err
+		}
 	}
+	return rewrapped, failed, nil
+}
 
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return "", err
-	}
+// reencryptColumn rewraps the encrypted values of one connections column
+func (s *ConnectionService) reencryptColumn(ctx context.Context, column string) (rewrapped, failed int, err error) {
+	prefix := envelopeVersion + ":" + s.keyring.PrimaryID() + ":%"
+	lastID := uuid.Nil
+	for {
+		rows, err := s.db.Pool().Query(ctx, `
+			SELECT id, `+column+` FROM connections
+			WHERE `+column+` <> '' AND `+column+` NOT LIKE $1 AND id > $2
+			ORDER BY id LIMIT $3
+		`, prefix, lastID, reencryptBatchSize)
+		if err != nil {
+			return rewrapped, failed, err
+		}
+		type credential struct {
+			id    uuid.UUID
+			value string
+		}
+		var batch []credential
+		for rows.Next() {
+			var c credential
+			if err := rows.Scan(&c.id, &c.value); err != nil {
+				rows.Close()
+				return rewrapped, failed, err
+			}
+			batch = append(batch, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewrapped, failed, err
+		}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
+		for _, c := range batch {
+			lastID = c.id
+			value, err := s.keyring.Rewrap(c.value)
+			if err != nil {
+				log.Printf("Failed to re-encrypt %s of connection %s: %v", column, c.id, err)
+				failed++
+				continue
+			}
+			// Skip rows changed since they were read
+			tag, err := s.db.Pool().Exec(ctx, `
+				UPDATE connections SET `+column+` = $1 WHERE id = $2 AND `+column+` = $3
+			`, value, c.id, c.value)
+			if err != nil {
+				return rewrapped, failed, err
+			}
+			rewrapped += int(tag.RowsAffected())
+		}
 
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return "", errors.New("ciphertext too short")
+		if len(batch) < reencryptBatchSize {
+			return rewrapped, failed, nil
+		}
 	}
+}
 
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", err
-	}
+// StartReencryption rewraps credentials now and every interval until ctx is done
+func (s *ConnectionService) StartReencryption(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		rewrapped, failed, err := s.ReencryptCredentials(ctx)
+		if err != nil {
+			log.Printf("Credential re-encryption failed: %v", err)
+		} else if rewrapped > 0 || failed > 0 {
+			log.Printf("Re-encrypted %d connection credentials with key %s, %d failed", rewrapped, s.keyring.PrimaryID(), failed)
+		}
 
-	return string(plaintext), nil
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 // GetConnectionWithPassword retrieves connection with decrypted password (internal use)
 func (s *ConnectionService) GetConnectionWithPassword(ctx context.Context, connID uuid.UUID) (*models.Connection, error) {
 	var conn models.Connection
 	var encryptedPass string
+	var tunnel sshTunnelRow
+	var certs tlsRow
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, user_id, name, type, host, port, database, username, password, ssl_mode, options
+		SELECT id, user_id, name, type, host, port, database, username, password, COALESCE(password_ref, ''), ssl_mode, options,
+			`+sshTunnelColumns+`, COALESCE(ssh_private_key, ''), `+tlsColumns+`, `+tlsMaterialColumns+`
 		FROM connections WHERE id = $1
 	`, connID).Scan(&conn.ID, &conn.UserID, &conn.Name, &conn.Type, &conn.Host, &conn.Port,
-		&conn.Database, &conn.Username, &encryptedPass, &conn.SSLMode, &conn.Options)
+		&conn.Database, &conn.Username, &encryptedPass, &conn.PasswordRef, &conn.SSLMode, &conn.Options,
+		&tunnel.Host, &tunnel.Port, &tunnel.User, &tunnel.HostKeyFingerprint, &tunnel.PrivateKey,
+		&certs.Certificates, &certs.ExpiresAt, &certs.CACert, &certs.ClientCert, &certs.ClientKey)
 	if err == pgx.ErrNoRows {
 		return nil, ErrConnectionNotFound
 	}
@@ -359,11 +595,22 @@ func (s *ConnectionService) GetConnectionWithPassword(ctx context.Context, connI
 		return nil, err
 	}
 
-	password, err := s.decryptPassword(encryptedPass)
+	// Connections with a secret reference have no stored password
+	if conn.PasswordRef == "" {
+		password, err := s.decryptPassword(encryptedPass)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt password: %w", err)
+		}
+		conn.Password = password
+	}
+	conn.SSHTunnel, err = s.decryptSSHTunnel(tunnel.orNil())
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+		return nil, err
+	}
+	conn.TLS, err = s.decryptTLS(certs.orNil(time.Now().UTC()))
+	if err != nil {
+		return nil, err
 	}
-	conn.Password = password
 
 	return &conn, nil
 }
@@ -0,0 +1,738 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var (
+	ErrInvalidBundle             = errors.New("invalid bundle")
+	ErrBundlePassphraseRequired  = errors.New("bundle credentials are encrypted; provide the passphrase")
+	ErrInvalidBundlePassphrase   = errors.New("wrong passphrase for bundle credentials")
+	ErrBundlePassphraseTooShort  = errors.New("passphrase must be at least 12 characters")
+	ErrInvalidConflictResolution = errors.New("on_conflict must be skip, rename or overwrite")
+)
+
+// connectionBundleVersion is the format version of exported bundles
+const connectionBundleVersion = 1
+
+// minBundlePassphraseLength is the shortest passphrase credentials are
+// encrypted with
+const minBundlePassphraseLength = 12
+
+// scrypt parameters deriving the key of bundle credentials from a passphrase
+const (
+	bundleKDF     = "scrypt"
+	bundleScryptN = 1 << 15
+	bundleScryptR = 8
+	bundleScryptP = 1
+)
+
+// Bundle formats
+const (
+	BundleFormatJSON = "json"
+	BundleFormatYAML = "yaml"
+)
+
+// Conflict resolutions for imported names that already exist
+const (
+	ConflictSkip      = "skip"
+	ConflictRename    = "rename"
+	ConflictOverwrite = "overwrite"
+)
+
+// ConnectionBundle is a portable export of connections and the pipelines
+// between them. Pipelines refer to connections by name, so a bundle exported
+// from one environment can be imported into another.
+type ConnectionBundle struct {
+	Version     int                `json:"version" yaml:"version"`
+	ExportedAt  time.Time          `json:"exported_at" yaml:"exported_at"`
+	Encryption  *BundleEncryption  `json:"encryption,omitempty" yaml:"encryption,omitempty"`
+	Connections []BundleConnection `json:"connections" yaml:"connections"`
+	Pipelines   []BundlePipeline   `json:"pipelines,omitempty" yaml:"pipelines,omitempty"`
+}
+
+// BundleEncryption describes how the credentials of a bundle are encrypted.
+// Bundles exported without a passphrase carry no credentials.
+type BundleEncryption struct {
+	KDF  string `json:"kdf" yaml:"kdf"`
+	Salt string `json:"salt" yaml:"salt"` // base64
+}
+
+// BundleConnection is a connection in a bundle
+type BundleConnection struct {
+	Name        string            `json:"name" yaml:"name"`
+	Type        string            `json:"type" yaml:"type"`
+	Host        string            `json:"host" yaml:"host"`
+	Port        int               `json:"port" yaml:"port"`
+	Database    string            `json:"database" yaml:"database"`
+	Username    string            `json:"username" yaml:"username"`
+	PasswordRef string            `json:"password_ref,omitempty" yaml:"password_ref,omitempty"`
+	SSLMode     string            `json:"ssl_mode" yaml:"ssl_mode"`
+	Options     map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+	SSHTunnel   *BundleSSHTunnel  `json:"ssh_tunnel,omitempty" yaml:"ssh_tunnel,omitempty"`
+	// Secrets holds the encrypted bundleSecrets of the connection
+	Secrets string `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+}
+
+// BundleSSHTunnel is the SSH tunnel of a bundled connection, without its key
+type BundleSSHTunnel struct {
+	Host               string `json:"host" yaml:"host"`
+	Port               int    `json:"port" yaml:"port"`
+	User               string `json:"user" yaml:"user"`
+	HostKeyFingerprint string `json:"host_key_fingerprint" yaml:"host_key_fingerprint"`
+}
+
+// BundlePipeline is a pipeline in a bundle
+type BundlePipeline struct {
+	Name             string            `json:"name" yaml:"name"`
+	Description      string            `json:"description,omitempty" yaml:"description,omitempty"`
+	SourceConnection string            `json:"source_connection" yaml:"source_connection"`
+	TargetConnection string            `json:"target_connection,omitempty" yaml:"target_connection,omitempty"`
+	TargetType       string            `json:"target_type" yaml:"target_type"`
+	TargetConfig     map[string]string `json:"target_config,omitempty" yaml:"target_config,omitempty"`
+	Tables           []string          `json:"tables,omitempty" yaml:"tables,omitempty"`
+}
+
+// bundleSecrets are the credentials of a connection, encrypted in a bundle
+type bundleSecrets struct {
+	Password      string `json:"password,omitempty"`
+	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
+	CACert        string `json:"ca_cert,omitempty"`
+	ClientCert    string `json:"client_cert,omitempty"`
+	ClientKey     string `json:"client_key,omitempty"`
+}
+
+// ExportOptions selects what a bundle holds
+type ExportOptions struct {
+	ConnectionIDs    []uuid.UUID // all connections when empty
+	IncludePipelines bool
+	Passphrase       string // credentials are omitted when empty
+}
+
+// ImportOptions controls how a bundle is imported
+type ImportOptions struct {
+	Passphrase string
+	OnConflict string // skip, rename or overwrite; skip when empty
+	// MaxPipelines caps the pipelines of the user after the import; zero
+	// means no limit
+	MaxPipelines int
+	// Features are the licensed features; pipelines whose target requires
+	// another are rejected
+	Features map[string]bool
+}
+
+// Import actions
+const (
+	ImportCreated     = "created"
+	ImportRenamed     = "renamed"
+	ImportSkipped     = "skipped"
+	ImportOverwritten = "overwritten"
+)
+
+// ImportItem is the outcome of importing one connection or pipeline
+type ImportItem struct {
+	Name   string    `json:"name"`
+	Action string    `json:"action"`
+	ID     uuid.UUID `json:"id"`
+	// ImportedAs is the new name of a renamed item
+	ImportedAs string `json:"imported_as,omitempty"`
+	// NeedsCredentials marks connections imported without a password
+	NeedsCredentials bool `json:"needs_credentials,omitempty"`
+}
+
+// ImportResult is the outcome of importing a bundle
+type ImportResult struct {
+	Connections []ImportItem `json:"connections"`
+	Pipelines   []ImportItem `json:"pipelines"`
+}
+
+// ConnectionBundleService exports and imports connections and pipelines
+type ConnectionBundleService struct {
+	db          *repository.PostgresDB
+	connections *ConnectionService
+	pipelines   *PipelineService
+}
+
+// NewConnectionBundleService creates a new connection bundle service
+func NewConnectionBundleService(db *repository.PostgresDB, connections *ConnectionService, pipelines *PipelineService) *ConnectionBundleService {
+	return &ConnectionBundleService{db: db, connections: connections, pipelines: pipelines}
+}
+
+// MarshalBundle renders a bundle as JSON or YAML
+func MarshalBundle(bundle *ConnectionBundle, format string) ([]byte, error) {
+	switch format {
+	case BundleFormatJSON, "":
+		return json.MarshalIndent(bundle, "", "  ")
+	case BundleFormatYAML:
+		return yaml.Marshal(bundle)
+	}
+	return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidBundle, format)
+}
+
+// ParseBundle reads a JSON or YAML bundle
+func ParseBundle(data []byte) (*ConnectionBundle, error) {
+	// JSON is valid YAML, so one decoder reads both
+	var bundle ConnectionBundle
+	if err := yaml.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if bundle.Version != connectionBundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// bundleCipher encrypts the credentials of one bundle
+type bundleCipher struct {
+	key []byte
+}
+
+// newBundleCipher derives the key of passphrase and the salt of enc
+func newBundleCipher(passphrase string, enc *BundleEncryption) (*bundleCipher, error) {
+	if enc.KDF != bundleKDF {
+		return nil, fmt.Errorf("%w: unknown kdf %q", ErrInvalidBundle, enc.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil || len(salt) < 16 {
+		return nil, fmt.Errorf("%w: invalid salt", ErrInvalidBundle)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, bundleScryptN, bundleScryptR, bundleScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &bundleCipher{key: key}, nil
+}
+
+// newBundleEncryption returns encryption settings with a random salt
+func newBundleEncryption() (*BundleEncryption, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return &BundleEncryption{KDF: bundleKDF, Salt: base64.StdEncoding.EncodeToString(salt)}, nil
+}
+
+// seal encrypts the secrets of the connection named name, binding them to it
+func (c *bundleCipher) seal(name string, secrets *bundleSecrets) (string, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealGCM(c.key, plaintext, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts the secrets of the connection named name
+func (c *bundleCipher) open(name, value string) (*bundleSecrets, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: secrets of connection %q are not base64", ErrInvalidBundle, name)
+	}
+	plaintext, err := openGCM(c.key, sealed, []byte(name))
+	if err != nil {
+		return nil, ErrInvalidBundlePassphrase
+	}
+	var secrets bundleSecrets
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("%w: secrets of connection %q: %v", ErrInvalidBundle, name, err)
+	}
+	return &secrets, nil
+}
+
+// Export bundles connections of a user and, optionally, the pipelines
+// between them
+func (s *ConnectionBundleService) Export(ctx context.Context, userID uuid.UUID, opts ExportOptions) (*ConnectionBundle, error) {
+	bundle := &ConnectionBundle{
+		Version:     connectionBundleVersion,
+		ExportedAt:  time.Now().UTC(),
+		Connections: make([]BundleConnection, 0),
+	}
+
+	var cipher *bundleCipher
+	if opts.Passphrase != "" {
+		if len(opts.Passphrase) < minBundlePassphraseLength {
+			return nil, ErrBundlePassphraseTooShort
+		}
+		enc, err := newBundleEncryption()
+		if err != nil {
+			return nil, err
+		}
+		if cipher, err = newBundleCipher(opts.Passphrase, enc); err != nil {
+			return nil, err
+		}
+		bundle.Encryption = enc
+	}
+
+	ids := opts.ConnectionIDs
+	if len(ids) == 0 {
+		conns, err := s.connections.ListConnections(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range conns {
+			ids = append(ids, c.ID)
+		}
+	}
+
+	names := make(map[uuid.UUID]string, len(ids))
+	for _, id := range ids {
+		conn, err := s.connections.GetConnectionWithPassword(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if conn.UserID != userID {
+			return nil, ErrConnectionNotFound
+		}
+		if _, ok := names[conn.ID]; ok {
+			continue
+		}
+		names[conn.ID] = conn.Name
+
+		bc, err := bundleConnection(conn, cipher)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Connections = append(bundle.Connections, *bc)
+	}
+
+	if opts.IncludePipelines {
+		pipelines, err := s.pipelines.ListPipelines(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, listed := range pipelines {
+			// Only pipelines whose connections are in the bundle can be imported
+			source, ok := names[listed.SourceConnID]
+			if !ok {
+				continue
+			}
+			target := ""
+			if listed.TargetConnID != nil {
+				if target, ok = names[*listed.TargetConnID]; !ok {
+					continue
+				}
+			}
+			p, err := s.pipelines.GetPipeline(ctx, userID, listed.ID)
+			if err != nil {
+				return nil, err
+			}
+			bundle.Pipelines = append(bundle.Pipelines, BundlePipeline{
+				Name:             p.Name,
+				Description:      p.Description,
+				SourceConnection: source,
+				TargetConnection: target,
+				TargetType:       p.TargetType,
+				TargetConfig:     p.TargetConfig,
+				Tables:           p.Tables,
+			})
+		}
+	}
+
+	return bundle, nil
+}
+
+// bundleConnection converts a connection with decrypted credentials,
+// encrypting them with cipher, or dropping them when cipher is nil
+func bundleConnection(conn *models.Connection, cipher *bundleCipher) (*BundleConnection, error) {
+	bc := &BundleConnection{
+		Name:        conn.Name,
+		Type:        conn.Type,
+		Host:        conn.Host,
+		Port:        conn.Port,
+		Database:    conn.Database,
+		Username:    conn.Username,
+		PasswordRef: conn.PasswordRef,
+		SSLMode:     conn.SSLMode,
+		Options:     conn.Options,
+	}
+	secrets := &bundleSecrets{Password: conn.Password}
+	if t := conn.SSHTunnel; t != nil {
+		bc.SSHTunnel = &BundleSSHTunnel{Host: t.Host, Port: t.Port, User: t.User, HostKeyFingerprint: t.HostKeyFingerprint}
+		secrets.SSHPrivateKey = t.PrivateKey
+	}
+	if conn.TLS != nil {
+		secrets.CACert, secrets.ClientCert, secrets.ClientKey = conn.TLS.CACert, conn.TLS.ClientCert, conn.TLS.ClientKey
+	}
+
+	if cipher != nil && *secrets != (bundleSecrets{}) {
+		sealed, err := cipher.seal(conn.Name, secrets)
+		if err != nil {
+			return nil, err
+		}
+		bc.Secrets = sealed
+	}
+	return bc, nil
+}
+
+// validateBundle checks names are set and unique, and that pipelines refer
+// to bundled or existing connections
+func validateBundle(bundle *ConnectionBundle, existing map[string]models.Connection) error {
+	bundled := make(map[string]bool, len(bundle.Connections))
+	for _, c := range bundle.Connections {
+		if c.Name == "" || c.Type == "" || c.Host == "" || c.Port == 0 {
+			return fmt.Errorf("%w: connections need a name, type, host and port", ErrInvalidBundle)
+		}
+		if bundled[c.Name] {
+			return fmt.Errorf("%w: duplicate connection %q", ErrInvalidBundle, c.Name)
+		}
+		bundled[c.Name] = true
+	}
+
+	pipelines := make(map[string]bool, len(bundle.Pipelines))
+	for _, p := range bundle.Pipelines {
+		if p.Name == "" || p.SourceConnection == "" || p.TargetType == "" {
+			return fmt.Errorf("%w: pipelines need a name, source_connection and target_type", ErrInvalidBundle)
+		}
+		if pipelines[p.Name] {
+			return fmt.Errorf("%w: duplicate pipeline %q", ErrInvalidBundle, p.Name)
+		}
+		pipelines[p.Name] = true
+		for _, ref := range []string{p.SourceConnection, p.TargetConnection} {
+			if _, ok := existing[ref]; ref != "" && !bundled[ref] && !ok {
+				return fmt.Errorf("%w: pipeline %q refers to unknown connection %q", ErrInvalidBundle, p.Name, ref)
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueName returns name, or name with the lowest free " (n)" suffix
+func uniqueName(name string, taken func(string) bool) string {
+	candidate := name
+	for n := 2; taken(candidate); n++ {
+		candidate = fmt.Sprintf("%s (%d)", name, n)
+	}
+	return candidate
+}
+
+// Import creates the connections and pipelines of a bundle in one
+// transaction. Names that already exist are skipped, renamed or overwritten as
+// opts.OnConflict says. The bundle is validated, its credentials decrypted, the
+// targets of imported pipelines checked against their schemas and the
+// licensed features, and their tables against their sources before
+// anything is written; sources that aren't reachable from this environment
+// yet are accepted unchecked, like when creating a pipeline.
+func (s *ConnectionBundleService) Import(ctx context.Context, userID uuid.UUID, bundle *ConnectionBundle, opts ImportOptions) (*ImportResult, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = ConflictSkip
+	case ConflictSkip, ConflictRename, ConflictOverwrite:
+	default:
+		return nil, ErrInvalidConflictResolution
+	}
+
+	existingConns, err := s.connections.ListConnections(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	connsByName := make(map[string]models.Connection, len(existingConns))
+	for _, c := range existingConns {
+		connsByName[c.Name] = c
+	}
+	if err := validateBundle(bundle, connsByName); err != nil {
+		return nil, err
+	}
+
+	secrets, err := openBundleSecrets(bundle, opts.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	existingPipelines, err := s.pipelines.ListPipelines(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pipelinesByName := make(map[string]models.Pipeline, len(existingPipelines))
+	for _, p := range existingPipelines {
+		pipelinesByName[p.Name] = p
+	}
+	if opts.MaxPipelines > 0 {
+		created := 0
+		for _, p := range bundle.Pipelines {
+			if _, exists := pipelinesByName[p.Name]; !exists || opts.OnConflict == ConflictRename {
+				created++
+			}
+		}
+		if created > 0 && len(existingPipelines)+created > opts.MaxPipelines {
+			return nil, ErrPipelineLimitReached
+		}
+	}
+
+	if err := checkImportTargets(bundle, pipelinesByName, opts); err != nil {
+		return nil, err
+	}
+	if err := s.validateImportTables(ctx, userID, bundle, secrets, connsByName, pipelinesByName, opts.OnConflict); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	result := &ImportResult{Connections: make([]ImportItem, 0), Pipelines: make([]ImportItem, 0)}
+	connIDs := make(map[string]uuid.UUID, len(bundle.Connections))
+	for name, c := range connsByName {
+		connIDs[name] = c.ID
+	}
+
+	for _, bc := range bundle.Connections {
+		item, err := s.importConnection(ctx, tx, userID, &bc, secrets[bc.Name], connsByName, opts.OnConflict)
+		if err != nil {
+			return nil, fmt.Errorf("connection %q: %w", bc.Name, err)
+		}
+		connIDs[bc.Name] = item.ID
+		result.Connections = append(result.Connections, *item)
+	}
+
+	for _, bp := range bundle.Pipelines {
+		item, err := s.importPipeline(ctx, tx, userID, &bp, connIDs, pipelinesByName, opts.OnConflict)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: %w", bp.Name, err)
+		}
+		result.Pipelines = append(result.Pipelines, *item)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	// Catalogs cached before the commit may describe the old settings
+	for _, item := range result.Connections {
+		if item.Action == ImportOverwritten {
+			s.connections.invalidateCatalog(ctx, item.ID)
+		}
+	}
+	return result, nil
+}
+
+// validateImportTables checks the tables of the pipelines an import writes
+// exist in their sources, as the sources will be after the import. Bundled
+// sources are introspected once each.
+func (s *ConnectionBundleService) validateImportTables(ctx context.Context, userID uuid.UUID, bundle *ConnectionBundle, secrets map[string]*bundleSecrets, conns map[string]models.Connection, pipelines map[string]models.Pipeline, onConflict string) error {
+	bundled := make(map[string]*BundleConnection, len(bundle.Connections))
+	for i := range bundle.Connections {
+		bundled[bundle.Connections[i].Name] = &bundle.Connections[i]
+	}
+	type discovery struct {
+		catalog *ConnectionCatalog
+		err     error
+	}
+	discovered := make(map[string]discovery)
+
+	for _, bp := range bundle.Pipelines {
+		if _, exists := pipelines[bp.Name]; exists && onConflict == ConflictSkip {
+			continue
+		}
+		if len(bp.Tables) == 0 {
+			continue
+		}
+
+		source := bp.SourceConnection
+		existing, exists := conns[source]
+		bc, isBundled := bundled[source]
+		var err error
+		if isBundled && !(exists && onConflict == ConflictSkip) {
+			d, ok := discovered[source]
+			if !ok {
+				d.catalog, d.err = discoverConnection(ctx, bundledModel(bc, secrets[source]))
+				discovered[source] = d
+			}
+			err = validateDiscoveredTables(d.catalog, d.err, bp.Tables)
+		} else {
+			err = s.connections.ValidatePipelineTables(ctx, userID, existing.ID, bp.Tables)
+		}
+		if err != nil {
+			return fmt.Errorf("pipeline %q: %w", bp.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkImportTargets checks the target of every pipeline the import writes
+// like creating a pipeline does, and stores it under its canonical name
+func checkImportTargets(bundle *ConnectionBundle, pipelines map[string]models.Pipeline, opts ImportOptions) error {
+	for i := range bundle.Pipelines {
+		bp := &bundle.Pipelines[i]
+		if _, exists := pipelines[bp.Name]; exists && opts.OnConflict == ConflictSkip {
+			continue
+		}
+		target, err := CheckTarget(bp.TargetType, bp.TargetConfig, opts.Features)
+		if err != nil {
+			return fmt.Errorf("pipeline %q: %w", bp.Name, err)
+		}
+		bp.TargetType = target.Name
+	}
+	return nil
+}
+
+// openBundleSecrets decrypts the credentials of every bundled connection, by name
+func openBundleSecrets(bundle *ConnectionBundle, passphrase string) (map[string]*bundleSecrets, error) {
+	secrets := make(map[string]*bundleSecrets)
+	var cipher *bundleCipher
+	for _, c := range bundle.Connections {
+		if c.Secrets == "" {
+			continue
+		}
+		if cipher == nil {
+			if bundle.Encryption == nil {
+				return nil, fmt.Errorf("%w: credentials without encryption settings", ErrInvalidBundle)
+			}
+			if passphrase == "" {
+				return nil, ErrBundlePassphraseRequired
+			}
+			var err error
+			if cipher, err = newBundleCipher(passphrase, bundle.Encryption); err != nil {
+				return nil, err
+			}
+		}
+		opened, err := cipher.open(c.Name, c.Secrets)
+		if err != nil {
+			return nil, err
+		}
+		secrets[c.Name] = opened
+	}
+	return secrets, nil
+}
+
+// bundledModel returns the connection of bc with its decrypted secrets
+func bundledModel(bc *BundleConnection, secrets *bundleSecrets) *models.Connection {
+	if secrets == nil {
+		secrets = &bundleSecrets{}
+	}
+	conn := &models.Connection{
+		Name:        bc.Name,
+		Type:        bc.Type,
+		Host:        bc.Host,
+		Port:        bc.Port,
+		Database:    bc.Database,
+		Username:    bc.Username,
+		Password:    secrets.Password,
+		PasswordRef: bc.PasswordRef,
+		SSLMode:     bc.SSLMode,
+		Options:     bc.Options,
+	}
+	if conn.SSLMode == "" {
+		conn.SSLMode = SSLPrefer
+	}
+	if t := bc.SSHTunnel; t != nil {
+		conn.SSHTunnel = &models.SSHTunnel{
+			Host:               t.Host,
+			Port:               t.Port,
+			User:               t.User,
+			PrivateKey:         secrets.SSHPrivateKey,
+			HostKeyFingerprint: t.HostKeyFingerprint,
+		}
+	}
+	if secrets.CACert != "" || secrets.ClientCert != "" {
+		conn.TLS = &models.ConnectionTLS{CACert: secrets.CACert, ClientCert: secrets.ClientCert, ClientKey: secrets.ClientKey}
+	}
+	return conn
+}
+
+func (s *ConnectionBundleService) importConnection(ctx context.Context, tx pgx.Tx, userID uuid.UUID, bc *BundleConnection, secrets *bundleSecrets, existing map[string]models.Connection, onConflict string) (*ImportItem, error) {
+	conn := bundledModel(bc, secrets)
+	item := &ImportItem{Name: bc.Name, Action: ImportCreated}
+	item.NeedsCredentials = conn.Password == "" && conn.PasswordRef == "" ||
+		conn.SSHTunnel != nil && conn.SSHTunnel.PrivateKey == ""
+
+	if current, ok := existing[bc.Name]; ok {
+		switch onConflict {
+		case ConflictSkip:
+			item.Action, item.ID, item.NeedsCredentials = ImportSkipped, current.ID, false
+			return item, nil
+		case ConflictOverwrite:
+			if err := s.connections.overwriteConnection(ctx, tx, userID, current.ID, conn); err != nil {
+				return nil, err
+			}
+			item.Action, item.ID = ImportOverwritten, current.ID
+			return item, nil
+		case ConflictRename:
+			conn.Name = uniqueName(bc.Name, func(name string) bool {
+				_, taken := existing[name]
+				return taken
+			})
+			item.Action, item.ImportedAs = ImportRenamed, conn.Name
+		}
+	}
+
+	// A tunnel without its key can't be created, so it is left out
+	if conn.SSHTunnel != nil && conn.SSHTunnel.PrivateKey == "" {
+		conn.SSHTunnel = nil
+	}
+	created, err := s.connections.createConnectionCopy(ctx, tx, userID, conn)
+	if err != nil {
+		return nil, err
+	}
+	existing[created.Name] = *created
+	item.ID = created.ID
+	return item, nil
+}
+
+func (s *ConnectionBundleService) importPipeline(ctx context.Context, tx pgx.Tx, userID uuid.UUID, bp *BundlePipeline, connIDs map[string]uuid.UUID, existing map[string]models.Pipeline, onConflict string) (*ImportItem, error) {
+	pipeline := &models.Pipeline{
+		Name:         bp.Name,
+		Description:  bp.Description,
+		SourceConnID: connIDs[bp.SourceConnection],
+		TargetType:   bp.TargetType,
+		TargetConfig: bp.TargetConfig,
+		Tables:       bp.Tables,
+	}
+	if bp.TargetConnection != "" {
+		targetID := connIDs[bp.TargetConnection]
+		pipeline.TargetConnID = &targetID
+	}
+	item := &ImportItem{Name: bp.Name, Action: ImportCreated}
+
+	if current, ok := existing[bp.Name]; ok {
+		switch onConflict {
+		case ConflictSkip:
+			item.Action, item.ID = ImportSkipped, current.ID
+			return item, nil
+		case ConflictOverwrite:
+			_, err := tx.Exec(ctx, `
+				UPDATE pipelines SET description = $1, source_connection_id = $2, target_connection_id = $3,
+					target_type = $4, target_config = $5, tables = $6, updated_at = $7
+				WHERE id = $8 AND user_id = $9
+			`, pipeline.Description, pipeline.SourceConnID, pipeline.TargetConnID, pipeline.TargetType,
+				pipeline.TargetConfig, pipeline.Tables, time.Now().UTC(), current.ID, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update pipeline: %w", err)
+			}
+			item.Action, item.ID = ImportOverwritten, current.ID
+			return item, nil
+		case ConflictRename:
+			pipeline.Name = uniqueName(bp.Name, func(name string) bool {
+				_, taken := existing[name]
+				return taken
+			})
+			item.Action, item.ImportedAs = ImportRenamed, pipeline.Name
+		}
+	}
+
+	created, err := s.pipelines.createPipeline(ctx, tx, userID, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	existing[created.Name] = *created
+	item.ID = created.ID
+	return item, nil
+}
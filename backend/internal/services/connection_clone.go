@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+var ErrConnectionNameTaken = errors.New("a connection with this name already exists")
+
+// connectionNameTaken reports whether the user has a connection named name
+func (s *ConnectionService) connectionNameTaken(ctx context.Context, userID uuid.UUID, name string) (bool, error) {
+	var taken bool
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM connections WHERE user_id = $1 AND name = $2)
+	`, userID, name).Scan(&taken)
+	return taken, err
+}
+
+// createConnectionCopy creates a connection from plaintext credentials,
+// including its certificates, within tx. Nothing is left behind when the
+// certificates are rejected and tx is rolled back.
+func (s *ConnectionService) createConnectionCopy(ctx context.Context, tx pgx.Tx, userID uuid.UUID, conn *models.Connection) (*models.Connection, error) {
+	material := conn.TLS
+	conn.TLS = nil
+	created, err := s.createConnection(ctx, tx, userID, conn)
+	if err != nil {
+		return nil, err
+	}
+	if material == nil {
+		return created, nil
+	}
+
+	certs, err := s.setCertificates(ctx, tx, userID, created.ID, material)
+	if err != nil {
+		return nil, err
+	}
+	created.TLS = certs
+	return created, nil
+}
+
+// overwriteConnection replaces the settings of a connection with those of
+// conn within tx, keeping its name. Credentials conn lacks are kept.
+func (s *ConnectionService) overwriteConnection(ctx context.Context, tx pgx.Tx, userID, connID uuid.UUID, conn *models.Connection) error {
+	updates := map[string]interface{}{
+		"host":     conn.Host,
+		"port":     float64(conn.Port),
+		"database": conn.Database,
+		"username": conn.Username,
+		"ssl_mode": conn.SSLMode,
+	}
+	switch {
+	case conn.PasswordRef != "":
+		updates["password_ref"] = conn.PasswordRef
+	case conn.Password != "":
+		updates["password"] = conn.Password
+	}
+	if t := conn.SSHTunnel; t != nil {
+		updates["ssh_tunnel"] = map[string]interface{}{
+			"host":                 t.Host,
+			"port":                 float64(t.Port),
+			"user":                 t.User,
+			"private_key":          t.PrivateKey,
+			"host_key_fingerprint": t.HostKeyFingerprint,
+		}
+	} else {
+		updates["ssh_tunnel"] = nil
+	}
+
+	if _, err := s.updateConnection(ctx, tx, userID, connID, updates); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE connections SET options = $1 WHERE id = $2 AND user_id = $3
+	`, conn.Options, connID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update connection: %w", err)
+	}
+	if conn.TLS != nil {
+		if _, err := s.setCertificates(ctx, tx, userID, connID, conn.TLS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloneConnection copies a connection, with its credentials, tunnel and
+// certificates, under a new name. overrides replaces settings of the copy
+// like the updates of UpdateConnection do; name is required.
+func (s *ConnectionService) CloneConnection(ctx context.Context, userID, connID uuid.UUID, overrides map[string]interface{}) (*models.Connection, error) {
+	conn, err := s.GetConnectionWithPassword(ctx, connID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, ErrConnectionNotFound
+	}
+
+	name, _ := overrides["name"].(string)
+	taken, err := s.connectionNameTaken(ctx, userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrConnectionNameTaken
+	}
+	conn.Name = name
+
+	if host, ok := overrides["host"].(string); ok {
+		conn.Host = host
+	}
+	if port, ok := overrides["port"].(float64); ok {
+		conn.Port = int(port)
+	}
+	if database, ok := overrides["database"].(string); ok {
+		conn.Database = database
+	}
+	if username, ok := overrides["username"].(string); ok {
+		conn.Username = username
+	}
+	if sslMode, ok := overrides["ssl_mode"].(string); ok {
+		conn.SSLMode = sslMode
+	}
+	// A password replaces a secret reference and the other way around
+	if password, ok := overrides["password"].(string); ok && password != "" {
+		conn.Password, conn.PasswordRef = password, ""
+	}
+	if ref, ok := overrides["password_ref"].(string); ok && ref != "" {
+		conn.Password, conn.PasswordRef = "", ref
+	}
+	if value, ok := overrides["ssh_tunnel"]; ok {
+		if conn.SSHTunnel, err = overrideSSHTunnel(conn.SSHTunnel, value); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	created, err := s.createConnectionCopy(ctx, tx, userID, conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// overrideSSHTunnel applies the ssh_tunnel override of a clone to the
+// plaintext tunnel of the original. A nil value removes the tunnel.
+func overrideSSHTunnel(current *models.SSHTunnel, value interface{}) (*models.SSHTunnel, error) {
+	if value == nil {
+		return nil, nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: ssh_tunnel must be an object or null", ErrInvalidSSHTunnel)
+	}
+	tunnel := &models.SSHTunnel{}
+	if current != nil {
+		*tunnel = *current
+	}
+	if host, ok := fields["host"].(string); ok {
+		tunnel.Host = host
+	}
+	if port, ok := fields["port"].(float64); ok {
+		tunnel.Port = int(port)
+	}
+	if user, ok := fields["user"].(string); ok {
+		tunnel.User = user
+	}
+	if key, ok := fields["private_key"].(string); ok && key != "" {
+		tunnel.PrivateKey = key
+	}
+	if fingerprint, ok := fields["host_key_fingerprint"].(string); ok {
+		tunnel.HostKeyFingerprint = fingerprint
+	}
+	return tunnel, nil
+}
@@ -0,0 +1,522 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var (
+	ErrDiscoveryNotSupported = errors.New("schema discovery is not available for this connection type")
+	ErrInvalidPipelineTables = errors.New("invalid pipeline tables")
+)
+
+// catalogCacheTTL is how long discovery results are reused
+const catalogCacheTTL = 5 * time.Minute
+
+// DiscoveredColumn is a column of a source table
+type DiscoveredColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// DiscoveredTable is a table of a source database
+type DiscoveredTable struct {
+	Schema      string             `json:"schema"`
+	Name        string             `json:"name"`
+	Columns     []DiscoveredColumn `json:"columns"`
+	PrimaryKey  []string           `json:"primary_key"`
+	RowEstimate int64              `json:"row_estimate"`
+}
+
+// QualifiedName returns schema.table, the form pipelines list tables in
+func (t *DiscoveredTable) QualifiedName() string {
+	return t.Schema + "." + t.Name
+}
+
+// DiscoveredSchema is a schema of a source database; MySQL databases are schemas
+type DiscoveredSchema struct {
+	Name       string `json:"name"`
+	TableCount int    `json:"table_count"`
+}
+
+// ConnectionCatalog is what discovery found in a source database
+type ConnectionCatalog struct {
+	ConnectionID  uuid.UUID          `json:"connection_id"`
+	DefaultSchema string             `json:"default_schema"`
+	Schemas       []DiscoveredSchema `json:"schemas"`
+	Tables        []DiscoveredTable  `json:"tables"`
+	DiscoveredAt  time.Time          `json:"discovered_at"`
+}
+
+// SetRedis enables caching of discovery results
+func (s *ConnectionService) SetRedis(redis *repository.RedisClient) {
+	s.redis = redis
+}
+
+func catalogCacheKey(connID uuid.UUID) string {
+	return "connections:catalog:" + connID.String()
+}
+
+// invalidateCatalog drops cached discovery results after the connection changes
+func (s *ConnectionService) invalidateCatalog(ctx context.Context, connID uuid.UUID) {
+	if s.redis != nil {
+		s.redis.Client().Del(ctx, catalogCacheKey(connID))
+	}
+}
+
+// loadConnectionParams returns the user's connection and the settings to connect with
+func (s *ConnectionService) loadConnectionParams(ctx context.Context, userID, connID uuid.UUID) (*models.Connection, *ConnectionParams, error) {
+	if _, err := s.GetConnection(ctx, userID, connID); err != nil {
+		return nil, nil, err
+	}
+	conn, err := s.GetConnectionWithPassword(ctx, connID)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := connectionParams(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, p, nil
+}
+
+// connectionParams returns the settings to connect to conn with, which has
+// plaintext credentials
+func connectionParams(conn *models.Connection) (*ConnectionParams, error) {
+	if conn.PasswordRef != "" {
+		return nil, ErrSecretResolvedByEngine
+	}
+	sslMode, err := normalizeSSLMode(conn.SSLMode)
+	if err != nil {
+		return nil, err
+	}
+	p := &ConnectionParams{
+		Type:     conn.Type,
+		Host:     conn.Host,
+		Port:     conn.Port,
+		Database: conn.Database,
+		Username: conn.Username,
+		Password: conn.Password,
+		SSLMode:  sslMode,
+		Options:  conn.Options,
+
+		SSHTunnel:    conn.SSHTunnel,
+		Certificates: conn.TLS,
+	}
+	if err := p.loadCertificates(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Discover introspects the schemas and tables of a source connection. Results
+// are cached for a few minutes unless refresh is set.
+func (s *ConnectionService) Discover(ctx context.Context, userID, connID uuid.UUID, refresh bool) (*ConnectionCatalog, error) {
+	conn, p, err := s.loadConnectionParams(ctx, userID, connID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := catalogCacheKey(connID)
+	if s.redis != nil && !refresh {
+		data, err := s.redis.Client().Get(ctx, key).Bytes()
+		if err == nil {
+			var catalog ConnectionCatalog
+			if json.Unmarshal(data, &catalog) == nil {
+				return &catalog, nil
+			}
+		} else if err != redis.Nil {
+			log.Printf("Failed to read catalog cache for connection %s: %v", connID, err)
+		}
+	}
+
+	catalog, err := discoverCatalog(ctx, conn.Type, p)
+	if err != nil {
+		return nil, err
+	}
+	catalog.ConnectionID = connID
+	catalog.DiscoveredAt = time.Now().UTC()
+	catalog.Schemas = countSchemaTables(catalog.Schemas, catalog.Tables)
+
+	if s.redis != nil {
+		if data, err := json.Marshal(catalog); err == nil {
+			s.redis.Client().Set(ctx, key, data, catalogCacheTTL)
+		}
+	}
+	return catalog, nil
+}
+
+// discoverCatalog introspects a source of connType reached with p
+func discoverCatalog(ctx context.Context, connType string, p *ConnectionParams) (*ConnectionCatalog, error) {
+	var discover func(ctx context.Context, p *ConnectionParams) (*ConnectionCatalog, error)
+	switch connType {
+	case "postgres", "postgresql":
+		discover = discoverPostgres
+	case "mysql", "mariadb":
+		discover = discoverMySQL
+	default:
+		return nil, ErrDiscoveryNotSupported
+	}
+	var catalog *ConnectionCatalog
+	err := withSSHTunnel(ctx, p, func(p *ConnectionParams) error {
+		var err error
+		catalog, err = discover(ctx, p)
+		return err
+	})
+	return catalog, err
+}
+
+// countSchemaTables fills in the table count of each schema
+func countSchemaTables(schemas []DiscoveredSchema, tables []DiscoveredTable) []DiscoveredSchema {
+	counts := make(map[string]int)
+	for _, t := range tables {
+		counts[t.Schema]++
+	}
+	for i := range schemas {
+		schemas[i].TableCount = counts[schemas[i].Name]
+	}
+	return schemas
+}
+
+// TablesInSchema returns the discovered tables, limited to schema when set
+func (c *ConnectionCatalog) TablesInSchema(schema string) []DiscoveredTable {
+	if schema == "" {
+		return c.Tables
+	}
+	tables := []DiscoveredTable{}
+	for _, t := range c.Tables {
+		if t.Schema == schema {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+func discoverPostgres(ctx context.Context, p *ConnectionParams) (*ConnectionCatalog, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	conn, err := connectPostgres(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+
+	catalog := &ConnectionCatalog{DefaultSchema: "public", Schemas: []DiscoveredSchema{}, Tables: []DiscoveredTable{}}
+
+	rows, err := conn.Query(ctx, `
+		SELECT nspname FROM pg_namespace
+		WHERE nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'
+			AND has_schema_privilege(oid, 'USAGE')
+		ORDER BY nspname
+	`)
+	if err != nil {
+		return nil, postgresTestError(err)
+	}
+	schemas, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, postgresTestError(err)
+	}
+	for _, name := range schemas {
+		catalog.Schemas = append(catalog.Schemas, DiscoveredSchema{Name: name})
+	}
+
+	// Partitions are captured through their parent, so only roots are listed
+	rows, err = conn.Query(ctx, `
+		SELECT n.nspname, c.relname, GREATEST(c.reltuples, 0)::bigint,
+			COALESCE((
+				SELECT array_agg(a.attname ORDER BY array_position(i.indkey, a.attnum))
+				FROM pg_index i JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+				WHERE i.indrelid = c.oid AND i.indisprimary
+			), '{}')
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p') AND NOT c.relispartition
+			AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+		ORDER BY n.nspname, c.relname
+	`)
+	if err != nil {
+		return nil, postgresTestError(err)
+	}
+	index := make(map[string]int)
+	for rows.Next() {
+		t := DiscoveredTable{Columns: []DiscoveredColumn{}}
+		if err := rows.Scan(&t.Schema, &t.Name, &t.RowEstimate, &t.PrimaryKey); err != nil {
+			rows.Close()
+			return nil, postgresTestError(err)
+		}
+		index[t.QualifiedName()] = len(catalog.Tables)
+		catalog.Tables = append(catalog.Tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, postgresTestError(err)
+	}
+
+	rows, err = conn.Query(ctx, `
+		SELECT n.nspname, c.relname, a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p') AND NOT c.relispartition AND a.attnum > 0 AND NOT a.attisdropped
+			AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+		ORDER BY n.nspname, c.relname, a.attnum
+	`)
+	if err != nil {
+		return nil, postgresTestError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schema, table string
+		var col DiscoveredColumn
+		if err := rows.Scan(&schema, &table, &col.Name, &col.Type, &col.Nullable); err != nil {
+			return nil, postgresTestError(err)
+		}
+		if i, ok := index[schema+"."+table]; ok {
+			catalog.Tables[i].Columns = append(catalog.Tables[i].Columns, col)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, postgresTestError(err)
+	}
+
+	return catalog, nil
+}
+
+// mysqlSystemSchemas are never captured
+const mysqlSystemSchemas = `('mysql', 'information_schema', 'performance_schema', 'sys')`
+
+func discoverMySQL(ctx context.Context, p *ConnectionParams) (*ConnectionCatalog, error) {
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return nil, err
+	}
+	db, err := openMySQL(p)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	catalog := &ConnectionCatalog{DefaultSchema: p.Database, Schemas: []DiscoveredSchema{}, Tables: []DiscoveredTable{}}
+
+	schemas, err := queryMySQLStrings(ctx, db, `
+		SELECT SCHEMA_NAME FROM information_schema.SCHEMATA
+		WHERE SCHEMA_NAME NOT IN `+mysqlSystemSchemas+` ORDER BY SCHEMA_NAME`)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range schemas {
+		catalog.Schemas = append(catalog.Schemas, DiscoveredSchema{Name: name})
+	}
+
+	// TABLE_ROWS is an estimate for InnoDB
+	rows, err := db.QueryContext(ctx, `
+		SELECT TABLE_SCHEMA, TABLE_NAME, COALESCE(TABLE_ROWS, 0) FROM information_schema.TABLES
+		WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA NOT IN `+mysqlSystemSchemas+`
+		ORDER BY TABLE_SCHEMA, TABLE_NAME`)
+	if err != nil {
+		return nil, mysqlTestError(err)
+	}
+	index := make(map[string]int)
+	for rows.Next() {
+		t := DiscoveredTable{Columns: []DiscoveredColumn{}, PrimaryKey: []string{}}
+		if err := rows.Scan(&t.Schema, &t.Name, &t.RowEstimate); err != nil {
+			rows.Close()
+			return nil, mysqlTestError(err)
+		}
+		index[t.QualifiedName()] = len(catalog.Tables)
+		catalog.Tables = append(catalog.Tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, mysqlTestError(err)
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE = 'YES', COLUMN_KEY = 'PRI'
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA NOT IN `+mysqlSystemSchemas+`
+		ORDER BY TABLE_SCHEMA, TABLE_NAME, ORDINAL_POSITION`)
+	if err != nil {
+		return nil, mysqlTestError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schema, table string
+		var col DiscoveredColumn
+		var primary bool
+		if err := rows.Scan(&schema, &table, &col.Name, &col.Type, &col.Nullable, &primary); err != nil {
+			return nil, mysqlTestError(err)
+		}
+		i, ok := index[schema+"."+table]
+		if !ok {
+			continue // a view
+		}
+		catalog.Tables[i].Columns = append(catalog.Tables[i].Columns, col)
+		if primary {
+			catalog.Tables[i].PrimaryKey = append(catalog.Tables[i].PrimaryKey, col.Name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mysqlTestError(err)
+	}
+
+	return catalog, nil
+}
+
+func queryMySQLStrings(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, mysqlTestError(err)
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, mysqlTestError(err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mysqlTestError(err)
+	}
+	return values, nil
+}
+
+// ValidatePipelineTables checks the tables of a pipeline exist in its source.
+// Sources that can't be introspected, aren't reachable from the platform
+// (engines often run inside customer networks) or whose password only the
+// engine knows are accepted unchecked.
+func (s *ConnectionService) ValidatePipelineTables(ctx context.Context, userID, connID uuid.UUID, tables []string) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	catalog, err := s.Discover(ctx, userID, connID, false)
+	return validateDiscoveredTables(catalog, err, tables)
+}
+
+// discoverConnection introspects a connection that isn't stored yet, e.g.
+// one being imported
+func discoverConnection(ctx context.Context, conn *models.Connection) (*ConnectionCatalog, error) {
+	p, err := connectionParams(conn)
+	if err != nil {
+		return nil, err
+	}
+	return discoverCatalog(ctx, conn.Type, p)
+}
+
+// validateDiscoveredTables checks tables against the result of discovering
+// their source, accepting them when the source couldn't be introspected
+func validateDiscoveredTables(catalog *ConnectionCatalog, err error, tables []string) error {
+	if errors.Is(err, ErrDiscoveryNotSupported) || errors.Is(err, ErrConnectionTestFail) ||
+		errors.Is(err, ErrSecretResolvedByEngine) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return catalog.ValidateTables(tables)
+}
+
+// ValidateTables checks each table exists, suggesting close matches for the
+// ones that don't. Names without a schema are looked up in the default schema.
+func (c *ConnectionCatalog) ValidateTables(tables []string) error {
+	known := make(map[string]bool, len(c.Tables))
+	for _, t := range c.Tables {
+		known[t.QualifiedName()] = true
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for _, name := range tables {
+		name = strings.TrimSpace(name)
+		qualified := name
+		if !strings.Contains(name, ".") && c.DefaultSchema != "" {
+			qualified = c.DefaultSchema + "." + name
+		}
+		switch {
+		case name == "":
+			problems = append(problems, "empty table name")
+		case seen[qualified]:
+			problems = append(problems, fmt.Sprintf("%s is listed twice", name))
+		case !known[qualified]:
+			problem := fmt.Sprintf("%s does not exist", name)
+			if suggestion := c.suggestTable(qualified); suggestion != "" {
+				problem += fmt.Sprintf(" (did you mean %s?)", suggestion)
+			}
+			problems = append(problems, problem)
+		}
+		seen[qualified] = true
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidPipelineTables, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// suggestTable returns the discovered table closest to a misspelled name, or
+// the same table in another schema
+func (c *ConnectionCatalog) suggestTable(qualified string) string {
+	_, table := splitTableName(qualified)
+	lower := strings.ToLower(qualified)
+
+	best, bestDistance := "", 0
+	var sameName []string
+	for _, t := range c.Tables {
+		name := t.QualifiedName()
+		if strings.EqualFold(t.Name, table) {
+			sameName = append(sameName, name)
+		}
+		distance := editDistance(lower, strings.ToLower(name))
+		if best == "" || distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+	if len(sameName) > 0 {
+		sort.Strings(sameName)
+		return sameName[0]
+	}
+	// Allow about one typo per four characters
+	if best != "" && bestDistance <= max(1, len(table)/4) {
+		return best
+	}
+	return ""
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCatalog() *ConnectionCatalog {
+	return &ConnectionCatalog{
+		DefaultSchema: "public",
+		Schemas:       []DiscoveredSchema{{Name: "public"}, {Name: "sales"}, {Name: "empty"}},
+		Tables: []DiscoveredTable{
+			{Schema: "public", Name: "customers"},
+			{Schema: "public", Name: "orders"},
+			{Schema: "sales", Name: "invoices"},
+			{Schema: "sales", Name: "line_items"},
+		},
+	}
+}
+
+func TestConnectionCatalog_ValidateTables(t *testing.T) {
+	catalog := testCatalog()
+
+	assert.NoError(t, catalog.ValidateTables([]string{"orders", "public.customers", "sales.invoices"}))
+	assert.NoError(t, catalog.ValidateTables(nil))
+
+	tests := []struct {
+		name   string
+		tables []string
+		want   []string
+	}{
+		{"typo", []string{"public.ordrs"}, []string{"public.ordrs does not exist (did you mean public.orders?)"}},
+		{"unqualified typo", []string{"custmers"}, []string{"custmers does not exist (did you mean public.customers?)"}},
+		{"wrong schema", []string{"invoices"}, []string{"invoices does not exist (did you mean sales.invoices?)"}},
+		{"no close match", []string{"audit_log"}, []string{"audit_log does not exist"}},
+		{"duplicate", []string{"orders", "public.orders"}, []string{"public.orders is listed twice"}},
+		{"empty", []string{" "}, []string{"empty table name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := catalog.ValidateTables(tt.tables)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrInvalidPipelineTables))
+			for _, want := range tt.want {
+				assert.Contains(t, err.Error(), want)
+			}
+			if tt.name == "no close match" {
+				assert.NotContains(t, err.Error(), "did you mean")
+			}
+		})
+	}
+}
+
+func TestValidateDiscoveredTables(t *testing.T) {
+	catalog := testCatalog()
+	tables := []string{"audit_log"}
+
+	// Sources that can't be discovered now are checked when the pipeline starts
+	assert.NoError(t, validateDiscoveredTables(nil, ErrDiscoveryNotSupported, tables))
+	assert.NoError(t, validateDiscoveredTables(nil, fmt.Errorf("%w: timeout", ErrConnectionTestFail), tables))
+	assert.NoError(t, validateDiscoveredTables(nil, ErrSecretResolvedByEngine, tables))
+
+	assert.NoError(t, validateDiscoveredTables(catalog, nil, []string{"orders"}))
+	assert.True(t, errors.Is(validateDiscoveredTables(catalog, nil, tables), ErrInvalidPipelineTables))
+	assert.Error(t, validateDiscoveredTables(nil, errors.New("boom"), tables))
+}
+
+func TestConnectionCatalog_TablesInSchema(t *testing.T) {
+	catalog := testCatalog()
+	assert.Len(t, catalog.TablesInSchema(""), 4)
+	assert.Len(t, catalog.TablesInSchema("sales"), 2)
+	empty := catalog.TablesInSchema("empty")
+	assert.NotNil(t, empty)
+	assert.Empty(t, empty)
+
+	schemas := countSchemaTables(catalog.Schemas, catalog.Tables)
+	assert.Equal(t, []DiscoveredSchema{{"public", 2}, {"sales", 2}, {"empty", 0}}, schemas)
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("orders", "orders"))
+	assert.Equal(t, 1, editDistance("ordrs", "orders"))
+	assert.Equal(t, 2, editDistance("oredrs", "orders"))
+	assert.Equal(t, 6, editDistance("", "orders"))
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+// Connection test statuses
+const (
+	ConnectionTestSuccess = "success"
+	ConnectionTestFailed  = "failed"
+)
+
+// Connection test triggers
+const (
+	ConnectionTestManual    = "manual"
+	ConnectionTestScheduled = "scheduled"
+	ConnectionTestEngine    = "engine"
+)
+
+const (
+	// maxConnectionTestMessage caps the error message stored for a test
+	maxConnectionTestMessage = 1000
+	// connectionTestRetention is how long the health history is kept
+	connectionTestRetention = 30 * 24 * time.Hour
+	// scheduledTestBatchSize caps the connections re-tested per run
+	scheduledTestBatchSize = 100
+	// scheduledTestConcurrency caps the scheduled tests run at once
+	scheduledTestConcurrency = 4
+	// maxScheduledTestCheckInterval is how often the scheduler looks for
+	// connections due at most
+	maxScheduledTestCheckInterval = 5 * time.Minute
+)
+
+// newConnectionTest describes the outcome of a test that took latency
+func newConnectionTest(connID uuid.UUID, trigger string, latency time.Duration, testErr error) *models.ConnectionTest {
+	latencyMs := latency.Milliseconds()
+	test := &models.ConnectionTest{
+		ConnectionID: connID,
+		Status:       ConnectionTestSuccess,
+		Trigger:      trigger,
+		LatencyMs:    &latencyMs,
+	}
+	if testErr != nil {
+		test.Status = ConnectionTestFailed
+		test.Category = ConnectionTestCategory(testErr)
+		test.Message = testErr.Error()
+	}
+	return test
+}
+
+// recordConnectionTest stores a test in the health history and as the
+// current status of the connection, and notifies the owner when a healthy
+// connection starts failing
+func (s *ConnectionService) recordConnectionTest(ctx context.Context, userID uuid.UUID, test *models.ConnectionTest) error {
+	test.ID = uuid.New()
+	test.TestedAt = time.Now().UTC()
+	test.Message = truncate(test.Message, maxConnectionTestMessage)
+
+	// Engines report messages without the category drivers' errors carry
+	testError := test.Message
+	if test.Trigger == ConnectionTestEngine && test.Category != "" {
+		testError = test.Category + ": " + testError
+	}
+
+	var name, previous string
+	err := s.db.Pool().QueryRow(ctx, `
+		UPDATE connections c SET last_tested_at = $1, test_status = $2, test_error = NULLIF($3, '')
+		FROM connections prev
+		WHERE c.id = $4 AND c.user_id = $5 AND prev.id = c.id
+		RETURNING c.name, COALESCE(prev.test_status, '')
+	`, test.TestedAt, test.Status, testError, test.ConnectionID, userID).Scan(&name, &previous)
+	if err == pgx.ErrNoRows {
+		return ErrConnectionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Pool().Exec(ctx, `
+		INSERT INTO connection_tests (id, connection_id, status, trigger, latency_ms, category, message, tested_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8)
+	`, test.ID, test.ConnectionID, test.Status, test.Trigger, test.LatencyMs, test.Category, test.Message, test.TestedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record connection test: %w", err)
+	}
+
+	if startedFailing(previous, test.Status) {
+		if err := s.notifyConnectionFailing(ctx, userID, name, test); err != nil {
+			log.Printf("Failed to notify owner of failing connection %s: %v", test.ConnectionID, err)
+		}
+	}
+	return nil
+}
+
+// startedFailing reports whether a test moved a healthy connection to failed.
+// Connections that were never healthy, or already failing, aren't notified again.
+func startedFailing(previous, status string) bool {
+	return previous == ConnectionTestSuccess && status == ConnectionTestFailed
+}
+
+// notifyConnectionFailing emails the owner of a connection that started failing
+func (s *ConnectionService) notifyConnectionFailing(ctx context.Context, userID uuid.UUID, connName string, test *models.ConnectionTest) error {
+	if s.emailService == nil {
+		return nil
+	}
+	var name, email string
+	err := s.db.Pool().QueryRow(ctx, `SELECT name, email FROM users WHERE id = $1`, userID).Scan(&name, &email)
+	if err != nil {
+		return err
+	}
+	return s.emailService.SendConnectionFailingEmail(ctx, email, name, connName, test)
+}
+
+// ListConnectionTests returns the most recent tests of a connection, newest first
+func (s *ConnectionService) ListConnectionTests(ctx context.Context, userID, connID uuid.UUID, limit int) ([]models.ConnectionTest, error) {
+	var exists bool
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM connections WHERE id = $1 AND user_id = $2)
+	`, connID, userID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrConnectionNotFound
+	}
+
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT id, connection_id, status, trigger, latency_ms, COALESCE(category, ''), COALESCE(message, ''), tested_at
+		FROM connection_tests WHERE connection_id = $1
+		ORDER BY tested_at DESC LIMIT $2
+	`, connID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tests := make([]models.ConnectionTest, 0)
+	for rows.Next() {
+		var t models.ConnectionTest
+		if err := rows.Scan(&t.ID, &t.ConnectionID, &t.Status, &t.Trigger, &t.LatencyMs, &t.Category, &t.Message, &t.TestedAt); err != nil {
+			return nil, err
+		}
+		tests = append(tests, t)
+	}
+	return tests, rows.Err()
+}
+
+// RetestConnections tests the connections last tested more than interval
+// ago. Connections whose password only the engine can resolve are left to
+// the engine. Due connections are claimed by stamping last_tested_at, so each
+// is tested by only one replica.
+func (s *ConnectionService) RetestConnections(ctx context.Context, interval time.Duration) (int, error) {
+	now := time.Now().UTC()
+	rows, err := s.db.Pool().Query(ctx, `
+		UPDATE connections c SET last_tested_at = $3
+		FROM (
+			SELECT id FROM connections
+			WHERE password_ref IS NULL AND (last_tested_at IS NULL OR last_tested_at < $1)
+			ORDER BY last_tested_at NULLS FIRST
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE c.id = due.id
+		RETURNING c.id, c.user_id
+	`, now.Add(-interval), scheduledTestBatchSize, now)
+	if err != nil {
+		return 0, err
+	}
+	type dueConnection struct {
+		id, userID uuid.UUID
+	}
+	var due []dueConnection
+	for rows.Next() {
+		var c dueConnection
+		if err := rows.Scan(&c.id, &c.userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, scheduledTestConcurrency)
+	var wg sync.WaitGroup
+	for _, c := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c dueConnection) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := s.runConnectionTest(ctx, c.userID, c.id, ConnectionTestScheduled)
+			if err != nil && !errors.Is(err, ErrConnectionTestFail) && err != ErrConnectionNotFound {
+				log.Printf("Scheduled test of connection %s failed: %v", c.id, err)
+			}
+		}(c)
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+// PruneConnectionTests deletes health history older than connectionTestRetention
+func (s *ConnectionService) PruneConnectionTests(ctx context.Context) (int64, error) {
+	tag, err := s.db.Pool().Exec(ctx, `
+		DELETE FROM connection_tests WHERE tested_at < $1
+	`, time.Now().UTC().Add(-connectionTestRetention))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// StartScheduledTests re-tests connections every interval, and prunes their
+// health history, until ctx is done. A zero interval disables scheduled tests.
+func (s *ConnectionService) StartScheduledTests(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("Scheduled connection tests are disabled")
+		return
+	}
+	check := interval
+	if check > maxScheduledTestCheckInterval {
+		check = maxScheduledTestCheckInterval
+	}
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	for {
+		if tested, err := s.RetestConnections(ctx, interval); err != nil {
+			log.Printf("Scheduled connection tests failed: %v", err)
+		} else if tested > 0 {
+			log.Printf("Re-tested %d connections", tested)
+		}
+		if _, err := s.PruneConnectionTests(ctx); err != nil {
+			log.Printf("Failed to prune connection test history: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
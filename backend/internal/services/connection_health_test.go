@@ -0,0 +1,52 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConnectionTest(t *testing.T) {
+	connID := uuid.New()
+
+	test := newConnectionTest(connID, ConnectionTestScheduled, 1500*time.Millisecond, nil)
+	assert.Equal(t, connID, test.ConnectionID)
+	assert.Equal(t, ConnectionTestSuccess, test.Status)
+	assert.Equal(t, ConnectionTestScheduled, test.Trigger)
+	require.NotNil(t, test.LatencyMs)
+	assert.Equal(t, int64(1500), *test.LatencyMs)
+	assert.Empty(t, test.Category)
+	assert.Empty(t, test.Message)
+
+	testErr := newConnectionTestError(ConnErrAuth, errors.New("password authentication failed"), "cannot log in as %s", "cdc")
+	test = newConnectionTest(connID, ConnectionTestManual, time.Second, testErr)
+	assert.Equal(t, ConnectionTestFailed, test.Status)
+	assert.Equal(t, ConnErrAuth, test.Category)
+	assert.Equal(t, "cannot log in as cdc: password authentication failed", test.Message)
+
+	// Errors that aren't classified are still recorded
+	test = newConnectionTest(connID, ConnectionTestManual, time.Second, errors.New("driver: bad connection"))
+	assert.Equal(t, ConnErrUnknown, test.Category)
+}
+
+func TestStartedFailing(t *testing.T) {
+	tests := []struct {
+		previous string
+		status   string
+		expected bool
+	}{
+		{ConnectionTestSuccess, ConnectionTestFailed, true},
+		{ConnectionTestFailed, ConnectionTestFailed, false},
+		{"", ConnectionTestFailed, false},
+		{"pending", ConnectionTestFailed, false},
+		{ConnectionTestSuccess, ConnectionTestSuccess, false},
+		{ConnectionTestFailed, ConnectionTestSuccess, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, startedFailing(tt.previous, tt.status), "%q -> %q", tt.previous, tt.status)
+	}
+}
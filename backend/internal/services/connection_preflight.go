@@ -0,0 +1,529 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrPreflightNotSupported = errors.New("preflight checks are not available for this connection type")
+
+// Preflight check results
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+// Default replication object names, overridable with the publication and
+// slot_name connection options
+const (
+	defaultPublication = "savegress"
+	defaultSlotName    = "savegress"
+)
+
+// PreflightCheck is the result of one CDC readiness check
+type PreflightCheck struct {
+	Name        string `json:"name"`
+	Table       string `json:"table,omitempty"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// PreflightReport lists whether a source connection is ready for CDC
+type PreflightReport struct {
+	ConnectionID uuid.UUID        `json:"connection_id"`
+	Type         string           `json:"type"`
+	Status       string           `json:"status"`
+	Tables       []string         `json:"tables"`
+	Checks       []PreflightCheck `json:"checks"`
+	CheckedAt    time.Time        `json:"checked_at"`
+}
+
+// preflightStatus returns the worst status of checks
+func preflightStatus(checks []PreflightCheck) string {
+	status := PreflightPass
+	for _, c := range checks {
+		switch c.Status {
+		case PreflightFail:
+			return PreflightFail
+		case PreflightWarn:
+			status = PreflightWarn
+		}
+	}
+	return status
+}
+
+// Preflight checks a source connection is configured for CDC. tables defaults
+// to the tables of the pipelines reading from the connection.
+func (s *ConnectionService) Preflight(ctx context.Context, userID, connID uuid.UUID, tables []string) (*PreflightReport, error) {
+	conn, p, err := s.loadConnectionParams(ctx, userID, connID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tables) == 0 {
+		err := s.db.Pool().QueryRow(ctx, `
+			SELECT COALESCE(array_agg(DISTINCT t ORDER BY t), '{}')
+			FROM pipelines, unnest(tables) AS t
+			WHERE source_connection_id = $1
+		`, connID).Scan(&tables)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var gather func(p *ConnectionParams) ([]PreflightCheck, error)
+	switch conn.Type {
+	case "postgres", "postgresql":
+		gather = func(p *ConnectionParams) ([]PreflightCheck, error) {
+			facts, err := gatherPostgresPreflight(ctx, p, tables)
+			if err != nil {
+				return nil, err
+			}
+			return postgresPreflightChecks(facts), nil
+		}
+	case "mysql", "mariadb":
+		gather = func(p *ConnectionParams) ([]PreflightCheck, error) {
+			facts, err := gatherMySQLPreflight(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			return mysqlPreflightChecks(facts), nil
+		}
+	default:
+		return nil, ErrPreflightNotSupported
+	}
+
+	var checks []PreflightCheck
+	err = withSSHTunnel(ctx, p, func(p *ConnectionParams) error {
+		checks, err = gather(p)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreflightReport{
+		ConnectionID: connID,
+		Type:         conn.Type,
+		Status:       preflightStatus(checks),
+		Tables:       tables,
+		Checks:       checks,
+		CheckedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// splitTableName splits schema.table, defaulting the schema to public
+func splitTableName(name string) (schema, table string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "public", name
+}
+
+// postgresPreflightFacts is the server state the PostgreSQL checks evaluate
+type postgresPreflightFacts struct {
+	User                 string
+	WALLevel             string
+	CanReplicate         bool
+	MaxSlots             int
+	UsedSlots            int
+	SlotName             string
+	SlotExists           bool
+	Publication          string
+	PublicationExists    bool
+	PublicationAllTables bool
+	PublishedTables      map[string]bool // schema.table
+	Tables               []postgresTableFacts
+}
+
+type postgresTableFacts struct {
+	Name            string // schema.table
+	Exists          bool
+	ReplicaIdentity string // d(efault), n(othing), f(ull) or i(ndex)
+	HasPrimaryKey   bool
+}
+
+func gatherPostgresPreflight(ctx context.Context, p *ConnectionParams, tables []string) (*postgresPreflightFacts, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	conn, err := connectPostgres(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+
+	f := &postgresPreflightFacts{
+		SlotName:        p.Options["slot_name"],
+		Publication:     p.Options["publication"],
+		PublishedTables: make(map[string]bool),
+	}
+	if f.SlotName == "" {
+		f.SlotName = defaultSlotName
+	}
+	if f.Publication == "" {
+		f.Publication = defaultPublication
+	}
+
+	if err := conn.QueryRow(ctx, `SHOW wal_level`).Scan(&f.WALLevel); err != nil {
+		return nil, postgresTestError(err)
+	}
+
+	// rds_replication grants replication on Amazon RDS and Aurora
+	err = conn.QueryRow(ctx, `
+		SELECT current_user, r.rolsuper OR r.rolreplication OR EXISTS (
+			SELECT 1 FROM pg_roles g
+			WHERE g.rolname = 'rds_replication' AND pg_has_role(current_user, g.oid, 'member')
+		)
+		FROM pg_roles r WHERE r.rolname = current_user
+	`).Scan(&f.User, &f.CanReplicate)
+	if err != nil {
+		return nil, postgresTestError(err)
+	}
+
+	err = conn.QueryRow(ctx, `
+		SELECT current_setting('max_replication_slots')::int,
+			(SELECT count(*) FROM pg_replication_slots),
+			EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)
+	`, f.SlotName).Scan(&f.MaxSlots, &f.UsedSlots, &f.SlotExists)
+	if err != nil {
+		return nil, postgresTestError(err)
+	}
+
+	err = conn.QueryRow(ctx, `SELECT puballtables FROM pg_publication WHERE pubname = $1`, f.Publication).
+		Scan(&f.PublicationAllTables)
+	switch {
+	case err == pgx.ErrNoRows:
+	case err != nil:
+		return nil, postgresTestError(err)
+	default:
+		f.PublicationExists = true
+	}
+
+	if f.PublicationExists && !f.PublicationAllTables {
+		rows, err := conn.Query(ctx, `
+			SELECT schemaname || '.' || tablename FROM pg_publication_tables WHERE pubname = $1
+		`, f.Publication)
+		if err != nil {
+			return nil, postgresTestError(err)
+		}
+		published, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, postgresTestError(err)
+		}
+		for _, name := range published {
+			f.PublishedTables[name] = true
+		}
+	}
+
+	for _, name := range tables {
+		schema, table := splitTableName(name)
+		t := postgresTableFacts{Name: schema + "." + table}
+		err := conn.QueryRow(ctx, `
+			SELECT c.relreplident::text,
+				EXISTS (SELECT 1 FROM pg_index i WHERE i.indrelid = c.oid AND i.indisprimary)
+			FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p')
+		`, schema, table).Scan(&t.ReplicaIdentity, &t.HasPrimaryKey)
+		switch {
+		case err == pgx.ErrNoRows:
+		case err != nil:
+			return nil, postgresTestError(err)
+		default:
+			t.Exists = true
+		}
+		f.Tables = append(f.Tables, t)
+	}
+
+	return f, nil
+}
+
+func postgresPreflightChecks(f *postgresPreflightFacts) []PreflightCheck {
+	var checks []PreflightCheck
+
+	if f.WALLevel == "logical" {
+		checks = append(checks, PreflightCheck{Name: "wal_level", Status: PreflightPass,
+			Message: "wal_level is logical"})
+	} else {
+		checks = append(checks, PreflightCheck{Name: "wal_level", Status: PreflightFail,
+			Message:     fmt.Sprintf("wal_level is %s, logical decoding needs logical", f.WALLevel),
+			Remediation: "ALTER SYSTEM SET wal_level = logical; -- then restart the server"})
+	}
+
+	user := pgx.Identifier{f.User}.Sanitize()
+	if f.CanReplicate {
+		checks = append(checks, PreflightCheck{Name: "replication_privilege", Status: PreflightPass,
+			Message: fmt.Sprintf("%s can start replication", f.User)})
+	} else {
+		checks = append(checks, PreflightCheck{Name: "replication_privilege", Status: PreflightFail,
+			Message: fmt.Sprintf("%s lacks the REPLICATION attribute", f.User),
+			Remediation: fmt.Sprintf("ALTER ROLE %s WITH REPLICATION; -- on Amazon RDS: GRANT rds_replication TO %s;",
+				user, user)})
+	}
+
+	free := f.MaxSlots - f.UsedSlots
+	switch {
+	case f.SlotExists:
+		checks = append(checks, PreflightCheck{Name: "replication_slots", Status: PreflightPass,
+			Message: fmt.Sprintf("replication slot %s already exists", f.SlotName)})
+	case free > 0:
+		checks = append(checks, PreflightCheck{Name: "replication_slots", Status: PreflightPass,
+			Message: fmt.Sprintf("%d of %d replication slots free", free, f.MaxSlots)})
+	default:
+		checks = append(checks, PreflightCheck{Name: "replication_slots", Status: PreflightFail,
+			Message: fmt.Sprintf("all %d replication slots are in use", f.MaxSlots),
+			Remediation: fmt.Sprintf("ALTER SYSTEM SET max_replication_slots = %d; -- then restart the server",
+				f.UsedSlots+4)})
+	}
+
+	tableList := make([]string, 0, len(f.Tables))
+	var unpublished []string
+	for _, t := range f.Tables {
+		if !t.Exists {
+			continue
+		}
+		tableList = append(tableList, quotePostgresTable(t.Name))
+		if f.PublicationExists && !f.PublicationAllTables && !f.PublishedTables[t.Name] {
+			unpublished = append(unpublished, quotePostgresTable(t.Name))
+		}
+	}
+	publication := pgx.Identifier{f.Publication}.Sanitize()
+	switch {
+	case !f.PublicationExists:
+		remediation := fmt.Sprintf("CREATE PUBLICATION %s FOR ALL TABLES;", publication)
+		if len(tableList) > 0 {
+			remediation = fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s;", publication, strings.Join(tableList, ", "))
+		}
+		checks = append(checks, PreflightCheck{Name: "publication", Status: PreflightFail,
+			Message:     fmt.Sprintf("publication %s does not exist", f.Publication),
+			Remediation: remediation})
+	case len(unpublished) > 0:
+		checks = append(checks, PreflightCheck{Name: "publication", Status: PreflightFail,
+			Message: fmt.Sprintf("publication %s does not include %d selected tables", f.Publication, len(unpublished)),
+			Remediation: fmt.Sprintf("ALTER PUBLICATION %s ADD TABLE %s;", publication,
+				strings.Join(unpublished, ", "))})
+	default:
+		checks = append(checks, PreflightCheck{Name: "publication", Status: PreflightPass,
+			Message: fmt.Sprintf("publication %s includes the selected tables", f.Publication)})
+	}
+
+	if len(f.Tables) == 0 {
+		checks = append(checks, PreflightCheck{Name: "replica_identity", Status: PreflightWarn,
+			Message: "no tables selected, replica identity was not checked"})
+	}
+	for _, t := range f.Tables {
+		checks = append(checks, postgresReplicaIdentityCheck(t))
+	}
+
+	return checks
+}
+
+// postgresReplicaIdentityCheck checks updates and deletes of t carry the old row key
+func postgresReplicaIdentityCheck(t postgresTableFacts) PreflightCheck {
+	check := PreflightCheck{Name: "replica_identity", Table: t.Name}
+	fix := fmt.Sprintf("ALTER TABLE %s REPLICA IDENTITY FULL; -- or add a primary key", quotePostgresTable(t.Name))
+
+	switch {
+	case !t.Exists:
+		check.Status = PreflightFail
+		check.Message = "table does not exist"
+	case t.ReplicaIdentity == "f":
+		check.Status = PreflightPass
+		check.Message = "replica identity is FULL"
+	case t.ReplicaIdentity == "i":
+		check.Status = PreflightPass
+		check.Message = "replica identity uses an index"
+	case t.ReplicaIdentity == "n":
+		check.Status = PreflightFail
+		check.Message = "replica identity is NOTHING, updates and deletes can't be captured"
+		check.Remediation = fix
+	case t.HasPrimaryKey:
+		check.Status = PreflightPass
+		check.Message = "replica identity is the primary key"
+	default:
+		check.Status = PreflightFail
+		check.Message = "table has no primary key, updates and deletes can't be captured"
+		check.Remediation = fix
+	}
+	return check
+}
+
+func quotePostgresTable(name string) string {
+	schema, table := splitTableName(name)
+	return pgx.Identifier{schema, table}.Sanitize()
+}
+
+// mysqlPreflightFacts is the server state the MySQL checks evaluate
+type mysqlPreflightFacts struct {
+	MariaDB        bool
+	LogBin         bool
+	BinlogFormat   string
+	BinlogRowImage string
+	GTIDMode       string // MySQL only; MariaDB always records GTIDs
+	User           string // user@host
+	Grants         []string
+}
+
+func gatherMySQLPreflight(ctx context.Context, p *ConnectionParams) (*mysqlPreflightFacts, error) {
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return nil, err
+	}
+	db, err := openMySQL(p)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	f := &mysqlPreflightFacts{}
+	var version string
+	err = db.QueryRowContext(ctx, `SELECT VERSION(), @@log_bin, @@binlog_format, @@binlog_row_image, CURRENT_USER()`).
+		Scan(&version, &f.LogBin, &f.BinlogFormat, &f.BinlogRowImage, &f.User)
+	if err != nil {
+		return nil, mysqlTestError(err)
+	}
+	f.MariaDB = strings.Contains(strings.ToLower(version), "mariadb")
+
+	if !f.MariaDB {
+		if err := db.QueryRowContext(ctx, `SELECT @@gtid_mode`).Scan(&f.GTIDMode); err != nil {
+			return nil, mysqlTestError(err)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `SHOW GRANTS FOR CURRENT_USER()`)
+	if err != nil {
+		return nil, mysqlTestError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return nil, mysqlTestError(err)
+		}
+		f.Grants = append(f.Grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mysqlTestError(err)
+	}
+
+	return f, nil
+}
+
+func mysqlPreflightChecks(f *mysqlPreflightFacts) []PreflightCheck {
+	var checks []PreflightCheck
+
+	if f.LogBin {
+		checks = append(checks, PreflightCheck{Name: "log_bin", Status: PreflightPass,
+			Message: "binary logging is enabled"})
+	} else {
+		checks = append(checks, PreflightCheck{Name: "log_bin", Status: PreflightFail,
+			Message:     "binary logging is disabled",
+			Remediation: "-- set log_bin = mysql-bin and server_id in my.cnf, then restart the server"})
+	}
+
+	if strings.EqualFold(f.BinlogFormat, "ROW") {
+		checks = append(checks, PreflightCheck{Name: "binlog_format", Status: PreflightPass,
+			Message: "binlog_format is ROW"})
+	} else {
+		checks = append(checks, PreflightCheck{Name: "binlog_format", Status: PreflightFail,
+			Message:     fmt.Sprintf("binlog_format is %s, row changes need ROW", f.BinlogFormat),
+			Remediation: mysqlSetGlobal(f.MariaDB, "binlog_format", "'ROW'")})
+	}
+
+	if strings.EqualFold(f.BinlogRowImage, "FULL") {
+		checks = append(checks, PreflightCheck{Name: "binlog_row_image", Status: PreflightPass,
+			Message: "binlog_row_image is FULL"})
+	} else {
+		checks = append(checks, PreflightCheck{Name: "binlog_row_image", Status: PreflightWarn,
+			Message:     fmt.Sprintf("binlog_row_image is %s, change events will miss unchanged columns", f.BinlogRowImage),
+			Remediation: mysqlSetGlobal(f.MariaDB, "binlog_row_image", "'FULL'")})
+	}
+
+	switch {
+	case f.MariaDB:
+		checks = append(checks, PreflightCheck{Name: "gtid_mode", Status: PreflightPass,
+			Message: "MariaDB always records GTIDs"})
+	case strings.EqualFold(f.GTIDMode, "ON"):
+		checks = append(checks, PreflightCheck{Name: "gtid_mode", Status: PreflightPass,
+			Message: "gtid_mode is ON"})
+	default:
+		checks = append(checks, PreflightCheck{Name: "gtid_mode", Status: PreflightWarn,
+			Message: fmt.Sprintf("gtid_mode is %s, the engine falls back to binlog positions, which don't survive failover",
+				f.GTIDMode),
+			Remediation: "SET PERSIST enforce_gtid_consistency = ON; SET PERSIST gtid_mode = OFF_PERMISSIVE; " +
+				"SET PERSIST gtid_mode = ON_PERMISSIVE; SET PERSIST gtid_mode = ON;"})
+	}
+
+	// MariaDB 10.5 renamed REPLICATION SLAVE and split BINLOG MONITOR out of REPLICATION CLIENT
+	var missing []string
+	if !mysqlHasGrant(f.Grants, "REPLICATION SLAVE", "REPLICATION REPLICA") {
+		missing = append(missing, "REPLICATION SLAVE")
+	}
+	if !mysqlHasGrant(f.Grants, "REPLICATION CLIENT", "BINLOG MONITOR") {
+		missing = append(missing, "REPLICATION CLIENT")
+	}
+	if len(missing) == 0 {
+		checks = append(checks, PreflightCheck{Name: "replication_grants", Status: PreflightPass,
+			Message: fmt.Sprintf("%s has REPLICATION SLAVE and REPLICATION CLIENT", f.User)})
+	} else {
+		checks = append(checks, PreflightCheck{Name: "replication_grants", Status: PreflightFail,
+			Message: fmt.Sprintf("%s lacks %s", f.User, strings.Join(missing, " and ")),
+			Remediation: fmt.Sprintf("GRANT %s ON *.* TO %s;", strings.Join(missing, ", "),
+				mysqlAccount(f.User))})
+	}
+
+	return checks
+}
+
+// mysqlSetGlobal returns the statement that durably changes a server variable
+func mysqlSetGlobal(mariaDB bool, name, value string) string {
+	if mariaDB {
+		return fmt.Sprintf("SET GLOBAL %s = %s; -- and set it in my.cnf", name, value)
+	}
+	return fmt.Sprintf("SET PERSIST %s = %s;", name, value)
+}
+
+// mysqlHasGrant reports whether a global grant includes any of privileges
+func mysqlHasGrant(grants []string, privileges ...string) bool {
+	for _, grant := range grants {
+		grant = strings.ToUpper(grant)
+		on := strings.Index(grant, " ON *.* TO ")
+		if !strings.HasPrefix(grant, "GRANT ") || on < 0 {
+			continue
+		}
+		for _, priv := range strings.Split(grant[len("GRANT "):on], ",") {
+			priv = strings.TrimSpace(priv)
+			if priv == "ALL" || priv == "ALL PRIVILEGES" {
+				return true
+			}
+			for _, want := range privileges {
+				if priv == want {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// mysqlAccount quotes a user@host account name
+func mysqlAccount(account string) string {
+	user, host := account, "%"
+	if i := strings.LastIndex(account, "@"); i >= 0 {
+		user, host = account[:i], account[i+1:]
+	}
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return quote(user) + "@" + quote(host)
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findPreflightCheck(t *testing.T, checks []PreflightCheck, name, table string) PreflightCheck {
+	t.Helper()
+	for _, c := range checks {
+		if c.Name == name && c.Table == table {
+			return c
+		}
+	}
+	t.Fatalf("no %s check for %q", name, table)
+	return PreflightCheck{}
+}
+
+func readyPostgres() *postgresPreflightFacts {
+	return &postgresPreflightFacts{
+		User:                 "cdc",
+		WALLevel:             "logical",
+		CanReplicate:         true,
+		MaxSlots:             10,
+		UsedSlots:            2,
+		SlotName:             "savegress",
+		Publication:          "savegress",
+		PublicationExists:    true,
+		PublicationAllTables: true,
+		PublishedTables:      map[string]bool{},
+		Tables: []postgresTableFacts{
+			{Name: "public.orders", Exists: true, ReplicaIdentity: "d", HasPrimaryKey: true},
+		},
+	}
+}
+
+func TestPostgresPreflightChecks(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		checks := postgresPreflightChecks(readyPostgres())
+		assert.Equal(t, PreflightPass, preflightStatus(checks))
+		assert.Len(t, checks, 5)
+	})
+
+	t.Run("server settings", func(t *testing.T) {
+		f := readyPostgres()
+		f.WALLevel = "replica"
+		f.CanReplicate = false
+		f.UsedSlots = 10
+		checks := postgresPreflightChecks(f)
+		assert.Equal(t, PreflightFail, preflightStatus(checks))
+
+		wal := findPreflightCheck(t, checks, "wal_level", "")
+		assert.Equal(t, PreflightFail, wal.Status)
+		assert.Contains(t, wal.Remediation, "wal_level = logical")
+
+		role := findPreflightCheck(t, checks, "replication_privilege", "")
+		assert.Equal(t, PreflightFail, role.Status)
+		assert.Contains(t, role.Remediation, `ALTER ROLE "cdc" WITH REPLICATION`)
+
+		slots := findPreflightCheck(t, checks, "replication_slots", "")
+		assert.Equal(t, PreflightFail, slots.Status)
+		assert.Contains(t, slots.Remediation, "max_replication_slots = 14")
+
+		// An existing slot is reused even when none are free
+		f.SlotExists = true
+		slots = findPreflightCheck(t, postgresPreflightChecks(f), "replication_slots", "")
+		assert.Equal(t, PreflightPass, slots.Status)
+	})
+
+	t.Run("publication", func(t *testing.T) {
+		f := readyPostgres()
+		f.PublicationExists = false
+		pub := findPreflightCheck(t, postgresPreflightChecks(f), "publication", "")
+		assert.Equal(t, PreflightFail, pub.Status)
+		assert.Equal(t, `CREATE PUBLICATION "savegress" FOR TABLE "public"."orders";`, pub.Remediation)
+
+		f = readyPostgres()
+		f.PublicationAllTables = false
+		f.Tables = append(f.Tables, postgresTableFacts{Name: "sales.items", Exists: true, ReplicaIdentity: "f"})
+		f.PublishedTables["sales.items"] = true
+		pub = findPreflightCheck(t, postgresPreflightChecks(f), "publication", "")
+		assert.Equal(t, PreflightFail, pub.Status)
+		assert.Equal(t, `ALTER PUBLICATION "savegress" ADD TABLE "public"."orders";`, pub.Remediation)
+	})
+
+	t.Run("replica identity", func(t *testing.T) {
+		tests := []struct {
+			table  postgresTableFacts
+			status string
+			fix    bool
+		}{
+			{postgresTableFacts{Name: "public.a", Exists: true, ReplicaIdentity: "d", HasPrimaryKey: true}, PreflightPass, false},
+			{postgresTableFacts{Name: "public.b", Exists: true, ReplicaIdentity: "d"}, PreflightFail, true},
+			{postgresTableFacts{Name: "public.c", Exists: true, ReplicaIdentity: "f"}, PreflightPass, false},
+			{postgresTableFacts{Name: "public.d", Exists: true, ReplicaIdentity: "i"}, PreflightPass, false},
+			{postgresTableFacts{Name: "public.e", Exists: true, ReplicaIdentity: "n", HasPrimaryKey: true}, PreflightFail, true},
+			{postgresTableFacts{Name: "public.f"}, PreflightFail, false},
+		}
+		for _, tt := range tests {
+			check := postgresReplicaIdentityCheck(tt.table)
+			assert.Equal(t, tt.status, check.Status, tt.table.Name)
+			assert.Equal(t, tt.table.Name, check.Table)
+			assert.Equal(t, tt.fix, check.Remediation != "", tt.table.Name)
+		}
+
+		f := readyPostgres()
+		f.Tables = nil
+		check := findPreflightCheck(t, postgresPreflightChecks(f), "replica_identity", "")
+		assert.Equal(t, PreflightWarn, check.Status)
+	})
+}
+
+func TestMySQLPreflightChecks(t *testing.T) {
+	ready := func() *mysqlPreflightFacts {
+		return &mysqlPreflightFacts{
+			LogBin:         true,
+			BinlogFormat:   "ROW",
+			BinlogRowImage: "FULL",
+			GTIDMode:       "ON",
+			User:           "cdc@%",
+			Grants:         []string{"GRANT SELECT, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `cdc`@`%`"},
+		}
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		checks := mysqlPreflightChecks(ready())
+		assert.Equal(t, PreflightPass, preflightStatus(checks))
+		assert.Len(t, checks, 5)
+	})
+
+	t.Run("misconfigured", func(t *testing.T) {
+		f := ready()
+		f.BinlogFormat = "MIXED"
+		f.BinlogRowImage = "MINIMAL"
+		f.GTIDMode = "OFF"
+		f.Grants = []string{"GRANT SELECT ON `shop`.* TO `cdc`@`%`", "GRANT REPLICATION CLIENT ON `shop`.* TO `cdc`@`%`"}
+		checks := mysqlPreflightChecks(f)
+		assert.Equal(t, PreflightFail, preflightStatus(checks))
+
+		format := findPreflightCheck(t, checks, "binlog_format", "")
+		assert.Equal(t, PreflightFail, format.Status)
+		assert.Equal(t, "SET PERSIST binlog_format = 'ROW';", format.Remediation)
+
+		assert.Equal(t, PreflightWarn, findPreflightCheck(t, checks, "binlog_row_image", "").Status)
+		assert.Equal(t, PreflightWarn, findPreflightCheck(t, checks, "gtid_mode", "").Status)
+
+		grants := findPreflightCheck(t, checks, "replication_grants", "")
+		assert.Equal(t, PreflightFail, grants.Status)
+		assert.Equal(t, "GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO 'cdc'@'%';", grants.Remediation)
+	})
+
+	t.Run("mariadb", func(t *testing.T) {
+		f := ready()
+		f.MariaDB = true
+		f.GTIDMode = ""
+		f.BinlogFormat = "STATEMENT"
+		f.Grants = []string{"GRANT BINLOG MONITOR, REPLICATION REPLICA ON *.* TO `cdc`@`%`"}
+		checks := mysqlPreflightChecks(f)
+
+		assert.Equal(t, PreflightPass, findPreflightCheck(t, checks, "gtid_mode", "").Status)
+		assert.Equal(t, PreflightPass, findPreflightCheck(t, checks, "replication_grants", "").Status)
+		assert.Contains(t, findPreflightCheck(t, checks, "binlog_format", "").Remediation, "SET GLOBAL binlog_format")
+	})
+}
+
+func TestMySQLHasGrant(t *testing.T) {
+	assert.True(t, mysqlHasGrant([]string{"GRANT ALL PRIVILEGES ON *.* TO `root`@`localhost` WITH GRANT OPTION"},
+		"REPLICATION SLAVE"))
+	assert.False(t, mysqlHasGrant([]string{"GRANT ALL PRIVILEGES ON `shop`.* TO `cdc`@`%`"}, "REPLICATION SLAVE"))
+	assert.False(t, mysqlHasGrant([]string{"GRANT REPLICATION SLAVE ADMIN ON *.* TO `cdc`@`%`"}, "REPLICATION SLAVE"))
+}
+
+func TestPreflightHelpers(t *testing.T) {
+	schema, table := splitTableName("orders")
+	assert.Equal(t, "public", schema)
+	assert.Equal(t, "orders", table)
+	schema, table = splitTableName("sales.items")
+	assert.Equal(t, "sales", schema)
+	assert.Equal(t, "items", table)
+
+	assert.Equal(t, "'o''brien'@'10.0.0.%'", mysqlAccount("o'brien@10.0.0.%"))
+
+	require.Equal(t, PreflightWarn, preflightStatus([]PreflightCheck{{Status: PreflightPass}, {Status: PreflightWarn}}))
+	require.Equal(t, PreflightPass, preflightStatus(nil))
+}
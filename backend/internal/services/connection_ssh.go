@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+var ErrInvalidSSHTunnel = errors.New("invalid SSH tunnel")
+
+// defaultSSHPort is used when a tunnel names no port
+const defaultSSHPort = 22
+
+// validateSSHTunnel checks and normalizes tunnel settings before they are
+// stored. t.PrivateKey must hold the plaintext key, if any.
+func validateSSHTunnel(t *models.SSHTunnel) error {
+	t.Host = strings.TrimSpace(t.Host)
+	t.User = strings.TrimSpace(t.User)
+	if t.Host == "" || t.User == "" {
+		return fmt.Errorf("%w: host and user are required", ErrInvalidSSHTunnel)
+	}
+	if t.Port == 0 {
+		t.Port = defaultSSHPort
+	}
+	if t.Port < 0 || t.Port > 65535 {
+		return fmt.Errorf("%w: invalid port %d", ErrInvalidSSHTunnel, t.Port)
+	}
+
+	if t.PrivateKey != "" {
+		if _, err := ssh.ParsePrivateKey([]byte(t.PrivateKey)); err != nil {
+			var passphraseErr *ssh.PassphraseMissingError
+			if errors.As(err, &passphraseErr) {
+				return fmt.Errorf("%w: passphrase-protected private keys are not supported", ErrInvalidSSHTunnel)
+			}
+			return fmt.Errorf("%w: private_key must be an unencrypted PEM or OpenSSH key", ErrInvalidSSHTunnel)
+		}
+	}
+
+	fingerprint, err := normalizeHostKeyFingerprint(t.HostKeyFingerprint)
+	if err != nil {
+		return err
+	}
+	t.HostKeyFingerprint = fingerprint
+	return nil
+}
+
+// normalizeHostKeyFingerprint accepts the SHA256 fingerprint printed by
+// ssh-keygen -lf, with or without the SHA256: prefix and base64 padding
+func normalizeHostKeyFingerprint(fingerprint string) (string, error) {
+	hash := strings.TrimPrefix(strings.TrimSpace(fingerprint), "SHA256:")
+	hash = strings.TrimRight(hash, "=")
+	if decoded, err := base64.RawStdEncoding.DecodeString(hash); err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("%w: host_key_fingerprint must be a SHA256 fingerprint as printed by ssh-keygen -lf", ErrInvalidSSHTunnel)
+	}
+	return "SHA256:" + hash, nil
+}
+
+// sshTunnelColumns selects the tunnel settings of a connection, except the key
+const sshTunnelColumns = `COALESCE(ssh_host, ''), COALESCE(ssh_port, 0), COALESCE(ssh_user, ''),
+			COALESCE(ssh_host_key_fingerprint, '')`
+
+// sshTunnelRow scans the tunnel columns of a connection
+type sshTunnelRow models.SSHTunnel
+
+// orNil returns the tunnel, or nil when the connection has none
+func (r *sshTunnelRow) orNil() *models.SSHTunnel {
+	if r.Host == "" {
+		return nil
+	}
+	tunnel := models.SSHTunnel(*r)
+	return &tunnel
+}
+
+// decryptSSHTunnel returns t with its private key decrypted
+func (s *ConnectionService) decryptSSHTunnel(t *models.SSHTunnel) (*models.SSHTunnel, error) {
+	if t == nil || t.PrivateKey == "" {
+		return t, nil
+	}
+	key, err := s.decryptPassword(t.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SSH private key: %w", err)
+	}
+	t.PrivateKey = key
+	return t, nil
+}
+
+// mergeSSHTunnel applies the ssh_tunnel value of an update to the current
+// tunnel. It returns nil to remove the tunnel, and a tunnel with an encrypted
+// private key, or none to keep the stored one.
+func (s *ConnectionService) mergeSSHTunnel(current *models.SSHTunnel, value interface{}) (*models.SSHTunnel, error) {
+	if value == nil {
+		return nil, nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: ssh_tunnel must be an object or null", ErrInvalidSSHTunnel)
+	}
+
+	tunnel := &models.SSHTunnel{}
+	if current != nil {
+		*tunnel = *current
+	}
+	if host, ok := fields["host"].(string); ok {
+		tunnel.Host = host
+	}
+	if port, ok := fields["port"].(float64); ok {
+		tunnel.Port = int(port)
+	}
+	if user, ok := fields["user"].(string); ok {
+		tunnel.User = user
+	}
+	if key, ok := fields["private_key"].(string); ok {
+		tunnel.PrivateKey = key
+	}
+	if fingerprint, ok := fields["host_key_fingerprint"].(string); ok {
+		tunnel.HostKeyFingerprint = fingerprint
+	}
+	if tunnel.PrivateKey == "" && current == nil {
+		return nil, fmt.Errorf("%w: private_key is required", ErrInvalidSSHTunnel)
+	}
+	if err := validateSSHTunnel(tunnel); err != nil {
+		return nil, err
+	}
+
+	if tunnel.PrivateKey != "" {
+		encryptedKey, err := s.encryptPassword(tunnel.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt SSH private key: %w", err)
+		}
+		tunnel.PrivateKey = encryptedKey
+	}
+	return tunnel, nil
+}
+
+// saveSSHTunnel stores the tunnel of a connection, keeping the stored private
+// key when tunnel has none. A nil tunnel removes it.
+func (s *ConnectionService) saveSSHTunnel(ctx context.Context, q querier, userID, connID uuid.UUID, tunnel *models.SSHTunnel) error {
+	if tunnel == nil {
+		_, err := q.Exec(ctx, `
+			UPDATE connections SET ssh_host = NULL, ssh_port = NULL, ssh_user = NULL, ssh_private_key = NULL,
+				ssh_host_key_fingerprint = NULL
+			WHERE id = $1 AND user_id = $2
+		`, connID, userID)
+		return err
+	}
+	_, err := q.Exec(ctx, `
+		UPDATE connections SET ssh_host = $1, ssh_port = $2, ssh_user = $3,
+			ssh_private_key = COALESCE(NULLIF($4, ''), ssh_private_key), ssh_host_key_fingerprint = $5
+		WHERE id = $6 AND user_id = $7
+	`, tunnel.Host, tunnel.Port, tunnel.User, tunnel.PrivateKey, tunnel.HostKeyFingerprint, connID, userID)
+	return err
+}
+
+// sshTunnel forwards connections accepted on a local port to a target
+// address, through an SSH bastion
+type sshTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	target   string
+	wg       sync.WaitGroup
+}
+
+// openSSHTunnel connects to the bastion of t, verifying its host key, and
+// checks the bastion can reach target. Failures are *ConnectionTestError.
+func openSSHTunnel(ctx context.Context, t *models.SSHTunnel, target string) (*sshTunnel, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(t.PrivateKey))
+	if err != nil {
+		return nil, newConnectionTestError(ConnErrConfig, err, "invalid SSH private key")
+	}
+	if err := checkReachable(ctx, t.Host, t.Port); err != nil {
+		return nil, err
+	}
+
+	address := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	dialer := net.Dialer{Timeout: connectionTestTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, newConnectionTestError(ConnErrNetwork, err, "cannot connect to SSH host %s", address)
+	}
+
+	config := &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: sshHostKeyCallback(t.HostKeyFingerprint),
+		Timeout:         connectionTestTimeout,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, newConnectionTestError(ConnErrSSH, err, "SSH handshake with %s failed", address)
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	// Report an unreachable database as such rather than as a driver error
+	probe, err := client.Dial("tcp", target)
+	if err != nil {
+		client.Close()
+		return nil, newConnectionTestError(ConnErrNetwork, err, "SSH host %s cannot connect to %s", address, target)
+	}
+	probe.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	tunnel := &sshTunnel{client: client, listener: listener, target: target}
+	tunnel.wg.Add(1)
+	go tunnel.serve()
+	return tunnel, nil
+}
+
+// sshHostKeyCallback accepts only the host key with the given fingerprint
+func sshHostKeyCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if got := ssh.FingerprintSHA256(key); got != fingerprint {
+			return fmt.Errorf("host key mismatch: expected %s, got %s", fingerprint, got)
+		}
+		return nil
+	}
+}
+
+func (t *sshTunnel) serve() {
+	defer t.wg.Done()
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.wg.Add(1)
+		go t.forward(local)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+	defer local.Close()
+
+	remote, err := t.client.Dial("tcp", t.target)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// LocalAddr returns the local host and port that reach the target
+func (t *sshTunnel) LocalAddr() (string, int) {
+	addr := t.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Close stops forwarding and disconnects from the bastion
+func (t *sshTunnel) Close() error {
+	t.listener.Close()
+	err := t.client.Close()
+	t.wg.Wait()
+	return err
+}
+
+// withSSHTunnel calls fn with settings that reach the database of p, through
+// its SSH tunnel when it has one. Certificates are still verified against the
+// database host name.
+func withSSHTunnel(ctx context.Context, p *ConnectionParams, fn func(p *ConnectionParams) error) error {
+	if p.SSHTunnel == nil {
+		return fn(p)
+	}
+	if p.Type == "dynamodb" && awsRegionPattern.MatchString(p.Host) {
+		return newConnectionTestError(ConnErrConfig, nil, "SSH tunnels need a DynamoDB endpoint host, not a region")
+	}
+
+	tunnel, err := openSSHTunnel(ctx, p.SSHTunnel, p.Address())
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	local := *p
+	local.Host, local.Port = tunnel.LocalAddr()
+	local.TLSServerName = p.tlsHost()
+	local.SSHTunnel = nil
+	return fn(&local)
+}
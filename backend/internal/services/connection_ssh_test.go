@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+// newSSHKey returns a private key in OpenSSH PEM format and its signer
+func newSSHKey(t *testing.T) (string, ssh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(block)), signer
+}
+
+// startSSHServer runs a bastion that accepts clientKey and forwards
+// direct-tcpip channels, returning its address
+func startSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) (string, int) {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "bastion" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHConn(conn, config)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func serveSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "direct-tcpip" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		// host string, port uint32, origin string, origin port uint32
+		data := newChan.ExtraData()
+		hostLen := binary.BigEndian.Uint32(data)
+		host := string(data[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(data[4+hostLen:])
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, chanReqs, err := newChan.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chanReqs)
+		go func() {
+			defer channel.Close()
+			defer target.Close()
+			go io.Copy(target, channel)
+			io.Copy(channel, target)
+		}()
+	}
+}
+
+// startEchoServer returns the address of a TCP server that echoes its input
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestSSHTunnel(t *testing.T) {
+	_, hostKey := newSSHKey(t)
+	clientPEM, clientKey := newSSHKey(t)
+	host, port := startSSHServer(t, hostKey, clientKey.PublicKey())
+	echo := startEchoServer(t)
+
+	tunnel := &models.SSHTunnel{
+		Host:               host,
+		Port:               port,
+		User:               "bastion",
+		PrivateKey:         clientPEM,
+		HostKeyFingerprint: ssh.FingerprintSHA256(hostKey.PublicKey()),
+	}
+
+	t.Run("forwards", func(t *testing.T) {
+		echoHost, echoPort, _ := net.SplitHostPort(echo)
+		p := &ConnectionParams{Type: "postgres", Host: echoHost, SSHTunnel: tunnel}
+		p.Port, _ = strconv.Atoi(echoPort)
+
+		err := withSSHTunnel(context.Background(), p, func(local *ConnectionParams) error {
+			assert.Equal(t, "127.0.0.1", local.Host)
+			assert.NotEqual(t, p.Port, local.Port)
+			assert.Equal(t, echoHost, local.TLSServerName)
+
+			conn, err := net.Dial("tcp", local.Address())
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("ping"))
+			require.NoError(t, err)
+			reply := make([]byte, 4)
+			_, err = io.ReadFull(conn, reply)
+			require.NoError(t, err)
+			assert.Equal(t, "ping", string(reply))
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("host key mismatch", func(t *testing.T) {
+		_, otherKey := newSSHKey(t)
+		wrong := *tunnel
+		wrong.HostKeyFingerprint = ssh.FingerprintSHA256(otherKey.PublicKey())
+		_, err := openSSHTunnel(context.Background(), &wrong, echo)
+		require.Error(t, err)
+		assert.Equal(t, ConnErrSSH, ConnectionTestCategory(err))
+		assert.Contains(t, err.Error(), "host key mismatch")
+	})
+
+	t.Run("key rejected", func(t *testing.T) {
+		otherPEM, _ := newSSHKey(t)
+		wrong := *tunnel
+		wrong.PrivateKey = otherPEM
+		_, err := openSSHTunnel(context.Background(), &wrong, echo)
+		assert.Equal(t, ConnErrSSH, ConnectionTestCategory(err))
+	})
+
+	t.Run("target unreachable", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		closed := listener.Addr().String()
+		listener.Close()
+
+		_, err = openSSHTunnel(context.Background(), tunnel, closed)
+		assert.Equal(t, ConnErrNetwork, ConnectionTestCategory(err))
+		assert.Contains(t, err.Error(), "cannot connect to "+closed)
+	})
+}
+
+func TestValidateSSHTunnel(t *testing.T) {
+	keyPEM, hostKey := newSSHKey(t)
+	fingerprint := ssh.FingerprintSHA256(hostKey.PublicKey())
+
+	tunnel := &models.SSHTunnel{
+		Host:               " bastion.example.com ",
+		User:               "ec2-user",
+		PrivateKey:         keyPEM,
+		HostKeyFingerprint: fingerprint[len("SHA256:"):] + "=",
+	}
+	require.NoError(t, validateSSHTunnel(tunnel))
+	assert.Equal(t, "bastion.example.com", tunnel.Host)
+	assert.Equal(t, 22, tunnel.Port)
+	assert.Equal(t, fingerprint, tunnel.HostKeyFingerprint)
+
+	invalid := []models.SSHTunnel{
+		{User: "ec2-user", HostKeyFingerprint: fingerprint},
+		{Host: "bastion", User: "ec2-user", Port: 70000, HostKeyFingerprint: fingerprint},
+		{Host: "bastion", User: "ec2-user", PrivateKey: "not a key", HostKeyFingerprint: fingerprint},
+		{Host: "bastion", User: "ec2-user", HostKeyFingerprint: "MD5:16:27:ac:a5"},
+	}
+	for _, tt := range invalid {
+		err := validateSSHTunnel(&tt)
+		assert.True(t, errors.Is(err, ErrInvalidSSHTunnel), "%+v", tt)
+	}
+}
+
+func TestMergeSSHTunnel(t *testing.T) {
+	service := NewConnectionService(nil, "test-key")
+	keyPEM, hostKey := newSSHKey(t)
+	fingerprint := ssh.FingerprintSHA256(hostKey.PublicKey())
+
+	removed, err := service.mergeSSHTunnel(&models.SSHTunnel{Host: "bastion"}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, removed)
+
+	_, err = service.mergeSSHTunnel(nil, map[string]interface{}{
+		"host": "bastion", "user": "ec2-user", "host_key_fingerprint": fingerprint,
+	})
+	assert.True(t, errors.Is(err, ErrInvalidSSHTunnel), "a new tunnel needs a private key")
+
+	created, err := service.mergeSSHTunnel(nil, map[string]interface{}{
+		"host": "bastion", "port": float64(2222), "user": "ec2-user", "private_key": keyPEM,
+		"host_key_fingerprint": fingerprint,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2222, created.Port)
+	decrypted, err := service.decryptPassword(created.PrivateKey)
+	require.NoError(t, err)
+	assert.Equal(t, keyPEM, decrypted)
+
+	// The stored key is kept when an update doesn't replace it
+	current := &models.SSHTunnel{Host: "bastion", Port: 22, User: "ec2-user", HostKeyFingerprint: fingerprint}
+	updated, err := service.mergeSSHTunnel(current, map[string]interface{}{"host": "bastion-2"})
+	require.NoError(t, err)
+	assert.Equal(t, "bastion-2", updated.Host)
+	assert.Empty(t, updated.PrivateKey)
+}
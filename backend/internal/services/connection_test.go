@@ -39,7 +39,7 @@ func TestNewConnectionService(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			service := NewConnectionService(nil, tt.encryptionKey)
 			assert.NotNil(t, service)
-			assert.Len(t, service.encryptionKey, 32)
+			assert.Len(t, service.keyring.keys[service.keyring.PrimaryID()], 32)
 		})
 	}
 }
@@ -178,30 +178,24 @@ func TestConnectionService_ErrorConstants(t *testing.T) {
 }
 
 func TestConnectionService_ConnectionTypes(t *testing.T) {
-	// Document supported connection types
+	service := NewConnectionService(nil, "test-key")
+
+	// Every source type licenses advertise has a protocol-level tester
 	supportedTypes := []string{
 		"postgres",
 		"postgresql",
 		"mysql",
 		"mariadb",
-	}
-
-	// Types with only TCP test (no driver test)
-	tcpOnlyTypes := []string{
 		"mongodb",
 		"sqlserver",
+		"cassandra",
+		"dynamodb",
 		"oracle",
 	}
 
 	for _, connType := range supportedTypes {
 		t.Run("supported_"+connType, func(t *testing.T) {
-			assert.NotEmpty(t, connType)
-		})
-	}
-
-	for _, connType := range tcpOnlyTypes {
-		t.Run("tcp_only_"+connType, func(t *testing.T) {
-			assert.NotEmpty(t, connType)
+			assert.Contains(t, service.testers, connType)
 		})
 	}
 }
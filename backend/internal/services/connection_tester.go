@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+// Connection test error categories
+const (
+	ConnErrDNS        = "dns"        // the host name doesn't resolve
+	ConnErrNetwork    = "network"    // the host can't be reached or the connection dropped
+	ConnErrTLS        = "tls"        // TLS handshake or certificate verification failed
+	ConnErrAuth       = "auth"       // the credentials were rejected
+	ConnErrPermission = "permission" // authenticated, but not allowed to use the database
+	ConnErrDatabase   = "database"   // the database, keyspace or table doesn't exist
+	ConnErrConfig     = "config"     // the connection settings are invalid
+	ConnErrSSH        = "ssh"        // the SSH host key or key authentication was rejected
+	ConnErrUnknown    = "unknown"
+)
+
+// connectionTestTimeout bounds each connection test
+const connectionTestTimeout = 10 * time.Second
+
+// ConnectionTestError is a failed connection test. It matches ErrConnectionTestFail.
+type ConnectionTestError struct {
+	Category string
+	Message  string
+	err      error
+}
+
+func (e *ConnectionTestError) Error() string {
+	return e.Message
+}
+
+func (e *ConnectionTestError) Unwrap() []error {
+	return []error{ErrConnectionTestFail, e.err}
+}
+
+// newConnectionTestError wraps a driver error, classifying it when category is empty
+func newConnectionTestError(category string, err error, format string, args ...interface{}) *ConnectionTestError {
+	if category == "" {
+		category = classifyConnectionError(err)
+	}
+	message := fmt.Sprintf(format, args...)
+	if err != nil {
+		message += ": " + err.Error()
+	}
+	return &ConnectionTestError{Category: category, Message: message, err: err}
+}
+
+// ConnectionTestCategory returns the category of a failed connection test
+func ConnectionTestCategory(err error) string {
+	var testErr *ConnectionTestError
+	if errors.As(err, &testErr) {
+		return testErr.Category
+	}
+	return ConnErrUnknown
+}
+
+// ConnectionParams are the settings a tester connects with
+type ConnectionParams struct {
+	Type     string
+	Host     string
+	Port     int
+	Database string
+	Username string
+	Password string
+	SSLMode  string
+	Options  map[string]string
+
+	// SSHTunnel is the bastion the database is reached through, with the
+	// decrypted private key
+	SSHTunnel *models.SSHTunnel
+	// TLSServerName is the host certificates are verified against when it
+	// differs from Host, e.g. through a tunnel
+	TLSServerName string
+	// Certificates is the CA bundle and client certificate, decrypted. They
+	// are parsed by loadCertificates.
+	Certificates *models.ConnectionTLS
+	rootCAs      *x509.CertPool
+	clientCerts  []tls.Certificate
+}
+
+// Address returns host:port
+func (p *ConnectionParams) Address() string {
+	return net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+}
+
+// tlsHost returns the host name certificates are verified against
+func (p *ConnectionParams) tlsHost() string {
+	if p.TLSServerName != "" {
+		return p.TLSServerName
+	}
+	return p.Host
+}
+
+// ConnectionTester checks that a source is usable at the protocol level
+type ConnectionTester interface {
+	// Types returns the connection types the tester handles
+	Types() []string
+	// Test connects, authenticates and checks the database exists. Failures
+	// are returned as *ConnectionTestError.
+	Test(ctx context.Context, p *ConnectionParams) error
+}
+
+// defaultConnectionTesters returns testers for every source type licenses advertise
+func defaultConnectionTesters() []ConnectionTester {
+	return []ConnectionTester{
+		postgresTester{},
+		mysqlTester{},
+		sqlServerTester{},
+		oracleTester{},
+		mongoTester{},
+		cassandraTester{},
+		dynamoDBTester{},
+	}
+}
+
+// SSL modes, as in libpq
+const (
+	SSLDisable    = "disable"
+	SSLAllow      = "allow"
+	SSLPrefer     = "prefer"
+	SSLRequire    = "require"
+	SSLVerifyCA   = "verify-ca"
+	SSLVerifyFull = "verify-full"
+)
+
+// normalizeSSLMode defaults an empty mode to prefer and rejects unknown ones
+func normalizeSSLMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return SSLPrefer, nil
+	case SSLDisable, SSLAllow, SSLPrefer, SSLRequire, SSLVerifyCA, SSLVerifyFull:
+		return mode, nil
+	default:
+		return "", newConnectionTestError(ConnErrConfig, nil,
+			"invalid ssl_mode %q: must be disable, allow, prefer, require, verify-ca or verify-full", mode)
+	}
+}
+
+// connectionTLSConfig returns the TLS settings of sslMode for host. Certificates
+// are only checked by verify-ca (chain) and verify-full (chain and host name).
+func connectionTLSConfig(sslMode, host string) *tls.Config {
+	switch sslMode {
+	case SSLVerifyFull:
+		return &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	case SSLVerifyCA:
+		return &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: true, // the chain is verified below, without the host name
+			VerifyConnection:   verifyCertificateChainWith(nil),
+		}
+	default:
+		return &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true}
+	}
+}
+
+// verifyCertificateChainWith checks the server certificate chains to one of
+// roots, or to a system root when roots is nil
+func verifyCertificateChainWith(roots *x509.CertPool) func(tls.ConnectionState) error {
+	return verifyCertificateFor(roots, "")
+}
+
+// verifyCertificateFor checks the server certificate chains like
+// verifyCertificateChainWith and, unless host is empty, is valid for host
+func verifyCertificateFor(roots *x509.CertPool, host string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("tls: server sent no certificate")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{DNSName: host, Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
+
+// withTLSFallback connects with the TLS settings of sslMode, for drivers that
+// can't negotiate TLS themselves. prefer retries in plaintext when the TLS
+// handshake fails; allow tries plaintext first and retries with TLS.
+func withTLSFallback(sslMode, host string, connect func(tlsConfig *tls.Config) error) error {
+	switch sslMode {
+	case SSLDisable:
+		return connect(nil)
+	case SSLAllow:
+		err := connect(nil)
+		if err != nil && ConnectionTestCategory(err) == ConnErrNetwork {
+			if tlsErr := connect(connectionTLSConfig(sslMode, host)); tlsErr == nil {
+				return nil
+			}
+		}
+		return err
+	case SSLPrefer:
+		err := connect(connectionTLSConfig(sslMode, host))
+		if err != nil && ConnectionTestCategory(err) == ConnErrTLS {
+			return connect(nil)
+		}
+		return err
+	default:
+		return connect(connectionTLSConfig(sslMode, host))
+	}
+}
+
+// checkReachable resolves host and opens a TCP connection to it, so DNS and
+// network failures are reported as such before a driver obscures them
+func checkReachable(ctx context.Context, host string, port int) error {
+	if host == "" {
+		return newConnectionTestError(ConnErrConfig, nil, "host is required")
+	}
+	if port <= 0 || port > 65535 {
+		return newConnectionTestError(ConnErrConfig, nil, "invalid port %d", port)
+	}
+
+	if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return newConnectionTestError(ConnErrDNS, err, "cannot resolve %s", host)
+		}
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: connectionTestTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return newConnectionTestError(ConnErrNetwork, err, "cannot connect to %s", address)
+	}
+	conn.Close()
+	return nil
+}
+
+// classifyConnectionError categorizes transport-level errors; driver-specific
+// auth, permission and database errors are recognized by each tester
+func classifyConnectionError(err error) string {
+	if err == nil {
+		return ConnErrUnknown
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ConnErrDNS
+	}
+
+	var (
+		recordErr    tls.RecordHeaderError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return ConnErrTLS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return ConnErrNetwork
+	}
+
+	// Drivers often flatten errors into strings
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "no such host"):
+		return ConnErrDNS
+	case strings.Contains(msg, "tls") || strings.Contains(msg, "x509") || strings.Contains(msg, "ssl") ||
+		strings.Contains(msg, "certificate"):
+		return ConnErrTLS
+	case strings.Contains(msg, "connection refused") || strings.Contains(msg, "i/o timeout") ||
+		strings.Contains(msg, "connection reset") || strings.Contains(msg, "eof") ||
+		strings.Contains(msg, "no route to host"):
+		return ConnErrNetwork
+	case strings.Contains(msg, "authentication") || strings.Contains(msg, "password"):
+		return ConnErrAuth
+	case strings.Contains(msg, "permission") || strings.Contains(msg, "access denied") ||
+		strings.Contains(msg, "not authorized") || strings.Contains(msg, "unauthorized"):
+		return ConnErrPermission
+	}
+	return ConnErrUnknown
+}
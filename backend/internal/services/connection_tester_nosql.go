@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+	"github.com/gocql/gocql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// mongoTester checks MongoDB sources. Users authenticate against the
+// auth_source option, or the database itself when it isn't set.
+type mongoTester struct{}
+
+func (mongoTester) Types() []string { return []string{"mongodb"} }
+
+func (mongoTester) Test(ctx context.Context, p *ConnectionParams) error {
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return err
+	}
+	return withTLSFallback(p.SSLMode, p.tlsHost(), func(tlsConfig *tls.Config) error {
+		return testMongo(ctx, p, tlsConfig)
+	})
+}
+
+func testMongo(ctx context.Context, p *ConnectionParams, tlsConfig *tls.Config) error {
+	opts := options.Client().
+		SetHosts([]string{p.Address()}).
+		SetDirect(true).
+		SetAppName("Savegress").
+		SetConnectTimeout(connectionTestTimeout).
+		SetServerSelectionTimeout(connectionTestTimeout).
+		SetTLSConfig(tlsConfig)
+	if p.Username != "" {
+		authSource := p.Options["auth_source"]
+		if authSource == "" {
+			authSource = p.Database
+		}
+		opts.SetAuth(options.Credential{Username: p.Username, Password: p.Password, AuthSource: authSource})
+	}
+
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		return newConnectionTestError(ConnErrConfig, err, "invalid connection settings")
+	}
+	defer client.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return mongoTestError(err)
+	}
+	if p.Database == "" {
+		return nil
+	}
+
+	names, err := client.ListDatabaseNames(ctx, bson.D{{Key: "name", Value: p.Database}},
+		options.ListDatabases().SetAuthorizedDatabases(true))
+	if err != nil {
+		return mongoTestError(err)
+	}
+	if len(names) == 0 {
+		return newConnectionTestError(ConnErrDatabase, nil, "database %q does not exist", p.Database)
+	}
+	return nil
+}
+
+func mongoTestError(err error) error {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		switch cmdErr.Code {
+		case 18: // AuthenticationFailed
+			return newConnectionTestError(ConnErrAuth, err, "authentication failed")
+		case 13: // Unauthorized
+			return newConnectionTestError(ConnErrPermission, err, "permission denied")
+		}
+	}
+	return newConnectionTestError("", err, "connection failed")
+}
+
+// cassandraTester checks Cassandra sources. Database is the keyspace.
+type cassandraTester struct{}
+
+func (cassandraTester) Types() []string { return []string{"cassandra"} }
+
+func (cassandraTester) Test(ctx context.Context, p *ConnectionParams) error {
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return err
+	}
+	return withTLSFallback(p.SSLMode, p.tlsHost(), func(tlsConfig *tls.Config) error {
+		return testCassandra(ctx, p, tlsConfig)
+	})
+}
+
+func testCassandra(ctx context.Context, p *ConnectionParams, tlsConfig *tls.Config) error {
+	cluster := gocql.NewCluster(p.Host)
+	cluster.Port = p.Port
+	cluster.ConnectTimeout = connectionTestTimeout
+	cluster.Timeout = connectionTestTimeout
+	cluster.NumConns = 1
+	// Only talk to the given host, not the peers it advertises
+	cluster.DisableInitialHostLookup = true
+	if p.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: p.Username, Password: p.Password}
+	}
+	if tlsConfig != nil {
+		cluster.SslOpts = &gocql.SslOptions{Config: tlsConfig, EnableHostVerification: !tlsConfig.InsecureSkipVerify}
+	}
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return cassandraTestError(err)
+	}
+	defer session.Close()
+
+	if p.Database == "" {
+		return nil
+	}
+	var keyspace string
+	err = session.Query(`SELECT keyspace_name FROM system_schema.keyspaces WHERE keyspace_name = ?`, p.Database).
+		WithContext(ctx).Scan(&keyspace)
+	if err == gocql.ErrNotFound {
+		return newConnectionTestError(ConnErrDatabase, nil, "keyspace %q does not exist", p.Database)
+	}
+	if err != nil {
+		return cassandraTestError(err)
+	}
+	return nil
+}
+
+func cassandraTestError(err error) error {
+	var reqErr gocql.RequestError
+	if errors.As(err, &reqErr) {
+		switch reqErr.Code() {
+		case gocql.ErrCodeCredentials:
+			return newConnectionTestError(ConnErrAuth, err, "authentication failed")
+		case gocql.ErrCodeUnauthorized:
+			return newConnectionTestError(ConnErrPermission, err, "permission denied")
+		}
+	}
+	return newConnectionTestError("", err, "connection failed")
+}
+
+// awsRegionPattern matches AWS region names such as us-east-1
+var awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d+$`)
+
+// dynamoDBTester checks DynamoDB sources. Host is either an AWS region or the
+// host of a DynamoDB-compatible endpoint, username and password are the access
+// key (requests go unsigned without one), and database is an optional table
+// that must exist.
+type dynamoDBTester struct{}
+
+func (dynamoDBTester) Types() []string { return []string{"dynamodb"} }
+
+func (dynamoDBTester) Test(ctx context.Context, p *ConnectionParams) error {
+	region := p.Options["region"]
+	endpoint := ""
+	host, port := p.Host, p.Port
+	if awsRegionPattern.MatchString(p.Host) {
+		region = p.Host
+		host, port = "dynamodb."+region+".amazonaws.com", 443
+	} else {
+		scheme := "https"
+		if p.SSLMode == SSLDisable {
+			scheme = "http"
+		}
+		endpoint = scheme + "://" + p.Address()
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if err := checkReachable(ctx, host, port); err != nil {
+		return err
+	}
+
+	httpClient := awshttp.NewBuildableClient().WithTimeout(connectionTestTimeout)
+	if endpoint != "" && p.SSLMode != SSLDisable {
+		httpClient = httpClient.WithTransportOptions(func(tr *http.Transport) {
+			tr.TLSClientConfig = connectionTLSConfig(p.SSLMode, p.tlsHost())
+		})
+	}
+	// The config is built by hand rather than loaded, so the environment,
+	// shared profiles and instance metadata of the platform never supply
+	// credentials for a user's connection
+	awsCfg := aws.Config{
+		Region:           region,
+		HTTPClient:       httpClient,
+		RetryMaxAttempts: 1,
+		Credentials:      dynamoDBCredentials(p),
+	}
+	client := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	var err error
+	if p.Database != "" {
+		_, err = client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(p.Database)})
+	} else {
+		_, err = client.ListTables(ctx, &dynamodb.ListTablesInput{Limit: aws.Int32(1)})
+	}
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			switch apiErr.ErrorCode() {
+			case "UnrecognizedClientException", "InvalidSignatureException", "ExpiredTokenException",
+				"MissingAuthenticationTokenException":
+				return newConnectionTestError(ConnErrAuth, err, "authentication failed")
+			case "AccessDeniedException":
+				return newConnectionTestError(ConnErrPermission, err, "permission denied")
+			case "ResourceNotFoundException":
+				return newConnectionTestError(ConnErrDatabase, err, "table %q does not exist", p.Database)
+			}
+		}
+		return newConnectionTestError("", err, "connection failed")
+	}
+	return nil
+}
+
+// dynamoDBCredentials returns the connection's access key, or anonymous
+// credentials when it has none
+func dynamoDBCredentials(p *ConnectionParams) aws.CredentialsProvider {
+	if p.Username == "" {
+		return aws.AnonymousCredentials{}
+	}
+	return credentials.NewStaticCredentialsProvider(p.Username, p.Password, "")
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/microsoft/go-mssqldb/msdsn"
+	go_ora "github.com/sijms/go-ora/v2"
+	"github.com/sijms/go-ora/v2/network"
+)
+
+// pingSQL opens db and checks a connection can be made
+func pingSQL(ctx context.Context, db *sql.DB) error {
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// postgresTester checks PostgreSQL sources. pgx negotiates every ssl_mode itself.
+type postgresTester struct{}
+
+func (postgresTester) Types() []string { return []string{"postgres", "postgresql"} }
+
+func (postgresTester) Test(ctx context.Context, p *ConnectionParams) error {
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	conn, err := connectPostgres(ctx, p)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if err := conn.Ping(ctx); err != nil {
+		return postgresTestError(err)
+	}
+	return nil
+}
+
+// connectPostgres opens a connection with the settings of p
+func connectPostgres(ctx context.Context, p *ConnectionParams) (*pgx.Conn, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(p.Username, p.Password),
+		Host:     p.Address(),
+		Path:     "/" + p.Database,
+		RawQuery: url.Values{"sslmode": {p.SSLMode}, "connect_timeout": {"10"}}.Encode(),
+	}
+	cfg, err := pgx.ParseConfig(dsn.String())
+	if err != nil {
+		return nil, newConnectionTestError(ConnErrConfig, err, "invalid connection settings")
+	}
+	applyPostgresTLS(cfg, p)
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, postgresTestError(err)
+	}
+	return conn, nil
+}
+
+func postgresTestError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "28P01", "28000": // invalid_password, invalid_authorization_specification
+			return newConnectionTestError(ConnErrAuth, pgErr, "authentication failed")
+		case "3D000": // invalid_catalog_name
+			return newConnectionTestError(ConnErrDatabase, pgErr, "database does not exist")
+		case "42501": // insufficient_privilege
+			return newConnectionTestError(ConnErrPermission, pgErr, "permission denied")
+		}
+	}
+	return newConnectionTestError("", err, "connection failed")
+}
+
+// mysqlTester checks MySQL and MariaDB sources
+type mysqlTester struct{}
+
+func (mysqlTester) Types() []string { return []string{"mysql", "mariadb"} }
+
+func (mysqlTester) Test(ctx context.Context, p *ConnectionParams) error {
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return err
+	}
+	db, err := openMySQL(p)
+	if err != nil {
+		return err
+	}
+	if err := pingSQL(ctx, db); err != nil {
+		return mysqlTestError(err)
+	}
+	return nil
+}
+
+// openMySQL returns a handle for the settings of p; it doesn't connect yet
+func openMySQL(p *ConnectionParams) (*sql.DB, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = p.Username
+	cfg.Passwd = p.Password
+	cfg.Net = "tcp"
+	cfg.Addr = p.Address()
+	cfg.DBName = p.Database
+	cfg.Timeout = connectionTestTimeout
+	cfg.ReadTimeout = connectionTestTimeout
+	switch p.SSLMode {
+	case SSLDisable:
+		cfg.TLSConfig = "false"
+	case SSLAllow, SSLPrefer:
+		cfg.TLS = p.tlsConfig()
+		cfg.AllowFallbackToPlaintext = true
+	default:
+		cfg.TLS = p.tlsConfig()
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, newConnectionTestError(ConnErrConfig, err, "invalid connection settings")
+	}
+	return sql.OpenDB(connector), nil
+}
+
+func mysqlTestError(err error) error {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1045: // ER_ACCESS_DENIED_ERROR
+			return newConnectionTestError(ConnErrAuth, myErr, "authentication failed")
+		case 1044: // ER_DBACCESS_DENIED_ERROR
+			return newConnectionTestError(ConnErrPermission, myErr, "permission denied")
+		case 1049: // ER_BAD_DB_ERROR
+			return newConnectionTestError(ConnErrDatabase, myErr, "database does not exist")
+		case 3159: // ER_SECURE_TRANSPORT_REQUIRED
+			return newConnectionTestError(ConnErrTLS, myErr, "server requires TLS")
+		}
+	}
+	if errors.Is(err, mysql.ErrNoTLS) {
+		return newConnectionTestError(ConnErrTLS, err, "server does not support TLS")
+	}
+	return newConnectionTestError("", err, "connection failed")
+}
+
+// sqlServerTester checks SQL Server sources
+type sqlServerTester struct{}
+
+func (sqlServerTester) Types() []string { return []string{"sqlserver", "mssql"} }
+
+func (sqlServerTester) Test(ctx context.Context, p *ConnectionParams) error {
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return err
+	}
+	cfg, err := sqlServerConfig(p)
+	if err != nil {
+		return newConnectionTestError(ConnErrConfig, err, "invalid connection settings")
+	}
+
+	if err := pingSQL(ctx, sql.OpenDB(mssql.NewConnectorConfig(cfg))); err != nil {
+		var msErr mssql.Error
+		if errors.As(err, &msErr) {
+			switch msErr.Number {
+			case 18456: // login failed
+				return newConnectionTestError(ConnErrAuth, msErr, "authentication failed")
+			case 4060: // cannot open database requested by the login
+				return newConnectionTestError(ConnErrDatabase, msErr, "database does not exist or is not accessible")
+			case 916, 229: // not a valid user in the database, permission denied
+				return newConnectionTestError(ConnErrPermission, msErr, "permission denied")
+			}
+		}
+		return newConnectionTestError("", err, "connection failed")
+	}
+	return nil
+}
+
+// sqlServerConfig returns the driver settings of p. Certificates are checked
+// against the host name of p even when Host is a tunnel's local end.
+func sqlServerConfig(p *ConnectionParams) (msdsn.Config, error) {
+	query := url.Values{
+		"database":           {p.Database},
+		"dial timeout":       {strconv.Itoa(int(connectionTestTimeout.Seconds()))},
+		"encrypt":            {"true"},
+		"app name":           {"Savegress"},
+		"connection timeout": {strconv.Itoa(int(connectionTestTimeout.Seconds()))},
+	}
+	switch p.SSLMode {
+	case SSLDisable:
+		query.Set("encrypt", "disable")
+	case SSLAllow, SSLPrefer:
+		// Only the login packet is encrypted, as the server allows
+		query.Set("encrypt", "false")
+		query.Set("TrustServerCertificate", "true")
+	case SSLRequire:
+		query.Set("TrustServerCertificate", "true")
+	case SSLVerifyCA, SSLVerifyFull:
+		// The driver defaults to the dialed host, which a tunnel rewrites
+		query.Set("hostnameincertificate", p.tlsHost())
+	}
+	dsn := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(p.Username, p.Password),
+		Host:     p.Address(),
+		RawQuery: query.Encode(),
+	}
+	cfg, err := msdsn.Parse(dsn.String())
+	if err != nil {
+		return cfg, err
+	}
+	if p.SSLMode == SSLVerifyCA {
+		cfg.TLSConfig = connectionTLSConfig(p.SSLMode, p.tlsHost())
+	}
+	return cfg, nil
+}
+
+// oracleTester checks Oracle sources. Database is the service name.
+type oracleTester struct{}
+
+func (oracleTester) Types() []string { return []string{"oracle"} }
+
+func (oracleTester) Test(ctx context.Context, p *ConnectionParams) error {
+	if p.Database == "" {
+		return newConnectionTestError(ConnErrConfig, nil, "database (the service name) is required")
+	}
+	if err := checkReachable(ctx, p.Host, p.Port); err != nil {
+		return err
+	}
+
+	return withTLSFallback(p.SSLMode, p.tlsHost(), func(tlsConfig *tls.Config) error {
+		return testOracle(ctx, p, tlsConfig)
+	})
+}
+
+// testOracle connects with go-ora, which takes TLS settings as options as well as a tls.Config
+func testOracle(ctx context.Context, p *ConnectionParams, tlsConfig *tls.Config) error {
+	options := map[string]string{"TIMEOUT": strconv.Itoa(int(connectionTestTimeout.Seconds()))}
+	if tlsConfig != nil {
+		options["SSL"] = "true"
+		options["SSL VERIFY"] = strconv.FormatBool(p.SSLMode == SSLVerifyCA || p.SSLMode == SSLVerifyFull)
+	}
+	dsn := go_ora.BuildUrl(p.Host, p.Port, p.Database, p.Username, p.Password, options)
+	connector := go_ora.NewConnector(dsn).(*go_ora.OracleConnector)
+	if tlsConfig != nil {
+		connector.WithTLSConfig(oracleTLSConfig(tlsConfig, p.tlsHost()))
+	}
+
+	if err := pingSQL(ctx, sql.OpenDB(connector)); err != nil {
+		var oraErr *network.OracleError
+		if errors.As(err, &oraErr) {
+			switch oraErr.ErrCode {
+			case 1017, 28000, 28001: // invalid credentials, account locked, password expired
+				return newConnectionTestError(ConnErrAuth, oraErr, "authentication failed")
+			case 1045: // lacks CREATE SESSION privilege
+				return newConnectionTestError(ConnErrPermission, oraErr, "permission denied")
+			case 12514, 12505: // listener does not know the service or SID
+				return newConnectionTestError(ConnErrDatabase, oraErr, "service does not exist")
+			}
+		}
+		return newConnectionTestError("", err, "connection failed")
+	}
+	return nil
+}
+
+// oracleTLSConfig adapts cfg to go-ora, which overwrites ServerName with the
+// dialed host. Behind a tunnel that is the tunnel's local end, so the host
+// name is checked against host while verifying the chain instead.
+func oracleTLSConfig(cfg *tls.Config, host string) *tls.Config {
+	if cfg.InsecureSkipVerify {
+		return cfg
+	}
+	cfg = cfg.Clone()
+	cfg.InsecureSkipVerify = true // verified below, against host
+	cfg.VerifyConnection = verifyCertificateFor(cfg.RootCAs, host)
+	return cfg
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConnectionTester struct {
+	types []string
+	err   error
+	got   *ConnectionParams
+}
+
+func (f *fakeConnectionTester) Types() []string { return f.types }
+
+func (f *fakeConnectionTester) Test(ctx context.Context, p *ConnectionParams) error {
+	f.got = p
+	return f.err
+}
+
+func TestConnectionService_RegisterTester(t *testing.T) {
+	service := NewConnectionService(nil, "test-key")
+	fake := &fakeConnectionTester{types: []string{"postgres", "clickhouse"}}
+	service.RegisterTester(fake)
+
+	err := service.TestConnectionDirect(context.Background(), "clickhouse", "db.example.com", 9000, "events", "user", "secret", "", nil)
+	require.NoError(t, err)
+	require.NotNil(t, fake.got)
+	assert.Equal(t, "db.example.com", fake.got.Host)
+	assert.Equal(t, SSLPrefer, fake.got.SSLMode, "empty ssl_mode defaults to prefer")
+
+	// Replaces the built-in tester
+	assert.Same(t, fake, service.testers["postgres"].(*fakeConnectionTester))
+	assert.IsType(t, mysqlTester{}, service.testers["mysql"])
+}
+
+func TestConnectionService_DoConnectionTestRejectsBadSettings(t *testing.T) {
+	service := NewConnectionService(nil, "test-key")
+
+	err := service.TestConnectionDirect(context.Background(), "redis", "localhost", 6379, "", "", "", "disable", nil)
+	assert.True(t, errors.Is(err, ErrConnectionTestFail))
+	assert.Equal(t, ConnErrConfig, ConnectionTestCategory(err))
+	assert.Contains(t, err.Error(), "unsupported connection type")
+
+	err = service.TestConnectionDirect(context.Background(), "postgres", "localhost", 5432, "", "", "", "sometimes", nil)
+	assert.Equal(t, ConnErrConfig, ConnectionTestCategory(err))
+	assert.Contains(t, err.Error(), "invalid ssl_mode")
+}
+
+func TestNormalizeSSLMode(t *testing.T) {
+	for _, mode := range []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"} {
+		got, err := normalizeSSLMode(mode)
+		require.NoError(t, err)
+		assert.Equal(t, mode, got)
+	}
+
+	got, err := normalizeSSLMode(" Require ")
+	require.NoError(t, err)
+	assert.Equal(t, SSLRequire, got)
+
+	_, err = normalizeSSLMode("true")
+	assert.Error(t, err)
+}
+
+func TestConnectionTLSConfig(t *testing.T) {
+	full := connectionTLSConfig(SSLVerifyFull, "db.example.com")
+	assert.False(t, full.InsecureSkipVerify)
+	assert.Equal(t, "db.example.com", full.ServerName)
+
+	ca := connectionTLSConfig(SSLVerifyCA, "db.example.com")
+	assert.True(t, ca.InsecureSkipVerify)
+	assert.NotNil(t, ca.VerifyConnection, "verify-ca checks the chain itself")
+	assert.Error(t, ca.VerifyConnection(tls.ConnectionState{}))
+
+	required := connectionTLSConfig(SSLRequire, "db.example.com")
+	assert.True(t, required.InsecureSkipVerify)
+	assert.Nil(t, required.VerifyConnection)
+}
+
+func TestWithTLSFallback(t *testing.T) {
+	tlsErr := newConnectionTestError(ConnErrTLS, nil, "handshake failed")
+	netErr := newConnectionTestError(ConnErrNetwork, nil, "connection reset")
+	authErr := newConnectionTestError(ConnErrAuth, nil, "authentication failed")
+
+	// attempts records whether each attempt used TLS
+	run := func(mode string, results ...error) ([]bool, error) {
+		var attempts []bool
+		err := withTLSFallback(mode, "db.example.com", func(cfg *tls.Config) error {
+			attempts = append(attempts, cfg != nil)
+			result := results[0]
+			results = results[1:]
+			return result
+		})
+		return attempts, err
+	}
+
+	attempts, err := run(SSLPrefer, tlsErr, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, attempts, "prefer falls back to plaintext")
+
+	attempts, err = run(SSLPrefer, authErr)
+	assert.Equal(t, authErr, err)
+	assert.Equal(t, []bool{true}, attempts, "only TLS failures fall back")
+
+	attempts, err = run(SSLRequire, tlsErr)
+	assert.Equal(t, tlsErr, err)
+	assert.Equal(t, []bool{true}, attempts)
+
+	attempts, err = run(SSLAllow, netErr, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, attempts, "allow retries with TLS")
+
+	attempts, err = run(SSLAllow, netErr, authErr)
+	assert.Equal(t, netErr, err, "the plaintext failure is reported")
+	assert.Len(t, attempts, 2)
+
+	attempts, err = run(SSLDisable, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false}, attempts)
+}
+
+func TestClassifyConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"dns", &net.DNSError{Err: "no such host", Name: "db.invalid", IsNotFound: true}, ConnErrDNS},
+		{"wrapped dns", fmt.Errorf("dial: %w", &net.DNSError{Err: "server misbehaving"}), ConnErrDNS},
+		{"unknown authority", fmt.Errorf("handshake: %w", x509.UnknownAuthorityError{}), ConnErrTLS},
+		{"hostname mismatch", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "db"}, ConnErrTLS},
+		{"refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ConnErrNetwork},
+		{"deadline", context.DeadlineExceeded, ConnErrNetwork},
+		{"flattened tls", errors.New("server selection error: remote error: tls: handshake failure"), ConnErrTLS},
+		{"flattened auth", errors.New("unable to authenticate: Authentication failed."), ConnErrAuth},
+		{"other", errors.New("something odd"), ConnErrUnknown},
+		{"nil", nil, ConnErrUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifyConnectionError(tt.err))
+		})
+	}
+}
+
+func TestConnectionTestError(t *testing.T) {
+	cause := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	err := newConnectionTestError("", cause, "cannot connect to %s", "db:5432")
+
+	assert.Equal(t, ConnErrNetwork, err.Category)
+	assert.Equal(t, "cannot connect to db:5432: dial tcp: connection refused", err.Error())
+	assert.True(t, errors.Is(err, ErrConnectionTestFail))
+
+	var opErr *net.OpError
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, ConnErrNetwork, ConnectionTestCategory(fmt.Errorf("test: %w", err)))
+}
+
+func TestCheckReachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	assert.NoError(t, checkReachable(context.Background(), "127.0.0.1", port))
+
+	ln.Close()
+	err = checkReachable(context.Background(), "127.0.0.1", port)
+	assert.Equal(t, ConnErrNetwork, ConnectionTestCategory(err))
+
+	err = checkReachable(context.Background(), "127.0.0.1", 70000)
+	assert.Equal(t, ConnErrConfig, ConnectionTestCategory(err))
+
+	err = checkReachable(context.Background(), "", 5432)
+	assert.Equal(t, ConnErrConfig, ConnectionTestCategory(err))
+}
+
+func TestConnectionParams_Address(t *testing.T) {
+	assert.Equal(t, "db.example.com:5432", (&ConnectionParams{Host: "db.example.com", Port: 5432}).Address())
+	assert.Equal(t, "[2001:db8::1]:5432", (&ConnectionParams{Host: "2001:db8::1", Port: 5432}).Address())
+}
+
+func TestAWSRegionPattern(t *testing.T) {
+	for _, region := range []string{"us-east-1", "eu-central-2", "us-gov-west-1", "ap-southeast-3"} {
+		assert.True(t, awsRegionPattern.MatchString(region), region)
+	}
+	for _, host := range []string{"localhost", "dynamodb.us-east-1.amazonaws.com", "10.0.0.5", "my-dynamo-proxy"} {
+		assert.False(t, awsRegionPattern.MatchString(host), host)
+	}
+}
+
+func TestDynamoDBCredentials(t *testing.T) {
+	// The platform's own credentials must never be used for a user's connection
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAPLATFORM")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "platform-secret")
+
+	assert.IsType(t, aws.AnonymousCredentials{}, dynamoDBCredentials(&ConnectionParams{}))
+
+	creds, err := dynamoDBCredentials(&ConnectionParams{Username: "AKIAUSER", Password: "user-secret"}).Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKIAUSER", creds.AccessKeyID)
+	assert.Equal(t, "user-secret", creds.SecretAccessKey)
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+var (
+	ErrInvalidCertificate       = errors.New("invalid certificate")
+	ErrCertificatesNotSupported = errors.New("certificates are not supported for this connection type")
+)
+
+// certificateExpiryWindow is how long before expiry certificates are warned about
+const certificateExpiryWindow = 30 * 24 * time.Hour
+
+// certificateTypes are the connection types certificates are used for
+var certificateTypes = map[string]bool{
+	"postgres":   true,
+	"postgresql": true,
+	"mysql":      true,
+	"mariadb":    true,
+}
+
+// Certificate usages
+const (
+	CertificateCA     = "ca"
+	CertificateClient = "client"
+)
+
+// parseCertificateMaterial validates the PEM material of t and describes its
+// certificates. It needs a CA bundle, a client certificate and key, or both,
+// and rejects certificates that have expired or aren't valid yet.
+func parseCertificateMaterial(t *models.ConnectionTLS, now time.Time) error {
+	t.CACert = strings.TrimSpace(t.CACert)
+	t.ClientCert = strings.TrimSpace(t.ClientCert)
+	t.ClientKey = strings.TrimSpace(t.ClientKey)
+	if t.CACert == "" && t.ClientCert == "" && t.ClientKey == "" {
+		return fmt.Errorf("%w: provide ca_cert, client_cert and client_key, or both", ErrInvalidCertificate)
+	}
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("%w: client_cert and client_key must be provided together", ErrInvalidCertificate)
+	}
+
+	t.Certificates = nil
+	if t.CACert != "" {
+		certs, err := parsePEMCertificates(t.CACert)
+		if err != nil {
+			return fmt.Errorf("%w: ca_cert: %v", ErrInvalidCertificate, err)
+		}
+		for _, cert := range certs {
+			t.Certificates = append(t.Certificates, describeCertificate(CertificateCA, cert))
+		}
+	}
+	if t.ClientCert != "" {
+		pair, err := tls.X509KeyPair([]byte(t.ClientCert), []byte(t.ClientKey))
+		if err != nil {
+			return fmt.Errorf("%w: client_cert and client_key: %v", ErrInvalidCertificate, err)
+		}
+		t.Certificates = append(t.Certificates, describeCertificate(CertificateClient, pair.Leaf))
+	}
+
+	t.ExpiresAt = nil
+	for _, c := range t.Certificates {
+		if now.After(c.NotAfter) {
+			return fmt.Errorf("%w: %s certificate %q expired on %s", ErrInvalidCertificate,
+				c.Usage, c.Subject, c.NotAfter.Format("2006-01-02"))
+		}
+		if now.Before(c.NotBefore) {
+			return fmt.Errorf("%w: %s certificate %q is not valid before %s", ErrInvalidCertificate,
+				c.Usage, c.Subject, c.NotBefore.Format("2006-01-02"))
+		}
+		if t.ExpiresAt == nil || c.NotAfter.Before(*t.ExpiresAt) {
+			notAfter := c.NotAfter
+			t.ExpiresAt = &notAfter
+		}
+	}
+	t.ExpiryWarning = certificateExpiryWarning(t.ExpiresAt, now)
+	return nil
+}
+
+// parsePEMCertificates parses every certificate of a PEM bundle
+func parsePEMCertificates(bundle string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
+}
+
+func describeCertificate(usage string, cert *x509.Certificate) models.CertificateInfo {
+	return models.CertificateInfo{
+		Usage:     usage,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+	}
+}
+
+// certificateExpiryWarning describes certificates that expired or expire
+// within certificateExpiryWindow, or returns ""
+func certificateExpiryWarning(expiresAt *time.Time, now time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+	left := expiresAt.Sub(now)
+	switch {
+	case left <= 0:
+		return fmt.Sprintf("a certificate expired on %s", expiresAt.Format("2006-01-02"))
+	case left <= 24*time.Hour:
+		return "a certificate expires within a day"
+	case left <= certificateExpiryWindow:
+		return fmt.Sprintf("a certificate expires in %d days", int(left.Hours()/24))
+	}
+	return ""
+}
+
+// loadCertificates parses the certificate material of p for tlsConfig
+func (p *ConnectionParams) loadCertificates() error {
+	if p.Certificates == nil {
+		return nil
+	}
+	if p.Certificates.CACert != "" {
+		certs, err := parsePEMCertificates(p.Certificates.CACert)
+		if err != nil {
+			return newConnectionTestError(ConnErrConfig, err, "invalid CA certificate")
+		}
+		p.rootCAs = x509.NewCertPool()
+		for _, cert := range certs {
+			p.rootCAs.AddCert(cert)
+		}
+	}
+	if p.Certificates.ClientCert != "" {
+		pair, err := tls.X509KeyPair([]byte(p.Certificates.ClientCert), []byte(p.Certificates.ClientKey))
+		if err != nil {
+			return newConnectionTestError(ConnErrConfig, err, "invalid client certificate")
+		}
+		p.clientCerts = []tls.Certificate{pair}
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS settings of the ssl_mode of p, verifying the
+// server with its CA bundle and presenting its client certificate
+func (p *ConnectionParams) tlsConfig() *tls.Config {
+	cfg := connectionTLSConfig(p.SSLMode, p.tlsHost())
+	if p.rootCAs != nil {
+		cfg.RootCAs = p.rootCAs
+		if p.SSLMode == SSLVerifyCA {
+			cfg.VerifyConnection = verifyCertificateChainWith(p.rootCAs)
+		}
+	}
+	cfg.Certificates = p.clientCerts
+	return cfg
+}
+
+// tlsRow scans the certificate columns of a connection
+type tlsRow models.ConnectionTLS
+
+// tlsColumns selects the certificate descriptions of a connection, without the material
+const tlsColumns = `tls_certificates, tls_expires_at`
+
+// tlsMaterialColumns selects the encrypted certificate material of a connection
+const tlsMaterialColumns = `COALESCE(tls_ca_cert, ''), COALESCE(tls_client_cert, ''), COALESCE(tls_client_key, '')`
+
+// orNil returns the certificates, or nil when the connection has none
+func (r *tlsRow) orNil(now time.Time) *models.ConnectionTLS {
+	if len(r.Certificates) == 0 {
+		return nil
+	}
+	t := models.ConnectionTLS(*r)
+	t.ExpiryWarning = certificateExpiryWarning(t.ExpiresAt, now)
+	return &t
+}
+
+// decryptTLS returns t with its certificate material decrypted
+func (s *ConnectionService) decryptTLS(t *models.ConnectionTLS) (*models.ConnectionTLS, error) {
+	if t == nil {
+		return nil, nil
+	}
+	for _, field := range []*string{&t.CACert, &t.ClientCert, &t.ClientKey} {
+		if *field == "" {
+			continue
+		}
+		plaintext, err := s.decryptPassword(*field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt certificates: %w", err)
+		}
+		*field = plaintext
+	}
+	return t, nil
+}
+
+// SetCertificates replaces the CA bundle and client certificate of a connection
+func (s *ConnectionService) SetCertificates(ctx context.Context, userID, connID uuid.UUID, material *models.ConnectionTLS) (*models.ConnectionTLS, error) {
+	return s.setCertificates(ctx, s.db.Pool(), userID, connID, material)
+}
+
+func (s *ConnectionService) setCertificates(ctx context.Context, q querier, userID, connID uuid.UUID, material *models.ConnectionTLS) (*models.ConnectionTLS, error) {
+	conn, err := s.getConnection(ctx, q, userID, connID)
+	if err != nil {
+		return nil, err
+	}
+	if !certificateTypes[conn.Type] {
+		return nil, ErrCertificatesNotSupported
+	}
+	if err := parseCertificateMaterial(material, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]string, 3)
+	for i, value := range []string{material.CACert, material.ClientCert, material.ClientKey} {
+		if value == "" {
+			continue
+		}
+		if encrypted[i], err = s.encryptPassword(value); err != nil {
+			return nil, fmt.Errorf("failed to encrypt certificates: %w", err)
+		}
+	}
+
+	// A new expiry is notified again
+	_, err = q.Exec(ctx, `
+		UPDATE connections SET tls_ca_cert = NULLIF($1, ''), tls_client_cert = NULLIF($2, ''), tls_client_key = NULLIF($3, ''),
+			tls_certificates = $4, tls_expires_at = $5, tls_expiry_notified_at = NULL, updated_at = $6
+		WHERE id = $7 AND user_id = $8
+	`, encrypted[0], encrypted[1], encrypted[2], material.Certificates, material.ExpiresAt, time.Now().UTC(), connID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save certificates: %w", err)
+	}
+	s.invalidateCatalog(ctx, connID)
+
+	material.CACert, material.ClientCert, material.ClientKey = "", "", ""
+	return material, nil
+}
+
+// DeleteCertificates removes the certificates of a connection
+func (s *ConnectionService) DeleteCertificates(ctx context.Context, userID, connID uuid.UUID) error {
+	tag, err := s.db.Pool().Exec(ctx, `
+		UPDATE connections SET tls_ca_cert = NULL, tls_client_cert = NULL, tls_client_key = NULL,
+			tls_certificates = NULL, tls_expires_at = NULL, tls_expiry_notified_at = NULL, updated_at = $1
+		WHERE id = $2 AND user_id = $3
+	`, time.Now().UTC(), connID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrConnectionNotFound
+	}
+	s.invalidateCatalog(ctx, connID)
+	return nil
+}
+
+// CertificateExpiryNotice is a connection whose certificates expire soon
+type CertificateExpiryNotice struct {
+	ConnectionID   uuid.UUID
+	ConnectionName string
+	ExpiresAt      time.Time
+}
+
+// NotifyExpiringCertificates emails owners of connections whose certificates
+// expire within certificateExpiryWindow, once per uploaded certificate set.
+// Connections are marked notified before sending, so replicas running at the
+// same time don't email the same owner twice.
+func (s *ConnectionService) NotifyExpiringCertificates(ctx context.Context) error {
+	if s.emailService == nil {
+		return nil
+	}
+
+	// Truncated to what the column stores, so a failed send can release its claim
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	rows, err := s.db.Pool().Query(ctx, `
+		UPDATE connections c SET tls_expiry_notified_at = $2
+		FROM users u
+		WHERE u.id = c.user_id AND c.tls_expires_at < $1 AND c.tls_expiry_notified_at IS NULL
+		RETURNING c.id, c.name, c.tls_expires_at, c.user_id, u.name, u.email
+	`, now.Add(certificateExpiryWindow), now)
+	if err != nil {
+		return err
+	}
+	type owner struct {
+		name, email string
+		notices     []CertificateExpiryNotice
+	}
+	owners := make(map[uuid.UUID]*owner)
+	for rows.Next() {
+		var n CertificateExpiryNotice
+		var userID uuid.UUID
+		var name, email string
+		if err := rows.Scan(&n.ConnectionID, &n.ConnectionName, &n.ExpiresAt, &userID, &name, &email); err != nil {
+			rows.Close()
+			return err
+		}
+		if owners[userID] == nil {
+			owners[userID] = &owner{name: name, email: email}
+		}
+		owners[userID].notices = append(owners[userID].notices, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var firstErr error
+	for userID, o := range owners {
+		sort.Slice(o.notices, func(i, j int) bool { return o.notices[i].ExpiresAt.Before(o.notices[j].ExpiresAt) })
+		if err := s.emailService.SendCertificateExpiryEmail(ctx, o.email, o.name, o.notices); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("user %s: %w", userID, err)
+			}
+			// Nobody got the notice, so the next run may send it
+			ids := make([]uuid.UUID, len(o.notices))
+			for i, n := range o.notices {
+				ids[i] = n.ConnectionID
+			}
+			if _, releaseErr := s.db.Pool().Exec(ctx, `
+				UPDATE connections SET tls_expiry_notified_at = NULL
+				WHERE id = ANY($1) AND tls_expiry_notified_at = $2
+			`, ids, now); releaseErr != nil {
+				log.Printf("Failed to release certificate expiry notices of user %s: %v", userID, releaseErr)
+			}
+		}
+	}
+	return firstErr
+}
+
+// StartCertificateExpiryCheck runs NotifyExpiringCertificates now and every
+// interval until ctx is done
+func (s *ConnectionService) StartCertificateExpiryCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.NotifyExpiringCertificates(ctx); err != nil {
+			log.Printf("Certificate expiry notices failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyPostgresTLS adds the CA bundle, client certificate and server name of
+// p to the TLS settings pgx derived from the ssl_mode
+func applyPostgresTLS(cfg *pgx.ConnConfig, p *ConnectionParams) {
+	configs := []*tls.Config{cfg.TLSConfig}
+	for _, fallback := range cfg.Fallbacks {
+		configs = append(configs, fallback.TLSConfig)
+	}
+	for _, tlsConfig := range configs {
+		if tlsConfig == nil {
+			continue
+		}
+		if p.TLSServerName != "" {
+			tlsConfig.ServerName = p.TLSServerName
+		}
+		// pgx's verify-ca check reads RootCAs when it runs
+		if p.rootCAs != nil {
+			tlsConfig.RootCAs = p.rootCAs
+		}
+		tlsConfig.Certificates = p.clientCerts
+	}
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+// testCertificate is a certificate and its key in PEM format
+type testCertificate struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+	keyPEM  string
+}
+
+// newTestCertificate issues a certificate valid between notBefore and
+// notAfter, signed by parent or self-signed when parent is nil. Certificates
+// signed by parent are also valid for cn as a host name.
+func newTestCertificate(t *testing.T, cn string, parent *testCertificate, notBefore, notAfter time.Time) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	issuer, signer := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		issuer, signer = parent.cert, parent.key
+		template.DNSNames = []string{cn}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func TestParseCertificateMaterial(t *testing.T) {
+	now := time.Now().UTC()
+	ca := newTestCertificate(t, "Example CA", nil, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	client := newTestCertificate(t, "replication_user", ca, now.Add(-time.Hour), now.AddDate(0, 0, 10))
+
+	t.Run("CA and client", func(t *testing.T) {
+		material := &models.ConnectionTLS{CACert: ca.certPEM, ClientCert: client.certPEM, ClientKey: client.keyPEM}
+		require.NoError(t, parseCertificateMaterial(material, now))
+		require.Len(t, material.Certificates, 2)
+		assert.Equal(t, CertificateCA, material.Certificates[0].Usage)
+		assert.Equal(t, "CN=Example CA", material.Certificates[0].Subject)
+		assert.Equal(t, CertificateClient, material.Certificates[1].Usage)
+		assert.Equal(t, "CN=Example CA", material.Certificates[1].Issuer)
+
+		// The earliest expiry is reported, with a warning
+		require.NotNil(t, material.ExpiresAt)
+		assert.True(t, material.ExpiresAt.Equal(client.cert.NotAfter))
+		assert.Contains(t, material.ExpiryWarning, "expires in")
+	})
+
+	t.Run("CA only", func(t *testing.T) {
+		material := &models.ConnectionTLS{CACert: ca.certPEM}
+		require.NoError(t, parseCertificateMaterial(material, now))
+		assert.Len(t, material.Certificates, 1)
+		assert.Empty(t, material.ExpiryWarning)
+	})
+
+	expired := newTestCertificate(t, "old", nil, now.AddDate(-1, 0, 0), now.Add(-time.Hour))
+	future := newTestCertificate(t, "future", nil, now.Add(time.Hour), now.AddDate(1, 0, 0))
+	other := newTestCertificate(t, "other", ca, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+
+	invalid := map[string]*models.ConnectionTLS{
+		"empty":              {},
+		"missing key":        {ClientCert: client.certPEM},
+		"mismatched pair":    {ClientCert: client.certPEM, ClientKey: other.keyPEM},
+		"not PEM":            {CACert: "not a certificate"},
+		"key as CA":          {CACert: ca.keyPEM},
+		"expired":            {CACert: expired.certPEM},
+		"not yet valid":      {CACert: future.certPEM},
+		"expired CA in pair": {CACert: expired.certPEM, ClientCert: client.certPEM, ClientKey: client.keyPEM},
+	}
+	for name, material := range invalid {
+		err := parseCertificateMaterial(material, now)
+		assert.True(t, errors.Is(err, ErrInvalidCertificate), "%s: %v", name, err)
+	}
+}
+
+func TestCertificateExpiryWarning(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	assert.Empty(t, certificateExpiryWarning(nil, now))
+	assert.Empty(t, certificateExpiryWarning(at(60*24*time.Hour), now))
+	assert.Equal(t, "a certificate expires in 12 days", certificateExpiryWarning(at(12*24*time.Hour+time.Hour), now))
+	assert.Equal(t, "a certificate expires within a day", certificateExpiryWarning(at(time.Hour), now))
+	assert.Equal(t, "a certificate expired on 2026-02-28", certificateExpiryWarning(at(-24*time.Hour), now))
+}
+
+func TestConnectionParams_TLSConfig(t *testing.T) {
+	now := time.Now().UTC()
+	ca := newTestCertificate(t, "Example CA", nil, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	client := newTestCertificate(t, "replication_user", ca, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+
+	p := &ConnectionParams{
+		Type:    "postgres",
+		Host:    "db.example.com",
+		SSLMode: SSLVerifyCA,
+		Certificates: &models.ConnectionTLS{
+			CACert:     ca.certPEM,
+			ClientCert: client.certPEM,
+			ClientKey:  client.keyPEM,
+		},
+	}
+	require.NoError(t, p.loadCertificates())
+
+	cfg := p.tlsConfig()
+	assert.NotNil(t, cfg.RootCAs)
+	assert.NotNil(t, cfg.VerifyConnection)
+	require.Len(t, cfg.Certificates, 1)
+
+	// verify-ca accepts a chain to the uploaded CA whatever the host name
+	server := newTestCertificate(t, "other-host", ca, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	assert.NoError(t, cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{server.cert}}))
+	stranger := newTestCertificate(t, "stranger", nil, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	assert.Error(t, cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{stranger.cert}}))
+
+	// Broken material is a configuration error
+	p.Certificates.ClientKey = ca.keyPEM
+	err := p.loadCertificates()
+	assert.Equal(t, ConnErrConfig, ConnectionTestCategory(err))
+}
+
+func TestVerifyFullThroughTunnel(t *testing.T) {
+	now := time.Now().UTC()
+	ca := newTestCertificate(t, "Example CA", nil, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	server := newTestCertificate(t, "db.example.com", ca, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+
+	// The tunnel rewrites Host to its local end; certificates name the database
+	p := &ConnectionParams{
+		Host:          "127.0.0.1",
+		Port:          14330,
+		Username:      "sa",
+		Password:      "secret",
+		Database:      "orders",
+		SSLMode:       SSLVerifyFull,
+		TLSServerName: "db.example.com",
+	}
+
+	t.Run("sqlserver", func(t *testing.T) {
+		cfg, err := sqlServerConfig(p)
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", cfg.Host)
+		assert.True(t, cfg.HostInCertificateProvided)
+		require.NotNil(t, cfg.TLSConfig)
+		assert.Equal(t, "db.example.com", cfg.TLSConfig.ServerName)
+		assert.False(t, cfg.TLSConfig.InsecureSkipVerify)
+	})
+
+	t.Run("oracle", func(t *testing.T) {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		base := connectionTLSConfig(p.SSLMode, p.tlsHost())
+		base.RootCAs = roots
+
+		handshake := func(cfg *tls.Config) error {
+			// go-ora sets ServerName to the host it dials
+			cfg.ServerName = p.Host
+			keyPair, err := tls.X509KeyPair([]byte(server.certPEM), []byte(server.keyPEM))
+			require.NoError(t, err)
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{keyPair}}).Handshake()
+			}()
+
+			conn, err := net.DialTimeout("tcp", listener.Addr().String(), time.Second)
+			require.NoError(t, err)
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			return tls.Client(conn, cfg).Handshake()
+		}
+
+		assert.NoError(t, handshake(oracleTLSConfig(base, p.tlsHost())))
+		assert.Error(t, handshake(oracleTLSConfig(base, "other.example.com")))
+		assert.Equal(t, "db.example.com", base.ServerName, "the shared settings are left alone")
+		// Without the adaptation the dialed host fails verification
+		assert.Error(t, handshake(base.Clone()))
+	})
+}
+
+func TestTLSRow_OrNil(t *testing.T) {
+	now := time.Now().UTC()
+	var empty tlsRow
+	assert.Nil(t, empty.orNil(now))
+
+	expiresAt := now.Add(5 * 24 * time.Hour)
+	row := tlsRow{
+		Certificates: []models.CertificateInfo{{Usage: CertificateCA, NotAfter: expiresAt}},
+		ExpiresAt:    &expiresAt,
+	}
+	certs := row.orNil(now)
+	require.NotNil(t, certs)
+	assert.Contains(t, certs.ExpiryWarning, "expires in")
+}
@@ -0,0 +1,656 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var (
+	ErrContractNotFound       = errors.New("contract not found")
+	ErrInvalidContract        = errors.New("invalid contract")
+	ErrContractClosed         = errors.New("contract has ended")
+	ErrContractNotStarted     = errors.New("contract has not started yet")
+	ErrLicenseNotOwned        = errors.New("license belongs to a different user")
+	ErrLicenseAlreadyAttached = errors.New("license is already attached to a contract")
+	ErrLicenseNotAttached     = errors.New("license is not attached to this contract")
+)
+
+// Contract statuses
+const (
+	ContractPending    = "pending"
+	ContractActive     = "active"
+	ContractExpired    = "expired"
+	ContractTerminated = "terminated"
+)
+
+// contractReminderDays are the days before a contract ends when renewal reminders go out
+var contractReminderDays = []int{90, 30, 7}
+
+// ContractService manages enterprise contracts and keeps their licenses in line
+// with the contract dates and committed limits.
+type ContractService struct {
+	db             *repository.PostgresDB
+	licenseService *LicenseService
+	emailService   *EmailService
+	salesEmail     string
+}
+
+// NewContractService creates a new contract service.
+// salesEmail receives a copy of every renewal reminder; it may be empty.
+func NewContractService(db *repository.PostgresDB, licenseService *LicenseService, emailService *EmailService, salesEmail string) *ContractService {
+	return &ContractService{
+		db:             db,
+		licenseService: licenseService,
+		emailService:   emailService,
+		salesEmail:     salesEmail,
+	}
+}
+
+// ContractUpdate holds the contract fields an admin may change; nil fields are kept
+type ContractUpdate struct {
+	Name          *string    `json:"name"`
+	PONumber      *string    `json:"po_number"`
+	Tier          *string    `json:"tier"`
+	StartDate     *time.Time `json:"start_date"`
+	EndDate       *time.Time `json:"end_date"`
+	MaxSources    *int       `json:"max_sources"`
+	MaxTables     *int       `json:"max_tables"`
+	MaxThroughput *int64     `json:"max_throughput"`
+	ContractValue *int64     `json:"contract_value"`
+	Currency      *string    `json:"currency"`
+	AutoRenew     *bool      `json:"auto_renew"`
+	Notes         *string    `json:"notes"`
+}
+
+// ValidateContract normalizes a contract and checks its terms
+func ValidateContract(c *models.Contract) error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.PONumber = strings.TrimSpace(c.PONumber)
+	c.Currency = strings.ToLower(strings.TrimSpace(c.Currency))
+	if c.Tier == "" {
+		c.Tier = "enterprise"
+	}
+	if c.Currency == "" {
+		c.Currency = "usd"
+	}
+
+	if c.UserID == uuid.Nil {
+		return fmt.Errorf("%w: user_id is required", ErrInvalidContract)
+	}
+	if c.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidContract)
+	}
+	if c.Tier != "pro" && c.Tier != "enterprise" {
+		return fmt.Errorf("%w: tier must be pro or enterprise", ErrInvalidContract)
+	}
+	if c.StartDate.IsZero() || c.EndDate.IsZero() {
+		return fmt.Errorf("%w: start_date and end_date are required", ErrInvalidContract)
+	}
+	if !c.EndDate.After(c.StartDate) {
+		return fmt.Errorf("%w: end_date must be after start_date", ErrInvalidContract)
+	}
+	if c.MaxSources < 0 || c.MaxTables < 0 || c.MaxThroughput < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidContract)
+	}
+	if c.ContractValue < 0 {
+		return fmt.Errorf("%w: contract_value must not be negative", ErrInvalidContract)
+	}
+	if len(c.Currency) != 3 {
+		return fmt.Errorf("%w: currency must be a three-letter code", ErrInvalidContract)
+	}
+	return nil
+}
+
+// contractStatusAt returns the status a contract should have at the given time
+func contractStatusAt(c *models.Contract, now time.Time) string {
+	switch {
+	case c.Status == ContractTerminated:
+		return ContractTerminated
+	case now.Before(c.StartDate):
+		return ContractPending
+	case !now.Before(c.EndDate):
+		return ContractExpired
+	default:
+		return ContractActive
+	}
+}
+
+// renewedEndDate extends an auto-renewing contract by whole years until it ends after now
+func renewedEndDate(end, now time.Time) time.Time {
+	for !end.After(now) {
+		end = end.AddDate(1, 0, 0)
+	}
+	return end
+}
+
+// dueReminder picks the renewal reminder to send for a contract ending in daysLeft
+// days. Only one email goes out even if several thresholds were missed (e.g. a
+// contract created 20 days before its end); all of them are returned for recording.
+func dueReminder(daysLeft int, sent map[int]bool) (int, []int) {
+	threshold := 0
+	var record []int
+	for _, days := range contractReminderDays {
+		if daysLeft > days || sent[days] {
+			continue
+		}
+		record = append(record, days)
+		if threshold == 0 || days < threshold {
+			threshold = days
+		}
+	}
+	return threshold, record
+}
+
+// contractTerms returns the license terms granted by a contract
+func contractTerms(c *models.Contract) LicenseTerms {
+	return LicenseTerms{
+		Tier:          c.Tier,
+		ExpiresAt:     c.EndDate,
+		MaxSources:    c.MaxSources,
+		MaxTables:     c.MaxTables,
+		MaxThroughput: c.MaxThroughput,
+		Metadata: map[string]string{
+			"contract_id": c.ID.String(),
+			"po_number":   c.PONumber,
+		},
+	}
+}
+
+const contractColumns = `id, user_id, name, po_number, tier, status, start_date, end_date, max_sources, max_tables,
+	max_throughput, contract_value, currency, auto_renew, notes, created_by, created_at, updated_at`
+
+func scanContract(row pgx.Row) (*models.Contract, error) {
+	var c models.Contract
+	err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.PONumber, &c.Tier, &c.Status, &c.StartDate, &c.EndDate,
+		&c.MaxSources, &c.MaxTables, &c.MaxThroughput, &c.ContractValue, &c.Currency, &c.AutoRenew,
+		&c.Notes, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CreateContract stores a new contract
+func (s *ContractService) CreateContract(ctx context.Context, c *models.Contract) (*models.Contract, error) {
+	if err := ValidateContract(c); err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := s.db.Pool().QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`, c.UserID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	c.ID = uuid.New()
+	c.Status = contractStatusAt(c, time.Now().UTC())
+	c.LicenseIDs = []uuid.UUID{}
+
+	err := s.db.Pool().QueryRow(ctx, `
+		INSERT INTO contracts (id, user_id, name, po_number, tier, status, start_date, end_date, max_sources, max_tables,
+			max_throughput, contract_value, currency, auto_renew, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING created_at, updated_at
+	`, c.ID, c.UserID, c.Name, c.PONumber, c.Tier, c.Status, c.StartDate, c.EndDate, c.MaxSources, c.MaxTables,
+		c.MaxThroughput, c.ContractValue, c.Currency, c.AutoRenew, c.Notes, c.CreatedBy).Scan(&c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create contract: %w", err)
+	}
+
+	return c, nil
+}
+
+// GetContract returns a contract with its attached licenses
+func (s *ContractService) GetContract(ctx context.Context, id uuid.UUID) (*models.Contract, error) {
+	c, err := scanContract(s.db.Pool().QueryRow(ctx, `SELECT `+contractColumns+` FROM contracts WHERE id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrContractNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.LicenseIDs, err = s.contractLicenseIDs(ctx, c.ID); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListContracts returns contracts, optionally filtered by user and status
+func (s *ContractService) ListContracts(ctx context.Context, userID *uuid.UUID, status string) ([]*models.Contract, error) {
+	query := `SELECT ` + contractColumns + ` FROM contracts WHERE 1=1`
+	args := []interface{}{}
+	if userID != nil {
+		args = append(args, *userID)
+		query += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	query += " ORDER BY end_date ASC"
+
+	rows, err := s.db.Pool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contracts := make([]*models.Contract, 0)
+	for rows.Next() {
+		c, err := scanContract(rows)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range contracts {
+		if c.LicenseIDs, err = s.contractLicenseIDs(ctx, c.ID); err != nil {
+			return nil, err
+		}
+	}
+	return contracts, nil
+}
+
+func (s *ContractService) contractLicenseIDs(ctx context.Context, contractID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT license_id FROM contract_licenses WHERE contract_id = $1 ORDER BY created_at
+	`, contractID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateContract changes the terms of a contract and reissues its licenses
+func (s *ContractService) UpdateContract(ctx context.Context, id uuid.UUID, update ContractUpdate) (*models.Contract, error) {
+	c, err := s.GetContract(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == ContractTerminated {
+		return nil, ErrContractClosed
+	}
+
+	if update.Name != nil {
+		c.Name = *update.Name
+	}
+	if update.PONumber != nil {
+		c.PONumber = *update.PONumber
+	}
+	if update.Tier != nil {
+		c.Tier = *update.Tier
+	}
+	if update.StartDate != nil {
+		c.StartDate = *update.StartDate
+	}
+	if update.EndDate != nil {
+		c.EndDate = *update.EndDate
+	}
+	if update.MaxSources != nil {
+		c.MaxSources = *update.MaxSources
+	}
+	if update.MaxTables != nil {
+		c.MaxTables = *update.MaxTables
+	}
+	if update.MaxThroughput != nil {
+		c.MaxThroughput = *update.MaxThroughput
+	}
+	if update.ContractValue != nil {
+		c.ContractValue = *update.ContractValue
+	}
+	if update.Currency != nil {
+		c.Currency = *update.Currency
+	}
+	if update.AutoRenew != nil {
+		c.AutoRenew = *update.AutoRenew
+	}
+	if update.Notes != nil {
+		c.Notes = *update.Notes
+	}
+	if err := ValidateContract(c); err != nil {
+		return nil, err
+	}
+	c.Status = contractStatusAt(c, time.Now().UTC())
+
+	if err := s.saveContract(ctx, c); err != nil {
+		return nil, err
+	}
+	if err := s.syncLicenses(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *ContractService) saveContract(ctx context.Context, c *models.Contract) error {
+	return s.db.Pool().QueryRow(ctx, `
+		UPDATE contracts
+		SET name = $1, po_number = $2, tier = $3, status = $4, start_date = $5, end_date = $6, max_sources = $7,
+			max_tables = $8, max_throughput = $9, contract_value = $10, currency = $11, auto_renew = $12, notes = $13
+		WHERE id = $14
+		RETURNING updated_at
+	`, c.Name, c.PONumber, c.Tier, c.Status, c.StartDate, c.EndDate, c.MaxSources, c.MaxTables, c.MaxThroughput,
+		c.ContractValue, c.Currency, c.AutoRenew, c.Notes, c.ID).Scan(&c.UpdatedAt)
+}
+
+// TerminateContract ends a contract early and expires its licenses
+func (s *ContractService) TerminateContract(ctx context.Context, id uuid.UUID) (*models.Contract, error) {
+	c, err := s.GetContract(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == ContractTerminated {
+		return c, nil
+	}
+
+	now := time.Now().UTC()
+	c.Status = ContractTerminated
+	if c.EndDate.After(now) {
+		c.EndDate = now
+	}
+	if err := s.saveContract(ctx, c); err != nil {
+		return nil, err
+	}
+	if err := s.syncLicenses(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AttachLicense puts an existing license of the contract owner under the contract's terms
+func (s *ContractService) AttachLicense(ctx context.Context, contractID, licenseID uuid.UUID) (*models.Contract, error) {
+	c, err := s.GetContract(ctx, contractID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == ContractExpired || c.Status == ContractTerminated {
+		return nil, ErrContractClosed
+	}
+
+	var ownerID uuid.UUID
+	err = s.db.Pool().QueryRow(ctx, `SELECT user_id FROM licenses WHERE id = $1`, licenseID).Scan(&ownerID)
+	if err == pgx.ErrNoRows {
+		return nil, ErrLicenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != c.UserID {
+		return nil, ErrLicenseNotOwned
+	}
+
+	result, err := s.db.Pool().Exec(ctx, `
+		INSERT INTO contract_licenses (contract_id, license_id) VALUES ($1, $2)
+		ON CONFLICT (license_id) DO NOTHING
+	`, c.ID, licenseID)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected() == 0 {
+		var attachedTo uuid.UUID
+		_ = s.db.Pool().QueryRow(ctx, `SELECT contract_id FROM contract_licenses WHERE license_id = $1`, licenseID).Scan(&attachedTo)
+		if attachedTo != c.ID {
+			return nil, ErrLicenseAlreadyAttached
+		}
+	}
+
+	if c.Status == ContractActive {
+		if _, err := s.licenseService.ApplyLicenseTerms(ctx, licenseID, contractTerms(c)); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetContract(ctx, c.ID)
+}
+
+// IssueLicense creates a new license for the contract owner and attaches it
+func (s *ContractService) IssueLicense(ctx context.Context, contractID uuid.UUID, hardwareID string) (*models.License, error) {
+	c, err := s.GetContract(ctx, contractID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == ContractExpired || c.Status == ContractTerminated {
+		return nil, ErrContractClosed
+	}
+	// Licenses of pending contracts would be usable before the contract starts
+	if c.Status == ContractPending || time.Now().Before(c.StartDate) {
+		return nil, ErrContractNotStarted
+	}
+
+	// A license is only issued linked to the contract and under its terms
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	validDays := int(math.Ceil(time.Until(c.EndDate).Hours() / 24))
+	lic, err := s.licenseService.createLicense(ctx, tx, c.UserID, c.Tier, validDays, hardwareID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO contract_licenses (contract_id, license_id) VALUES ($1, $2)
+	`, c.ID, lic.ID)
+	if err != nil {
+		return nil, err
+	}
+	lic, err = s.licenseService.applyLicenseTerms(ctx, tx, lic.ID, contractTerms(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return lic, nil
+}
+
+// DetachLicense removes a license from a contract; the license keeps its current terms
+func (s *ContractService) DetachLicense(ctx context.Context, contractID, licenseID uuid.UUID) error {
+	result, err := s.db.Pool().Exec(ctx, `
+		DELETE FROM contract_licenses WHERE contract_id = $1 AND license_id = $2
+	`, contractID, licenseID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLicenseNotAttached
+	}
+	return nil
+}
+
+// syncLicenses reissues the contract's licenses while it is active and expires
+// them once it has ended. Pending contracts leave their licenses untouched.
+func (s *ContractService) syncLicenses(ctx context.Context, c *models.Contract) error {
+	var firstErr error
+	for _, licenseID := range c.LicenseIDs {
+		var err error
+		switch c.Status {
+		case ContractActive:
+			_, err = s.licenseService.ApplyLicenseTerms(ctx, licenseID, contractTerms(c))
+			if errors.Is(err, ErrLicenseRevoked) {
+				err = nil
+			}
+		case ContractExpired, ContractTerminated:
+			err = s.licenseService.ExpireLicense(ctx, licenseID)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to update license %s: %w", licenseID, err)
+		}
+	}
+	return firstErr
+}
+
+// ProcessContracts activates contracts that have started, renews or expires
+// contracts that have ended and sends renewal reminders.
+func (s *ContractService) ProcessContracts(ctx context.Context) error {
+	contracts, err := s.ListContracts(ctx, nil, "")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var firstErr error
+	for _, c := range contracts {
+		if c.Status != ContractPending && c.Status != ContractActive {
+			continue
+		}
+		if err := s.processContract(ctx, c, now); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("contract %s: %w", c.ID, err)
+		}
+	}
+	return firstErr
+}
+
+func (s *ContractService) processContract(ctx context.Context, c *models.Contract, now time.Time) error {
+	changed := false
+	if c.AutoRenew && !now.Before(c.EndDate) {
+		c.EndDate = renewedEndDate(c.EndDate, now)
+		changed = true
+	}
+	if status := contractStatusAt(c, now); status != c.Status {
+		c.Status = status
+		changed = true
+	}
+
+	if changed {
+		if err := s.saveContract(ctx, c); err != nil {
+			return err
+		}
+		if err := s.syncLicenses(ctx, c); err != nil {
+			return err
+		}
+	}
+
+	if c.Status != ContractActive {
+		return nil
+	}
+	return s.sendRenewalReminder(ctx, c, now)
+}
+
+func (s *ContractService) sendRenewalReminder(ctx context.Context, c *models.Contract, now time.Time) error {
+	daysLeft := int(math.Ceil(c.EndDate.Sub(now).Hours() / 24))
+	if daysLeft > contractReminderDays[0] {
+		return nil
+	}
+
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT days_before FROM contract_reminders WHERE contract_id = $1 AND end_date = $2
+	`, c.ID, c.EndDate)
+	if err != nil {
+		return err
+	}
+	sent := make(map[int]bool)
+	for rows.Next() {
+		var days int
+		if err := rows.Scan(&days); err != nil {
+			rows.Close()
+			return err
+		}
+		sent[days] = true
+	}
+	rows.Close()
+
+	threshold, record := dueReminder(daysLeft, sent)
+	if threshold == 0 {
+		return nil
+	}
+
+	var name, email string
+	if err := s.db.Pool().QueryRow(ctx, `SELECT name, email FROM users WHERE id = $1`, c.UserID).Scan(&name, &email); err != nil {
+		return fmt.Errorf("failed to load contract owner: %w", err)
+	}
+
+	// Claim the reminder before sending, so neither another replica nor a
+	// retry after a failed sales copy emails the owner again
+	claimed, err := s.claimReminders(ctx, c, record)
+	if err != nil {
+		return err
+	}
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	info := ContractReminderInfo{
+		CustomerName: name,
+		ContractName: c.Name,
+		PONumber:     c.PONumber,
+		EndDate:      c.EndDate,
+		DaysLeft:     daysLeft,
+		AutoRenew:    c.AutoRenew,
+	}
+	if err := s.emailService.SendContractRenewalReminder(ctx, email, info); err != nil {
+		// Nobody got the reminder, so the next run may send it
+		if _, releaseErr := s.db.Pool().Exec(ctx, `
+			DELETE FROM contract_reminders WHERE contract_id = $1 AND end_date = $2 AND days_before = ANY($3)
+		`, c.ID, c.EndDate, claimed); releaseErr != nil {
+			log.Printf("Failed to release renewal reminder of contract %s: %v", c.ID, releaseErr)
+		}
+		return fmt.Errorf("failed to send renewal reminder: %w", err)
+	}
+	if s.salesEmail != "" && !strings.EqualFold(s.salesEmail, email) {
+		if err := s.emailService.SendContractRenewalReminder(ctx, s.salesEmail, info); err != nil {
+			return fmt.Errorf("failed to send renewal reminder to sales: %w", err)
+		}
+	}
+	return nil
+}
+
+// claimReminders records the reminders of the contract's current term as
+// sent and returns those no one had recorded yet
+func (s *ContractService) claimReminders(ctx context.Context, c *models.Contract, days []int) ([]int, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		INSERT INTO contract_reminders (contract_id, end_date, days_before)
+		SELECT $1, $2, unnest($3::int[])
+		ON CONFLICT DO NOTHING
+		RETURNING days_before
+	`, c.ID, c.EndDate, days)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// Start runs ProcessContracts every interval until ctx is canceled
+func (s *ContractService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ProcessContracts(ctx); err != nil {
+			log.Printf("Contract processing failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
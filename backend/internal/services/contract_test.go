@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestValidateContract(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+
+	t.Run("applies defaults", func(t *testing.T) {
+		c := &models.Contract{UserID: uuid.New(), Name: " Acme 2025 ", StartDate: start, EndDate: end, Currency: "EUR"}
+		assert.NoError(t, ValidateContract(c))
+		assert.Equal(t, "Acme 2025", c.Name)
+		assert.Equal(t, "enterprise", c.Tier)
+		assert.Equal(t, "eur", c.Currency)
+	})
+
+	tests := []struct {
+		name     string
+		contract models.Contract
+	}{
+		{"missing user", models.Contract{Name: "Acme", StartDate: start, EndDate: end}},
+		{"missing name", models.Contract{UserID: uuid.New(), StartDate: start, EndDate: end}},
+		{"community tier", models.Contract{UserID: uuid.New(), Name: "Acme", Tier: "community", StartDate: start, EndDate: end}},
+		{"end before start", models.Contract{UserID: uuid.New(), Name: "Acme", StartDate: end, EndDate: start}},
+		{"missing dates", models.Contract{UserID: uuid.New(), Name: "Acme"}},
+		{"negative limit", models.Contract{UserID: uuid.New(), Name: "Acme", StartDate: start, EndDate: end, MaxSources: -1}},
+		{"bad currency", models.Contract{UserID: uuid.New(), Name: "Acme", StartDate: start, EndDate: end, Currency: "euro"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateContract(&tt.contract)
+			assert.True(t, errors.Is(err, ErrInvalidContract))
+		})
+	}
+}
+
+func TestContractStatusAt(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	c := &models.Contract{StartDate: start, EndDate: end}
+
+	assert.Equal(t, ContractPending, contractStatusAt(c, start.Add(-time.Hour)))
+	assert.Equal(t, ContractActive, contractStatusAt(c, start))
+	assert.Equal(t, ContractActive, contractStatusAt(c, end.Add(-time.Second)))
+	assert.Equal(t, ContractExpired, contractStatusAt(c, end))
+
+	c.Status = ContractTerminated
+	assert.Equal(t, ContractTerminated, contractStatusAt(c, start.AddDate(0, 6, 0)))
+}
+
+func TestRenewedEndDate(t *testing.T) {
+	end := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, end.AddDate(1, 0, 0), renewedEndDate(end, end))
+	// A job that was down for more than a year still lands in the future
+	assert.Equal(t, end.AddDate(2, 0, 0), renewedEndDate(end, end.AddDate(1, 0, 1)))
+}
+
+func TestDueReminder(t *testing.T) {
+	tests := []struct {
+		name              string
+		daysLeft          int
+		sent              map[int]bool
+		expectedThreshold int
+		expectedRecord    []int
+	}{
+		{"too early", 120, nil, 0, nil},
+		{"90 days", 90, nil, 90, []int{90}},
+		{"90 already sent", 60, map[int]bool{90: true}, 0, nil},
+		{"30 days", 29, map[int]bool{90: true}, 30, []int{30}},
+		{"created late sends one reminder", 20, nil, 30, []int{90, 30}},
+		{"7 days", 5, map[int]bool{90: true, 30: true}, 7, []int{7}},
+		{"all sent", 1, map[int]bool{90: true, 30: true, 7: true}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threshold, record := dueReminder(tt.daysLeft, tt.sent)
+			assert.Equal(t, tt.expectedThreshold, threshold)
+			assert.Equal(t, tt.expectedRecord, record)
+		})
+	}
+}
+
+func TestContractTerms(t *testing.T) {
+	c := &models.Contract{
+		ID:         uuid.New(),
+		Tier:       "enterprise",
+		PONumber:   "PO-1234",
+		EndDate:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		MaxSources: 25,
+	}
+
+	terms := contractTerms(c)
+	assert.Equal(t, "enterprise", terms.Tier)
+	assert.Equal(t, c.EndDate, terms.ExpiresAt)
+	assert.Equal(t, 25, terms.MaxSources)
+	assert.Equal(t, c.ID.String(), terms.Metadata["contract_id"])
+	assert.Equal(t, "PO-1234", terms.Metadata["po_number"])
+}
@@ -8,7 +8,11 @@ import (
 	"html/template"
 	"net/http"
 	"net/smtp"
+	"strings"
 	"time"
+
+	"github.com/savegress/platform/backend/internal/metrics"
+	"github.com/savegress/platform/backend/internal/models"
 )
 
 // EmailService handles sending emails
@@ -24,6 +28,22 @@ type EmailProvider interface {
 	Send(ctx context.Context, to, subject, htmlBody, textBody string) error
 }
 
+// instrumentedProvider records the result of every send in the email metrics
+type instrumentedProvider struct {
+	EmailProvider
+	name string
+}
+
+func (p *instrumentedProvider) Send(ctx context.Context, to, subject, htmlBody, textBody string) error {
+	err := p.EmailProvider.Send(ctx, to, subject, htmlBody, textBody)
+	result := metrics.EmailSent
+	if err != nil {
+		result = metrics.EmailFailed
+	}
+	metrics.EmailsSent.WithLabelValues(p.name, result).Inc()
+	return err
+}
+
 // EmailConfig holds email service configuration
 type EmailConfig struct {
 	Provider    string // "smtp", "resend", "sendgrid"
@@ -75,8 +95,13 @@ func NewEmailService(cfg EmailConfig) (*EmailService, error) {
 		provider = &NoOpProvider{}
 	}
 
+	providerName := cfg.Provider
+	if providerName == "" {
+		providerName = "noop"
+	}
+
 	return &EmailService{
-		provider:    provider,
+		provider:    &instrumentedProvider{EmailProvider: provider, name: providerName},
 		fromAddress: cfg.FromAddress,
 		fromName:    cfg.FromName,
 		baseURL:     cfg.BaseURL,
@@ -527,6 +552,524 @@ Savegress CDC Platform
 	return s.provider.Send(ctx, to, subject, htmlBody, textBody)
 }
 
+// ContractReminderInfo contains the details of a contract renewal reminder
+type ContractReminderInfo struct {
+	CustomerName string
+	ContractName string
+	PONumber     string
+	EndDate      time.Time
+	DaysLeft     int
+	AutoRenew    bool
+}
+
+// SendContractRenewalReminder notifies that a contract is about to end
+func (s *EmailService) SendContractRenewalReminder(ctx context.Context, to string, info ContractReminderInfo) error {
+	subject := fmt.Sprintf("Your Savegress Contract Ends in %d Days", info.DaysLeft)
+
+	renewal := "Please reach out to your account manager to renew it. Licenses issued under this contract stop working when it ends."
+	if info.AutoRenew {
+		renewal = "This contract renews automatically for another year. Contact your account manager if you'd like to change its terms."
+	}
+
+	poNumber := info.PONumber
+	if poNumber == "" {
+		poNumber = "-"
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #0066cc; margin: 0;">Savegress</h1>
+        </div>
+
+        <h2>Contract Renewal</h2>
+
+        <p>Hi %s,</p>
+
+        <p>Your contract <strong>%s</strong> ends on <strong>%s</strong> (in %d days).</p>
+
+        <table style="width: 100%%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px 0; color: #666;">PO number</td>
+                <td style="padding: 8px 0; text-align: right;">%s</td>
+            </tr>
+        </table>
+
+        <p>%s</p>
+
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s/licenses" style="background-color: #0066cc; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block; font-weight: 500;">View Licenses</a>
+        </div>
+
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+
+        <p style="color: #999; font-size: 12px; text-align: center;">
+            © Savegress CDC Platform
+        </p>
+    </div>
+</body>
+</html>
+`, template.HTMLEscapeString(info.CustomerName), template.HTMLEscapeString(info.ContractName),
+		info.EndDate.Format("January 2, 2006"), info.DaysLeft, template.HTMLEscapeString(poNumber), renewal, s.baseURL)
+
+	textBody := fmt.Sprintf(`Contract Renewal
+
+Hi %s,
+
+Your contract "%s" ends on %s (in %d days).
+
+PO number: %s
+
+%s
+
+View your licenses: %s/licenses
+
+---
+Savegress CDC Platform
+`, info.CustomerName, info.ContractName, info.EndDate.Format("January 2, 2006"), info.DaysLeft, poNumber, renewal, s.baseURL)
+
+	return s.provider.Send(ctx, to, subject, htmlBody, textBody)
+}
+
+// SendUsageStatementEmail sends a monthly usage statement summary
+func (s *EmailService) SendUsageStatementEmail(ctx context.Context, to, name string, stmt *UsageStatement) error {
+	month := stmt.PeriodStart.Format("January 2006")
+	subject := fmt.Sprintf("Your Savegress Usage Statement for %s", month)
+	billingURL := s.baseURL + "/billing"
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #0066cc; margin: 0;">Savegress</h1>
+        </div>
+
+        <h2>Usage Statement: %s</h2>
+
+        <p>Hi %s,</p>
+
+        <p>Here is a summary of your Savegress usage for %s.</p>
+
+        <table style="width: 100%%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px 0; color: #666;">Events processed</td>
+                <td style="padding: 8px 0; text-align: right;">%d</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px 0; color: #666;">Data processed</td>
+                <td style="padding: 8px 0; text-align: right;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px 0; color: #666;">Licenses / instances / pipelines</td>
+                <td style="padding: 8px 0; text-align: right;">%d / %d / %d</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px 0; color: #666;">Errors</td>
+                <td style="padding: 8px 0; text-align: right;">%d</td>
+            </tr>
+        </table>
+
+        <p>The full statement, broken down by license, instance, pipeline and source type, can be downloaded as CSV or JSON from your billing page.</p>
+
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #0066cc; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block; font-weight: 500;">Open Billing</a>
+        </div>
+
+        <p style="color: #666; font-size: 14px;">You can turn these emails off in your billing settings.</p>
+
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+
+        <p style="color: #999; font-size: 12px; text-align: center;">
+            © Savegress CDC Platform
+        </p>
+    </div>
+</body>
+</html>
+`, month, template.HTMLEscapeString(name), month, stmt.Totals.EventsProcessed, formatBytes(stmt.Totals.BytesProcessed),
+		stmt.Totals.Licenses, stmt.Totals.Instances, stmt.Totals.Pipelines, stmt.Totals.ErrorCount, billingURL)
+
+	textBody := fmt.Sprintf(`Usage Statement: %s
+
+Hi %s,
+
+Here is a summary of your Savegress usage for %s.
+
+Events processed: %d
+Data processed: %s
+Licenses / instances / pipelines: %d / %d / %d
+Errors: %d
+
+Download the full statement (CSV or JSON) from your billing page: %s
+
+You can turn these emails off in your billing settings.
+
+---
+Savegress CDC Platform
+`, month, name, month, stmt.Totals.EventsProcessed, formatBytes(stmt.Totals.BytesProcessed),
+		stmt.Totals.Licenses, stmt.Totals.Instances, stmt.Totals.Pipelines, stmt.Totals.ErrorCount, billingURL)
+
+	return s.provider.Send(ctx, to, subject, htmlBody, textBody)
+}
+
+// SendAlertEmail notifies that an alert started firing or was resolved
+func (s *EmailService) SendAlertEmail(ctx context.Context, to string, n *AlertNotification) error {
+	summary := alertSummary(n)
+	subject := "Savegress alert: " + summary
+	alertsURL := s.baseURL + "/alerts"
+
+	headline := "Alert Firing"
+	color := "#cc3300"
+	if n.Status == AlertResolved {
+		headline = "Alert Resolved"
+		color = "#2e7d32"
+	}
+	if n.Test {
+		headline = "Test Alert"
+		color = "#0066cc"
+	}
+
+	subjectName := n.Alert.SubjectName
+	if subjectName == "" {
+		subjectName = n.Alert.Subject
+	}
+	condition := fmt.Sprintf("%s %s %s", n.Rule.Metric, alertOperators[n.Rule.Operator], formatAlertValue(n.Rule.Threshold))
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #0066cc; margin: 0;">Savegress</h1>
+        </div>
+
+        <h2 style="color: %s;">%s: %s</h2>
+
+        <table style="width: 100%%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px 0; color: #666;">%s</td>
+                <td style="padding: 8px 0; text-align: right;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px 0; color: #666;">Condition</td>
+                <td style="padding: 8px 0; text-align: right;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px 0; color: #666;">Current value</td>
+                <td style="padding: 8px 0; text-align: right;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px 0; color: #666;">Since</td>
+                <td style="padding: 8px 0; text-align: right;">%s</td>
+            </tr>
+        </table>
+
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #0066cc; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block; font-weight: 500;">View Alerts</a>
+        </div>
+
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+
+        <p style="color: #999; font-size: 12px; text-align: center;">
+            © Savegress CDC Platform
+        </p>
+    </div>
+</body>
+</html>
+`, color, headline, template.HTMLEscapeString(n.Rule.Name), alertScopeLabel(n.Rule.Scope), template.HTMLEscapeString(subjectName),
+		template.HTMLEscapeString(condition), formatAlertValue(n.Alert.Value), n.Alert.StartedAt.Format(time.RFC1123), alertsURL)
+
+	textBody := fmt.Sprintf(`%s: %s
+
+%s: %s
+Condition: %s
+Current value: %s
+Since: %s
+
+View alerts: %s
+
+---
+Savegress CDC Platform
+`, headline, n.Rule.Name, alertScopeLabel(n.Rule.Scope), subjectName, condition, formatAlertValue(n.Alert.Value),
+		n.Alert.StartedAt.Format(time.RFC1123), alertsURL)
+
+	return s.provider.Send(ctx, to, subject, htmlBody, textBody)
+}
+
+// fleetStatusLabels describe fleet version statuses in upgrade notices
+var fleetStatusLabels = map[string]string{
+	VersionOutdated:   "Outdated",
+	VersionDeprecated: "Deprecated",
+	VersionVulnerable: "Security advisory",
+}
+
+// SendFleetUpgradeEmail tells an account owner that instances run versions that need upgrading
+func (s *EmailService) SendFleetUpgradeEmail(ctx context.Context, to, name string, notice *FleetUpgradeNotice) error {
+	subject := "Savegress engine upgrade recommended"
+	for _, v := range notice.Versions {
+		if v.Status == VersionVulnerable {
+			subject = "Security advisory: upgrade your Savegress engines"
+			break
+		}
+	}
+	fleetURL := s.baseURL + "/fleet"
+
+	latest := "Upgrade to the latest release to stay supported."
+	if notice.LatestVersion != "" {
+		latest = fmt.Sprintf("The latest release is %s.", notice.LatestVersion)
+	}
+
+	var rowsHTML, rowsText strings.Builder
+	for _, v := range notice.Versions {
+		instances := fmt.Sprintf("%d instance", v.InstanceCount)
+		if v.InstanceCount != 1 {
+			instances += "s"
+		}
+		fmt.Fprintf(&rowsHTML, `
+            <tr>
+                <td style="padding: 8px 0; border-top: 1px solid #eee;">%s</td>
+                <td style="padding: 8px 0; border-top: 1px solid #eee;">%s</td>
+                <td style="padding: 8px 0; border-top: 1px solid #eee; text-align: right;">%s</td>
+            </tr>`, template.HTMLEscapeString(v.Version), fleetStatusLabels[v.Status], instances)
+		fmt.Fprintf(&rowsText, "%s: %s, %s\n", v.Version, fleetStatusLabels[v.Status], instances)
+		for _, a := range v.Advisories {
+			fmt.Fprintf(&rowsHTML, `
+            <tr>
+                <td colspan="3" style="padding: 0 0 8px 16px; color: #666; font-size: 14px;">%s</td>
+            </tr>`, template.HTMLEscapeString(advisorySummary(a)))
+			fmt.Fprintf(&rowsText, "  - %s\n", advisorySummary(a))
+		}
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #0066cc; margin: 0;">Savegress</h1>
+        </div>
+
+        <h2>Engine Upgrade Recommended</h2>
+
+        <p>Hi %s,</p>
+
+        <p>Some of your Savegress engine instances run versions that should be upgraded. %s</p>
+
+        <table style="width: 100%%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <th style="padding: 8px 0; text-align: left; color: #666;">Version</th>
+                <th style="padding: 8px 0; text-align: left; color: #666;">Status</th>
+                <th style="padding: 8px 0; text-align: right; color: #666;">Running on</th>
+            </tr>%s
+        </table>
+
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #0066cc; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block; font-weight: 500;">View Instances</a>
+        </div>
+
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+
+        <p style="color: #999; font-size: 12px; text-align: center;">
+            © Savegress CDC Platform
+        </p>
+    </div>
+</body>
+</html>
+`, template.HTMLEscapeString(name), template.HTMLEscapeString(latest), rowsHTML.String(), fleetURL)
+
+	textBody := fmt.Sprintf(`Engine Upgrade Recommended
+
+Hi %s,
+
+Some of your Savegress engine instances run versions that should be upgraded. %s
+
+%s
+View your instances: %s
+
+---
+Savegress CDC Platform
+`, name, latest, rowsText.String(), fleetURL)
+
+	return s.provider.Send(ctx, to, subject, htmlBody, textBody)
+}
+
+// SendCertificateExpiryEmail tells an account owner that certificates of connections expire soon
+func (s *EmailService) SendCertificateExpiryEmail(ctx context.Context, to, name string, notices []CertificateExpiryNotice) error {
+	subject := "Connection certificates expire soon"
+	connectionsURL := s.baseURL + "/connections"
+
+	var rowsHTML, rowsText strings.Builder
+	for _, n := range notices {
+		expires := n.ExpiresAt.Format("January 2, 2006")
+		fmt.Fprintf(&rowsHTML, `
+            <tr>
+                <td style="padding: 8px 0; border-top: 1px solid #eee;">%s</td>
+                <td style="padding: 8px 0; border-top: 1px solid #eee; text-align: right;">%s</td>
+            </tr>`, template.HTMLEscapeString(n.ConnectionName), expires)
+		fmt.Fprintf(&rowsText, "%s: %s\n", n.ConnectionName, expires)
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #0066cc; margin: 0;">Savegress</h1>
+        </div>
+
+        <h2>Certificates Expire Soon</h2>
+
+        <p>Hi %s,</p>
+
+        <p>Certificates of these connections expire soon. Upload renewed certificates, and update your engines, so replication isn't interrupted.</p>
+
+        <table style="width: 100%%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <th style="padding: 8px 0; text-align: left; color: #666;">Connection</th>
+                <th style="padding: 8px 0; text-align: right; color: #666;">Expires</th>
+            </tr>%s
+        </table>
+
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #0066cc; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block; font-weight: 500;">View Connections</a>
+        </div>
+
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+
+        <p style="color: #999; font-size: 12px; text-align: center;">
+            © Savegress CDC Platform
+        </p>
+    </div>
+</body>
+</html>
+`, template.HTMLEscapeString(name), rowsHTML.String(), connectionsURL)
+
+	textBody := fmt.Sprintf(`Certificates Expire Soon
+
+Hi %s,
+
+Certificates of these connections expire soon. Upload renewed certificates, and update your engines, so replication isn't interrupted.
+
+%s
+View your connections: %s
+
+---
+Savegress CDC Platform
+`, name, rowsText.String(), connectionsURL)
+
+	return s.provider.Send(ctx, to, subject, htmlBody, textBody)
+}
+
+// SendConnectionFailingEmail notifies the owner of a connection that started
+// failing its tests after being healthy
+func (s *EmailService) SendConnectionFailingEmail(ctx context.Context, to, name, connName string, test *models.ConnectionTest) error {
+	subject := fmt.Sprintf("Connection %s is failing", connName)
+	connectionsURL := s.baseURL + "/connections"
+	testedAt := test.TestedAt.Format("January 2, 2006 15:04 MST")
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #0066cc; margin: 0;">Savegress</h1>
+        </div>
+
+        <h2>Connection Failing</h2>
+
+        <p>Hi %s,</p>
+
+        <p>The connection <strong>%s</strong> passed its previous test, but failed a %s test on %s. Pipelines using it may stop replicating.</p>
+
+        <div style="background-color: #fff5f5; border-left: 4px solid #cc0000; padding: 15px; margin: 20px 0;">
+            <p style="margin: 0;"><strong>%s</strong></p>
+            <p style="margin: 5px 0 0 0;">%s</p>
+        </div>
+
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #0066cc; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block; font-weight: 500;">View Connections</a>
+        </div>
+
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+
+        <p style="color: #999; font-size: 12px; text-align: center;">
+            © Savegress CDC Platform
+        </p>
+    </div>
+</body>
+</html>
+`, template.HTMLEscapeString(name), template.HTMLEscapeString(connName), test.Trigger, testedAt,
+		template.HTMLEscapeString(test.Category), template.HTMLEscapeString(test.Message), connectionsURL)
+
+	textBody := fmt.Sprintf(`Connection Failing
+
+Hi %s,
+
+The connection %s passed its previous test, but failed a %s test on %s. Pipelines using it may stop replicating.
+
+%s: %s
+
+View your connections: %s
+
+---
+Savegress CDC Platform
+`, name, connName, test.Trigger, testedAt, test.Category, test.Message, connectionsURL)
+
+	return s.provider.Send(ctx, to, subject, htmlBody, textBody)
+}
+
+// advisorySummary renders an advisory as one line, e.g. "[high] Title (fixed in 1.2.0)"
+func advisorySummary(a *models.ReleaseAdvisory) string {
+	summary := fmt.Sprintf("[%s] %s", a.Severity, a.Title)
+	if a.FixedIn != "" {
+		summary += fmt.Sprintf(" (fixed in %s)", a.FixedIn)
+	}
+	if a.URL != "" {
+		summary += " " + a.URL
+	}
+	return summary
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 GiB"
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
 // --- Email Providers ---
 
 // ResendProvider sends emails via Resend API
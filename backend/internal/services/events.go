@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var ErrInvalidStreamTicket = errors.New("invalid or expired stream ticket")
+
+// Dashboard stream event types
+const (
+	EventInstanceStatus  = "instance.status"
+	EventPipelineStats   = "pipeline.stats"
+	EventPipelineLog     = "pipeline.log"
+	EventPipelineAnomaly = "pipeline.anomaly"
+)
+
+const (
+	// streamTicketTTL is how long a stream ticket can be redeemed
+	streamTicketTTL = 30 * time.Second
+	// instanceStatusTTL keeps the last published status of instances that stopped reporting
+	instanceStatusTTL = 25 * time.Hour
+	// instanceStatusHorizon is how far back the sweep looks for instances going offline
+	instanceStatusHorizon = 24 * time.Hour
+)
+
+// StreamEvent is a message on an account's dashboard stream
+type StreamEvent struct {
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// InstanceStatusEvent is published when an instance goes online or offline
+type InstanceStatusEvent struct {
+	LicenseID  string    `json:"license_id"`
+	HardwareID string    `json:"hardware_id"`
+	Hostname   string    `json:"hostname"`
+	Status     string    `json:"status"` // online, offline
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// PipelineStatsEvent is published when an engine reports pipeline statistics
+type PipelineStatsEvent struct {
+	PipelineID      uuid.UUID  `json:"pipeline_id"`
+	Status          string     `json:"status"`
+	EventsProcessed int64      `json:"events_processed"`
+	BytesProcessed  int64      `json:"bytes_processed"`
+	CurrentLagMs    int64      `json:"current_lag_ms"`
+	LastEventAt     *time.Time `json:"last_event_at,omitempty"`
+}
+
+// EventService fans dashboard events out to every API replica through Redis pub/sub
+type EventService struct {
+	db    *repository.PostgresDB
+	redis *repository.RedisClient
+	hub   *eventHub
+}
+
+// NewEventService creates a new event service
+func NewEventService(db *repository.PostgresDB, redis *repository.RedisClient) *EventService {
+	return &EventService{db: db, redis: redis, hub: newEventHub()}
+}
+
+const eventChannelPrefix = "events:user:"
+
+func eventChannel(userID uuid.UUID) string {
+	return eventChannelPrefix + userID.String()
+}
+
+func instanceStatusKey(licenseID, hardwareID string) string {
+	return "events:instance_status:" + licenseID + ":" + hardwareID
+}
+
+// instanceStatus returns the dashboard status of an instance last seen at lastSeen
+func instanceStatus(lastSeen, now time.Time) string {
+	if now.Sub(lastSeen) < instanceOnlineWindow {
+		return "online"
+	}
+	return "offline"
+}
+
+// streamMessage encodes an event as published on a user's channel
+func streamMessage(eventType string, data interface{}) ([]byte, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(StreamEvent{Type: eventType, Time: time.Now().UTC(), Data: payload})
+}
+
+// Publish sends an event to the user's stream. Failures are logged; events are
+// best-effort and never fail the operation that produced them. Safe on a nil service.
+func (s *EventService) Publish(ctx context.Context, userID uuid.UUID, eventType string, data interface{}) {
+	if s == nil {
+		return
+	}
+	msg, err := streamMessage(eventType, data)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+	if err := s.redis.Client().Publish(ctx, eventChannel(userID), msg).Err(); err != nil {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// UpdateInstanceStatus records an instance's status and publishes it if it
+// changed. The swap is atomic, so only one replica publishes each change.
+func (s *EventService) UpdateInstanceStatus(ctx context.Context, userID uuid.UUID, ev InstanceStatusEvent) {
+	if s == nil {
+		return
+	}
+	prev, err := s.redis.Client().SetArgs(ctx, instanceStatusKey(ev.LicenseID, ev.HardwareID), ev.Status,
+		redis.SetArgs{Get: true, TTL: instanceStatusTTL}).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Failed to record status of instance %s: %v", ev.HardwareID, err)
+		return
+	}
+	if prev == ev.Status {
+		return
+	}
+	s.Publish(ctx, userID, EventInstanceStatus, ev)
+}
+
+// CreateStreamTicket returns a short-lived, single-use ticket that opens the
+// user's stream. Browsers' EventSource can't send an Authorization header.
+func (s *EventService) CreateStreamTicket(ctx context.Context, userID uuid.UUID) (string, time.Duration, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", 0, err
+	}
+	ticket := hex.EncodeToString(b)
+	if err := s.redis.Client().Set(ctx, "events:ticket:"+ticket, userID.String(), streamTicketTTL).Err(); err != nil {
+		return "", 0, err
+	}
+	return ticket, streamTicketTTL, nil
+}
+
+// RedeemStreamTicket consumes a ticket and returns the user it was issued to
+func (s *EventService) RedeemStreamTicket(ctx context.Context, ticket string) (uuid.UUID, error) {
+	if len(ticket) != 64 {
+		return uuid.Nil, ErrInvalidStreamTicket
+	}
+	value, err := s.redis.Client().GetDel(ctx, "events:ticket:"+ticket).Result()
+	if err == redis.Nil {
+		return uuid.Nil, ErrInvalidStreamTicket
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, ErrInvalidStreamTicket
+	}
+	return userID, nil
+}
+
+// SweepInstanceStatus publishes instances that went offline since the last sweep
+// (and ones that came online without reporting telemetry, e.g. on activation)
+func (s *EventService) SweepInstanceStatus(ctx context.Context) error {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT DISTINCT ON (a.license_id, a.hardware_id)
+			l.user_id, a.license_id::text, a.hardware_id, COALESCE(a.hostname, ''), a.last_seen_at
+		FROM license_activations a
+		JOIN licenses l ON a.license_id = l.id
+		WHERE a.deactivated_at IS NULL AND a.last_seen_at > $1
+		ORDER BY a.license_id, a.hardware_id, a.last_seen_at DESC
+	`, time.Now().Add(-instanceStatusHorizon))
+	if err != nil {
+		return err
+	}
+
+	type instance struct {
+		userID uuid.UUID
+		event  InstanceStatusEvent
+	}
+	var instances []instance
+	for rows.Next() {
+		var in instance
+		if err := rows.Scan(&in.userID, &in.event.LicenseID, &in.event.HardwareID, &in.event.Hostname, &in.event.LastSeenAt); err != nil {
+			rows.Close()
+			return err
+		}
+		instances = append(instances, in)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, in := range instances {
+		in.event.Status = instanceStatus(in.event.LastSeenAt, now)
+		s.UpdateInstanceStatus(ctx, in.userID, in.event)
+	}
+	return nil
+}
+
+// Start sweeps instance status until ctx is cancelled
+func (s *EventService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SweepInstanceStatus(ctx); err != nil {
+			log.Printf("Instance status sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
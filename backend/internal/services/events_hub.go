@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTooManyStreams         = errors.New("too many open event streams")
+	ErrEventStreamUnavailable = errors.New("event stream unavailable")
+)
+
+const (
+	// maxStreamsPerUser caps the dashboard streams one account can hold open
+	// on a replica, e.g. browser tabs
+	maxStreamsPerUser = 5
+	// streamBuffer is how many events a slow stream may fall behind before
+	// further events are dropped for it
+	streamBuffer = 64
+	// eventListenRetry is the wait before resubscribing after Redis fails
+	eventListenRetry = 5 * time.Second
+)
+
+// EventSubscription receives the events of one account's dashboard stream
+type EventSubscription struct {
+	C <-chan string
+
+	hub    *eventHub
+	userID uuid.UUID
+	ch     chan string
+}
+
+// Close stops delivery to the subscription
+func (sub *EventSubscription) Close() {
+	sub.hub.remove(sub)
+}
+
+// eventHub fans events received on the replica's single Redis subscription
+// out to the streams open on this replica
+type eventHub struct {
+	mu        sync.Mutex
+	listening bool
+	streams   map[uuid.UUID]map[*EventSubscription]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{streams: make(map[uuid.UUID]map[*EventSubscription]struct{})}
+}
+
+func (h *eventHub) start() {
+	h.mu.Lock()
+	h.listening = true
+	h.mu.Unlock()
+}
+
+// stop ends every open stream; clients reconnect once the replica listens again
+func (h *eventHub) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.listening = false
+	for userID, subs := range h.streams {
+		for sub := range subs {
+			close(sub.ch)
+		}
+		delete(h.streams, userID)
+	}
+}
+
+func (h *eventHub) add(userID uuid.UUID) (*EventSubscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.listening {
+		return nil, ErrEventStreamUnavailable
+	}
+	if len(h.streams[userID]) >= maxStreamsPerUser {
+		return nil, ErrTooManyStreams
+	}
+
+	ch := make(chan string, streamBuffer)
+	sub := &EventSubscription{C: ch, hub: h, userID: userID, ch: ch}
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[*EventSubscription]struct{})
+	}
+	h.streams[userID][sub] = struct{}{}
+	return sub, nil
+}
+
+func (h *eventHub) remove(sub *EventSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs, ok := h.streams[sub.userID]
+	if !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.streams, sub.userID)
+	}
+}
+
+// dispatch delivers a message published on a user's event channel
+func (h *eventHub) dispatch(channel, payload string) {
+	userID, err := uuid.Parse(strings.TrimPrefix(channel, eventChannelPrefix))
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.streams[userID] {
+		select {
+		case sub.ch <- payload:
+		default:
+			// The client isn't keeping up; it catches up from the API on reconnect
+		}
+	}
+}
+
+// Subscribe opens a stream of the user's events on this replica; the caller
+// must close the subscription
+func (s *EventService) Subscribe(userID uuid.UUID) (*EventSubscription, error) {
+	return s.hub.add(userID)
+}
+
+// Listen holds this replica's Redis subscription to every account's events and
+// fans them out to open streams until ctx is cancelled
+func (s *EventService) Listen(ctx context.Context) {
+	for {
+		if err := s.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Event subscription failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventListenRetry):
+		}
+	}
+}
+
+func (s *EventService) listen(ctx context.Context) error {
+	pubsub := s.redis.Client().PSubscribe(ctx, eventChannelPrefix+"*")
+	defer pubsub.Close()
+	// Streams open only once the subscription is confirmed, so none misses an event
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	s.hub.start()
+	defer s.hub.stop()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+			s.hub.dispatch(msg.Channel, msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventHubDeliversPublishedEvents(t *testing.T) {
+	s := NewEventService(nil, nil)
+	userID, otherID := uuid.New(), uuid.New()
+
+	_, err := s.Subscribe(userID)
+	assert.Equal(t, ErrEventStreamUnavailable, err)
+
+	s.hub.start()
+	sub, err := s.Subscribe(userID)
+	require.NoError(t, err)
+	defer sub.Close()
+	other, err := s.Subscribe(otherID)
+	require.NoError(t, err)
+	defer other.Close()
+
+	msg, err := streamMessage(EventPipelineStats, PipelineStatsEvent{EventsProcessed: 42})
+	require.NoError(t, err)
+	s.hub.dispatch(eventChannel(userID), string(msg))
+
+	select {
+	case payload := <-sub.C:
+		var ev StreamEvent
+		require.NoError(t, json.Unmarshal([]byte(payload), &ev))
+		assert.Equal(t, EventPipelineStats, ev.Type)
+		assert.JSONEq(t, `{"pipeline_id":"00000000-0000-0000-0000-000000000000","status":"","events_processed":42,"bytes_processed":0,"current_lag_ms":0}`, string(ev.Data))
+	default:
+		t.Fatal("event was not delivered")
+	}
+	assert.Empty(t, other.C)
+}
+
+func TestEventHubLimitsStreamsPerUser(t *testing.T) {
+	s := NewEventService(nil, nil)
+	s.hub.start()
+	userID := uuid.New()
+
+	var subs []*EventSubscription
+	for i := 0; i < maxStreamsPerUser; i++ {
+		sub, err := s.Subscribe(userID)
+		require.NoError(t, err)
+		subs = append(subs, sub)
+	}
+	_, err := s.Subscribe(userID)
+	assert.Equal(t, ErrTooManyStreams, err)
+
+	subs[0].Close()
+	sub, err := s.Subscribe(userID)
+	require.NoError(t, err)
+
+	// Losing the Redis subscription ends open streams
+	s.hub.stop()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	sub.Close()
+}
+
+func TestEventHubDropsEventsForSlowStreams(t *testing.T) {
+	hub := newEventHub()
+	hub.start()
+	userID := uuid.New()
+	sub, err := hub.add(userID)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	for i := 0; i < streamBuffer+10; i++ {
+		hub.dispatch(eventChannel(userID), "{}")
+	}
+	assert.Len(t, sub.C, streamBuffer)
+}
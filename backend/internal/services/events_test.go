@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceStatus(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, "online", instanceStatus(now, now))
+	assert.Equal(t, "online", instanceStatus(now.Add(-4*time.Minute), now))
+	assert.Equal(t, "offline", instanceStatus(now.Add(-5*time.Minute), now))
+	assert.Equal(t, "offline", instanceStatus(now.Add(-time.Hour), now))
+}
+
+func TestEventKeys(t *testing.T) {
+	userID := uuid.MustParse("6f1c2b8e-0d4a-4e8b-9a51-2b7c3d4e5f60")
+	assert.Equal(t, "events:user:6f1c2b8e-0d4a-4e8b-9a51-2b7c3d4e5f60", eventChannel(userID))
+	assert.Equal(t, "events:instance_status:lic:hw-1", instanceStatusKey("lic", "hw-1"))
+}
+
+func TestStreamEvent_JSON(t *testing.T) {
+	payload, err := json.Marshal(PipelineStatsEvent{PipelineID: uuid.New(), Status: "running", CurrentLagMs: 120})
+	require.NoError(t, err)
+
+	msg, err := json.Marshal(StreamEvent{Type: EventPipelineStats, Time: time.Now().UTC(), Data: payload})
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg, &decoded))
+	assert.Equal(t, "pipeline.stats", decoded["type"])
+	data := decoded["data"].(map[string]interface{})
+	assert.Equal(t, "running", data["status"])
+	assert.Equal(t, float64(120), data["current_lag_ms"])
+	assert.NotContains(t, data, "last_event_at")
+}
+
+func TestEventService_NilIsNoop(t *testing.T) {
+	var s *EventService
+	assert.NotPanics(t, func() {
+		s.Publish(context.Background(), uuid.New(), EventPipelineLog, map[string]string{"message": "hi"})
+		s.UpdateInstanceStatus(context.Background(), uuid.New(), InstanceStatusEvent{Status: "online"})
+	})
+}
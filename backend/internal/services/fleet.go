@@ -0,0 +1,614 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var (
+	ErrReleaseAdvisoryNotFound = errors.New("release advisory not found")
+	ErrInvalidReleaseAdvisory  = errors.New("invalid release advisory")
+)
+
+// Release advisory kinds
+const (
+	AdvisoryDeprecated = "deprecated"
+	AdvisorySecurity   = "security"
+)
+
+// Fleet version statuses
+const (
+	VersionCurrent    = "current"
+	VersionOutdated   = "outdated"
+	VersionDeprecated = "deprecated"
+	VersionVulnerable = "vulnerable"
+	VersionUnknown    = "unknown" // not reported, or not a release version
+)
+
+var advisorySeverities = map[string]bool{"low": true, "medium": true, "high": true, "critical": true}
+
+const (
+	// fleetProduct is the product engine instances run
+	fleetProduct = "cdc-engine"
+	// fleetLookback leaves out instances that haven't been seen for a while
+	fleetLookback = "30 days"
+)
+
+// FleetInstance is an engine instance in the fleet view
+type FleetInstance struct {
+	UserID     uuid.UUID `json:"-"`
+	LicenseID  string    `json:"license_id"`
+	HardwareID string    `json:"hardware_id"`
+	Hostname   string    `json:"hostname"`
+	Version    string    `json:"-"`
+	Online     bool      `json:"online"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// FleetVersion groups the instances running one version
+type FleetVersion struct {
+	Version       string                    `json:"version"`
+	Status        string                    `json:"status"`
+	InstanceCount int                       `json:"instance_count"`
+	AccountCount  int                       `json:"account_count,omitempty"`
+	Instances     []FleetInstance           `json:"instances,omitempty"`
+	Advisories    []*models.ReleaseAdvisory `json:"advisories"`
+}
+
+// FleetVersions is the fleet grouped by engine version
+type FleetVersions struct {
+	Product       string         `json:"product"`
+	LatestVersion string         `json:"latest_version,omitempty"`
+	Versions      []FleetVersion `json:"versions"`
+}
+
+// FleetUpgradeNotice tells an account owner that instances run versions that need upgrading
+type FleetUpgradeNotice struct {
+	LatestVersion string
+	Versions      []FleetVersion
+}
+
+// FleetService tracks which engine versions instances run and advises upgrades
+type FleetService struct {
+	db              *repository.PostgresDB
+	emailService    *EmailService
+	downloadService *DownloadService
+}
+
+// NewFleetService creates a new fleet service
+func NewFleetService(db *repository.PostgresDB, emailService *EmailService) *FleetService {
+	return &FleetService{db: db, emailService: emailService}
+}
+
+// SetDownloadService sets the source of known releases. Without it versions
+// can't be compared, and only advisories are reported.
+func (s *FleetService) SetDownloadService(downloadService *DownloadService) {
+	s.downloadService = downloadService
+}
+
+// parseVersion splits a version like "v1.2.3-rc.1" into its numeric parts and pre-release tag
+func parseVersion(v string) ([]int, string, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	core, pre, _ := strings.Cut(v, "-")
+	if core == "" {
+		return nil, "", false
+	}
+	fields := strings.Split(core, ".")
+	if len(fields) > 4 {
+		return nil, "", false
+	}
+	parts := make([]int, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return nil, "", false
+		}
+		parts[i] = n
+	}
+	return parts, pre, true
+}
+
+// normalizeVersion returns the canonical form of a release version, without a
+// leading "v" or build metadata, so "v1.2.3" and "1.2.3" are the same version.
+// Other versions are only trimmed.
+func normalizeVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if _, _, ok := parseVersion(v); !ok {
+		return v
+	}
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	return v
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, equal to or newer
+// than b. ok is false when either isn't a release version.
+func compareVersions(a, b string) (int, bool) {
+	pa, preA, okA := parseVersion(a)
+	pb, preB, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	// A pre-release comes before its release
+	switch {
+	case preA == preB:
+		return 0, true
+	case preA == "":
+		return 1, true
+	case preB == "":
+		return -1, true
+	case preA < preB:
+		return -1, true
+	default:
+		return 1, true
+	}
+}
+
+// latestRelease returns the newest release of product, or "" when there's none.
+// Pre-releases are skipped, so instances aren't told to upgrade to them.
+func latestRelease(releases []ReleaseInfo, product string) string {
+	latest := ""
+	for _, r := range releases {
+		if r.Product != product {
+			continue
+		}
+		if _, pre, ok := parseVersion(r.Version); !ok || pre != "" {
+			continue
+		}
+		if latest == "" {
+			latest = r.Version
+			continue
+		}
+		if cmp, ok := compareVersions(r.Version, latest); ok && cmp > 0 {
+			latest = r.Version
+		}
+	}
+	return latest
+}
+
+// versionStatus classifies a version against the latest release and its advisories
+func versionStatus(version, latest string, advisories []*models.ReleaseAdvisory) string {
+	status := VersionUnknown
+	if cmp, ok := compareVersions(version, latest); ok {
+		status = VersionCurrent
+		if cmp < 0 {
+			status = VersionOutdated
+		}
+	}
+	for _, a := range advisories {
+		switch {
+		case a.Kind == AdvisorySecurity:
+			return VersionVulnerable
+		case a.Kind == AdvisoryDeprecated:
+			status = VersionDeprecated
+		}
+	}
+	return status
+}
+
+// needsUpgrade reports whether owners are told about instances with status
+func needsUpgrade(status string) bool {
+	return status == VersionOutdated || status == VersionDeprecated || status == VersionVulnerable
+}
+
+// groupFleet groups instances by normalized version, newest version first.
+// advisories is keyed by normalized version. Instances are
+// listed only when withInstances is set; accounts are counted otherwise.
+func groupFleet(instances []FleetInstance, latest string, advisories map[string][]*models.ReleaseAdvisory, withInstances bool) []FleetVersion {
+	byVersion := make(map[string]*FleetVersion)
+	accounts := make(map[string]map[uuid.UUID]bool)
+	for _, in := range instances {
+		version := normalizeVersion(in.Version)
+		v, ok := byVersion[version]
+		if !ok {
+			v = &FleetVersion{
+				Version:    version,
+				Status:     versionStatus(version, latest, advisories[version]),
+				Advisories: advisories[version],
+			}
+			if v.Advisories == nil {
+				v.Advisories = make([]*models.ReleaseAdvisory, 0)
+			}
+			byVersion[version] = v
+			accounts[version] = make(map[uuid.UUID]bool)
+		}
+		v.InstanceCount++
+		if withInstances {
+			v.Instances = append(v.Instances, in)
+		} else {
+			accounts[version][in.UserID] = true
+		}
+	}
+
+	versions := make([]FleetVersion, 0, len(byVersion))
+	for version, v := range byVersion {
+		if !withInstances {
+			v.AccountCount = len(accounts[version])
+		}
+		versions = append(versions, *v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		cmp, ok := compareVersions(versions[i].Version, versions[j].Version)
+		if !ok {
+			// Unparseable versions go last
+			_, _, okI := parseVersion(versions[i].Version)
+			_, _, okJ := parseVersion(versions[j].Version)
+			if okI != okJ {
+				return okI
+			}
+			return versions[i].Version < versions[j].Version
+		}
+		return cmp > 0
+	})
+	return versions
+}
+
+// ValidateReleaseAdvisory normalizes an advisory and checks it's complete
+func ValidateReleaseAdvisory(a *models.ReleaseAdvisory) error {
+	a.Product = strings.TrimSpace(a.Product)
+	if a.Product == "" {
+		a.Product = fleetProduct
+	}
+	a.Version = normalizeVersion(a.Version)
+	a.Kind = strings.ToLower(strings.TrimSpace(a.Kind))
+	a.Severity = strings.ToLower(strings.TrimSpace(a.Severity))
+	if a.Severity == "" {
+		a.Severity = "medium"
+	}
+	a.Title = strings.TrimSpace(a.Title)
+	a.URL = strings.TrimSpace(a.URL)
+	a.FixedIn = normalizeVersion(a.FixedIn)
+
+	if _, _, ok := parseVersion(a.Version); !ok {
+		return fmt.Errorf("%w: version must be a release version such as 1.2.3", ErrInvalidReleaseAdvisory)
+	}
+	if a.Kind != AdvisoryDeprecated && a.Kind != AdvisorySecurity {
+		return fmt.Errorf("%w: kind must be deprecated or security", ErrInvalidReleaseAdvisory)
+	}
+	if !advisorySeverities[a.Severity] {
+		return fmt.Errorf("%w: severity must be low, medium, high or critical", ErrInvalidReleaseAdvisory)
+	}
+	if a.Title == "" || len(a.Title) > 255 {
+		return fmt.Errorf("%w: title is required", ErrInvalidReleaseAdvisory)
+	}
+	if a.URL != "" {
+		if u, err := url.Parse(a.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: url must be an http(s) URL", ErrInvalidReleaseAdvisory)
+		}
+	}
+	if a.FixedIn != "" {
+		cmp, ok := compareVersions(a.FixedIn, a.Version)
+		if !ok || cmp <= 0 {
+			return fmt.Errorf("%w: fixed_in must be a version newer than version", ErrInvalidReleaseAdvisory)
+		}
+	}
+	return nil
+}
+
+const releaseAdvisoryColumns = `id, product, version, kind, severity, title, COALESCE(description, ''),
+	COALESCE(url, ''), COALESCE(fixed_in, ''), created_by, created_at, updated_at`
+
+func scanReleaseAdvisory(row pgx.Row) (*models.ReleaseAdvisory, error) {
+	var a models.ReleaseAdvisory
+	err := row.Scan(&a.ID, &a.Product, &a.Version, &a.Kind, &a.Severity, &a.Title, &a.Description,
+		&a.URL, &a.FixedIn, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListAdvisories returns release advisories, optionally only those of product
+func (s *FleetService) ListAdvisories(ctx context.Context, product string) ([]*models.ReleaseAdvisory, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT `+releaseAdvisoryColumns+` FROM release_advisories
+		WHERE $1 = '' OR product = $1
+		ORDER BY product, created_at DESC
+	`, product)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	advisories := make([]*models.ReleaseAdvisory, 0)
+	for rows.Next() {
+		a, err := scanReleaseAdvisory(rows)
+		if err != nil {
+			return nil, err
+		}
+		advisories = append(advisories, a)
+	}
+	return advisories, rows.Err()
+}
+
+// CreateAdvisory adds a release advisory
+func (s *FleetService) CreateAdvisory(ctx context.Context, a *models.ReleaseAdvisory) (*models.ReleaseAdvisory, error) {
+	if err := ValidateReleaseAdvisory(a); err != nil {
+		return nil, err
+	}
+	return scanReleaseAdvisory(s.db.Pool().QueryRow(ctx, `
+		INSERT INTO release_advisories (product, version, kind, severity, title, description, url, fixed_in, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9)
+		RETURNING `+releaseAdvisoryColumns,
+		a.Product, a.Version, a.Kind, a.Severity, a.Title, a.Description, a.URL, a.FixedIn, a.CreatedBy))
+}
+
+// GetAdvisory returns a release advisory
+func (s *FleetService) GetAdvisory(ctx context.Context, id uuid.UUID) (*models.ReleaseAdvisory, error) {
+	a, err := scanReleaseAdvisory(s.db.Pool().QueryRow(ctx, `
+		SELECT `+releaseAdvisoryColumns+` FROM release_advisories WHERE id = $1
+	`, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrReleaseAdvisoryNotFound
+	}
+	return a, err
+}
+
+// UpdateAdvisory replaces a release advisory
+func (s *FleetService) UpdateAdvisory(ctx context.Context, a *models.ReleaseAdvisory) (*models.ReleaseAdvisory, error) {
+	if err := ValidateReleaseAdvisory(a); err != nil {
+		return nil, err
+	}
+	updated, err := scanReleaseAdvisory(s.db.Pool().QueryRow(ctx, `
+		UPDATE release_advisories
+		SET product = $2, version = $3, kind = $4, severity = $5, title = $6,
+			description = NULLIF($7, ''), url = NULLIF($8, ''), fixed_in = NULLIF($9, '')
+		WHERE id = $1
+		RETURNING `+releaseAdvisoryColumns,
+		a.ID, a.Product, a.Version, a.Kind, a.Severity, a.Title, a.Description, a.URL, a.FixedIn))
+	if err == pgx.ErrNoRows {
+		return nil, ErrReleaseAdvisoryNotFound
+	}
+	return updated, err
+}
+
+// DeleteAdvisory removes a release advisory
+func (s *FleetService) DeleteAdvisory(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Pool().Exec(ctx, `DELETE FROM release_advisories WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrReleaseAdvisoryNotFound
+	}
+	return nil
+}
+
+// latestVersion returns the newest known engine release, or "" without a release source
+func (s *FleetService) latestVersion(ctx context.Context) (string, error) {
+	if s.downloadService == nil {
+		return "", nil
+	}
+	releases, err := s.downloadService.ListReleases(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list releases: %w", err)
+	}
+	return latestRelease(releases, fleetProduct), nil
+}
+
+// advisoriesByVersion returns the engine's advisories keyed by normalized version
+func (s *FleetService) advisoriesByVersion(ctx context.Context) (map[string][]*models.ReleaseAdvisory, error) {
+	advisories, err := s.ListAdvisories(ctx, fleetProduct)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[string][]*models.ReleaseAdvisory)
+	for _, a := range advisories {
+		version := normalizeVersion(a.Version)
+		byVersion[version] = append(byVersion[version], a)
+	}
+	return byVersion, nil
+}
+
+// fleetInstances returns active instances with the version they last reported,
+// of one user or of everyone when userID is nil
+func (s *FleetService) fleetInstances(ctx context.Context, userID *uuid.UUID) ([]FleetInstance, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT DISTINCT ON (a.license_id, a.hardware_id)
+			l.user_id, a.license_id::text, a.hardware_id, COALESCE(a.hostname, ''),
+			COALESCE(NULLIF(t.version, ''), a.version, ''), a.last_seen_at
+		FROM license_activations a
+		JOIN licenses l ON a.license_id = l.id
+		LEFT JOIN LATERAL (
+			SELECT version FROM telemetry
+			WHERE license_id = a.license_id AND hardware_id = a.hardware_id AND pipeline_id IS NULL
+				AND timestamp > NOW() - INTERVAL '`+federationLookback+`'
+			ORDER BY timestamp DESC LIMIT 1
+		) t ON true
+		WHERE a.deactivated_at IS NULL AND a.last_seen_at > NOW() - INTERVAL '`+fleetLookback+`'
+			AND ($1::uuid IS NULL OR l.user_id = $1)
+		ORDER BY a.license_id, a.hardware_id, a.last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	instances := make([]FleetInstance, 0)
+	for rows.Next() {
+		var in FleetInstance
+		if err := rows.Scan(&in.UserID, &in.LicenseID, &in.HardwareID, &in.Hostname, &in.Version, &in.LastSeenAt); err != nil {
+			return nil, err
+		}
+		in.Version = strings.TrimSpace(in.Version)
+		in.Online = now.Sub(in.LastSeenAt) < instanceOnlineWindow
+		instances = append(instances, in)
+	}
+	return instances, rows.Err()
+}
+
+// fleetVersions builds the fleet view of one user, or of everyone when userID is nil
+func (s *FleetService) fleetVersions(ctx context.Context, userID *uuid.UUID) (*FleetVersions, error) {
+	latest, err := s.latestVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	advisories, err := s.advisoriesByVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := s.fleetInstances(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &FleetVersions{
+		Product:       fleetProduct,
+		LatestVersion: latest,
+		Versions:      groupFleet(instances, latest, advisories, userID != nil),
+	}, nil
+}
+
+// GetUserFleet returns the user's instances grouped by engine version
+func (s *FleetService) GetUserFleet(ctx context.Context, userID uuid.UUID) (*FleetVersions, error) {
+	return s.fleetVersions(ctx, &userID)
+}
+
+// GetFleet returns instance and account counts per engine version across all accounts
+func (s *FleetService) GetFleet(ctx context.Context) (*FleetVersions, error) {
+	return s.fleetVersions(ctx, nil)
+}
+
+// NotifyOwners emails account owners whose instances run versions that need
+// upgrading. Each account hears about a version once per status, so a version
+// that later turns deprecated or vulnerable is reported again.
+func (s *FleetService) NotifyOwners(ctx context.Context) error {
+	latest, err := s.latestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	advisories, err := s.advisoriesByVersion(ctx)
+	if err != nil {
+		return err
+	}
+	instances, err := s.fleetInstances(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	byUser := make(map[uuid.UUID][]FleetInstance)
+	for _, in := range instances {
+		byUser[in.UserID] = append(byUser[in.UserID], in)
+	}
+
+	var firstErr error
+	for userID, userInstances := range byUser {
+		var behind []FleetVersion
+		for _, v := range groupFleet(userInstances, latest, advisories, true) {
+			if needsUpgrade(v.Status) {
+				behind = append(behind, v)
+			}
+		}
+		if len(behind) == 0 {
+			continue
+		}
+		if err := s.notifyOwner(ctx, userID, latest, behind); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("user %s: %w", userID, err)
+		}
+	}
+	return firstErr
+}
+
+func (s *FleetService) notifyOwner(ctx context.Context, userID uuid.UUID, latest string, behind []FleetVersion) error {
+	var name, email string
+	if err := s.db.Pool().QueryRow(ctx, `SELECT name, email FROM users WHERE id = $1`, userID).Scan(&name, &email); err != nil {
+		return fmt.Errorf("failed to load account owner: %w", err)
+	}
+
+	// Record the notices before sending, so another replica running at the
+	// same time doesn't email the same versions
+	versions := make([]string, len(behind))
+	statuses := make([]string, len(behind))
+	for i, v := range behind {
+		versions[i], statuses[i] = v.Version, v.Status
+	}
+	rows, err := s.db.Pool().Query(ctx, `
+		INSERT INTO fleet_version_notices (user_id, version, status)
+		SELECT $1, unnest($2::text[]), unnest($3::text[])
+		ON CONFLICT DO NOTHING
+		RETURNING version || '/' || status
+	`, userID, versions, statuses)
+	if err != nil {
+		return err
+	}
+	claimed, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	claimedSet := make(map[string]bool, len(claimed))
+	for _, key := range claimed {
+		claimedSet[key] = true
+	}
+	var pending []FleetVersion
+	for _, v := range behind {
+		if claimedSet[v.Version+"/"+v.Status] {
+			pending = append(pending, v)
+		}
+	}
+
+	if err := s.emailService.SendFleetUpgradeEmail(ctx, email, name, &FleetUpgradeNotice{LatestVersion: latest, Versions: pending}); err != nil {
+		// Nobody got the notice, so the next run may send it
+		if _, releaseErr := s.db.Pool().Exec(ctx, `
+			DELETE FROM fleet_version_notices WHERE user_id = $1 AND version || '/' || status = ANY($2)
+		`, userID, claimed); releaseErr != nil {
+			log.Printf("Failed to release upgrade notices of user %s: %v", userID, releaseErr)
+		}
+		return fmt.Errorf("failed to send upgrade notice: %w", err)
+	}
+	return nil
+}
+
+// Start runs NotifyOwners every interval until ctx is canceled
+func (s *FleetService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.NotifyOwners(ctx); err != nil {
+			log.Printf("Fleet upgrade notices failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
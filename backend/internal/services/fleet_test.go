@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"1.0.0", "1.0.0", 0, true},
+		{"1.0", "1.0.0", 0, true},
+		{"v1.2.0", "1.1.9", 1, true},
+		{"1.9.0", "1.10.0", -1, true},
+		{"2.0.0-rc.1", "2.0.0", -1, true},
+		{"2.0.0-rc.2", "2.0.0-rc.1", 1, true},
+		{"1.0.0+build.5", "1.0.0", 0, true},
+		{"", "1.0.0", 0, false},
+		{"dev", "1.0.0", 0, false},
+		{"1.x", "1.0.0", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := compareVersions(tt.a, tt.b)
+		assert.Equal(t, tt.ok, ok, "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, tt.want, got, "%s vs %s", tt.a, tt.b)
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	releases := []ReleaseInfo{
+		{Product: "cdc-engine", Version: "1.2.0"},
+		{Product: "cdc-engine", Version: "1.10.0"},
+		{Product: "cdc-engine", Version: "nightly"},
+		{Product: "cdc-engine", Version: "1.11.0-rc.1"},
+		{Product: "cdc-engine", Version: "v2.0.0-beta"},
+		{Product: "cdc-broker", Version: "3.0.0"},
+	}
+	assert.Equal(t, "1.10.0", latestRelease(releases, "cdc-engine"))
+	assert.Equal(t, "3.0.0", latestRelease(releases, "cdc-broker"))
+	assert.Equal(t, "", latestRelease(releases, "other"))
+
+	// Only pre-releases means there's no release yet
+	assert.Equal(t, "", latestRelease([]ReleaseInfo{{Product: "cdc-engine", Version: "1.0.0-rc.1"}}, "cdc-engine"))
+}
+
+func TestVersionStatus(t *testing.T) {
+	deprecated := &models.ReleaseAdvisory{Kind: AdvisoryDeprecated}
+	security := &models.ReleaseAdvisory{Kind: AdvisorySecurity}
+
+	assert.Equal(t, VersionCurrent, versionStatus("1.2.0", "1.2.0", nil))
+	assert.Equal(t, VersionCurrent, versionStatus("1.3.0-beta", "1.2.0", nil), "ahead of the latest release")
+	assert.Equal(t, VersionOutdated, versionStatus("1.1.0", "1.2.0", nil))
+	assert.Equal(t, VersionUnknown, versionStatus("", "1.2.0", nil))
+	assert.Equal(t, VersionUnknown, versionStatus("1.1.0", "", nil), "no known releases")
+
+	assert.Equal(t, VersionDeprecated, versionStatus("1.2.0", "1.2.0", []*models.ReleaseAdvisory{deprecated}))
+	assert.Equal(t, VersionVulnerable, versionStatus("1.1.0", "1.2.0", []*models.ReleaseAdvisory{deprecated, security}))
+	assert.Equal(t, VersionVulnerable, versionStatus("1.1.0", "", []*models.ReleaseAdvisory{security}))
+
+	assert.False(t, needsUpgrade(VersionCurrent))
+	assert.False(t, needsUpgrade(VersionUnknown))
+	assert.True(t, needsUpgrade(VersionOutdated))
+	assert.True(t, needsUpgrade(VersionVulnerable))
+}
+
+func TestNormalizeVersion(t *testing.T) {
+	assert.Equal(t, "1.2.3", normalizeVersion("v1.2.3"))
+	assert.Equal(t, "1.2.3", normalizeVersion(" 1.2.3 "))
+	assert.Equal(t, "1.2.3-rc.1", normalizeVersion("v1.2.3-rc.1+build.7"))
+	assert.Equal(t, "nightly", normalizeVersion("nightly"))
+	assert.Equal(t, "", normalizeVersion(""))
+}
+
+func TestGroupFleet(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	instances := []FleetInstance{
+		{UserID: alice, HardwareID: "a1", Version: "1.1.0"},
+		{UserID: alice, HardwareID: "a2", Version: "1.2.0"},
+		{UserID: bob, HardwareID: "b1", Version: "v1.1.0"}, // same release with a "v" prefix
+		{UserID: bob, HardwareID: "b2", Version: ""},
+		{UserID: bob, HardwareID: "b3", Version: "1.10.0"},
+	}
+	advisories := map[string][]*models.ReleaseAdvisory{
+		"1.1.0": {{Kind: AdvisorySecurity, Title: "CVE"}},
+	}
+
+	t.Run("admin view counts accounts", func(t *testing.T) {
+		versions := groupFleet(instances, "1.10.0", advisories, false)
+		require.Len(t, versions, 4)
+
+		assert.Equal(t, "1.10.0", versions[0].Version)
+		assert.Equal(t, VersionCurrent, versions[0].Status)
+		assert.Equal(t, "1.2.0", versions[1].Version)
+		assert.Equal(t, VersionOutdated, versions[1].Status)
+		assert.Equal(t, "1.1.0", versions[2].Version)
+		assert.Equal(t, VersionVulnerable, versions[2].Status)
+		assert.Equal(t, 2, versions[2].InstanceCount)
+		assert.Equal(t, 2, versions[2].AccountCount)
+		assert.Len(t, versions[2].Advisories, 1)
+		assert.Nil(t, versions[2].Instances)
+
+		// Unreported versions go last
+		assert.Equal(t, "", versions[3].Version)
+		assert.Equal(t, VersionUnknown, versions[3].Status)
+		assert.NotNil(t, versions[3].Advisories)
+	})
+
+	t.Run("user view lists instances", func(t *testing.T) {
+		versions := groupFleet(instances[:2], "1.10.0", advisories, true)
+		require.Len(t, versions, 2)
+		assert.Equal(t, "1.2.0", versions[0].Version)
+		require.Len(t, versions[0].Instances, 1)
+		assert.Equal(t, "a2", versions[0].Instances[0].HardwareID)
+		assert.Zero(t, versions[0].AccountCount)
+	})
+}
+
+func TestValidateReleaseAdvisory(t *testing.T) {
+	valid := func() *models.ReleaseAdvisory {
+		return &models.ReleaseAdvisory{
+			Version: " v1.1.0 ",
+			Kind:    "Security",
+			Title:   "Credentials logged at debug level",
+			URL:     "https://savegress.io/security/2025-01",
+			FixedIn: "v1.1.1",
+		}
+	}
+
+	a := valid()
+	require.NoError(t, ValidateReleaseAdvisory(a))
+	assert.Equal(t, "cdc-engine", a.Product)
+	assert.Equal(t, "1.1.0", a.Version)
+	assert.Equal(t, "1.1.1", a.FixedIn)
+	assert.Equal(t, AdvisorySecurity, a.Kind)
+	assert.Equal(t, "medium", a.Severity)
+
+	tests := []struct {
+		name   string
+		mutate func(a *models.ReleaseAdvisory)
+	}{
+		{"bad version", func(a *models.ReleaseAdvisory) { a.Version = "latest" }},
+		{"bad kind", func(a *models.ReleaseAdvisory) { a.Kind = "broken" }},
+		{"bad severity", func(a *models.ReleaseAdvisory) { a.Severity = "urgent" }},
+		{"missing title", func(a *models.ReleaseAdvisory) { a.Title = " " }},
+		{"bad url", func(a *models.ReleaseAdvisory) { a.URL = "javascript:alert(1)" }},
+		{"fixed in older version", func(a *models.ReleaseAdvisory) { a.FixedIn = "1.0.9" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := valid()
+			tt.mutate(a)
+			assert.True(t, errors.Is(ValidateReleaseAdvisory(a), ErrInvalidReleaseAdvisory))
+		})
+	}
+}
+
+type recordingEmailProvider struct {
+	to, subject, html, text string
+}
+
+func (p *recordingEmailProvider) Send(ctx context.Context, to, subject, htmlBody, textBody string) error {
+	p.to, p.subject, p.html, p.text = to, subject, htmlBody, textBody
+	return nil
+}
+
+func TestSendFleetUpgradeEmail(t *testing.T) {
+	provider := &recordingEmailProvider{}
+	s := &EmailService{provider: provider, baseURL: "https://app.savegress.io"}
+
+	err := s.SendFleetUpgradeEmail(context.Background(), "owner@example.com", "Owner", &FleetUpgradeNotice{
+		LatestVersion: "1.2.0",
+		Versions: []FleetVersion{
+			{Version: "1.0.0", Status: VersionOutdated, InstanceCount: 1},
+			{Version: "1.1.0", Status: VersionVulnerable, InstanceCount: 3, Advisories: []*models.ReleaseAdvisory{
+				{Severity: "high", Title: "<b>Token leak</b>", FixedIn: "1.1.1"},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "owner@example.com", provider.to)
+	assert.Contains(t, provider.subject, "Security advisory")
+	assert.Contains(t, provider.text, "1.0.0: Outdated, 1 instance")
+	assert.Contains(t, provider.text, "1.1.0: Security advisory, 3 instances")
+	assert.Contains(t, provider.text, "[high] <b>Token leak</b> (fixed in 1.1.1)")
+	assert.Contains(t, provider.html, "&lt;b&gt;Token leak&lt;/b&gt;")
+	assert.Contains(t, provider.html, "The latest release is 1.2.0.")
+	assert.Contains(t, provider.html, "https://app.savegress.io/fleet")
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrUnknownEncryptionKey = errors.New("ciphertext was encrypted with an unknown key")
+	ErrInvalidCiphertext    = errors.New("invalid ciphertext")
+)
+
+// DefaultEncryptionKeyID identifies the master key when ENCRYPTION_KEY_ID isn't set
+const DefaultEncryptionKeyID = "primary"
+
+// LegacyDefaultKeyID identifies the former default master key among retired keys
+const LegacyDefaultKeyID = "legacy-default"
+
+// legacyDefaultKey is the former default ENCRYPTION_KEY, which was zero-padded
+// to 32 bytes. Deployments that never set a key hold credentials encrypted
+// with it, in every environment.
+const legacyDefaultKey = "savegress-dev-encryption-key32\x00\x00"
+
+// LegacyDefaultKey returns the former default master key
+func LegacyDefaultKey() []byte {
+	return []byte(legacyDefaultKey)
+}
+
+// EncryptionKeySize is the size of master keys and data keys (AES-256)
+const EncryptionKeySize = 32
+
+// envelopeVersion prefixes envelope ciphertexts. Older ciphertexts have no
+// prefix and are the password sealed directly with the master key.
+const envelopeVersion = "v2"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Keyring holds the master keys credentials are encrypted with. Each value
+// gets its own data key, which is sealed by the primary master key and stored
+// with the key's ID, so rotating the master key only rewraps data keys.
+//
+// Ciphertexts look like v2:<key id>:<wrapped data key>:<sealed value>.
+type Keyring struct {
+	primaryID string
+	keys      map[string][]byte
+}
+
+// NewKeyring creates a keyring that encrypts with the primary key and can
+// still decrypt with the retired ones
+func NewKeyring(primaryID string, primaryKey []byte, retired map[string][]byte) (*Keyring, error) {
+	k := &Keyring{primaryID: primaryID, keys: make(map[string][]byte)}
+	add := func(id string, key []byte) error {
+		if !keyIDPattern.MatchString(id) {
+			return fmt.Errorf("invalid encryption key ID %q: use up to 32 letters, digits, '-' or '_'", id)
+		}
+		if len(key) != EncryptionKeySize {
+			return fmt.Errorf("encryption key %q must be exactly %d bytes, got %d", id, EncryptionKeySize, len(key))
+		}
+		if _, ok := k.keys[id]; ok {
+			return fmt.Errorf("duplicate encryption key ID %q", id)
+		}
+		k.keys[id] = key
+		return nil
+	}
+
+	if err := add(primaryID, primaryKey); err != nil {
+		return nil, err
+	}
+	for id, key := range retired {
+		if err := add(id, key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// PrimaryID returns the ID of the key new ciphertexts are wrapped with
+func (k *Keyring) PrimaryID() string {
+	return k.primaryID
+}
+
+// Encrypt seals plaintext with a new data key wrapped by the primary key
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	dataKey := make([]byte, EncryptionKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	sealed, err := sealGCM(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return k.envelope(dataKey, sealed)
+}
+
+// envelope wraps dataKey with the primary key and formats the ciphertext
+func (k *Keyring) envelope(dataKey, sealed []byte) (string, error) {
+	wrapped, err := sealGCM(k.keys[k.primaryID], dataKey, envelopeAAD(k.primaryID))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		envelopeVersion,
+		k.primaryID,
+		base64.StdEncoding.EncodeToString(wrapped),
+		base64.StdEncoding.EncodeToString(sealed),
+	}, ":"), nil
+}
+
+// Decrypt opens a ciphertext sealed with any key of the keyring
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, envelopeVersion+":") {
+		return k.decryptLegacy(ciphertext)
+	}
+
+	dataKey, sealed, err := k.unwrap(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openGCM(dataKey, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// unwrap returns the data key and sealed value of an envelope ciphertext
+func (k *Keyring) unwrap(ciphertext string) (dataKey, sealed []byte, err error) {
+	parts := strings.Split(ciphertext, ":")
+	if len(parts) != 4 {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	keyID := parts[1]
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownEncryptionKey, keyID)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	sealed, err = base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	dataKey, err = openGCM(masterKey, wrapped, envelopeAAD(keyID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, sealed, nil
+}
+
+// decryptLegacy opens a ciphertext from before envelope encryption, which
+// records no key ID, by trying each key with the primary first
+func (k *Keyring) decryptLegacy(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openGCM(k.keys[k.primaryID], sealed, nil)
+	if err == nil {
+		return string(plaintext), nil
+	}
+	for id, key := range k.keys {
+		if id == k.primaryID {
+			continue
+		}
+		if plaintext, retiredErr := openGCM(key, sealed, nil); retiredErr == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", err
+}
+
+// NeedsRewrap reports whether a ciphertext isn't wrapped by the primary key
+func (k *Keyring) NeedsRewrap(ciphertext string) bool {
+	return !strings.HasPrefix(ciphertext, envelopeVersion+":"+k.primaryID+":")
+}
+
+// Rewrap returns ciphertext with its data key wrapped by the primary key.
+// Legacy ciphertexts are re-encrypted with a new data key.
+func (k *Keyring) Rewrap(ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, envelopeVersion+":") {
+		plaintext, err := k.decryptLegacy(ciphertext)
+		if err != nil {
+			return "", err
+		}
+		return k.Encrypt(plaintext)
+	}
+
+	dataKey, sealed, err := k.unwrap(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return k.envelope(dataKey, sealed)
+}
+
+// envelopeAAD binds a wrapped data key to the ID of the key that wrapped it
+func envelopeAAD(keyID string) []byte {
+	return []byte(envelopeVersion + ":" + keyID)
+}
+
+// sealGCM encrypts with AES-GCM, prefixing the nonce
+func sealGCM(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// openGCM decrypts the output of sealGCM
+func openGCM(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := gcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
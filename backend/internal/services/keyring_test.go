@@ -0,0 +1,116 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKeyA = []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	testKeyB = []byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+)
+
+// legacyEncrypt seals a password the way it was stored before envelope encryption
+func legacyEncrypt(t *testing.T, key []byte, password string) string {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(password), nil))
+}
+
+func TestNewKeyring(t *testing.T) {
+	k, err := NewKeyring("k2", testKeyB, map[string][]byte{"k1": testKeyA})
+	require.NoError(t, err)
+	assert.Equal(t, "k2", k.PrimaryID())
+
+	_, err = NewKeyring("k1", []byte("short"), nil)
+	assert.ErrorContains(t, err, "exactly 32 bytes, got 5")
+
+	_, err = NewKeyring("k1", testKeyA, map[string][]byte{"old": testKeyB[:31]})
+	assert.Error(t, err)
+
+	_, err = NewKeyring("bad:id", testKeyA, nil)
+	assert.ErrorContains(t, err, "invalid encryption key ID")
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	k, err := NewKeyring("k1", testKeyA, nil)
+	require.NoError(t, err)
+
+	ciphertext, err := k.Encrypt("s3cret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(ciphertext, "v2:k1:"))
+	assert.Len(t, strings.Split(ciphertext, ":"), 4)
+	assert.False(t, k.NeedsRewrap(ciphertext))
+
+	plaintext, err := k.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+
+	// The wrapped data key is bound to its key ID
+	tampered := strings.Replace(ciphertext, "v2:k1:", "v2:k2:", 1)
+	other, err := NewKeyring("k2", testKeyA, nil)
+	require.NoError(t, err)
+	_, err = other.Decrypt(tampered)
+	assert.Error(t, err)
+
+	_, err = other.Decrypt(ciphertext)
+	assert.True(t, errors.Is(err, ErrUnknownEncryptionKey))
+
+	_, err = k.Decrypt("v2:k1:not-enough-parts")
+	assert.True(t, errors.Is(err, ErrInvalidCiphertext))
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, err := NewKeyring("k1", testKeyA, nil)
+	require.NoError(t, err)
+	ciphertext, err := old.Encrypt("s3cret")
+	require.NoError(t, err)
+	legacy := legacyEncrypt(t, testKeyA, "legacy-pass")
+
+	rotated, err := NewKeyring("k2", testKeyB, map[string][]byte{"k1": testKeyA})
+	require.NoError(t, err)
+
+	// Retired keys still decrypt
+	plaintext, err := rotated.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+	plaintext, err = rotated.Decrypt(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-pass", plaintext)
+
+	assert.True(t, rotated.NeedsRewrap(ciphertext))
+	assert.True(t, rotated.NeedsRewrap(legacy))
+
+	// Rewrapping keeps the sealed value and swaps the wrapped data key
+	rewrapped, err := rotated.Rewrap(ciphertext)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rewrapped, "v2:k2:"))
+	assert.Equal(t, strings.Split(ciphertext, ":")[3], strings.Split(rewrapped, ":")[3])
+	assert.False(t, rotated.NeedsRewrap(rewrapped))
+
+	rewrappedLegacy, err := rotated.Rewrap(legacy)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rewrappedLegacy, "v2:k2:"))
+
+	// Once everything is rewrapped the retired key can go
+	current, err := NewKeyring("k2", testKeyB, nil)
+	require.NoError(t, err)
+	for ct, want := range map[string]string{rewrapped: "s3cret", rewrappedLegacy: "legacy-pass"} {
+		plaintext, err := current.Decrypt(ct)
+		require.NoError(t, err)
+		assert.Equal(t, want, plaintext)
+	}
+}
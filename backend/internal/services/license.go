@@ -50,9 +50,13 @@ func NewLicenseService(db *repository.PostgresDB, privateKeyBase64 string) *Lice
 
 // CreateLicense creates a new license for a user
 func (s *LicenseService) CreateLicense(ctx context.Context, userID uuid.UUID, tier string, validDays int, hardwareID string) (*models.License, error) {
+	return s.createLicense(ctx, s.db.Pool(), userID, tier, validDays, hardwareID)
+}
+
+func (s *LicenseService) createLicense(ctx context.Context, q querier, userID uuid.UUID, tier string, validDays int, hardwareID string) (*models.License, error) {
 	// Get user
 	var userName, company string
-	err := s.db.Pool().QueryRow(ctx, "SELECT name, COALESCE(company, '') FROM users WHERE id = $1", userID).Scan(&userName, &company)
+	err := q.QueryRow(ctx, "SELECT name, COALESCE(company, '') FROM users WHERE id = $1", userID).Scan(&userName, &company)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
@@ -78,14 +82,14 @@ func (s *LicenseService) CreateLicense(ctx context.Context, userID uuid.UUID, ti
 	}
 
 	// Generate signed license key using shared library
-	licenseKey, err := s.generateLicenseKey(lic, userID.String(), fmt.Sprintf("%s (%s)", userName, company))
+	licenseKey, err := s.generateLicenseKey(lic, userID.String(), fmt.Sprintf("%s (%s)", userName, company), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate license key: %w", err)
 	}
 	lic.LicenseKey = licenseKey
 
 	// Store in database
-	_, err = s.db.Pool().Exec(ctx, `
+	_, err = q.Exec(ctx, `
 		INSERT INTO licenses (id, user_id, license_key, tier, status, max_sources, max_tables, max_throughput, features, hardware_id, issued_at, expires_at, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`, lic.ID, lic.UserID, lic.LicenseKey, lic.Tier, lic.Status,
@@ -137,6 +141,11 @@ func (s *LicenseService) ActivateLicense(ctx context.Context, licenseID uuid.UUI
 		return nil, err
 	}
 
+	telemetrySecret, err := generateTelemetrySecret()
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if already activated on this hardware
 	var existingID uuid.UUID
 	err = s.db.Pool().QueryRow(ctx, `
@@ -145,17 +154,25 @@ func (s *LicenseService) ActivateLicense(ctx context.Context, licenseID uuid.UUI
 	`, licenseID, hardwareID).Scan(&existingID)
 
 	if err == nil {
-		// Update existing activation
+		// Update existing activation; activations made before telemetry signing get a secret now
 		now := time.Now().UTC()
-		_, err = s.db.Pool().Exec(ctx, `
+		err = s.db.Pool().QueryRow(ctx, `
 			UPDATE license_activations
-			SET last_seen_at = $1, hostname = $2, platform = $3, version = $4, ip_address = $5
-			WHERE id = $6
-		`, now, hostname, platform, version, ipAddress, existingID)
+			SET last_seen_at = $1, hostname = $2, platform = $3, version = $4, ip_address = $5,
+				telemetry_secret = COALESCE(telemetry_secret, $6)
+			WHERE id = $7
+			RETURNING telemetry_secret
+		`, now, hostname, platform, version, ipAddress, telemetrySecret, existingID).Scan(&telemetrySecret)
 		if err != nil {
 			return nil, fmt.Errorf("failed to update activation: %w", err)
 		}
-		return &models.LicenseActivation{ID: existingID, LicenseID: licenseID, HardwareID: hardwareID, LastSeenAt: now}, nil
+		return &models.LicenseActivation{
+			ID:              existingID,
+			LicenseID:       licenseID,
+			HardwareID:      hardwareID,
+			LastSeenAt:      now,
+			TelemetrySecret: telemetrySecret,
+		}, nil
 	}
 
 	// Check activation limit (enterprise = unlimited, pro = 5, trial = 1)
@@ -171,22 +188,24 @@ func (s *LicenseService) ActivateLicense(ctx context.Context, licenseID uuid.UUI
 
 	// Create new activation
 	activation := &models.LicenseActivation{
-		ID:          uuid.New(),
-		LicenseID:   licenseID,
-		HardwareID:  hardwareID,
-		Hostname:    hostname,
-		Platform:    platform,
-		Version:     version,
-		IPAddress:   ipAddress,
-		ActivatedAt: time.Now().UTC(),
-		LastSeenAt:  time.Now().UTC(),
+		ID:              uuid.New(),
+		LicenseID:       licenseID,
+		HardwareID:      hardwareID,
+		Hostname:        hostname,
+		Platform:        platform,
+		Version:         version,
+		IPAddress:       ipAddress,
+		ActivatedAt:     time.Now().UTC(),
+		LastSeenAt:      time.Now().UTC(),
+		TelemetrySecret: telemetrySecret,
 	}
 
 	_, err = s.db.Pool().Exec(ctx, `
-		INSERT INTO license_activations (id, license_id, hardware_id, hostname, platform, version, ip_address, activated_at, last_seen_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO license_activations (id, license_id, hardware_id, hostname, platform, version, ip_address, activated_at, last_seen_at, telemetry_secret)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`, activation.ID, activation.LicenseID, activation.HardwareID, activation.Hostname,
-		activation.Platform, activation.Version, activation.IPAddress, activation.ActivatedAt, activation.LastSeenAt)
+		activation.Platform, activation.Version, activation.IPAddress, activation.ActivatedAt, activation.LastSeenAt,
+		activation.TelemetrySecret)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create activation: %w", err)
 	}
@@ -296,7 +315,8 @@ func (s *LicenseService) GetLicenseActivations(ctx context.Context, licenseID uu
 }
 
 // generateLicenseKey creates a signed license key using the shared license package
-func (s *LicenseService) generateLicenseKey(lic *models.License, customerID, customerName string) (string, error) {
+// extraMetadata is embedded next to the license ID, e.g. the contract a license belongs to.
+func (s *LicenseService) generateLicenseKey(lic *models.License, customerID, customerName string, extraMetadata map[string]string) (string, error) {
 	if s.generator == nil {
 		return "", errors.New("license generator not configured")
 	}
@@ -322,6 +342,11 @@ func (s *LicenseService) generateLicenseKey(lic *models.License, customerID, cus
 			"license_id": lic.ID.String(),
 		},
 	}
+	for k, v := range extraMetadata {
+		if v != "" && k != "license_id" {
+			req.Metadata[k] = v
+		}
+	}
 
 	key, err := s.generator.Generate(req)
 	if err != nil {
@@ -522,6 +547,93 @@ func (s *LicenseService) ExtendLicense(ctx context.Context, userID uuid.UUID, da
 	return err
 }
 
+// LicenseTerms overrides the tier defaults of a license, e.g. with the terms of a contract.
+// Zero limits fall back to the tier defaults.
+type LicenseTerms struct {
+	Tier          string
+	ExpiresAt     time.Time
+	MaxSources    int
+	MaxTables     int
+	MaxThroughput int64
+	Metadata      map[string]string // embedded in the signed key
+}
+
+// ApplyLicenseTerms reissues a license with new terms and a freshly signed key.
+// Revoked licenses are left untouched.
+func (s *LicenseService) ApplyLicenseTerms(ctx context.Context, licenseID uuid.UUID, terms LicenseTerms) (*models.License, error) {
+	return s.applyLicenseTerms(ctx, s.db.Pool(), licenseID, terms)
+}
+
+func (s *LicenseService) applyLicenseTerms(ctx context.Context, q querier, licenseID uuid.UUID, terms LicenseTerms) (*models.License, error) {
+	var lic models.License
+	var userName, company string
+	err := q.QueryRow(ctx, `
+		SELECT l.id, l.user_id, l.status, COALESCE(l.hardware_id, ''), l.created_at, u.name, COALESCE(u.company, '')
+		FROM licenses l JOIN users u ON u.id = l.user_id
+		WHERE l.id = $1
+	`, licenseID).Scan(&lic.ID, &lic.UserID, &lic.Status, &lic.HardwareID, &lic.CreatedAt, &userName, &company)
+	if err != nil {
+		return nil, ErrLicenseNotFound
+	}
+	if lic.Status == "revoked" {
+		return nil, ErrLicenseRevoked
+	}
+
+	lim := s.getLimitsForTier(terms.Tier)
+	if terms.MaxSources > 0 {
+		lim.MaxSources = terms.MaxSources
+	}
+	if terms.MaxTables > 0 {
+		lim.MaxTables = terms.MaxTables
+	}
+	if terms.MaxThroughput > 0 {
+		lim.MaxThroughput = terms.MaxThroughput
+	}
+
+	lic.Tier = terms.Tier
+	lic.Status = "active"
+	lic.MaxSources = lim.MaxSources
+	lic.MaxTables = lim.MaxTables
+	lic.MaxThroughput = lim.MaxThroughput
+	lic.Features = s.getFeaturesForTier(terms.Tier)
+	lic.IssuedAt = time.Now().UTC()
+	lic.ExpiresAt = terms.ExpiresAt.UTC()
+	if !lic.ExpiresAt.After(lic.IssuedAt) {
+		lic.Status = "expired"
+	}
+
+	if lic.Status == "active" {
+		licenseKey, err := s.generateLicenseKey(&lic, lic.UserID.String(), fmt.Sprintf("%s (%s)", userName, company), terms.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate license key: %w", err)
+		}
+		lic.LicenseKey = licenseKey
+	}
+
+	err = q.QueryRow(ctx, `
+		UPDATE licenses
+		SET tier = $1, status = $2, max_sources = $3, max_tables = $4, max_throughput = $5, features = $6,
+			license_key = COALESCE(NULLIF($7, ''), license_key), issued_at = $8, expires_at = $9
+		WHERE id = $10
+		RETURNING license_key
+	`, lic.Tier, lic.Status, lic.MaxSources, lic.MaxTables, lic.MaxThroughput, lic.Features,
+		lic.LicenseKey, lic.IssuedAt, lic.ExpiresAt, lic.ID).Scan(&lic.LicenseKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update license: %w", err)
+	}
+
+	return &lic, nil
+}
+
+// ExpireLicense marks a license as expired as of now
+func (s *LicenseService) ExpireLicense(ctx context.Context, licenseID uuid.UUID) error {
+	_, err := s.db.Pool().Exec(ctx, `
+		UPDATE licenses SET status = 'expired', expires_at = LEAST(expires_at, NOW())
+		WHERE id = $1 AND status = 'active'
+	`, licenseID)
+	return err
+}
+
 // RevokeUserLicenses revokes all active licenses for a user (used when subscription is canceled)
 func (s *LicenseService) RevokeUserLicenses(ctx context.Context, userID uuid.UUID) error {
 	now := time.Now().UTC()
@@ -550,10 +662,14 @@ type LicenseStats struct {
 
 // RevenueMetrics contains revenue-related statistics
 type RevenueMetrics struct {
-	ProLicenses        int `json:"pro_licenses"`
-	EnterpriseLicenses int `json:"enterprise_licenses"`
-	TrialLicenses      int `json:"trial_licenses"`
-	ConversionRate     float64 `json:"conversion_rate"` // Trial -> Paid
+	ProLicenses         int     `json:"pro_licenses"`
+	EnterpriseLicenses  int     `json:"enterprise_licenses"`
+	TrialLicenses       int     `json:"trial_licenses"`
+	ConversionRate      float64 `json:"conversion_rate"` // Trial -> Paid
+	ActiveSubscriptions int     `json:"active_subscriptions"`
+	PayingCustomers     int     `json:"paying_customers"`
+	MRR                 int64   `json:"mrr"` // in cents, USD invoices only
+	ARR                 int64   `json:"arr"` // in cents, USD invoices only
 }
 
 // GetLicenseStats returns comprehensive license statistics (admin only)
@@ -638,28 +754,28 @@ func (s *LicenseService) GetLicenseStats(ctx context.Context) (*LicenseStats, er
 	stats.RevenueMetrics.EnterpriseLicenses = stats.LicensesByTier["enterprise"]
 	stats.RevenueMetrics.TrialLicenses = stats.LicensesByTier["trial"]
 
-	// Conversion rate (trials that converted to pro/enterprise)
-	var totalTrials, convertedTrials int
+	// Conversion rate (trial users who went on to pay an invoice)
+	conversion, err := s.GetTrialConversion(ctx, time.Time{}, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	stats.RevenueMetrics.ConversionRate = conversion.ConversionRate
+
 	err = s.db.Pool().QueryRow(ctx, `
-		SELECT COUNT(*) FROM licenses WHERE tier = 'trial'
-	`).Scan(&totalTrials)
-	if err == nil && totalTrials > 0 {
-		// Count users who had trial and now have pro/enterprise
-		err = s.db.Pool().QueryRow(ctx, `
-			SELECT COUNT(DISTINCT l1.user_id) FROM licenses l1
-			WHERE l1.tier = 'trial'
-			AND EXISTS (
-				SELECT 1 FROM licenses l2
-				WHERE l2.user_id = l1.user_id
-				AND l2.tier IN ('pro', 'enterprise')
-				AND l2.issued_at > l1.issued_at
-			)
-		`).Scan(&convertedTrials)
-		if err == nil {
-			stats.RevenueMetrics.ConversionRate = float64(convertedTrials) / float64(totalTrials) * 100
-		}
+		SELECT COUNT(*) FROM subscriptions WHERE status IN ('active', 'trialing', 'past_due')
+	`).Scan(&stats.RevenueMetrics.ActiveSubscriptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active subscriptions: %w", err)
 	}
 
+	mrr, customers, err := s.currentRevenue(ctx, "usd")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute MRR: %w", err)
+	}
+	stats.RevenueMetrics.MRR = mrr
+	stats.RevenueMetrics.ARR = mrr * 12
+	stats.RevenueMetrics.PayingCustomers = customers
+
 	return stats, nil
 }
 
@@ -719,11 +835,21 @@ func (s *LicenseService) GetUsageStats(ctx context.Context, licenseID uuid.UUID,
 	return records, nil
 }
 
+// AggregatedUsage is the usage of a license over a period
+type AggregatedUsage struct {
+	TotalEvents      int64     `json:"total_events"`
+	TotalBytes       int64     `json:"total_bytes"`
+	TotalErrors      int64     `json:"total_errors"`
+	AvgLatencyMs     float64   `json:"avg_latency_ms"`
+	MaxSourcesUsed   int       `json:"max_sources_used"`
+	MaxTablesTracked int       `json:"max_tables_tracked"`
+	PeriodStart      time.Time `json:"period_start"`
+	PeriodEnd        time.Time `json:"period_end"`
+}
+
 // GetAggregatedUsage returns aggregated usage for billing/reporting
-func (s *LicenseService) GetAggregatedUsage(ctx context.Context, licenseID uuid.UUID, startDate, endDate time.Time) (map[string]interface{}, error) {
-	var totalEvents, totalBytes, totalErrors int64
-	var avgLatency float64
-	var maxSources, maxTables int
+func (s *LicenseService) GetAggregatedUsage(ctx context.Context, licenseID uuid.UUID, startDate, endDate time.Time) (*AggregatedUsage, error) {
+	usage := &AggregatedUsage{PeriodStart: startDate, PeriodEnd: endDate}
 
 	err := s.db.Pool().QueryRow(ctx, `
 		SELECT
@@ -735,19 +861,11 @@ func (s *LicenseService) GetAggregatedUsage(ctx context.Context, licenseID uuid.
 			COALESCE(MAX(tables_tracked), 0)
 		FROM license_usage
 		WHERE license_id = $1 AND recorded_at BETWEEN $2 AND $3
-	`, licenseID, startDate, endDate).Scan(&totalEvents, &totalBytes, &totalErrors, &avgLatency, &maxSources, &maxTables)
+	`, licenseID, startDate, endDate).Scan(&usage.TotalEvents, &usage.TotalBytes, &usage.TotalErrors,
+		&usage.AvgLatencyMs, &usage.MaxSourcesUsed, &usage.MaxTablesTracked)
 	if err != nil {
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"total_events":      totalEvents,
-		"total_bytes":       totalBytes,
-		"total_errors":      totalErrors,
-		"avg_latency_ms":    avgLatency,
-		"max_sources_used":  maxSources,
-		"max_tables_tracked": maxTables,
-		"period_start":      startDate,
-		"period_end":        endDate,
-	}, nil
+	return usage, nil
 }
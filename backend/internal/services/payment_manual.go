@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrInvoiceNotOpen  = errors.New("invoice is not open")
+)
+
+// ManualProvider implements PaymentProvider for invoicing-only customers.
+// Admins issue invoices and mark them paid once money arrives (bank transfer,
+// purchase order, ...); marking an invoice paid produces the same billing
+// events a Stripe webhook would.
+type ManualProvider struct {
+	db *repository.PostgresDB
+}
+
+// NewManualProvider creates a manual invoicing payment provider
+func NewManualProvider(db *repository.PostgresDB) *ManualProvider {
+	return &ManualProvider{db: db}
+}
+
+// Name returns the provider name
+func (p *ManualProvider) Name() string {
+	return ProviderManual
+}
+
+// CreateCustomer returns a local customer ID; there is no external system
+func (p *ManualProvider) CreateCustomer(ctx context.Context, user *models.User, profile *models.BillingProfile) (string, error) {
+	return "manual_cus_" + user.ID.String(), nil
+}
+
+// UpdateCustomer is a no-op; manual invoices are rendered from the stored billing profile
+func (p *ManualProvider) UpdateCustomer(ctx context.Context, user *models.User, profile *models.BillingProfile) error {
+	return nil
+}
+
+// CreateCheckoutSession is not supported; subscriptions start when an admin marks an invoice paid
+func (p *ManualProvider) CreateCheckoutSession(ctx context.Context, user *models.User, plan, successURL, cancelURL string) (string, error) {
+	return "", ErrNotSupportedByProvider
+}
+
+// SetCancelAtPeriodEnd only needs the local record, which BillingService updates
+func (p *ManualProvider) SetCancelAtPeriodEnd(ctx context.Context, subscriptionID string, cancel bool) error {
+	return nil
+}
+
+// ChangePlan switches the plan; the next manual invoice is issued at the new plan's price
+func (p *ManualProvider) ChangePlan(ctx context.Context, subscriptionID, plan string) (*ProviderSubscription, error) {
+	if plan != "pro" && plan != "enterprise" {
+		return nil, ErrInvalidPlan
+	}
+	return &ProviderSubscription{ID: subscriptionID, PriceID: manualPriceID(plan)}, nil
+}
+
+// CreatePortalSession is not supported for manual invoicing
+func (p *ManualProvider) CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error) {
+	return "", ErrNotSupportedByProvider
+}
+
+// ParseWebhook is not supported; manual invoicing has no webhooks
+func (p *ManualProvider) ParseWebhook(payload []byte, signature string) (*BillingEvent, error) {
+	return nil, ErrNotSupportedByProvider
+}
+
+func manualPriceID(plan string) string {
+	return "manual_" + plan
+}
+
+func manualSubscriptionID(userID uuid.UUID) string {
+	return "manual_sub_" + userID.String()
+}
+
+// ManualInvoiceInput describes an invoice issued by an admin
+type ManualInvoiceInput struct {
+	Plan        string                   `json:"plan"` // plan granted when paid; empty for one-off charges
+	Currency    string                   `json:"currency"`
+	PeriodStart time.Time                `json:"period_start"`
+	PeriodEnd   time.Time                `json:"period_end"`
+	LineItems   []models.InvoiceLineItem `json:"line_items"`
+}
+
+// CreateInvoice issues an open invoice for a user
+func (p *ManualProvider) CreateInvoice(ctx context.Context, userID uuid.UUID, input ManualInvoiceInput) (*models.Invoice, error) {
+	if input.Plan != "" && input.Plan != "pro" && input.Plan != "enterprise" {
+		return nil, ErrInvalidPlan
+	}
+	if len(input.LineItems) == 0 {
+		return nil, errors.New("at least one line item is required")
+	}
+	if !input.PeriodEnd.After(input.PeriodStart) {
+		return nil, errors.New("period_end must be after period_start")
+	}
+	if input.Currency == "" {
+		input.Currency = "usd"
+	}
+
+	inv := &models.Invoice{
+		ID:              uuid.New(),
+		UserID:          userID,
+		StripeInvoiceID: "manual_in_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		PaymentProvider: ProviderManual,
+		Plan:            input.Plan,
+		Currency:        strings.ToLower(input.Currency),
+		Status:          "open",
+		PeriodStart:     input.PeriodStart,
+		PeriodEnd:       input.PeriodEnd,
+		LineItems:       input.LineItems,
+		CreatedAt:       time.Now().UTC(),
+	}
+	for i, item := range inv.LineItems {
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		if item.Amount == 0 {
+			item.Amount = item.UnitAmount * item.Quantity
+		}
+		inv.LineItems[i] = item
+		inv.Subtotal += item.Amount
+		inv.Tax += item.Tax
+	}
+	inv.Amount = inv.Subtotal + inv.Tax
+
+	lineItems, err := json.Marshal(inv.LineItems)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.db.Pool().Exec(ctx, `
+		INSERT INTO invoices (id, user_id, stripe_invoice_id, payment_provider, plan, subtotal, tax, amount, currency, status,
+			period_start, period_end, line_items, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, inv.ID, inv.UserID, inv.StripeInvoiceID, inv.PaymentProvider, inv.Plan, inv.Subtotal, inv.Tax, inv.Amount,
+		inv.Currency, inv.Status, inv.PeriodStart, inv.PeriodEnd, lineItems, inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// MarkInvoicePaid settles an open manual invoice. apply is called with the
+// billing events of the payment, the start or renewal of the subscription
+// for plan invoices, while the invoice is locked. The invoice is only marked
+// paid once apply succeeds, so a failed license change can be retried.
+func (p *ManualProvider) MarkInvoicePaid(ctx context.Context, invoiceID uuid.UUID, apply func([]*BillingEvent) error) error {
+	tx, err := p.db.Pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rec := InvoiceRecord{Provider: ProviderManual}
+	var userID uuid.UUID
+	var lineItems []byte
+	var periodStart, periodEnd time.Time
+
+	err = tx.QueryRow(ctx, `
+		SELECT user_id, stripe_invoice_id, COALESCE(plan, ''), subtotal, tax, amount, currency, status,
+			period_start, period_end, line_items
+		FROM invoices WHERE id = $1 AND payment_provider = $2
+		FOR UPDATE
+	`, invoiceID, ProviderManual).Scan(&userID, &rec.StripeInvoiceID, &rec.Plan, &rec.Subtotal, &rec.Tax,
+		&rec.Amount, &rec.Currency, &rec.Status, &periodStart, &periodEnd, &lineItems)
+	if err == pgx.ErrNoRows {
+		return ErrInvoiceNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if rec.Status != "open" {
+		return ErrInvoiceNotOpen
+	}
+	if err := json.Unmarshal(lineItems, &rec.LineItems); err != nil {
+		return fmt.Errorf("failed to decode invoice line items: %w", err)
+	}
+	rec.PeriodStart = periodStart.Unix()
+	rec.PeriodEnd = periodEnd.Unix()
+
+	var events []*BillingEvent
+	if rec.Plan != "" {
+		// A paid plan invoice renews the current subscription if it is already
+		// on that plan, otherwise it starts one (and licensing upgrades the user).
+		subEvent := &BillingEvent{
+			Provider:       ProviderManual,
+			Type:           EventSubscriptionStarted,
+			UserID:         userID,
+			SubscriptionID: manualSubscriptionID(userID),
+			PriceID:        manualPriceID(rec.Plan),
+			Plan:           rec.Plan,
+			Status:         "active",
+			PeriodStart:    rec.PeriodStart,
+			PeriodEnd:      rec.PeriodEnd,
+		}
+
+		// It only renews when the plan's license was issued too: apply runs
+		// outside this transaction, so a payment whose license failed is
+		// retried as a start, and one whose license exists is not issued twice
+		var renewal bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM subscriptions s
+				JOIN licenses l ON l.user_id = s.user_id AND l.tier = s.plan
+					AND l.status = 'active' AND l.expires_at > NOW()
+				WHERE s.user_id = $1 AND s.plan = $2 AND s.payment_provider = $3
+					AND s.status IN ('active', 'trialing', 'past_due')
+			)
+		`, userID, rec.Plan, ProviderManual).Scan(&renewal)
+		if err != nil {
+			return err
+		}
+		if renewal {
+			subEvent.Type = EventSubscriptionUpdated
+		}
+		events = append(events, subEvent)
+	}
+
+	if err := apply(events); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE invoices SET status = 'paid' WHERE id = $1`, invoiceID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// VoidInvoice cancels an open manual invoice
+func (p *ManualProvider) VoidInvoice(ctx context.Context, invoiceID uuid.UUID) error {
+	result, err := p.db.Pool().Exec(ctx, `
+		UPDATE invoices SET status = 'void'
+		WHERE id = $1 AND payment_provider = $2 AND status = 'open'
+	`, invoiceID, ProviderManual)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrInvoiceNotOpen
+	}
+	return nil
+}
+
+// EndSubscription returns the cancellation event for a user's manual subscription
+func (p *ManualProvider) EndSubscription(ctx context.Context, userID uuid.UUID) (*BillingEvent, error) {
+	var subID string
+	var periodEnd time.Time
+	err := p.db.Pool().QueryRow(ctx, `
+		SELECT stripe_subscription_id, current_period_end FROM subscriptions
+		WHERE user_id = $1 AND payment_provider = $2 AND status IN ('active', 'trialing', 'past_due')
+	`, userID, ProviderManual).Scan(&subID, &periodEnd)
+	if err != nil {
+		return nil, ErrNoSubscription
+	}
+
+	return &BillingEvent{
+		Provider:       ProviderManual,
+		Type:           EventSubscriptionCanceled,
+		UserID:         userID,
+		SubscriptionID: subID,
+		Status:         "canceled",
+		PeriodEnd:      periodEnd.Unix(),
+	}, nil
+}
+
+// manual returns the registered manual invoicing provider
+func (s *BillingService) manual() (*ManualProvider, error) {
+	provider, err := s.Provider(ProviderManual)
+	if err != nil {
+		return nil, err
+	}
+	manual, ok := provider.(*ManualProvider)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return manual, nil
+}
+
+// CreateManualInvoice issues an open invoice to a user billed through manual invoicing
+func (s *BillingService) CreateManualInvoice(ctx context.Context, user *models.User, input ManualInvoiceInput) (*models.Invoice, error) {
+	if user.PaymentProvider != ProviderManual {
+		return nil, ErrNotSupportedByProvider
+	}
+	manual, err := s.manual()
+	if err != nil {
+		return nil, err
+	}
+	return manual.CreateInvoice(ctx, user.ID, input)
+}
+
+// MarkManualInvoicePaid settles a manual invoice once apply has applied the
+// resulting billing events
+func (s *BillingService) MarkManualInvoicePaid(ctx context.Context, invoiceID uuid.UUID, apply func([]*BillingEvent) error) error {
+	manual, err := s.manual()
+	if err != nil {
+		return err
+	}
+	return manual.MarkInvoicePaid(ctx, invoiceID, apply)
+}
+
+// VoidManualInvoice cancels an open manual invoice
+func (s *BillingService) VoidManualInvoice(ctx context.Context, invoiceID uuid.UUID) error {
+	manual, err := s.manual()
+	if err != nil {
+		return err
+	}
+	return manual.VoidInvoice(ctx, invoiceID)
+}
+
+// EndManualSubscription returns the cancellation event for a user's manual subscription
+func (s *BillingService) EndManualSubscription(ctx context.Context, userID uuid.UUID) (*BillingEvent, error) {
+	manual, err := s.manual()
+	if err != nil {
+		return nil, err
+	}
+	return manual.EndSubscription(ctx, userID)
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestManualProvider_Unsupported(t *testing.T) {
+	provider := NewManualProvider(nil)
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New(), Email: "ap@acme.example"}
+
+	_, err := provider.CreateCheckoutSession(ctx, user, "pro", "https://ok", "https://cancel")
+	assert.Equal(t, ErrNotSupportedByProvider, err)
+
+	_, err = provider.CreatePortalSession(ctx, "manual_cus_1", "https://return")
+	assert.Equal(t, ErrNotSupportedByProvider, err)
+
+	_, err = provider.ParseWebhook([]byte(`{}`), "sig")
+	assert.Equal(t, ErrNotSupportedByProvider, err)
+}
+
+func TestManualProvider_CustomerAndPlan(t *testing.T) {
+	provider := NewManualProvider(nil)
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New()}
+
+	customerID, err := provider.CreateCustomer(ctx, user, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "manual_cus_"+user.ID.String(), customerID)
+
+	sub, err := provider.ChangePlan(ctx, "manual_sub_1", "enterprise")
+	assert.NoError(t, err)
+	assert.Equal(t, "manual_enterprise", sub.PriceID)
+
+	_, err = provider.ChangePlan(ctx, "manual_sub_1", "gold")
+	assert.Equal(t, ErrInvalidPlan, err)
+}
+
+func TestManualProvider_CreateInvoiceValidation(t *testing.T) {
+	provider := NewManualProvider(nil)
+	ctx := context.Background()
+
+	_, err := provider.CreateInvoice(ctx, uuid.New(), ManualInvoiceInput{Plan: "gold"})
+	assert.Equal(t, ErrInvalidPlan, err)
+
+	_, err = provider.CreateInvoice(ctx, uuid.New(), ManualInvoiceInput{Plan: "pro"})
+	assert.Error(t, err)
+}
+
+func TestBillingService_Providers(t *testing.T) {
+	service := NewBillingService("test_key", "test_webhook")
+
+	provider, err := service.Provider("")
+	assert.NoError(t, err)
+	assert.Equal(t, ProviderStripe, provider.Name())
+
+	_, err = service.Provider(ProviderManual)
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	service.RegisterProvider(NewManualProvider(nil))
+	provider, err = service.Provider(ProviderManual)
+	assert.NoError(t, err)
+	assert.Equal(t, ProviderManual, provider.Name())
+
+	_, ok := provider.(PaymentMethodProvider)
+	assert.False(t, ok, "manual invoicing keeps no payment methods on file")
+
+	// Manual customers have no cards; listing returns an empty set
+	methods, err := service.ListPaymentMethods(context.Background(), &models.User{PaymentProvider: ProviderManual})
+	assert.NoError(t, err)
+	assert.Empty(t, methods)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v76"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+// Payment provider names, stored in users.payment_provider
+const (
+	ProviderStripe = "stripe"
+	ProviderManual = "manual"
+)
+
+var (
+	ErrUnknownProvider        = errors.New("unknown payment provider")
+	ErrNotSupportedByProvider = errors.New("operation not supported by payment provider")
+)
+
+// BillingEventType is a provider-neutral billing event
+type BillingEventType string
+
+const (
+	// EventSubscriptionStarted fires when a customer starts paying for a plan
+	EventSubscriptionStarted BillingEventType = "subscription.started"
+	// EventSubscriptionUpdated fires when status or renewal settings change
+	EventSubscriptionUpdated BillingEventType = "subscription.updated"
+	// EventSubscriptionCanceled fires when a subscription has ended
+	EventSubscriptionCanceled BillingEventType = "subscription.canceled"
+	// EventInvoicePaid fires when an invoice has been settled
+	EventInvoicePaid BillingEventType = "invoice.paid"
+	// EventInvoicePaymentFailed fires when collecting an invoice failed
+	EventInvoicePaymentFailed BillingEventType = "invoice.payment_failed"
+)
+
+// BillingEvent is what providers report back, normalized so that licensing
+// reacts the same way regardless of who collected the money.
+type BillingEvent struct {
+	Provider          string
+	Type              BillingEventType
+	UserID            uuid.UUID // set when the provider knows our user ID
+	CustomerID        string    // provider customer ID, used when UserID is unknown
+	SubscriptionID    string
+	PriceID           string
+	Plan              string
+	Status            string
+	CancelAtPeriodEnd bool
+	PeriodStart       int64
+	PeriodEnd         int64
+	InvoiceURL        string
+	Invoice           *InvoiceRecord
+}
+
+// ProviderSubscription is the provider-side state of a subscription after a change
+type ProviderSubscription struct {
+	ID        string
+	PriceID   string
+	PeriodEnd int64
+}
+
+// PaymentProvider is implemented by every billing backend (Stripe, manual invoicing, ...)
+type PaymentProvider interface {
+	// Name returns the provider name stored on users, subscriptions and invoices
+	Name() string
+	// CreateCustomer registers the user with the provider and returns its customer ID.
+	// profile is nil when the user has not filled in a billing profile.
+	CreateCustomer(ctx context.Context, user *models.User, profile *models.BillingProfile) (string, error)
+	// UpdateCustomer pushes billing profile changes to the provider
+	UpdateCustomer(ctx context.Context, user *models.User, profile *models.BillingProfile) error
+	// CreateCheckoutSession returns a URL where the user can start a subscription
+	CreateCheckoutSession(ctx context.Context, user *models.User, plan, successURL, cancelURL string) (string, error)
+	// SetCancelAtPeriodEnd schedules or unschedules cancellation of a subscription
+	SetCancelAtPeriodEnd(ctx context.Context, subscriptionID string, cancel bool) error
+	// ChangePlan moves a subscription to another plan
+	ChangePlan(ctx context.Context, subscriptionID, plan string) (*ProviderSubscription, error)
+	// CreatePortalSession returns a URL to the provider's self-service portal
+	CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error)
+	// ParseWebhook verifies a webhook and converts it into a billing event.
+	// It returns a nil event for webhooks that need no action.
+	ParseWebhook(payload []byte, signature string) (*BillingEvent, error)
+}
+
+// PaymentMethodProvider is implemented by providers that store cards on file
+type PaymentMethodProvider interface {
+	ListPaymentMethods(ctx context.Context, customerID string) ([]*stripe.PaymentMethod, error)
+	AttachPaymentMethod(ctx context.Context, customerID, paymentMethodID string) error
+	DetachPaymentMethod(ctx context.Context, paymentMethodID string) error
+	SetDefaultPaymentMethod(ctx context.Context, customerID, paymentMethodID string) error
+	CreateSetupIntent(ctx context.Context, customerID string) (string, error)
+}
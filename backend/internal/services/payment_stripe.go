@@ -0,0 +1,478 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v76"
+	portalsession "github.com/stripe/stripe-go/v76/billingportal/session"
+	checkoutsession "github.com/stripe/stripe-go/v76/checkout/session"
+	"github.com/stripe/stripe-go/v76/customer"
+	"github.com/stripe/stripe-go/v76/paymentmethod"
+	"github.com/stripe/stripe-go/v76/setupintent"
+	"github.com/stripe/stripe-go/v76/subscription"
+	"github.com/stripe/stripe-go/v76/taxid"
+	"github.com/stripe/stripe-go/v76/webhook"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+// StripeProvider implements PaymentProvider on top of Stripe Billing
+type StripeProvider struct {
+	webhookSecret     string
+	proPriceID        string
+	enterprisePriceID string
+}
+
+// NewStripeProvider creates a Stripe payment provider
+func NewStripeProvider(secretKey, webhookSecret string) *StripeProvider {
+	stripe.Key = secretKey
+	return &StripeProvider{
+		webhookSecret: webhookSecret,
+	}
+}
+
+// Name returns the provider name
+func (p *StripeProvider) Name() string {
+	return ProviderStripe
+}
+
+// SetPriceIDs sets the Stripe price IDs for subscription plans
+func (p *StripeProvider) SetPriceIDs(proPriceID, enterprisePriceID string) {
+	p.proPriceID = proPriceID
+	p.enterprisePriceID = enterprisePriceID
+}
+
+func (p *StripeProvider) getPriceID(plan string) string {
+	switch plan {
+	case "pro":
+		return p.proPriceID
+	case "enterprise":
+		return p.enterprisePriceID
+	default:
+		return ""
+	}
+}
+
+// GetPlanFromPriceID returns the plan name for a Stripe price ID
+func (p *StripeProvider) GetPlanFromPriceID(priceID string) string {
+	switch priceID {
+	case p.proPriceID:
+		return "pro"
+	case p.enterprisePriceID:
+		return "enterprise"
+	default:
+		return "unknown"
+	}
+}
+
+// CreateCustomer creates a Stripe customer, using the billing profile for the
+// invoiced name, address and tax IDs when one exists
+func (p *StripeProvider) CreateCustomer(ctx context.Context, user *models.User, profile *models.BillingProfile) (string, error) {
+	params := &stripe.CustomerParams{
+		Email: stripe.String(user.Email),
+		Name:  stripe.String(user.Name),
+		Metadata: map[string]string{
+			"user_id": user.ID.String(),
+		},
+	}
+
+	if profile != nil {
+		params = customerParamsFromProfile(profile, user.Email)
+		for _, id := range profile.TaxIDs {
+			params.TaxIDData = append(params.TaxIDData, &stripe.CustomerTaxIDDataParams{
+				Type:  stripe.String(id.Type),
+				Value: stripe.String(id.Value),
+			})
+		}
+	}
+
+	c, err := customer.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Stripe customer: %w", err)
+	}
+
+	return c.ID, nil
+}
+
+// UpdateCustomer pushes a billing profile to the Stripe customer, reconciling
+// the customer's tax IDs with the ones on the profile
+func (p *StripeProvider) UpdateCustomer(ctx context.Context, user *models.User, profile *models.BillingProfile) error {
+	stripeCustomerID := user.StripeCustomerID
+	if _, err := customer.Update(stripeCustomerID, customerParamsFromProfile(profile, user.Email)); err != nil {
+		return fmt.Errorf("failed to update Stripe customer: %w", err)
+	}
+
+	wanted := make(map[string]models.TaxID, len(profile.TaxIDs))
+	for _, id := range profile.TaxIDs {
+		wanted[id.Type+":"+id.Value] = id
+	}
+
+	iter := taxid.List(&stripe.TaxIDListParams{Customer: stripe.String(stripeCustomerID)})
+	for iter.Next() {
+		existing := iter.TaxID()
+		key := string(existing.Type) + ":" + existing.Value
+		if _, ok := wanted[key]; ok {
+			delete(wanted, key)
+			continue
+		}
+		if _, err := taxid.Del(existing.ID, &stripe.TaxIDParams{Customer: stripe.String(stripeCustomerID)}); err != nil {
+			return fmt.Errorf("failed to remove Stripe tax ID: %w", err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to list Stripe tax IDs: %w", err)
+	}
+
+	for _, id := range wanted {
+		_, err := taxid.New(&stripe.TaxIDParams{
+			Customer: stripe.String(stripeCustomerID),
+			Type:     stripe.String(id.Type),
+			Value:    stripe.String(id.Value),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add Stripe tax ID: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// customerParamsFromProfile builds Stripe customer params from a billing profile.
+// Stripe sends invoices to the customer email, so the first invoice recipient
+// takes that slot (falling back to the login email) and the rest are kept in metadata.
+func customerParamsFromProfile(profile *models.BillingProfile, loginEmail string) *stripe.CustomerParams {
+	params := &stripe.CustomerParams{
+		Name:  stripe.String(profile.LegalName),
+		Email: stripe.String(loginEmail),
+		Address: &stripe.AddressParams{
+			Line1:      stripe.String(profile.AddressLine1),
+			Line2:      stripe.String(profile.AddressLine2),
+			City:       stripe.String(profile.City),
+			State:      stripe.String(profile.State),
+			PostalCode: stripe.String(profile.PostalCode),
+			Country:    stripe.String(profile.Country),
+		},
+		Metadata: map[string]string{
+			"user_id":    profile.UserID.String(),
+			"invoice_cc": "",
+		},
+	}
+
+	if len(profile.InvoiceEmails) > 0 {
+		params.Email = stripe.String(profile.InvoiceEmails[0])
+		params.Metadata["invoice_cc"] = strings.Join(profile.InvoiceEmails[1:], ",")
+	}
+
+	return params
+}
+
+// CreateCheckoutSession creates a Stripe checkout session for subscription
+func (p *StripeProvider) CreateCheckoutSession(ctx context.Context, user *models.User, plan, successURL, cancelURL string) (string, error) {
+	priceID := p.getPriceID(plan)
+	if priceID == "" {
+		return "", ErrInvalidPlan
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		Customer: stripe.String(user.StripeCustomerID),
+		Mode:     stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(priceID),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		SuccessURL: stripe.String(successURL),
+		CancelURL:  stripe.String(cancelURL),
+		Metadata: map[string]string{
+			"user_id": user.ID.String(),
+			"plan":    plan,
+		},
+	}
+
+	sess, err := checkoutsession.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checkout session: %w", err)
+	}
+
+	return sess.URL, nil
+}
+
+// SetCancelAtPeriodEnd schedules or unschedules cancellation of a Stripe subscription
+func (p *StripeProvider) SetCancelAtPeriodEnd(ctx context.Context, subscriptionID string, cancel bool) error {
+	params := &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(cancel),
+	}
+
+	if _, err := subscription.Update(subscriptionID, params); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	return nil
+}
+
+// ChangePlan swaps the price on a Stripe subscription, prorating the difference
+func (p *StripeProvider) ChangePlan(ctx context.Context, subscriptionID, plan string) (*ProviderSubscription, error) {
+	newPriceID := p.getPriceID(plan)
+	if newPriceID == "" {
+		return nil, ErrInvalidPlan
+	}
+
+	stripeSub, err := subscription.Get(subscriptionID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Stripe subscription: %w", err)
+	}
+
+	if len(stripeSub.Items.Data) == 0 {
+		return nil, errors.New("subscription has no items")
+	}
+
+	params := &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(stripeSub.Items.Data[0].ID),
+				Price: stripe.String(newPriceID),
+			},
+		},
+		ProrationBehavior: stripe.String(string(stripe.SubscriptionSchedulePhaseProrationBehaviorCreateProrations)),
+	}
+
+	updatedSub, err := subscription.Update(subscriptionID, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	return &ProviderSubscription{
+		ID:        updatedSub.ID,
+		PriceID:   newPriceID,
+		PeriodEnd: updatedSub.CurrentPeriodEnd,
+	}, nil
+}
+
+// CreatePortalSession creates a Stripe billing portal session
+func (p *StripeProvider) CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error) {
+	params := &stripe.BillingPortalSessionParams{
+		Customer:  stripe.String(customerID),
+		ReturnURL: stripe.String(returnURL),
+	}
+
+	sess, err := portalsession.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create portal session: %w", err)
+	}
+
+	return sess.URL, nil
+}
+
+// ParseWebhook verifies a Stripe webhook and converts it into a billing event
+func (p *StripeProvider) ParseWebhook(payload []byte, signature string) (*BillingEvent, error) {
+	event, err := webhook.ConstructEvent(payload, signature, p.webhookSecret)
+	if err != nil {
+		return nil, ErrInvalidWebhook
+	}
+	return billingEventFromStripe(&event)
+}
+
+// billingEventFromStripe maps the Stripe events we act on to billing events
+func billingEventFromStripe(event *stripe.Event) (*BillingEvent, error) {
+	switch event.Type {
+	case "checkout.session.completed":
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, fmt.Errorf("failed to parse checkout session: %w", err)
+		}
+
+		userID, err := uuid.Parse(session.Metadata["user_id"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id in checkout session metadata: %w", err)
+		}
+		if session.Subscription == nil {
+			return nil, errors.New("no subscription in checkout session")
+		}
+
+		plan := session.Metadata["plan"]
+		if plan == "" {
+			plan = "pro"
+		}
+
+		ev := &BillingEvent{
+			Provider:       ProviderStripe,
+			Type:           EventSubscriptionStarted,
+			UserID:         userID,
+			SubscriptionID: session.Subscription.ID,
+			Plan:           plan,
+			Status:         "active",
+			PeriodStart:    session.Subscription.CurrentPeriodStart,
+			PeriodEnd:      session.Subscription.CurrentPeriodEnd,
+		}
+		if session.Customer != nil {
+			ev.CustomerID = session.Customer.ID
+		}
+		if session.LineItems != nil && len(session.LineItems.Data) > 0 && session.LineItems.Data[0].Price != nil {
+			ev.PriceID = session.LineItems.Data[0].Price.ID
+		}
+		if session.Invoice != nil {
+			ev.InvoiceURL = session.Invoice.HostedInvoiceURL
+		}
+		return ev, nil
+
+	case "customer.subscription.updated", "customer.subscription.deleted":
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return nil, fmt.Errorf("failed to parse subscription: %w", err)
+		}
+
+		ev := &BillingEvent{
+			Provider:          ProviderStripe,
+			Type:              EventSubscriptionUpdated,
+			SubscriptionID:    sub.ID,
+			Status:            string(sub.Status),
+			CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+			PeriodStart:       sub.CurrentPeriodStart,
+			PeriodEnd:         sub.CurrentPeriodEnd,
+		}
+		if event.Type == "customer.subscription.deleted" {
+			ev.Type = EventSubscriptionCanceled
+		}
+		if sub.Customer != nil {
+			ev.CustomerID = sub.Customer.ID
+		}
+		return ev, nil
+
+	case "invoice.paid", "invoice.payment_failed":
+		var invoice stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+			return nil, fmt.Errorf("failed to parse invoice: %w", err)
+		}
+		if invoice.Customer == nil {
+			return nil, errors.New("no customer in invoice")
+		}
+
+		rec := InvoiceRecordFromStripe(&invoice)
+		ev := &BillingEvent{
+			Provider:   ProviderStripe,
+			Type:       EventInvoicePaid,
+			CustomerID: invoice.Customer.ID,
+			InvoiceURL: invoice.HostedInvoiceURL,
+			Invoice:    &rec,
+		}
+		if event.Type == "invoice.payment_failed" {
+			ev.Type = EventInvoicePaymentFailed
+		}
+		return ev, nil
+	}
+
+	return nil, nil
+}
+
+// InvoiceRecordFromStripe converts a Stripe invoice into an InvoiceRecord,
+// including per-line tax amounts.
+func InvoiceRecordFromStripe(inv *stripe.Invoice) InvoiceRecord {
+	rec := InvoiceRecord{
+		Provider:        ProviderStripe,
+		StripeInvoiceID: inv.ID,
+		Subtotal:        inv.Subtotal,
+		Tax:             inv.Tax,
+		Amount:          inv.AmountPaid,
+		Currency:        string(inv.Currency),
+		Status:          string(inv.Status),
+		InvoiceURL:      inv.HostedInvoiceURL,
+		InvoicePDF:      inv.InvoicePDF,
+		PeriodStart:     inv.PeriodStart,
+		PeriodEnd:       inv.PeriodEnd,
+		LineItems:       []models.InvoiceLineItem{},
+	}
+
+	if inv.Lines == nil {
+		return rec
+	}
+	for _, line := range inv.Lines.Data {
+		item := models.InvoiceLineItem{
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			UnitAmount:  int64(line.UnitAmountExcludingTax),
+			Amount:      line.AmountExcludingTax,
+		}
+		for _, t := range line.TaxAmounts {
+			item.Tax += t.Amount
+		}
+		if line.Period != nil {
+			start := time.Unix(line.Period.Start, 0)
+			end := time.Unix(line.Period.End, 0)
+			item.PeriodStart = &start
+			item.PeriodEnd = &end
+		}
+		rec.LineItems = append(rec.LineItems, item)
+	}
+	return rec
+}
+
+// ListPaymentMethods returns card payment methods for a customer
+func (p *StripeProvider) ListPaymentMethods(ctx context.Context, customerID string) ([]*stripe.PaymentMethod, error) {
+	params := &stripe.PaymentMethodListParams{
+		Customer: stripe.String(customerID),
+		Type:     stripe.String("card"),
+	}
+
+	methods := make([]*stripe.PaymentMethod, 0)
+	iter := paymentmethod.List(params)
+	for iter.Next() {
+		methods = append(methods, iter.PaymentMethod())
+	}
+
+	return methods, iter.Err()
+}
+
+// AttachPaymentMethod attaches a payment method to a customer
+func (p *StripeProvider) AttachPaymentMethod(ctx context.Context, customerID, paymentMethodID string) error {
+	params := &stripe.PaymentMethodAttachParams{
+		Customer: stripe.String(customerID),
+	}
+
+	if _, err := paymentmethod.Attach(paymentMethodID, params); err != nil {
+		return fmt.Errorf("failed to attach payment method: %w", err)
+	}
+	return nil
+}
+
+// DetachPaymentMethod removes a payment method from a customer
+func (p *StripeProvider) DetachPaymentMethod(ctx context.Context, paymentMethodID string) error {
+	if _, err := paymentmethod.Detach(paymentMethodID, nil); err != nil {
+		return fmt.Errorf("failed to detach payment method: %w", err)
+	}
+	return nil
+}
+
+// SetDefaultPaymentMethod sets the default payment method for a customer
+func (p *StripeProvider) SetDefaultPaymentMethod(ctx context.Context, customerID, paymentMethodID string) error {
+	params := &stripe.CustomerParams{
+		InvoiceSettings: &stripe.CustomerInvoiceSettingsParams{
+			DefaultPaymentMethod: stripe.String(paymentMethodID),
+		},
+	}
+
+	if _, err := customer.Update(customerID, params); err != nil {
+		return fmt.Errorf("failed to set default payment method: %w", err)
+	}
+	return nil
+}
+
+// CreateSetupIntent creates a SetupIntent for adding a new payment method via Stripe.js
+func (p *StripeProvider) CreateSetupIntent(ctx context.Context, customerID string) (string, error) {
+	params := &stripe.SetupIntentParams{
+		Customer:           stripe.String(customerID),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+	}
+
+	intent, err := setupintent.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create setup intent: %w", err)
+	}
+
+	return intent.ClientSecret, nil
+}
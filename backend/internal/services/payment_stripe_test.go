@@ -0,0 +1,189 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/stripe-go/v76"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestCustomerParamsFromProfile(t *testing.T) {
+	profile := &models.BillingProfile{
+		UserID:        uuid.New(),
+		LegalName:     "Acme Inc",
+		AddressLine1:  "1 Main St",
+		City:          "Springfield",
+		PostalCode:    "12345",
+		Country:       "US",
+		InvoiceEmails: []string{"ap@acme.example", "cfo@acme.example"},
+	}
+
+	params := customerParamsFromProfile(profile, "owner@acme.example")
+	assert.Equal(t, "Acme Inc", *params.Name)
+	assert.Equal(t, "ap@acme.example", *params.Email)
+	assert.Equal(t, "cfo@acme.example", params.Metadata["invoice_cc"])
+	assert.Equal(t, "US", *params.Address.Country)
+
+	profile.InvoiceEmails = nil
+	params = customerParamsFromProfile(profile, "owner@acme.example")
+	assert.Equal(t, "owner@acme.example", *params.Email)
+	assert.Equal(t, "", params.Metadata["invoice_cc"])
+}
+
+func TestInvoiceRecordFromStripe(t *testing.T) {
+	inv := &stripe.Invoice{
+		ID:               "in_123",
+		Subtotal:         10000,
+		Tax:              1900,
+		AmountPaid:       11900,
+		Currency:         stripe.CurrencyEUR,
+		Status:           stripe.InvoiceStatusPaid,
+		HostedInvoiceURL: "https://invoice.stripe.com/i/123",
+		Lines: &stripe.InvoiceLineItemList{
+			Data: []*stripe.InvoiceLineItem{
+				{
+					Description:            "Pro plan",
+					Quantity:               1,
+					AmountExcludingTax:     10000,
+					UnitAmountExcludingTax: 10000,
+					TaxAmounts:             []*stripe.InvoiceTotalTaxAmount{{Amount: 1900}},
+					Period:                 &stripe.Period{Start: 1700000000, End: 1702592000},
+				},
+			},
+		},
+	}
+
+	rec := InvoiceRecordFromStripe(inv)
+	assert.Equal(t, "in_123", rec.StripeInvoiceID)
+	assert.Equal(t, int64(10000), rec.Subtotal)
+	assert.Equal(t, int64(1900), rec.Tax)
+	assert.Equal(t, int64(11900), rec.Amount)
+	assert.Equal(t, "eur", rec.Currency)
+	assert.Len(t, rec.LineItems, 1)
+	assert.Equal(t, int64(1900), rec.LineItems[0].Tax)
+	assert.Equal(t, int64(10000), rec.LineItems[0].UnitAmount)
+	assert.NotNil(t, rec.LineItems[0].PeriodStart)
+
+	rec = InvoiceRecordFromStripe(&stripe.Invoice{ID: "in_456"})
+	assert.NotNil(t, rec.LineItems)
+	assert.Empty(t, rec.LineItems)
+}
+
+func stripeEvent(t *testing.T, eventType string, obj interface{}) *stripe.Event {
+	raw, err := json.Marshal(obj)
+	assert.NoError(t, err)
+	return &stripe.Event{
+		Type: stripe.EventType(eventType),
+		Data: &stripe.EventData{Raw: raw},
+	}
+}
+
+func TestBillingEventFromStripe(t *testing.T) {
+	userID := uuid.New()
+
+	t.Run("checkout completed starts subscription", func(t *testing.T) {
+		event := stripeEvent(t, "checkout.session.completed", map[string]interface{}{
+			"id":           "cs_123",
+			"customer":     "cus_123",
+			"subscription": "sub_123",
+			"metadata":     map[string]string{"user_id": userID.String(), "plan": "enterprise"},
+		})
+
+		ev, err := billingEventFromStripe(event)
+		assert.NoError(t, err)
+		assert.Equal(t, EventSubscriptionStarted, ev.Type)
+		assert.Equal(t, ProviderStripe, ev.Provider)
+		assert.Equal(t, userID, ev.UserID)
+		assert.Equal(t, "cus_123", ev.CustomerID)
+		assert.Equal(t, "sub_123", ev.SubscriptionID)
+		assert.Equal(t, "enterprise", ev.Plan)
+	})
+
+	t.Run("checkout defaults to pro plan", func(t *testing.T) {
+		event := stripeEvent(t, "checkout.session.completed", map[string]interface{}{
+			"subscription": "sub_123",
+			"metadata":     map[string]string{"user_id": userID.String()},
+		})
+
+		ev, err := billingEventFromStripe(event)
+		assert.NoError(t, err)
+		assert.Equal(t, "pro", ev.Plan)
+	})
+
+	t.Run("checkout without user id fails", func(t *testing.T) {
+		event := stripeEvent(t, "checkout.session.completed", map[string]interface{}{
+			"subscription": "sub_123",
+		})
+
+		_, err := billingEventFromStripe(event)
+		assert.Error(t, err)
+	})
+
+	t.Run("subscription updated", func(t *testing.T) {
+		event := stripeEvent(t, "customer.subscription.updated", map[string]interface{}{
+			"id":                   "sub_123",
+			"customer":             "cus_123",
+			"status":               "past_due",
+			"cancel_at_period_end": true,
+		})
+
+		ev, err := billingEventFromStripe(event)
+		assert.NoError(t, err)
+		assert.Equal(t, EventSubscriptionUpdated, ev.Type)
+		assert.Equal(t, "past_due", ev.Status)
+		assert.True(t, ev.CancelAtPeriodEnd)
+		assert.Equal(t, "cus_123", ev.CustomerID)
+	})
+
+	t.Run("subscription deleted", func(t *testing.T) {
+		event := stripeEvent(t, "customer.subscription.deleted", map[string]interface{}{
+			"id":       "sub_123",
+			"customer": "cus_123",
+		})
+
+		ev, err := billingEventFromStripe(event)
+		assert.NoError(t, err)
+		assert.Equal(t, EventSubscriptionCanceled, ev.Type)
+	})
+
+	t.Run("invoice paid carries invoice record", func(t *testing.T) {
+		event := stripeEvent(t, "invoice.paid", map[string]interface{}{
+			"id":          "in_123",
+			"customer":    "cus_123",
+			"amount_paid": 9900,
+			"currency":    "usd",
+			"status":      "paid",
+		})
+
+		ev, err := billingEventFromStripe(event)
+		assert.NoError(t, err)
+		assert.Equal(t, EventInvoicePaid, ev.Type)
+		assert.NotNil(t, ev.Invoice)
+		assert.Equal(t, "in_123", ev.Invoice.StripeInvoiceID)
+		assert.Equal(t, int64(9900), ev.Invoice.Amount)
+		assert.Equal(t, ProviderStripe, ev.Invoice.Provider)
+	})
+
+	t.Run("payment failed", func(t *testing.T) {
+		event := stripeEvent(t, "invoice.payment_failed", map[string]interface{}{
+			"id":       "in_123",
+			"customer": "cus_123",
+		})
+
+		ev, err := billingEventFromStripe(event)
+		assert.NoError(t, err)
+		assert.Equal(t, EventInvoicePaymentFailed, ev.Type)
+	})
+
+	t.Run("unhandled event types are ignored", func(t *testing.T) {
+		event := stripeEvent(t, "customer.created", map[string]interface{}{"id": "cus_123"})
+
+		ev, err := billingEventFromStripe(event)
+		assert.NoError(t, err)
+		assert.Nil(t, ev)
+	})
+}
@@ -20,7 +20,8 @@ var (
 
 // PipelineService handles pipeline management
 type PipelineService struct {
-	db *repository.PostgresDB
+	db           *repository.PostgresDB
+	eventService *EventService
 }
 
 // NewPipelineService creates a new pipeline service
@@ -28,15 +29,24 @@ func NewPipelineService(db *repository.PostgresDB) *PipelineService {
 	return &PipelineService{db: db}
 }
 
+// SetEventService enables dashboard stream events for pipeline stats and logs
+func (s *PipelineService) SetEventService(eventService *EventService) {
+	s.eventService = eventService
+}
+
 // CreatePipeline creates a new pipeline
 func (s *PipelineService) CreatePipeline(ctx context.Context, userID uuid.UUID, pipeline *models.Pipeline) (*models.Pipeline, error) {
+	return s.createPipeline(ctx, s.db.Pool(), userID, pipeline)
+}
+
+func (s *PipelineService) createPipeline(ctx context.Context, q querier, userID uuid.UUID, pipeline *models.Pipeline) (*models.Pipeline, error) {
 	pipeline.ID = uuid.New()
 	pipeline.UserID = userID
 	pipeline.Status = "created"
 	pipeline.CreatedAt = time.Now().UTC()
 	pipeline.UpdatedAt = pipeline.CreatedAt
 
-	_, err := s.db.Pool().Exec(ctx, `
+	_, err := q.Exec(ctx, `
 		INSERT INTO pipelines (id, user_id, name, description, source_connection_id, target_connection_id, target_type, target_config, tables, status, license_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`, pipeline.ID, pipeline.UserID, pipeline.Name, pipeline.Description, pipeline.SourceConnID,
@@ -158,9 +168,8 @@ func (s *PipelineService) UpdatePipeline(ctx context.Context, userID, pipelineID
 		p.TargetType = targetType
 	}
 	if targetConfig, ok := updates["target_config"].(map[string]interface{}); ok {
-		p.TargetConfig = make(map[string]string)
-		for k, v := range targetConfig {
-			p.TargetConfig[k] = fmt.Sprintf("%v", v)
+		if p.TargetConfig, err = TargetConfigValues(targetConfig); err != nil {
+			return nil, err
 		}
 	}
 
@@ -185,13 +194,68 @@ func (s *PipelineService) UpdatePipelineStatus(ctx context.Context, pipelineID u
 	return err
 }
 
-// UpdatePipelineStats updates runtime statistics from telemetry
-func (s *PipelineService) UpdatePipelineStats(ctx context.Context, pipelineID uuid.UUID, eventsProcessed, bytesProcessed, lagMs int64) error {
-	_, err := s.db.Pool().Exec(ctx, `
-		UPDATE pipelines SET events_processed = $1, bytes_processed = $2, current_lag_ms = $3, last_event_at = $4, updated_at = $5
-		WHERE id = $6
-	`, eventsProcessed, bytesProcessed, lagMs, time.Now().UTC(), time.Now().UTC(), pipelineID)
-	return err
+// Pipeline states an engine may report in telemetry
+var reportablePipelineStates = map[string]bool{
+	"running": true,
+	"paused":  true,
+	"stopped": true,
+	"error":   true,
+}
+
+// PipelineStatsUpdate holds runtime statistics reported by an engine for one pipeline
+type PipelineStatsUpdate struct {
+	PipelineID      uuid.UUID
+	LicenseID       uuid.UUID
+	HardwareID      string
+	EventsProcessed int64 // processed since the previous report
+	BytesProcessed  int64 // processed since the previous report
+	LagMs           int64
+	LastEventAt     *time.Time
+	State           string
+	ErrorMessage    string
+}
+
+// UpdatePipelineStats updates runtime statistics from telemetry within tx. The
+// pipeline must belong to the owner of the reporting license; it is bound to
+// the reporting instance. The returned event is for PublishPipelineStats once
+// tx has committed.
+func (s *PipelineService) UpdatePipelineStats(ctx context.Context, tx pgx.Tx, u PipelineStatsUpdate) (uuid.UUID, *PipelineStatsEvent, error) {
+	var state *string
+	if reportablePipelineStates[u.State] {
+		state = &u.State
+	}
+
+	var userID uuid.UUID
+	ev := &PipelineStatsEvent{PipelineID: u.PipelineID}
+	err := tx.QueryRow(ctx, `
+		UPDATE pipelines p SET
+			events_processed = p.events_processed + $1,
+			bytes_processed = p.bytes_processed + $2,
+			current_lag_ms = $3,
+			last_event_at = GREATEST(p.last_event_at, $4),
+			status = COALESCE($5::text, p.status),
+			error_message = CASE WHEN $5::text IS NULL THEN p.error_message ELSE NULLIF($6, '') END,
+			license_id = l.id,
+			hardware_id = $7,
+			updated_at = $8
+		FROM licenses l
+		WHERE p.id = $9 AND l.id = $10 AND p.user_id = l.user_id
+		RETURNING p.user_id, p.status, p.events_processed, p.bytes_processed, p.current_lag_ms, p.last_event_at
+	`, u.EventsProcessed, u.BytesProcessed, u.LagMs, u.LastEventAt, state, u.ErrorMessage,
+		u.HardwareID, time.Now().UTC(), u.PipelineID, u.LicenseID).Scan(
+		&userID, &ev.Status, &ev.EventsProcessed, &ev.BytesProcessed, &ev.CurrentLagMs, &ev.LastEventAt)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, nil, ErrPipelineNotFound
+	}
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	return userID, ev, nil
+}
+
+// PublishPipelineStats notifies the pipeline owner's dashboards of new stats
+func (s *PipelineService) PublishPipelineStats(ctx context.Context, userID uuid.UUID, ev *PipelineStatsEvent) {
+	s.eventService.Publish(ctx, userID, EventPipelineStats, ev)
 }
 
 // DeletePipeline deletes a pipeline
@@ -248,11 +312,27 @@ func (s *PipelineService) GetPipelineLogs(ctx context.Context, userID, pipelineI
 
 // AddPipelineLog adds a log entry for a pipeline
 func (s *PipelineService) AddPipelineLog(ctx context.Context, pipelineID uuid.UUID, level, message string, details map[string]interface{}) error {
-	_, err := s.db.Pool().Exec(ctx, `
+	entry := models.PipelineLog{
+		ID:         uuid.New(),
+		PipelineID: pipelineID,
+		Level:      level,
+		Message:    message,
+		Details:    details,
+		Timestamp:  time.Now().UTC(),
+	}
+
+	var userID uuid.UUID
+	err := s.db.Pool().QueryRow(ctx, `
 		INSERT INTO pipeline_logs (id, pipeline_id, level, message, details, timestamp)
 		VALUES ($1, $2, $3, $4, $5, $6)
-	`, uuid.New(), pipelineID, level, message, details, time.Now().UTC())
-	return err
+		RETURNING (SELECT user_id FROM pipelines WHERE id = $2)
+	`, entry.ID, entry.PipelineID, entry.Level, entry.Message, entry.Details, entry.Timestamp).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	s.eventService.Publish(ctx, userID, EventPipelineLog, entry)
+	return nil
 }
 
 // GetPipelineMetrics retrieves metrics for a pipeline
@@ -269,7 +349,8 @@ func (s *PipelineService) GetPipelineMetrics(ctx context.Context, userID, pipeli
 			SUM(t.events_processed) as events,
 			SUM(t.bytes_processed) as bytes,
 			AVG(t.avg_latency_ms) as latency,
-			SUM(t.error_count) as errors
+			SUM(t.error_count) as errors,
+			MAX(t.lag_ms) as lag
 		FROM telemetry t
 		WHERE t.pipeline_id = $1 AND t.timestamp > NOW() - ($2 || ' hours')::INTERVAL
 		GROUP BY hour
@@ -283,9 +364,9 @@ func (s *PipelineService) GetPipelineMetrics(ctx context.Context, userID, pipeli
 	metrics := make([]map[string]interface{}, 0)
 	for rows.Next() {
 		var hour time.Time
-		var events, bytes, errors int64
+		var events, bytes, errors, lag int64
 		var latency float64
-		if err := rows.Scan(&hour, &events, &bytes, &latency, &errors); err != nil {
+		if err := rows.Scan(&hour, &events, &bytes, &latency, &errors, &lag); err != nil {
 			return nil, err
 		}
 		metrics = append(metrics, map[string]interface{}{
@@ -294,6 +375,7 @@ func (s *PipelineService) GetPipelineMetrics(ctx context.Context, userID, pipeli
 			"bytes":     bytes,
 			"latency":   latency,
 			"errors":    errors,
+			"lag_ms":    lag,
 		})
 	}
 	return metrics, nil
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+var (
+	ErrUnknownTargetType   = errors.New("unknown target_type")
+	ErrInvalidTargetConfig = errors.New("invalid target_config")
+)
+
+// jsonSchemaDraft is the JSON Schema dialect target schemas are written in
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// TargetSchema is the JSON Schema of the target_config of a target type.
+// Configs are flat: every setting is a string, integer or boolean.
+type TargetSchema struct {
+	Schema               string                     `json:"$schema"`
+	Type                 string                     `json:"type"`
+	Properties           map[string]*TargetProperty `json:"properties"`
+	Required             []string                   `json:"required,omitempty"`
+	AnyOf                []TargetRequirement        `json:"anyOf,omitempty"`
+	AdditionalProperties bool                       `json:"additionalProperties"`
+}
+
+// TargetRequirement is one alternative set of required settings
+type TargetRequirement struct {
+	Required []string `json:"required"`
+}
+
+// TargetProperty describes one setting of a target config
+type TargetProperty struct {
+	Type        string   `json:"type"` // string, integer or boolean
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Minimum     *int64   `json:"minimum,omitempty"`
+	Maximum     *int64   `json:"maximum,omitempty"`
+	Default     string   `json:"default,omitempty"`
+
+	pattern *regexp.Regexp
+	// hint describes values matching Pattern in errors
+	hint string
+}
+
+// TargetType describes where a pipeline can deliver changes
+type TargetType struct {
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Label       string   `json:"label"`
+	Description string   `json:"description"`
+	// Feature is the license feature the target requires, empty for community
+	Feature string        `json:"feature,omitempty"`
+	Schema  *TargetSchema `json:"schema"`
+}
+
+// Setting patterns shared by targets
+const (
+	durationPattern     = `^[0-9]+(ms|s|m)$`
+	hostPortPattern     = `^[^\s,:]+:[0-9]{1,5}$`
+	hostPortListPattern = `^[^\s,:]+:[0-9]{1,5}(,[^\s,:]+:[0-9]{1,5})*$`
+
+	durationHint = "a duration like 30s"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+// newTargetSchema builds the schema of a target from its settings
+func newTargetSchema(properties map[string]*TargetProperty, required []string, anyOf ...[]string) *TargetSchema {
+	s := &TargetSchema{
+		Schema:     jsonSchemaDraft,
+		Type:       "object",
+		Properties: properties,
+		Required:   required,
+	}
+	for _, set := range anyOf {
+		s.AnyOf = append(s.AnyOf, TargetRequirement{Required: set})
+	}
+	for _, p := range properties {
+		if p.Pattern != "" {
+			p.pattern = regexp.MustCompile(p.Pattern)
+		}
+	}
+	return s
+}
+
+// Settings the engine reads for each output, see the output section of the
+// configuration reference
+var targetTypes = []TargetType{
+	{Name: "postgres", Label: "PostgreSQL", Description: "Replicate changes into the tables of the target connection",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"schema":       {Type: "string", Title: "Schema", Description: "Schema the tables are written to", Default: "public"},
+			"table_prefix": {Type: "string", Title: "Table prefix", Description: "Prefix added to the name of every replicated table"},
+			"batch_size":   {Type: "integer", Title: "Batch size", Description: "Rows written per transaction", Minimum: int64Ptr(1), Maximum: int64Ptr(100000), Default: "1000"},
+		}, nil)},
+	{Name: "stdout", Label: "Standard output", Description: "Print events to the standard output of the engine, useful for trying pipelines out",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"format": {Type: "string", Title: "Format", Enum: []string{"json", "text"}, Default: "json"},
+			"pretty": {Type: "boolean", Title: "Pretty print", Description: "Indent JSON events", Default: "false"},
+		}, nil)},
+	{Name: "file", Label: "File", Description: "Append events as JSON lines to a file on the engine host",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"path":      {Type: "string", Title: "Path", Description: "File the events are appended to", Pattern: `^/`, hint: "an absolute path"},
+			"max_size":  {Type: "integer", Title: "Max size (MB)", Description: "Size at which the file is rotated", Minimum: int64Ptr(1), Default: "100"},
+			"max_files": {Type: "integer", Title: "Max files", Description: "Rotated files kept", Minimum: int64Ptr(1), Default: "10"},
+			"compress":  {Type: "boolean", Title: "Compress", Description: "Gzip rotated files", Default: "true"},
+		}, []string{"path"})},
+	{Name: "http", Aliases: []string{"webhook"}, Label: "HTTP Webhook", Feature: "webhook",
+		Description: "Send events as HTTP requests to your endpoint",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"url":           {Type: "string", Title: "URL", Description: "Endpoint events are sent to", Format: "uri"},
+			"method":        {Type: "string", Title: "Method", Enum: []string{"POST", "PUT"}, Default: "POST"},
+			"authorization": {Type: "string", Title: "Authorization header", Description: "Sent with every request, e.g. Bearer ${WEBHOOK_TOKEN}"},
+			"batch_size":    {Type: "integer", Title: "Batch size", Description: "Events per request", Minimum: int64Ptr(1), Maximum: int64Ptr(10000), Default: "100"},
+			"timeout":       {Type: "string", Title: "Timeout", Description: "Request timeout, e.g. 30s", Pattern: durationPattern, hint: durationHint, Default: "30s"},
+		}, []string{"url"})},
+	{Name: "kafka", Label: "Apache Kafka", Feature: "kafka_output",
+		Description: "Publish events to Kafka topics",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"brokers":        {Type: "string", Title: "Brokers", Description: "Comma-separated host:port list", Pattern: hostPortListPattern, hint: "a comma-separated host:port list"},
+			"url":            {Type: "string", Title: "URL", Description: "Brokers as kafka://host:port[,host:port][/topic], instead of brokers and topic", Format: "uri"},
+			"topic":          {Type: "string", Title: "Topic", Description: "Topic events are published to, named after the pipeline by default"},
+			"topic_template": {Type: "string", Title: "Topic template", Description: "Topic per table, e.g. cdc.${schema}.${table}"},
+			"acks":           {Type: "string", Title: "Acks", Enum: []string{"none", "leader", "all"}, Default: "all"},
+			"compression":    {Type: "string", Title: "Compression", Enum: []string{"none", "gzip", "snappy", "lz4", "zstd"}, Default: "snappy"},
+			"partition_key":  {Type: "string", Title: "Partition key", Description: "Key events are partitioned by, e.g. ${table}"},
+		}, nil, []string{"brokers"}, []string{"url"})},
+	{Name: "grpc", Label: "gRPC", Feature: "grpc_output",
+		Description: "Stream events to a gRPC broker",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"broker_address":   {Type: "string", Title: "Broker address", Description: "host:port of the broker", Pattern: hostPortPattern, hint: "host:port"},
+			"max_message_size": {Type: "integer", Title: "Max message size", Description: "In bytes", Minimum: int64Ptr(1024), Default: "16777216"},
+			"tls":              {Type: "boolean", Title: "TLS", Description: "Connect to the broker over TLS", Default: "false"},
+		}, []string{"broker_address"})},
+	{Name: "s3", Label: "Amazon S3", Feature: "cloud_storage",
+		Description: "Write batches of events as JSON files to an S3 bucket",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"bucket":         {Type: "string", Title: "Bucket", Pattern: `^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`, hint: "a valid bucket name"},
+			"url":            {Type: "string", Title: "URL", Description: "Bucket and prefix as s3://bucket/prefix, instead of bucket and prefix", Format: "uri"},
+			"prefix":         {Type: "string", Title: "Prefix", Description: "Key prefix of the files"},
+			"region":         {Type: "string", Title: "Region", Pattern: `^[a-z]{2}(-[a-z]+)+-[0-9]$`, hint: "a region like eu-west-1"},
+			"format":         {Type: "string", Title: "Format", Enum: []string{"json", "jsonl"}, Default: "jsonl"},
+			"flush_interval": {Type: "string", Title: "Flush interval", Description: "How often a file is written, e.g. 60s", Pattern: durationPattern, hint: durationHint, Default: "60s"},
+		}, nil, []string{"bucket"}, []string{"url"})},
+	{Name: "bigquery", Label: "BigQuery", Feature: "cloud_storage",
+		Description: "Stream events into the tables of a Google BigQuery dataset",
+		Schema: newTargetSchema(map[string]*TargetProperty{
+			"project":          {Type: "string", Title: "Project", Description: "Google Cloud project ID", Pattern: `^[a-z][a-z0-9-]{4,28}[a-z0-9]$`, hint: "a Google Cloud project ID"},
+			"dataset":          {Type: "string", Title: "Dataset", Pattern: `^[A-Za-z0-9_]+$`, hint: "letters, digits and underscores"},
+			"url":              {Type: "string", Title: "URL", Description: "Project and dataset as bigquery://project.dataset, instead of project and dataset", Format: "uri"},
+			"location":         {Type: "string", Title: "Location", Description: "Location of the dataset, e.g. EU"},
+			"credentials_file": {Type: "string", Title: "Credentials file", Description: "Service account key on the engine host, application default credentials otherwise", Pattern: `^/`, hint: "an absolute path"},
+			"table_prefix":     {Type: "string", Title: "Table prefix", Description: "Prefix added to the name of every replicated table"},
+			"batch_size":       {Type: "integer", Title: "Batch size", Description: "Rows per streaming insert", Minimum: int64Ptr(1), Maximum: int64Ptr(50000), Default: "500"},
+		}, nil, []string{"project", "dataset"}, []string{"url"})},
+}
+
+// URL schemes accepted by the url setting of each target
+var targetURLSchemes = map[string][]string{
+	"http":     {"http", "https"},
+	"kafka":    {"kafka"},
+	"s3":       {"s3"},
+	"bigquery": {"bigquery"},
+}
+
+// TargetTypes returns the targets pipelines can deliver to
+func TargetTypes() []TargetType {
+	return targetTypes
+}
+
+// FindTargetType returns the target type called name, or one of its aliases
+func FindTargetType(name string) (TargetType, bool) {
+	for _, t := range targetTypes {
+		if t.Name == name {
+			return t, true
+		}
+		for _, alias := range t.Aliases {
+			if alias == name {
+				return t, true
+			}
+		}
+	}
+	return TargetType{}, false
+}
+
+// Allowed reports whether licensed features include the feature of the target
+func (t TargetType) Allowed(features map[string]bool) bool {
+	return t.Feature == "" || features[t.Feature]
+}
+
+// TargetNotAllowedError is returned for a target whose feature the licenses
+// don't include
+type TargetNotAllowedError struct {
+	Target TargetType
+}
+
+func (e *TargetNotAllowedError) Error() string {
+	return fmt.Sprintf("the %s target requires a plan with the %s feature", e.Target.Label, e.Target.Feature)
+}
+
+// CheckTarget validates config against the schema of the target type called
+// name, and that the licensed features include the one the target requires.
+// It returns the target type, whose Name is what pipelines store.
+func CheckTarget(name string, config map[string]string, features map[string]bool) (TargetType, error) {
+	if err := ValidateTargetConfig(name, config); err != nil {
+		return TargetType{}, err
+	}
+	target, _ := FindTargetType(name)
+	if !target.Allowed(features) {
+		return TargetType{}, &TargetNotAllowedError{Target: target}
+	}
+	return target, nil
+}
+
+// LicensedFeatures returns the features of the active licenses. Licenses past
+// their expiry count as expired whatever their status says.
+func LicensedFeatures(licenses []models.License) map[string]bool {
+	now := time.Now()
+	features := make(map[string]bool)
+	for _, lic := range licenses {
+		if lic.Status != "active" || !lic.ExpiresAt.After(now) {
+			continue
+		}
+		for _, f := range lic.Features {
+			features[f] = true
+		}
+	}
+	return features
+}
+
+// TargetConfigValues converts a target_config sent as JSON to the strings
+// pipelines store. Only strings, numbers and booleans are accepted.
+func TargetConfigValues(raw map[string]interface{}) (map[string]string, error) {
+	config := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			config[key] = v
+		case float64:
+			config[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			config[key] = strconv.FormatBool(v)
+		case nil:
+			// An unset value, like an empty one, means the default
+		default:
+			return nil, fmt.Errorf("%w: %s must be a string, number or boolean", ErrInvalidTargetConfig, key)
+		}
+	}
+	return config, nil
+}
+
+// ValidateTargetConfig checks config against the schema of the target type
+// called name. Empty values count as unset.
+func ValidateTargetConfig(name string, config map[string]string) error {
+	t, ok := FindTargetType(name)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownTargetType, name)
+	}
+	schema := t.Schema
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := config[key]
+		prop, ok := schema.Properties[key]
+		if !ok {
+			return fmt.Errorf("%w: unknown setting %s for the %s target", ErrInvalidTargetConfig, key, t.Name)
+		}
+		if value == "" {
+			continue
+		}
+		if err := validateTargetValue(t.Name, prop, value); err != nil {
+			return fmt.Errorf("%w: %s %s", ErrInvalidTargetConfig, key, err)
+		}
+	}
+
+	set := func(key string) bool { return config[key] != "" }
+	for _, key := range schema.Required {
+		if !set(key) {
+			return fmt.Errorf("%w: %s is required for the %s target", ErrInvalidTargetConfig, key, t.Name)
+		}
+	}
+	if len(schema.AnyOf) == 0 {
+		return nil
+	}
+	alternatives := make([]string, len(schema.AnyOf))
+	for i, req := range schema.AnyOf {
+		satisfied := true
+		for _, key := range req.Required {
+			satisfied = satisfied && set(key)
+		}
+		if satisfied {
+			return nil
+		}
+		alternatives[i] = strings.Join(req.Required, " and ")
+	}
+	return fmt.Errorf("%w: %s is required for the %s target", ErrInvalidTargetConfig, strings.Join(alternatives, " or "), t.Name)
+}
+
+// validateTargetValue checks one setting of a target. The error completes a
+// sentence starting with the name of the setting.
+func validateTargetValue(target string, prop *TargetProperty, value string) error {
+	switch prop.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		if prop.Minimum != nil && n < *prop.Minimum {
+			return fmt.Errorf("must be at least %d", *prop.Minimum)
+		}
+		if prop.Maximum != nil && n > *prop.Maximum {
+			return fmt.Errorf("must be at most %d", *prop.Maximum)
+		}
+		return nil
+	case "boolean":
+		if value != "true" && value != "false" {
+			return errors.New("must be true or false")
+		}
+		return nil
+	}
+
+	if len(prop.Enum) > 0 {
+		for _, allowed := range prop.Enum {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(prop.Enum, ", "))
+	}
+	if prop.pattern != nil && !prop.pattern.MatchString(value) {
+		return fmt.Errorf("must be %s", prop.hint)
+	}
+	if prop.Format == "uri" {
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return errors.New("must be an absolute URL")
+		}
+		if schemes := targetURLSchemes[target]; len(schemes) > 0 {
+			for _, scheme := range schemes {
+				if u.Scheme == scheme {
+					return nil
+				}
+			}
+			return fmt.Errorf("must be a %s:// URL", strings.Join(schemes, ":// or "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestTargetTypes(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, target := range TargetTypes() {
+		for _, name := range append([]string{target.Name}, target.Aliases...) {
+			assert.False(t, seen[name], "duplicate target %s", name)
+			seen[name] = true
+		}
+		for _, key := range target.Schema.Required {
+			assert.Contains(t, target.Schema.Properties, key, "%s requires an unknown setting", target.Name)
+		}
+		for _, req := range target.Schema.AnyOf {
+			for _, key := range req.Required {
+				assert.Contains(t, target.Schema.Properties, key, "%s requires an unknown setting", target.Name)
+			}
+		}
+		for key, prop := range target.Schema.Properties {
+			if prop.Pattern != "" {
+				assert.NotEmpty(t, prop.hint, "%s.%s has a pattern without a hint", target.Name, key)
+			}
+			if prop.Default != "" {
+				assert.NoError(t, validateTargetValue(target.Name, prop, prop.Default), "%s.%s default", target.Name, key)
+			}
+		}
+	}
+
+	webhook, ok := FindTargetType("webhook")
+	require.True(t, ok)
+	assert.Equal(t, "http", webhook.Name)
+	_, ok = FindTargetType("snowflake")
+	assert.False(t, ok)
+}
+
+func TestTargetSchema_JSON(t *testing.T) {
+	kafka, _ := FindTargetType("kafka")
+	data, err := json.Marshal(kafka.Schema)
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, jsonSchemaDraft, schema["$schema"])
+	assert.Equal(t, "object", schema["type"])
+	assert.Equal(t, false, schema["additionalProperties"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"required": []interface{}{"brokers"}},
+		map[string]interface{}{"required": []interface{}{"url"}},
+	}, schema["anyOf"])
+	brokers := schema["properties"].(map[string]interface{})["brokers"].(map[string]interface{})
+	assert.Equal(t, "string", brokers["type"])
+	assert.Equal(t, hostPortListPattern, brokers["pattern"])
+}
+
+func TestValidateTargetConfig(t *testing.T) {
+	valid := map[string]map[string]string{
+		"postgres": nil,
+		"webhook":  {"url": "https://api.example.com/events", "batch_size": "50", "timeout": "10s"},
+		"http":     {"url": "http://localhost:8080/hook", "method": ""},
+		"kafka":    {"brokers": "kafka1:9092,kafka2:9092", "topic": "orders", "acks": "all"},
+		"grpc":     {"broker_address": "broker:9092", "tls": "true"},
+		"s3":       {"url": "s3://events-bucket/orders"},
+		"file":     {"path": "/var/log/savegress/events.jsonl", "compress": "false"},
+		"bigquery": {"project": "acme-analytics", "dataset": "cdc_events"},
+	}
+	for name, config := range valid {
+		assert.NoError(t, ValidateTargetConfig(name, config), name)
+	}
+	assert.NoError(t, ValidateTargetConfig("kafka", map[string]string{"url": "kafka://kafka1:9092/orders"}))
+	// What the dashboard sends for BigQuery pipelines
+	assert.NoError(t, ValidateTargetConfig("bigquery", map[string]string{"url": "bigquery://acme-analytics.cdc_events"}))
+
+	invalid := map[string]struct {
+		target string
+		config map[string]string
+		want   string
+	}{
+		"unknown setting":      {"http", map[string]string{"url": "https://x.io", "verb": "POST"}, "unknown setting verb for the http target"},
+		"missing required":     {"http", map[string]string{"method": "POST"}, "url is required for the http target"},
+		"missing alternatives": {"kafka", map[string]string{"topic": "orders"}, "brokers or url is required for the kafka target"},
+		"not an integer":       {"http", map[string]string{"url": "https://x.io", "batch_size": "many"}, "batch_size must be an integer"},
+		"below minimum":        {"http", map[string]string{"url": "https://x.io", "batch_size": "0"}, "batch_size must be at least 1"},
+		"above maximum":        {"http", map[string]string{"url": "https://x.io", "batch_size": "20000"}, "batch_size must be at most 10000"},
+		"not a boolean":        {"grpc", map[string]string{"broker_address": "b:1", "tls": "yes"}, "tls must be true or false"},
+		"not in enum":          {"kafka", map[string]string{"brokers": "k:9092", "acks": "some"}, "acks must be one of none, leader, all"},
+		"pattern mismatch":     {"kafka", map[string]string{"brokers": "kafka1"}, "brokers must be a comma-separated host:port list"},
+		"relative url":         {"http", map[string]string{"url": "/events"}, "url must be an absolute URL"},
+		"wrong scheme":         {"s3", map[string]string{"url": "https://bucket.s3.amazonaws.com"}, "url must be a s3:// URL"},
+	}
+	for name, tc := range invalid {
+		err := ValidateTargetConfig(tc.target, tc.config)
+		require.Error(t, err, name)
+		assert.True(t, errors.Is(err, ErrInvalidTargetConfig), name)
+		assert.Equal(t, "invalid target_config: "+tc.want, err.Error(), name)
+	}
+
+	err := ValidateTargetConfig("snowflake", nil)
+	assert.True(t, errors.Is(err, ErrUnknownTargetType))
+	assert.Equal(t, `unknown target_type "snowflake"`, err.Error())
+}
+
+func TestTargetConfigValues(t *testing.T) {
+	config, err := TargetConfigValues(map[string]interface{}{
+		"url": "https://x.io", "batch_size": float64(1000000), "tls": true, "topic": nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"url": "https://x.io", "batch_size": "1000000", "tls": "true"}, config)
+
+	_, err = TargetConfigValues(map[string]interface{}{"headers": map[string]interface{}{"a": "b"}})
+	assert.True(t, errors.Is(err, ErrInvalidTargetConfig))
+}
+
+func TestTargetAllowed(t *testing.T) {
+	licenses := []models.License{
+		{Status: "active", Features: []string{"postgresql", "kafka_output"}, ExpiresAt: time.Now().Add(time.Hour)},
+		{Status: "expired", Features: []string{"cloud_storage"}, ExpiresAt: time.Now().Add(time.Hour)},
+		// Not yet marked expired, but past its expiry
+		{Status: "active", Features: []string{"webhook"}, ExpiresAt: time.Now().Add(-time.Hour)},
+	}
+	features := LicensedFeatures(licenses)
+
+	for name, want := range map[string]bool{"postgres": true, "kafka": true, "s3": false, "http": false} {
+		target, _ := FindTargetType(name)
+		assert.Equal(t, want, target.Allowed(features), name)
+	}
+	kafka, _ := FindTargetType("kafka")
+	assert.False(t, kafka.Allowed(LicensedFeatures(nil)))
+}
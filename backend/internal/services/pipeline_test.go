@@ -223,6 +223,7 @@ func TestPipelineService_MetricsFormat(t *testing.T) {
 		"bytes",
 		"latency",
 		"errors",
+		"lag_ms",
 	}
 
 	for _, field := range expectedMetricFields {
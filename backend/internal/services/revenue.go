@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+var ErrInvalidAnalyticsRange = errors.New("invalid analytics range")
+
+// maxAnalyticsPoints caps the number of points in a time series
+const maxAnalyticsPoints = 400
+
+// daysPerMonth is the average length of a month, used to normalize invoices to MRR
+const daysPerMonth = 365.2425 / 12
+
+// RevenuePoint is the recurring revenue at a point in time
+type RevenuePoint struct {
+	Date      time.Time `json:"date"`
+	MRR       int64     `json:"mrr"` // in cents
+	ARR       int64     `json:"arr"` // in cents
+	Customers int       `json:"customers"`
+}
+
+// RevenueReport contains recurring revenue, churn and retention over a date range.
+// Figures are derived from paid invoices: each invoice's amount (excluding tax)
+// is spread evenly over the service period it covers.
+type RevenueReport struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Currency string    `json:"currency"`
+	Interval string    `json:"interval"`
+
+	StartMRR            int64   `json:"start_mrr"`
+	MRR                 int64   `json:"mrr"`
+	ARR                 int64   `json:"arr"`
+	CustomersStart      int     `json:"customers_start"`
+	CustomersEnd        int     `json:"customers_end"`
+	NewCustomers        int     `json:"new_customers"`
+	ChurnedCustomers    int     `json:"churned_customers"`
+	CustomerChurnRate   float64 `json:"customer_churn_rate"`   // % of starting customers lost
+	RevenueChurnRate    float64 `json:"revenue_churn_rate"`    // % of starting MRR lost to churn and contraction
+	NetRevenueRetention float64 `json:"net_revenue_retention"` // % of starting MRR retained incl. expansion
+
+	Series []RevenuePoint `json:"series"`
+}
+
+// TrialConversion describes how many trials started in a range turned into paying customers
+type TrialConversion struct {
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	Trials           int       `json:"trials"`
+	Converted        int       `json:"converted"`
+	ConversionRate   float64   `json:"conversion_rate"` // %
+	AvgDaysToConvert float64   `json:"avg_days_to_convert"`
+}
+
+// TierDistributionPoint is the number of active licenses per tier at a point in time
+type TierDistributionPoint struct {
+	Date  time.Time      `json:"date"`
+	Tiers map[string]int `json:"tiers"`
+	Total int            `json:"total"`
+}
+
+// revenueInvoice is a paid invoice reduced to what revenue analytics needs
+type revenueInvoice struct {
+	UserID      uuid.UUID
+	Amount      int64 // excluding tax
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+// monthlyAmount normalizes an invoice to a monthly amount
+func (inv revenueInvoice) monthlyAmount() float64 {
+	days := inv.PeriodEnd.Sub(inv.PeriodStart).Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	return float64(inv.Amount) * daysPerMonth / days
+}
+
+// covers reports whether the invoice's service period contains t
+func (inv revenueInvoice) covers(t time.Time) bool {
+	return !t.Before(inv.PeriodStart) && t.Before(inv.PeriodEnd)
+}
+
+// AnalyticsSeries returns the points of a series from from (inclusive) to to
+// (exclusive). interval is day, week or month.
+func AnalyticsSeries(from, to time.Time, interval string) ([]time.Time, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidAnalyticsRange)
+	}
+
+	step := func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	switch interval {
+	case "day":
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week":
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+	default:
+		return nil, fmt.Errorf("%w: interval must be day, week or month", ErrInvalidAnalyticsRange)
+	}
+
+	var points []time.Time
+	for t := from; t.Before(to); t = step(t) {
+		if len(points) == maxAnalyticsPoints {
+			return nil, fmt.Errorf("%w: too many points, use a larger interval", ErrInvalidAnalyticsRange)
+		}
+		points = append(points, t)
+	}
+	return points, nil
+}
+
+// mrrAt returns the MRR per customer at t
+func mrrAt(invoices []revenueInvoice, t time.Time) map[uuid.UUID]float64 {
+	mrr := make(map[uuid.UUID]float64)
+	for _, inv := range invoices {
+		if inv.covers(t) {
+			mrr[inv.UserID] += inv.monthlyAmount()
+		}
+	}
+	return mrr
+}
+
+func sumMRR(mrr map[uuid.UUID]float64) float64 {
+	var total float64
+	for _, v := range mrr {
+		total += v
+	}
+	return total
+}
+
+// applyRetention fills the churn and retention figures of a report from the
+// MRR per customer at the start and end of the range.
+func applyRetention(report *RevenueReport, start, end map[uuid.UUID]float64) {
+	startTotal := sumMRR(start)
+	report.StartMRR = int64(startTotal)
+	report.MRR = int64(sumMRR(end))
+	report.ARR = report.MRR * 12
+	report.CustomersStart = len(start)
+	report.CustomersEnd = len(end)
+
+	var retained, lost float64
+	for userID, before := range start {
+		after := end[userID]
+		if after == 0 {
+			report.ChurnedCustomers++
+		}
+		retained += after
+		if after < before {
+			lost += before - after
+		}
+	}
+	for userID := range end {
+		if _, ok := start[userID]; !ok {
+			report.NewCustomers++
+		}
+	}
+
+	if report.CustomersStart > 0 {
+		report.CustomerChurnRate = float64(report.ChurnedCustomers) / float64(report.CustomersStart) * 100
+	}
+	if startTotal > 0 {
+		report.RevenueChurnRate = lost / startTotal * 100
+		report.NetRevenueRetention = retained / startTotal * 100
+	}
+}
+
+// servicePeriod returns the period an invoice pays for. Line item periods are
+// preferred since Stripe's invoice-level period does not always match the
+// subscription period being billed.
+func servicePeriod(lineItems []models.InvoiceLineItem, start, end time.Time) (time.Time, time.Time) {
+	var lineStart, lineEnd time.Time
+	for _, item := range lineItems {
+		if item.PeriodStart == nil || item.PeriodEnd == nil || !item.PeriodEnd.After(*item.PeriodStart) {
+			continue
+		}
+		if lineStart.IsZero() || item.PeriodStart.Before(lineStart) {
+			lineStart = *item.PeriodStart
+		}
+		if item.PeriodEnd.After(lineEnd) {
+			lineEnd = *item.PeriodEnd
+		}
+	}
+	if !lineStart.IsZero() {
+		return lineStart, lineEnd
+	}
+	return start, end
+}
+
+// revenueInvoices loads the recurring paid invoices in a currency that may
+// cover any point between from and to. One-off manual charges (no plan) are
+// not recurring revenue and are skipped.
+func (s *LicenseService) revenueInvoices(ctx context.Context, currency string, from, to time.Time) ([]revenueInvoice, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT user_id, subtotal, amount, tax, period_start, period_end, line_items
+		FROM invoices
+		WHERE status = 'paid' AND currency = $1
+		AND NOT (payment_provider = $2 AND plan IS NULL)
+		AND created_at < $4 AND created_at > $3 - INTERVAL '13 months'
+	`, currency, ProviderManual, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []revenueInvoice
+	for rows.Next() {
+		var inv revenueInvoice
+		var subtotal, amount, tax int64
+		var lineItemsJSON []byte
+		var start, end time.Time
+		if err := rows.Scan(&inv.UserID, &subtotal, &amount, &tax, &start, &end, &lineItemsJSON); err != nil {
+			return nil, err
+		}
+
+		var lineItems []models.InvoiceLineItem
+		if err := json.Unmarshal(lineItemsJSON, &lineItems); err != nil {
+			return nil, fmt.Errorf("failed to decode invoice line items: %w", err)
+		}
+		inv.PeriodStart, inv.PeriodEnd = servicePeriod(lineItems, start, end)
+
+		// Invoices recorded before the tax breakdown existed have no subtotal
+		inv.Amount = subtotal
+		if inv.Amount == 0 {
+			inv.Amount = amount - tax
+		}
+		if inv.Amount <= 0 || !inv.PeriodEnd.After(inv.PeriodStart) {
+			continue
+		}
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
+
+// GetRevenueReport returns MRR, ARR, churn and net revenue retention between from and to
+func (s *LicenseService) GetRevenueReport(ctx context.Context, from, to time.Time, interval, currency string) (*RevenueReport, error) {
+	points, err := AnalyticsSeries(from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	invoices, err := s.revenueInvoices(ctx, currency, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invoices: %w", err)
+	}
+
+	report := &RevenueReport{
+		From:     from,
+		To:       to,
+		Currency: currency,
+		Interval: interval,
+		Series:   make([]RevenuePoint, 0, len(points)),
+	}
+	for _, t := range points {
+		mrr := mrrAt(invoices, t)
+		total := int64(sumMRR(mrr))
+		report.Series = append(report.Series, RevenuePoint{Date: t, MRR: total, ARR: total * 12, Customers: len(mrr)})
+	}
+
+	// The range end is exclusive; ranges reaching into the future end now
+	end := to.Add(-time.Second)
+	if now := time.Now().UTC(); end.After(now) {
+		end = now
+	}
+	applyRetention(report, mrrAt(invoices, from), mrrAt(invoices, end))
+
+	return report, nil
+}
+
+// GetTrialConversion returns how many trials started between from and to went on to pay
+func (s *LicenseService) GetTrialConversion(ctx context.Context, from, to time.Time) (*TrialConversion, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidAnalyticsRange)
+	}
+
+	conversion := &TrialConversion{From: from, To: to}
+	err := s.db.Pool().QueryRow(ctx, `
+		WITH trials AS (
+			SELECT user_id, MIN(created_at) AS started_at
+			FROM licenses WHERE tier = 'trial'
+			GROUP BY user_id
+			HAVING MIN(created_at) >= $1 AND MIN(created_at) < $2
+		), conversions AS (
+			SELECT t.started_at, (
+				SELECT MIN(i.created_at) FROM invoices i
+				WHERE i.user_id = t.user_id AND i.status = 'paid' AND i.amount > 0 AND i.created_at >= t.started_at
+			) AS paid_at
+			FROM trials t
+		)
+		SELECT COUNT(*), COUNT(paid_at),
+			COALESCE(AVG(EXTRACT(EPOCH FROM paid_at - started_at) / 86400) FILTER (WHERE paid_at IS NOT NULL), 0)
+		FROM conversions
+	`, from, to).Scan(&conversion.Trials, &conversion.Converted, &conversion.AvgDaysToConvert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute trial conversion: %w", err)
+	}
+
+	if conversion.Trials > 0 {
+		conversion.ConversionRate = float64(conversion.Converted) / float64(conversion.Trials) * 100
+	}
+	return conversion, nil
+}
+
+// GetTierDistribution returns the number of active licenses per tier over time
+func (s *LicenseService) GetTierDistribution(ctx context.Context, from, to time.Time, interval string) ([]TierDistributionPoint, error) {
+	points, err := AnalyticsSeries(from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	distribution := make([]TierDistributionPoint, len(points))
+	index := make(map[int64]int, len(points))
+	for i, t := range points {
+		distribution[i] = TierDistributionPoint{Date: t, Tiers: make(map[string]int)}
+		index[t.Unix()] = i
+	}
+
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT d, l.tier, COUNT(*)
+		FROM unnest($1::timestamptz[]) AS d
+		JOIN licenses l ON l.created_at <= d AND l.expires_at > d AND (l.revoked_at IS NULL OR l.revoked_at > d)
+		GROUP BY d, l.tier
+	`, points)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute tier distribution: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d time.Time
+		var tier string
+		var count int
+		if err := rows.Scan(&d, &tier, &count); err != nil {
+			return nil, err
+		}
+		if i, ok := index[d.Unix()]; ok {
+			distribution[i].Tiers[tier] = count
+			distribution[i].Total += count
+		}
+	}
+	return distribution, rows.Err()
+}
+
+// currentRevenue returns today's MRR and number of paying customers in a currency
+func (s *LicenseService) currentRevenue(ctx context.Context, currency string) (int64, int, error) {
+	now := time.Now().UTC()
+	invoices, err := s.revenueInvoices(ctx, currency, now, now.Add(time.Second))
+	if err != nil {
+		return 0, 0, err
+	}
+	mrr := mrrAt(invoices, now)
+	return int64(sumMRR(mrr)), len(mrr), nil
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/savegress/platform/backend/internal/models"
+)
+
+func TestAnalyticsSeries(t *testing.T) {
+	from := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	t.Run("monthly", func(t *testing.T) {
+		points, err := AnalyticsSeries(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), "month")
+		assert.NoError(t, err)
+		assert.Len(t, points, 3)
+		assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), points[2])
+	})
+
+	t.Run("weekly", func(t *testing.T) {
+		points, err := AnalyticsSeries(from, from.AddDate(0, 0, 15), "week")
+		assert.NoError(t, err)
+		assert.Len(t, points, 3)
+	})
+
+	t.Run("rejects empty range", func(t *testing.T) {
+		_, err := AnalyticsSeries(from, from, "day")
+		assert.True(t, errors.Is(err, ErrInvalidAnalyticsRange))
+	})
+
+	t.Run("rejects unknown interval", func(t *testing.T) {
+		_, err := AnalyticsSeries(from, from.AddDate(0, 1, 0), "quarter")
+		assert.True(t, errors.Is(err, ErrInvalidAnalyticsRange))
+	})
+
+	t.Run("rejects too many points", func(t *testing.T) {
+		_, err := AnalyticsSeries(from, from.AddDate(5, 0, 0), "day")
+		assert.True(t, errors.Is(err, ErrInvalidAnalyticsRange))
+	})
+}
+
+func TestMRRAt(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	invoices := []revenueInvoice{
+		// Monthly plan, 30 days
+		{UserID: alice, Amount: 9900, PeriodStart: jan, PeriodEnd: jan.AddDate(0, 0, 30)},
+		// Yearly plan is spread over twelve months
+		{UserID: bob, Amount: 120000, PeriodStart: jan, PeriodEnd: jan.AddDate(1, 0, 0)},
+	}
+
+	mrr := mrrAt(invoices, jan.AddDate(0, 0, 10))
+	assert.Len(t, mrr, 2)
+	assert.InDelta(t, 9900*daysPerMonth/30, mrr[alice], 0.01)
+	assert.InDelta(t, 10000, mrr[bob], 30)
+
+	// Period end is exclusive
+	mrr = mrrAt(invoices, jan.AddDate(0, 0, 30))
+	assert.Len(t, mrr, 1)
+	assert.Contains(t, mrr, bob)
+}
+
+func TestApplyRetention(t *testing.T) {
+	kept, expanded, contracted, churned, added := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	start := map[uuid.UUID]float64{kept: 100, expanded: 100, contracted: 100, churned: 100}
+	end := map[uuid.UUID]float64{kept: 100, expanded: 200, contracted: 50, added: 300}
+
+	report := &RevenueReport{}
+	applyRetention(report, start, end)
+
+	assert.Equal(t, int64(400), report.StartMRR)
+	assert.Equal(t, int64(650), report.MRR)
+	assert.Equal(t, int64(7800), report.ARR)
+	assert.Equal(t, 4, report.CustomersStart)
+	assert.Equal(t, 4, report.CustomersEnd)
+	assert.Equal(t, 1, report.NewCustomers)
+	assert.Equal(t, 1, report.ChurnedCustomers)
+	assert.InDelta(t, 25.0, report.CustomerChurnRate, 0.001)
+	// 50 contracted + 100 churned out of 400
+	assert.InDelta(t, 37.5, report.RevenueChurnRate, 0.001)
+	// (100 + 200 + 50 + 0) / 400; new customers don't count towards retention
+	assert.InDelta(t, 87.5, report.NetRevenueRetention, 0.001)
+}
+
+func TestApplyRetention_NoStartingRevenue(t *testing.T) {
+	report := &RevenueReport{}
+	applyRetention(report, map[uuid.UUID]float64{}, map[uuid.UUID]float64{uuid.New(): 100})
+
+	assert.Equal(t, 1, report.NewCustomers)
+	assert.Zero(t, report.CustomerChurnRate)
+	assert.Zero(t, report.NetRevenueRetention)
+}
+
+func TestServicePeriod(t *testing.T) {
+	invStart := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	invEnd := invStart
+	lineStart := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	lineEnd := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	start, end := servicePeriod([]models.InvoiceLineItem{
+		{Description: "Pro plan", PeriodStart: &lineStart, PeriodEnd: &lineEnd},
+		{Description: "One-off"},
+	}, invStart, invEnd)
+	assert.Equal(t, lineStart, start)
+	assert.Equal(t, lineEnd, end)
+
+	start, end = servicePeriod(nil, invStart, lineEnd)
+	assert.Equal(t, invStart, start)
+	assert.Equal(t, lineEnd, end)
+}
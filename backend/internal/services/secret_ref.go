@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidSecretRef = errors.New("invalid secret reference")
+	// ErrSecretResolvedByEngine is returned for operations that need the
+	// password of a connection whose password only the engine can resolve
+	ErrSecretResolvedByEngine = errors.New("connection password is a secret reference resolved only by the engine")
+)
+
+// Secret reference kinds
+const (
+	SecretRefEnv   = "env"   // an environment variable of the engine
+	SecretRefFile  = "file"  // a file on the engine host, e.g. a mounted Kubernetes secret
+	SecretRefVault = "vault" // a HashiCorp Vault KV secret, read with the engine's Vault token
+)
+
+// defaultVaultSecretKey is read from a Vault secret when the reference names no key
+const defaultVaultSecretKey = "password"
+
+var envVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SecretRef points at a password the engine resolves where it runs, so it is
+// never stored by the platform. References are written as env:NAME,
+// file:/absolute/path or vault:mount/path#key.
+type SecretRef struct {
+	Kind string
+	Path string // variable name, file path or Vault secret path
+	Key  string // Vault secret key
+}
+
+// ParseSecretRef parses and normalizes a secret reference
+func ParseSecretRef(ref string) (*SecretRef, error) {
+	kind, value, ok := strings.Cut(strings.TrimSpace(ref), ":")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("%w: use env:NAME, file:/path or vault:path#key", ErrInvalidSecretRef)
+	}
+
+	r := &SecretRef{Kind: strings.ToLower(kind), Path: value}
+	switch r.Kind {
+	case SecretRefEnv:
+		if !envVarPattern.MatchString(value) {
+			return nil, fmt.Errorf("%w: %q is not a valid environment variable name", ErrInvalidSecretRef, value)
+		}
+	case SecretRefFile:
+		if !path.IsAbs(value) {
+			return nil, fmt.Errorf("%w: file path must be absolute", ErrInvalidSecretRef)
+		}
+		r.Path = path.Clean(value)
+	case SecretRefVault:
+		secretPath, key, _ := strings.Cut(value, "#")
+		secretPath = strings.Trim(secretPath, "/")
+		if secretPath == "" || strings.Contains(secretPath, "..") {
+			return nil, fmt.Errorf("%w: invalid Vault secret path", ErrInvalidSecretRef)
+		}
+		if key == "" {
+			key = defaultVaultSecretKey
+		}
+		r.Path, r.Key = secretPath, key
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q, use env, file or vault", ErrInvalidSecretRef, kind)
+	}
+	return r, nil
+}
+
+// String formats the reference the way engines read it
+func (r *SecretRef) String() string {
+	if r.Kind == SecretRefVault {
+		return r.Kind + ":" + r.Path + "#" + r.Key
+	}
+	return r.Kind + ":" + r.Path
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"env:PG_PASSWORD", "env:PG_PASSWORD"},
+		{" ENV:pg_password ", "env:pg_password"},
+		{"file:/run/secrets/../secrets/pg", "file:/run/secrets/pg"},
+		{"vault:/secret/data/pg/", "vault:secret/data/pg#password"},
+		{"vault:secret/data/pg#pass", "vault:secret/data/pg#pass"},
+	}
+	for _, tt := range tests {
+		ref, err := ParseSecretRef(tt.ref)
+		require.NoError(t, err, tt.ref)
+		assert.Equal(t, tt.want, ref.String())
+	}
+
+	for _, invalid := range []string{"", "PG_PASSWORD", "env:", "env:1PASS", "env:PG-PASS",
+		"file:secrets/pg", "vault:#password", "vault:secret/../pg", "aws:pg"} {
+		_, err := ParseSecretRef(invalid)
+		assert.True(t, errors.Is(err, ErrInvalidSecretRef), invalid)
+	}
+}
@@ -3,24 +3,39 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
-	"github.com/savegress/platform/backend/internal/models"
+	"github.com/savegress/platform/backend/internal/metrics"
 	"github.com/savegress/platform/backend/internal/repository"
 )
 
+var ErrInvalidTelemetry = errors.New("invalid telemetry")
+
 // TelemetryService handles usage telemetry from CDC engines
 type TelemetryService struct {
 	db    *repository.PostgresDB
 	redis *repository.RedisClient
+
+	signaturesRequiredAfter time.Time
+	ingestSlots             chan struct{}
+	retentionMonths         int
+	pipelineService         *PipelineService
+	eventService            *EventService
 }
 
 // NewTelemetryService creates a new telemetry service
 func NewTelemetryService(db *repository.PostgresDB, redis *repository.RedisClient) *TelemetryService {
-	return &TelemetryService{db: db, redis: redis}
+	return &TelemetryService{
+		db:          db,
+		redis:       redis,
+		ingestSlots: make(chan struct{}, maxConcurrentTelemetryBatches),
+	}
 }
 
 // TelemetryInput represents incoming telemetry data
@@ -37,6 +52,9 @@ type TelemetryInput struct {
 	UptimeHours     float64 `json:"uptime_hours"`
 	Version         string  `json:"version"`
 	SourceType      string  `json:"source_type"`
+
+	// Per-pipeline breakdown of the instance totals
+	Pipelines []PipelineSample `json:"pipelines,omitempty"`
 }
 
 // RecordTelemetry stores telemetry data
@@ -45,39 +63,14 @@ func (s *TelemetryService) RecordTelemetry(ctx context.Context, input TelemetryI
 	if err != nil {
 		return fmt.Errorf("invalid license ID: %w", err)
 	}
-
-	record := &models.TelemetryRecord{
-		ID:              uuid.New(),
-		LicenseID:       licenseID,
-		HardwareID:      input.HardwareID,
-		Timestamp:       time.Unix(input.Timestamp, 0).UTC(),
-		EventsProcessed: input.EventsProcessed,
-		BytesProcessed:  input.BytesProcessed,
-		TablesTracked:   input.TablesTracked,
-		SourcesActive:   input.SourcesActive,
-		AvgLatencyMs:    input.AvgLatencyMs,
-		ErrorCount:      input.ErrorCount,
-		UptimeHours:     input.UptimeHours,
-		Version:         input.Version,
-		SourceType:      input.SourceType,
+	// The same checks as batches: a sample outside the partitioned months
+	// would land in the default partition and block creating that month's
+	if err := validateTelemetrySample(input, time.Now()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTelemetry, err)
 	}
 
-	// Store in database (sampled - keep 1 per hour)
-	_, err = s.db.Pool().Exec(ctx, `
-		INSERT INTO telemetry (id, license_id, hardware_id, timestamp, events_processed, bytes_processed,
-			tables_tracked, sources_active, avg_latency_ms, error_count, uptime_hours, version, source_type)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		ON CONFLICT (license_id, hardware_id, date_trunc('hour', timestamp)) DO UPDATE SET
-			events_processed = EXCLUDED.events_processed,
-			bytes_processed = EXCLUDED.bytes_processed,
-			avg_latency_ms = EXCLUDED.avg_latency_ms,
-			error_count = EXCLUDED.error_count,
-			uptime_hours = EXCLUDED.uptime_hours
-	`, record.ID, record.LicenseID, record.HardwareID, record.Timestamp,
-		record.EventsProcessed, record.BytesProcessed, record.TablesTracked,
-		record.SourcesActive, record.AvgLatencyMs, record.ErrorCount,
-		record.UptimeHours, record.Version, record.SourceType)
-	if err != nil {
+	// Raw samples are stored as-is; hourly and daily views come from the rollup tables
+	if err := s.storeTelemetrySamples(ctx, licenseID, input.HardwareID, []TelemetryInput{input}); err != nil {
 		return fmt.Errorf("failed to store telemetry: %w", err)
 	}
 
@@ -86,6 +79,7 @@ func (s *TelemetryService) RecordTelemetry(ctx context.Context, input TelemetryI
 	key := fmt.Sprintf("telemetry:%s:%s", input.LicenseID, input.HardwareID)
 	s.redis.Client().Set(ctx, key, state, 5*time.Minute)
 
+	s.markInstanceSeen(ctx, licenseID, input.HardwareID, time.Unix(input.Timestamp, 0).UTC())
 	return nil
 }
 
@@ -116,7 +110,7 @@ func (s *TelemetryService) GetDashboardStats(ctx context.Context, userID uuid.UU
 			COALESCE(SUM(t.uptime_hours), 0)
 		FROM telemetry t
 		JOIN licenses l ON t.license_id = l.id
-		WHERE l.user_id = $1 AND t.timestamp > NOW() - INTERVAL '24 hours'
+		WHERE l.user_id = $1 AND t.pipeline_id IS NULL AND t.timestamp > NOW() - INTERVAL '24 hours'
 	`, userID).Scan(&stats.TotalEventsProcessed, &stats.TotalBytesProcessed,
 		&stats.ActiveInstances, &stats.ActiveLicenses, &stats.AvgLatencyMs,
 		&stats.TotalErrors, &stats.TotalUptimeHours)
@@ -136,9 +130,10 @@ type UsageDataPoint struct {
 	ErrorCount      int64     `json:"error_count"`
 }
 
-// GetUsageHistory returns usage time series for a user
+// GetUsageHistory returns usage time series for a user. Ranges up to a week
+// are hourly from raw telemetry; longer ones are daily from the rollups.
 func (s *TelemetryService) GetUsageHistory(ctx context.Context, userID uuid.UUID, days int) ([]UsageDataPoint, error) {
-	rows, err := s.db.Pool().Query(ctx, `
+	query := `
 		SELECT
 			date_trunc('hour', t.timestamp) as hour,
 			SUM(t.events_processed),
@@ -147,10 +142,27 @@ func (s *TelemetryService) GetUsageHistory(ctx context.Context, userID uuid.UUID
 			SUM(t.error_count)
 		FROM telemetry t
 		JOIN licenses l ON t.license_id = l.id
-		WHERE l.user_id = $1 AND t.timestamp > NOW() - ($2 || ' days')::INTERVAL
+		WHERE l.user_id = $1 AND t.pipeline_id IS NULL AND t.timestamp > NOW() - ($2 || ' days')::INTERVAL
 		GROUP BY hour
 		ORDER BY hour
-	`, userID, days)
+	`
+	if days > usageRollupThresholdDays {
+		query = `
+			SELECT
+				d.bucket::timestamp AT TIME ZONE 'UTC' as day,
+				SUM(d.events_processed),
+				SUM(d.bytes_processed),
+				COALESCE(SUM(d.avg_latency_ms * d.sample_count) / NULLIF(SUM(d.sample_count), 0), 0),
+				SUM(d.error_count)
+			FROM telemetry_daily d
+			JOIN licenses l ON d.license_id = l.id
+			WHERE l.user_id = $1 AND d.bucket > (NOW() AT TIME ZONE 'UTC')::date - $2::int
+			GROUP BY day
+			ORDER BY day
+		`
+	}
+
+	rows, err := s.db.Pool().Query(ctx, query, userID, days)
 	if err != nil {
 		return nil, err
 	}
@@ -197,7 +209,7 @@ func (s *TelemetryService) GetActiveInstances(ctx context.Context, userID uuid.U
 		LEFT JOIN LATERAL (
 			SELECT source_type, events_processed
 			FROM telemetry
-			WHERE license_id = a.license_id AND hardware_id = a.hardware_id
+			WHERE license_id = a.license_id AND hardware_id = a.hardware_id AND pipeline_id IS NULL
 			ORDER BY timestamp DESC LIMIT 1
 		) t ON true
 		WHERE l.user_id = $1 AND a.deactivated_at IS NULL
@@ -227,3 +239,76 @@ func (s *TelemetryService) GetActiveInstances(ctx context.Context, userID uuid.U
 	}
 	return instances, nil
 }
+
+// SetEventService enables dashboard stream events for instance status changes
+func (s *TelemetryService) SetEventService(eventService *EventService) {
+	s.eventService = eventService
+}
+
+// markInstanceSeen moves the instance's last_seen_at up to a sample's time, so
+// reporting instances show as online, and publishes the status if it changed
+func (s *TelemetryService) markInstanceSeen(ctx context.Context, licenseID uuid.UUID, hardwareID string, at time.Time) {
+	if now := time.Now().UTC(); at.After(now) {
+		at = now
+	}
+
+	var userID uuid.UUID
+	ev := InstanceStatusEvent{LicenseID: licenseID.String(), HardwareID: hardwareID}
+	err := s.db.Pool().QueryRow(ctx, `
+		UPDATE license_activations a SET last_seen_at = GREATEST(a.last_seen_at, $3)
+		FROM licenses l
+		WHERE a.license_id = $1 AND a.hardware_id = $2 AND a.deactivated_at IS NULL AND l.id = a.license_id
+		RETURNING l.user_id, COALESCE(a.hostname, ''), a.last_seen_at
+	`, licenseID, hardwareID, at).Scan(&userID, &ev.Hostname, &ev.LastSeenAt)
+	if err != nil {
+		if err != pgx.ErrNoRows {
+			log.Printf("Failed to update last seen of instance %s: %v", hardwareID, err)
+		}
+		return
+	}
+
+	ev.Status = instanceStatus(ev.LastSeenAt, time.Now())
+	s.eventService.UpdateInstanceStatus(ctx, userID, ev)
+}
+
+// FleetStats returns instance counts and the last telemetry time of every
+// active license, for the fleet gauges on /metrics
+func (s *TelemetryService) FleetStats(ctx context.Context) ([]metrics.FleetStat, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		WITH recent AS (
+			SELECT license_id, MAX(timestamp) AS last_at
+			FROM telemetry
+			WHERE timestamp > NOW() - INTERVAL '48 hours' AND pipeline_id IS NULL
+			GROUP BY license_id
+		), older AS (
+			SELECT license_id, MAX(bucket) AS last_at
+			FROM telemetry_hourly
+			GROUP BY license_id
+		)
+		SELECT l.user_id::text, l.id::text, l.tier,
+			COUNT(a.id) FILTER (WHERE a.last_seen_at > NOW() - INTERVAL '5 minutes'),
+			COUNT(a.id),
+			COALESCE(r.last_at, o.last_at)
+		FROM licenses l
+		LEFT JOIN license_activations a ON a.license_id = l.id AND a.deactivated_at IS NULL
+		LEFT JOIN recent r ON r.license_id = l.id
+		LEFT JOIN older o ON o.license_id = l.id
+		WHERE l.status = 'active' AND l.revoked_at IS NULL
+		GROUP BY l.user_id, l.id, l.tier, r.last_at, o.last_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []metrics.FleetStat
+	for rows.Next() {
+		var st metrics.FleetStat
+		if err := rows.Scan(&st.UserID, &st.LicenseID, &st.Tier, &st.OnlineInstances,
+			&st.ActiveInstances, &st.LastTelemetryAt); err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTelemetryUnsigned         = errors.New("telemetry must be signed")
+	ErrTelemetrySignatureInvalid = errors.New("invalid telemetry signature")
+	ErrTelemetryStale            = errors.New("telemetry timestamp outside allowed window")
+	ErrTelemetryReplayed         = errors.New("telemetry nonce already used")
+	ErrTelemetryUnknownInstance  = errors.New("no active activation for this instance")
+)
+
+// Telemetry signature headers sent by CDC engines
+const (
+	TelemetryTimestampHeader = "X-Savegress-Timestamp"
+	TelemetryNonceHeader     = "X-Savegress-Nonce"
+	TelemetrySignatureHeader = "X-Savegress-Signature"
+)
+
+// Quarantine reasons
+const (
+	QuarantineUnsigned         = "unsigned"
+	QuarantineInvalidSignature = "invalid_signature"
+	QuarantineStale            = "stale_timestamp"
+	QuarantineReplayed         = "replayed_nonce"
+	QuarantineUnknownInstance  = "unknown_instance"
+	QuarantineInvalidLicense   = "invalid_license"
+)
+
+// telemetryMaxSkew is how far a signed timestamp may be from the server clock.
+// Nonces are remembered for twice as long so a replay can never slip through.
+const telemetryMaxSkew = 5 * time.Minute
+
+// TelemetrySignature holds the signature headers of a telemetry request
+type TelemetrySignature struct {
+	Timestamp string
+	Nonce     string
+	Signature string
+}
+
+// QuarantinedTelemetry is a telemetry submission rejected as suspicious
+type QuarantinedTelemetry struct {
+	ID         uuid.UUID `json:"id"`
+	LicenseID  string    `json:"license_id"`
+	HardwareID string    `json:"hardware_id"`
+	Reason     string    `json:"reason"`
+	Payload    string    `json:"payload"`
+	RemoteIP   string    `json:"remote_ip"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// generateTelemetrySecret creates the HMAC key an activated instance signs telemetry with
+func generateTelemetrySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate telemetry secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SignTelemetry returns the hex HMAC-SHA256 of "timestamp.nonce.body" keyed with the activation's secret
+func SignTelemetry(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkTelemetrySignature verifies the timestamp window and HMAC of a signed request
+func checkTelemetrySignature(secret string, sig TelemetrySignature, body []byte, now time.Time) error {
+	if len(sig.Nonce) < 16 || len(sig.Nonce) > 64 {
+		return ErrTelemetrySignatureInvalid
+	}
+
+	ts, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+	if err != nil {
+		return ErrTelemetrySignatureInvalid
+	}
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew > telemetryMaxSkew || skew < -telemetryMaxSkew {
+		return ErrTelemetryStale
+	}
+
+	expected := SignTelemetry(secret, sig.Timestamp, sig.Nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(sig.Signature)) {
+		return ErrTelemetrySignatureInvalid
+	}
+	return nil
+}
+
+// QuarantineReason maps a telemetry verification error to a quarantine reason
+func QuarantineReason(err error) string {
+	switch err {
+	case ErrTelemetryUnsigned:
+		return QuarantineUnsigned
+	case ErrTelemetryStale:
+		return QuarantineStale
+	case ErrTelemetryReplayed:
+		return QuarantineReplayed
+	case ErrTelemetryUnknownInstance:
+		return QuarantineUnknownInstance
+	case ErrTelemetrySignatureInvalid:
+		return QuarantineInvalidSignature
+	default:
+		return QuarantineInvalidLicense
+	}
+}
+
+// SetSignatureEnforcement sets when unsigned telemetry stops being accepted.
+// The zero time keeps accepting unsigned telemetry.
+func (s *TelemetryService) SetSignatureEnforcement(requiredAfter time.Time) {
+	s.signaturesRequiredAfter = requiredAfter
+}
+
+// VerifyTelemetry authenticates a telemetry request against the secret of the
+// instance's activation and rejects replays. Unsigned requests are accepted
+// until the migration window closes.
+func (s *TelemetryService) VerifyTelemetry(ctx context.Context, licenseID, hardwareID string, sig TelemetrySignature, body []byte) error {
+	now := time.Now()
+	if sig.Signature == "" {
+		if s.signaturesRequiredAfter.IsZero() || now.Before(s.signaturesRequiredAfter) {
+			return nil
+		}
+		return ErrTelemetryUnsigned
+	}
+
+	var secret string
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT a.telemetry_secret FROM license_activations a
+		WHERE a.license_id::text = $1 AND a.hardware_id = $2
+		AND a.deactivated_at IS NULL AND a.telemetry_secret IS NOT NULL
+		ORDER BY a.last_seen_at DESC LIMIT 1
+	`, licenseID, hardwareID).Scan(&secret)
+	if err != nil {
+		return ErrTelemetryUnknownInstance
+	}
+
+	if err := checkTelemetrySignature(secret, sig, body, now); err != nil {
+		return err
+	}
+
+	// Only remember nonces of authentic requests so garbage can't fill Redis
+	key := fmt.Sprintf("telemetry:nonce:%s:%s:%s", licenseID, hardwareID, sig.Nonce)
+	fresh, err := s.redis.Client().SetNX(ctx, key, 1, 2*telemetryMaxSkew).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check telemetry nonce: %w", err)
+	}
+	if !fresh {
+		return ErrTelemetryReplayed
+	}
+	return nil
+}
+
+const (
+	// maxQuarantinedPayload caps how much of a rejected submission is kept
+	maxQuarantinedPayload = 64 << 10
+	// quarantineRateLimit caps the submissions kept per remote IP and per
+	// license each quarantineRateWindow; the rest are only rejected
+	quarantineRateLimit  = 30
+	quarantineRateWindow = time.Hour
+	// quarantineRetention is how long quarantined submissions are kept
+	quarantineRetention = 30 * 24 * time.Hour
+)
+
+// QuarantineTelemetry stores a rejected telemetry submission for review.
+// Submissions are unauthenticated, so their size, rate and age are capped.
+func (s *TelemetryService) QuarantineTelemetry(ctx context.Context, licenseID, hardwareID, reason string, payload []byte, remoteIP string) error {
+	licenseID, hardwareID, remoteIP = truncate(licenseID, 255), truncate(hardwareID, 255), truncate(remoteIP, 255)
+	allowed, err := s.quarantineAllowed(ctx, licenseID, remoteIP)
+	if err != nil || !allowed {
+		return err
+	}
+
+	if len(payload) > maxQuarantinedPayload {
+		payload = payload[:maxQuarantinedPayload]
+	}
+	_, err = s.db.Pool().Exec(ctx, `
+		INSERT INTO telemetry_quarantine (license_id, hardware_id, reason, payload, remote_ip)
+		VALUES ($1, $2, $3, $4, $5)
+	`, licenseID, hardwareID, reason, strings.ToValidUTF8(string(payload), ""), remoteIP)
+	return err
+}
+
+// quarantineAllowed counts a quarantined submission against the limits of
+// its remote IP and license, and reports whether it is within both
+func (s *TelemetryService) quarantineAllowed(ctx context.Context, licenseID, remoteIP string) (bool, error) {
+	for _, key := range []string{"telemetry:quarantine:ip:" + remoteIP, "telemetry:quarantine:license:" + licenseID} {
+		n, err := s.redis.Client().Incr(ctx, key).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to check quarantine rate: %w", err)
+		}
+		if n == 1 {
+			s.redis.Client().Expire(ctx, key, quarantineRateWindow)
+		}
+		if n > quarantineRateLimit {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PruneQuarantinedTelemetry deletes quarantined submissions older than quarantineRetention
+func (s *TelemetryService) PruneQuarantinedTelemetry(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := s.db.Pool().Exec(ctx, `
+		DELETE FROM telemetry_quarantine WHERE created_at < $1
+	`, now.Add(-quarantineRetention))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListQuarantinedTelemetry returns quarantined submissions, newest first (admin only)
+func (s *TelemetryService) ListQuarantinedTelemetry(ctx context.Context, reason string, limit, offset int) ([]QuarantinedTelemetry, int, error) {
+	var total int
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT COUNT(*) FROM telemetry_quarantine WHERE $1 = '' OR reason = $1
+	`, reason).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT id, license_id, hardware_id, reason, payload, remote_ip, created_at
+		FROM telemetry_quarantine
+		WHERE $1 = '' OR reason = $1
+		ORDER BY created_at DESC LIMIT $2 OFFSET $3
+	`, reason, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := make([]QuarantinedTelemetry, 0)
+	for rows.Next() {
+		var q QuarantinedTelemetry
+		if err := rows.Scan(&q.ID, &q.LicenseID, &q.HardwareID, &q.Reason, &q.Payload, &q.RemoteIP, &q.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, q)
+	}
+	return items, total, rows.Err()
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateTelemetrySecret(t *testing.T) {
+	a, err := generateTelemetrySecret()
+	assert.NoError(t, err)
+	b, err := generateTelemetrySecret()
+	assert.NoError(t, err)
+
+	assert.Len(t, a, 64)
+	assert.NotEqual(t, a, b)
+}
+
+func TestCheckTelemetrySignature(t *testing.T) {
+	secret := "s3cret"
+	body := []byte(`{"license_id":"lic","events_processed":10}`)
+	now := time.Unix(1735689600, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	nonce := "0123456789abcdef"
+
+	valid := TelemetrySignature{Timestamp: ts, Nonce: nonce, Signature: SignTelemetry(secret, ts, nonce, body)}
+	assert.NoError(t, checkTelemetrySignature(secret, valid, body, now))
+	assert.NoError(t, checkTelemetrySignature(secret, valid, body, now.Add(4*time.Minute)))
+
+	t.Run("tampered body", func(t *testing.T) {
+		err := checkTelemetrySignature(secret, valid, []byte(`{"license_id":"lic","events_processed":99}`), now)
+		assert.Equal(t, ErrTelemetrySignatureInvalid, err)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		assert.Equal(t, ErrTelemetrySignatureInvalid, checkTelemetrySignature("other", valid, body, now))
+	})
+
+	t.Run("stale timestamp", func(t *testing.T) {
+		assert.Equal(t, ErrTelemetryStale, checkTelemetrySignature(secret, valid, body, now.Add(6*time.Minute)))
+		assert.Equal(t, ErrTelemetryStale, checkTelemetrySignature(secret, valid, body, now.Add(-6*time.Minute)))
+	})
+
+	t.Run("malformed headers", func(t *testing.T) {
+		short := valid
+		short.Nonce = "abc"
+		assert.Equal(t, ErrTelemetrySignatureInvalid, checkTelemetrySignature(secret, short, body, now))
+
+		badTS := valid
+		badTS.Timestamp = "yesterday"
+		assert.Equal(t, ErrTelemetrySignatureInvalid, checkTelemetrySignature(secret, badTS, body, now))
+	})
+}
+
+func TestQuarantineReason(t *testing.T) {
+	assert.Equal(t, QuarantineUnsigned, QuarantineReason(ErrTelemetryUnsigned))
+	assert.Equal(t, QuarantineReplayed, QuarantineReason(ErrTelemetryReplayed))
+	assert.Equal(t, QuarantineStale, QuarantineReason(ErrTelemetryStale))
+	assert.Equal(t, QuarantineInvalidLicense, QuarantineReason(ErrLicenseExpired))
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	ErrTelemetryBatchTooLarge     = errors.New("telemetry batch too large")
+	ErrTelemetryBatchEmpty        = errors.New("telemetry batch is empty")
+	ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+	ErrTelemetryIngestBusy        = errors.New("telemetry ingest queue is full")
+)
+
+const (
+	// MaxTelemetryBatchItems caps the number of samples in one batch
+	MaxTelemetryBatchItems = 5000
+	// maxTelemetryBatchDecoded caps the decompressed batch size
+	maxTelemetryBatchDecoded = 32 << 20
+	// maxConcurrentTelemetryBatches is how many batches are processed at once
+	maxConcurrentTelemetryBatches = 8
+	// telemetryIngestWait is how long a batch may queue for a slot before backpressure kicks in
+	telemetryIngestWait = 2 * time.Second
+	// TelemetryRetryAfter is the suggested delay for a client that received backpressure
+	TelemetryRetryAfter = 30 * time.Second
+)
+
+// TelemetryBatchItemResult reports the outcome of a single sample in a batch
+type TelemetryBatchItemResult struct {
+	Line     int    `json:"line"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TelemetryBatchResult summarizes a batch ingestion
+type TelemetryBatchResult struct {
+	Accepted int                        `json:"accepted"`
+	Rejected int                        `json:"rejected"`
+	Items    []TelemetryBatchItemResult `json:"items"`
+}
+
+// DecodeTelemetryBody decompresses a request body according to its Content-Encoding.
+// The decompressed size is capped to guard against compression bombs.
+func DecodeTelemetryBody(r io.Reader, contentEncoding string) ([]byte, error) {
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		reader = r
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "zstd":
+		zr, err := zstd.NewReader(r, zstd.WithDecoderMaxMemory(maxTelemetryBatchDecoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return nil, ErrUnsupportedContentEncoding
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, maxTelemetryBatchDecoded+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress body: %w", err)
+	}
+	if len(body) > maxTelemetryBatchDecoded {
+		return nil, ErrTelemetryBatchTooLarge
+	}
+	return body, nil
+}
+
+// ParseTelemetryBatch splits an NDJSON body into samples. Lines that fail to
+// parse are reported in results without failing the whole batch; blank lines are skipped.
+func ParseTelemetryBatch(body []byte) ([]TelemetryInput, []TelemetryBatchItemResult, error) {
+	var inputs []TelemetryInput
+	var results []TelemetryBatchItemResult
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if len(results) >= MaxTelemetryBatchItems {
+			return nil, nil, ErrTelemetryBatchTooLarge
+		}
+
+		var input TelemetryInput
+		if err := json.Unmarshal(raw, &input); err != nil {
+			results = append(results, TelemetryBatchItemResult{Line: line, Error: "invalid JSON"})
+			inputs = append(inputs, TelemetryInput{})
+			continue
+		}
+		results = append(results, TelemetryBatchItemResult{Line: line, Accepted: true})
+		inputs = append(inputs, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, ErrTelemetryBatchTooLarge
+	}
+	if len(results) == 0 {
+		return nil, nil, ErrTelemetryBatchEmpty
+	}
+	return inputs, results, nil
+}
+
+// validateBatchItem checks a sample belongs to the submitting instance and is well formed
+func validateBatchItem(input TelemetryInput, licenseID, hardwareID string, now time.Time) error {
+	if input.LicenseID != licenseID || input.HardwareID != hardwareID {
+		return errors.New("sample belongs to a different instance than the batch")
+	}
+	return validateTelemetrySample(input, now)
+}
+
+// validateTelemetrySample checks a sample is well formed and falls within the
+// months that have partitions and the hours rollups still recompute
+func validateTelemetrySample(input TelemetryInput, now time.Time) error {
+	if input.Timestamp <= 0 {
+		return errors.New("timestamp is required")
+	}
+	ts := time.Unix(input.Timestamp, 0)
+	if ts.After(now.Add(telemetryMaxSkew)) {
+		return errors.New("timestamp is in the future")
+	}
+	if ts.Before(now.Add(-telemetryRollupLookback)) {
+		return errors.New("timestamp is too old")
+	}
+	if input.EventsProcessed < 0 || input.BytesProcessed < 0 || input.ErrorCount < 0 {
+		return errors.New("counters must not be negative")
+	}
+	for _, p := range input.Pipelines {
+		if _, err := uuid.Parse(p.PipelineID); err != nil {
+			return errors.New("invalid pipeline ID")
+		}
+		if p.EventsProcessed < 0 || p.BytesProcessed < 0 || p.ErrorCount < 0 || p.LagMs < 0 {
+			return errors.New("pipeline counters must not be negative")
+		}
+	}
+	return nil
+}
+
+// AcquireIngestSlot waits briefly for capacity to process a batch. It is
+// taken before the batch is decompressed and parsed, so the slots bound the
+// expensive part of ingest as well as the writes.
+func (s *TelemetryService) AcquireIngestSlot(ctx context.Context) (func(), error) {
+	timer := time.NewTimer(telemetryIngestWait)
+	defer timer.Stop()
+
+	select {
+	case s.ingestSlots <- struct{}{}:
+		return func() { <-s.ingestSlots }, nil
+	case <-timer.C:
+		return nil, ErrTelemetryIngestBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RecordTelemetryBatch bulk-inserts the accepted samples of a batch submitted by
+// one instance. results is updated in place with per-item rejections. The
+// caller holds an ingest slot.
+func (s *TelemetryService) RecordTelemetryBatch(ctx context.Context, licenseID, hardwareID string, inputs []TelemetryInput, results []TelemetryBatchItemResult) (*TelemetryBatchResult, error) {
+	license, err := uuid.Parse(licenseID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid license ID: %w", err)
+	}
+
+	now := time.Now()
+	valid := make([]TelemetryInput, 0, len(inputs))
+	var latest *TelemetryInput
+	for i, input := range inputs {
+		if !results[i].Accepted {
+			continue
+		}
+		if err := validateBatchItem(input, licenseID, hardwareID, now); err != nil {
+			results[i].Accepted = false
+			results[i].Error = err.Error()
+			continue
+		}
+
+		valid = append(valid, input)
+		if latest == nil || input.Timestamp >= latest.Timestamp {
+			latest = &inputs[i]
+		}
+	}
+
+	// Samples already recorded by an earlier attempt are accepted but not counted again
+	if err := s.storeTelemetrySamples(ctx, license, hardwareID, valid); err != nil {
+		return nil, fmt.Errorf("failed to store telemetry batch: %w", err)
+	}
+
+	// Cache latest state in Redis for real-time dashboard
+	if latest != nil {
+		state, _ := json.Marshal(latest)
+		key := fmt.Sprintf("telemetry:%s:%s", licenseID, hardwareID)
+		s.redis.Client().Set(ctx, key, state, 5*time.Minute)
+
+		s.markInstanceSeen(ctx, license, hardwareID, time.Unix(latest.Timestamp, 0).UTC())
+	}
+
+	result := &TelemetryBatchResult{Items: results}
+	for _, item := range results {
+		if item.Accepted {
+			result.Accepted++
+		} else {
+			result.Rejected++
+		}
+	}
+	return result, nil
+}
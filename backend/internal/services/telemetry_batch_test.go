@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const batchNDJSON = `{"license_id":"lic","hardware_id":"hw","timestamp":1735689600,"events_processed":10}
+{"license_id":"lic","hardware_id":"hw","timestamp":1735693200,"events_processed":20}
+`
+
+func TestDecodeTelemetryBody(t *testing.T) {
+	t.Run("identity", func(t *testing.T) {
+		body, err := DecodeTelemetryBody(strings.NewReader(batchNDJSON), "")
+		assert.NoError(t, err)
+		assert.Equal(t, batchNDJSON, string(body))
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(batchNDJSON))
+		gz.Close()
+
+		body, err := DecodeTelemetryBody(&buf, "gzip")
+		assert.NoError(t, err)
+		assert.Equal(t, batchNDJSON, string(body))
+	})
+
+	t.Run("zstd", func(t *testing.T) {
+		enc, _ := zstd.NewWriter(nil)
+		compressed := enc.EncodeAll([]byte(batchNDJSON), nil)
+		enc.Close()
+
+		body, err := DecodeTelemetryBody(bytes.NewReader(compressed), "zstd")
+		assert.NoError(t, err)
+		assert.Equal(t, batchNDJSON, string(body))
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		_, err := DecodeTelemetryBody(strings.NewReader(batchNDJSON), "br")
+		assert.Equal(t, ErrUnsupportedContentEncoding, err)
+	})
+
+	t.Run("corrupt gzip", func(t *testing.T) {
+		_, err := DecodeTelemetryBody(strings.NewReader("not gzip"), "gzip")
+		assert.Error(t, err)
+	})
+}
+
+func TestParseTelemetryBatch(t *testing.T) {
+	body := batchNDJSON + "\n{broken\n" + `{"license_id":"lic","hardware_id":"hw","timestamp":1735696800}`
+
+	inputs, results, err := ParseTelemetryBatch([]byte(body))
+	assert.NoError(t, err)
+	assert.Len(t, inputs, 4)
+	assert.Len(t, results, 4)
+
+	assert.True(t, results[0].Accepted)
+	assert.Equal(t, int64(20), inputs[1].EventsProcessed)
+	// Blank line is skipped but still counted for line numbers
+	assert.False(t, results[2].Accepted)
+	assert.Equal(t, 4, results[2].Line)
+	assert.Equal(t, "invalid JSON", results[2].Error)
+	assert.Equal(t, 5, results[3].Line)
+
+	_, _, err = ParseTelemetryBatch([]byte("\n\n"))
+	assert.Equal(t, ErrTelemetryBatchEmpty, err)
+
+	tooMany := strings.Repeat("{}\n", MaxTelemetryBatchItems+1)
+	_, _, err = ParseTelemetryBatch([]byte(tooMany))
+	assert.Equal(t, ErrTelemetryBatchTooLarge, err)
+}
+
+func TestValidateBatchItem(t *testing.T) {
+	now := time.Unix(1735700000, 0)
+	valid := TelemetryInput{LicenseID: "lic", HardwareID: "hw", Timestamp: 1735689600, EventsProcessed: 5}
+	assert.NoError(t, validateBatchItem(valid, "lic", "hw", now))
+
+	other := valid
+	other.HardwareID = "hw-2"
+	assert.Error(t, validateBatchItem(other, "lic", "hw", now))
+
+	missingTS := valid
+	missingTS.Timestamp = 0
+	assert.Error(t, validateBatchItem(missingTS, "lic", "hw", now))
+
+	future := valid
+	future.Timestamp = now.Add(time.Hour).Unix()
+	assert.Error(t, validateBatchItem(future, "lic", "hw", now))
+
+	old := valid
+	old.Timestamp = now.Add(-72 * time.Hour).Unix()
+	assert.Error(t, validateBatchItem(old, "lic", "hw", now))
+
+	badPipeline := valid
+	badPipeline.Pipelines = []PipelineSample{{PipelineID: "orders"}}
+	assert.Error(t, validateBatchItem(badPipeline, "lic", "hw", now))
+
+	negative := valid
+	negative.BytesProcessed = -1
+	assert.Error(t, validateBatchItem(negative, "lic", "hw", now))
+}
+
+func TestValidateTelemetrySample(t *testing.T) {
+	now := time.Unix(1735700000, 0)
+	// Single samples carry no batch identity, only the sample checks apply
+	valid := TelemetryInput{LicenseID: "lic", HardwareID: "hw", Timestamp: 1735689600}
+	assert.NoError(t, validateTelemetrySample(valid, now))
+
+	future := valid
+	future.Timestamp = now.AddDate(0, 2, 0).Unix()
+	assert.Error(t, validateTelemetrySample(future, now))
+
+	negative := valid
+	negative.ErrorCount = -1
+	assert.Error(t, validateTelemetrySample(negative, now))
+}
+
+func TestAcquireIngestSlot(t *testing.T) {
+	s := &TelemetryService{ingestSlots: make(chan struct{}, 1)}
+
+	release, err := s.AcquireIngestSlot(t.Context())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = s.AcquireIngestSlot(ctx)
+	assert.Error(t, err)
+
+	release()
+	release, err = s.AcquireIngestSlot(t.Context())
+	assert.NoError(t, err)
+	release()
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/metrics"
+)
+
+// federationLookback is how far back the latest report of an instance or pipeline is searched
+const federationLookback = "48 hours"
+
+// instanceOnlineWindow is how recently an instance must have been seen to count as online
+const instanceOnlineWindow = 5 * time.Minute
+
+// FederationSnapshot returns the latest telemetry of the user's instances and
+// pipelines, for the Prometheus federation endpoint
+func (s *TelemetryService) FederationSnapshot(ctx context.Context, userID uuid.UUID) (*metrics.AccountSnapshot, error) {
+	instances, err := s.federationInstances(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pipelines, err := s.federationPipelines(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &metrics.AccountSnapshot{Instances: instances, Pipelines: pipelines}, nil
+}
+
+func (s *TelemetryService) federationInstances(ctx context.Context, userID uuid.UUID) ([]metrics.EngineInstance, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT DISTINCT ON (a.license_id, a.hardware_id)
+			a.license_id::text, a.hardware_id, COALESCE(a.hostname, ''),
+			COALESCE(NULLIF(t.version, ''), a.version, ''), COALESCE(t.source_type, ''),
+			a.last_seen_at, t.timestamp,
+			COALESCE(t.events_processed, 0), COALESCE(t.bytes_processed, 0), COALESCE(t.error_count, 0),
+			COALESCE(t.avg_latency_ms, 0), COALESCE(t.uptime_hours, 0),
+			COALESCE(t.tables_tracked, 0), COALESCE(t.sources_active, 0)
+		FROM license_activations a
+		JOIN licenses l ON a.license_id = l.id
+		LEFT JOIN LATERAL (
+			SELECT timestamp, version, source_type, events_processed, bytes_processed, error_count,
+				avg_latency_ms, uptime_hours, tables_tracked, sources_active
+			FROM telemetry
+			WHERE license_id = a.license_id AND hardware_id = a.hardware_id AND pipeline_id IS NULL
+				AND timestamp > NOW() - INTERVAL '`+federationLookback+`'
+			ORDER BY timestamp DESC LIMIT 1
+		) t ON true
+		WHERE l.user_id = $1 AND a.deactivated_at IS NULL
+		ORDER BY a.license_id, a.hardware_id, a.last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	instances := make([]metrics.EngineInstance, 0)
+	for rows.Next() {
+		var in metrics.EngineInstance
+		if err := rows.Scan(&in.LicenseID, &in.HardwareID, &in.Hostname, &in.Version, &in.SourceType,
+			&in.LastSeenAt, &in.LastReportAt, &in.EventsProcessed, &in.BytesProcessed, &in.ErrorCount,
+			&in.AvgLatencyMs, &in.UptimeHours, &in.TablesTracked, &in.SourcesActive); err != nil {
+			return nil, err
+		}
+		in.Online = now.Sub(in.LastSeenAt) < instanceOnlineWindow
+		instances = append(instances, in)
+	}
+	return instances, rows.Err()
+}
+
+func (s *TelemetryService) federationPipelines(ctx context.Context, userID uuid.UUID) ([]metrics.EnginePipeline, error) {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT p.id::text, p.name, p.status, COALESCE(p.license_id::text, ''), COALESCE(p.hardware_id, ''),
+			p.events_processed, p.bytes_processed, p.current_lag_ms, p.last_event_at,
+			t.timestamp, COALESCE(t.error_count, 0), COALESCE(t.avg_latency_ms, 0)
+		FROM pipelines p
+		LEFT JOIN LATERAL (
+			SELECT timestamp, error_count, avg_latency_ms
+			FROM telemetry
+			WHERE pipeline_id = p.id AND timestamp > NOW() - INTERVAL '`+federationLookback+`'
+			ORDER BY timestamp DESC LIMIT 1
+		) t ON true
+		WHERE p.user_id = $1
+		ORDER BY p.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pipelines := make([]metrics.EnginePipeline, 0)
+	for rows.Next() {
+		var p metrics.EnginePipeline
+		if err := rows.Scan(&p.PipelineID, &p.Name, &p.Status, &p.LicenseID, &p.HardwareID,
+			&p.EventsProcessed, &p.BytesProcessed, &p.LagMs, &p.LastEventAt,
+			&p.LastReportAt, &p.ErrorCount, &p.AvgLatencyMs); err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, p)
+	}
+	return pipelines, rows.Err()
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// PipelineSample is the per-pipeline part of a telemetry sample. Counters are
+// deltas since the engine's previous report, like the instance counters.
+type PipelineSample struct {
+	PipelineID      string  `json:"pipeline_id"`
+	EventsProcessed int64   `json:"events_processed"`
+	BytesProcessed  int64   `json:"bytes_processed"`
+	ErrorCount      int64   `json:"error_count"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+	LagMs           int64   `json:"lag_ms"`
+	LastEventAt     int64   `json:"last_event_at,omitempty"` // unix seconds
+	State           string  `json:"state,omitempty"`         // running, paused, stopped, error
+	ErrorMessage    string  `json:"error_message,omitempty"`
+}
+
+// telemetryCopyColumns is the column order of rows built for bulk telemetry inserts
+var telemetryCopyColumns = []string{
+	"id", "license_id", "hardware_id", "timestamp", "events_processed", "bytes_processed",
+	"tables_tracked", "sources_active", "avg_latency_ms", "error_count", "uptime_hours",
+	"version", "source_type", "pipeline_id", "lag_ms",
+}
+
+// SetPipelineService enables per-pipeline telemetry
+func (s *TelemetryService) SetPipelineService(pipelineService *PipelineService) {
+	s.pipelineService = pipelineService
+}
+
+// instanceTelemetryRow builds the instance totals row of a sample
+func instanceTelemetryRow(licenseID uuid.UUID, input TelemetryInput) []interface{} {
+	return []interface{}{
+		uuid.New(), licenseID, input.HardwareID, time.Unix(input.Timestamp, 0).UTC(),
+		input.EventsProcessed, input.BytesProcessed, input.TablesTracked, input.SourcesActive,
+		input.AvgLatencyMs, input.ErrorCount, input.UptimeHours,
+		truncate(input.Version, 50), truncate(input.SourceType, 50), nil, int64(0),
+	}
+}
+
+// pipelineTelemetryRows builds one row per sampled pipeline that is in known
+func pipelineTelemetryRows(licenseID uuid.UUID, input TelemetryInput, known map[uuid.UUID]bool) [][]interface{} {
+	var rows [][]interface{}
+	for _, p := range input.Pipelines {
+		pipelineID, err := uuid.Parse(p.PipelineID)
+		if err != nil || !known[pipelineID] {
+			continue
+		}
+		rows = append(rows, []interface{}{
+			uuid.New(), licenseID, input.HardwareID, time.Unix(input.Timestamp, 0).UTC(),
+			p.EventsProcessed, p.BytesProcessed, 0, 0,
+			p.AvgLatencyMs, p.ErrorCount, 0.0,
+			truncate(input.Version, 50), truncate(input.SourceType, 50), pipelineID, p.LagMs,
+		})
+	}
+	return rows
+}
+
+// mergePipelineSamples folds the pipeline samples of one instance into a stats
+// update per pipeline: counters are summed, while lag, state and error come
+// from the most recent sample.
+func mergePipelineSamples(licenseID uuid.UUID, hardwareID string, inputs []TelemetryInput) []PipelineStatsUpdate {
+	var updates []PipelineStatsUpdate
+	index := make(map[uuid.UUID]int)
+	latest := make(map[uuid.UUID]int64)
+
+	for _, input := range inputs {
+		for _, p := range input.Pipelines {
+			pipelineID, err := uuid.Parse(p.PipelineID)
+			if err != nil {
+				continue
+			}
+
+			i, ok := index[pipelineID]
+			if !ok {
+				i = len(updates)
+				index[pipelineID] = i
+				updates = append(updates, PipelineStatsUpdate{
+					PipelineID: pipelineID,
+					LicenseID:  licenseID,
+					HardwareID: hardwareID,
+				})
+			}
+			u := &updates[i]
+			u.EventsProcessed += p.EventsProcessed
+			u.BytesProcessed += p.BytesProcessed
+
+			if p.LastEventAt > 0 {
+				t := time.Unix(p.LastEventAt, 0).UTC()
+				if u.LastEventAt == nil || t.After(*u.LastEventAt) {
+					u.LastEventAt = &t
+				}
+			}
+			if !ok || input.Timestamp >= latest[pipelineID] {
+				latest[pipelineID] = input.Timestamp
+				u.LagMs = p.LagMs
+				u.State = p.State
+				u.ErrorMessage = truncate(p.ErrorMessage, 2000)
+			}
+		}
+	}
+	return updates
+}
+
+// pipelineStatsChange is a stats update to publish once its transaction commits
+type pipelineStatsChange struct {
+	userID uuid.UUID
+	event  *PipelineStatsEvent
+}
+
+// applyPipelineSamples updates runtime stats of the sampled pipelines within tx.
+// It returns the pipelines that belong to the license owner and the changes to
+// publish after commit.
+func (s *TelemetryService) applyPipelineSamples(ctx context.Context, tx pgx.Tx, licenseID uuid.UUID, hardwareID string, inputs []TelemetryInput) (map[uuid.UUID]bool, []pipelineStatsChange, error) {
+	known := make(map[uuid.UUID]bool)
+	if s.pipelineService == nil {
+		return known, nil, nil
+	}
+
+	var changes []pipelineStatsChange
+	for _, u := range mergePipelineSamples(licenseID, hardwareID, inputs) {
+		userID, ev, err := s.pipelineService.UpdatePipelineStats(ctx, tx, u)
+		if errors.Is(err, ErrPipelineNotFound) {
+			log.Printf("Ignoring telemetry for unknown pipeline %s from license %s", u.PipelineID, licenseID)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		known[u.PipelineID] = true
+		changes = append(changes, pipelineStatsChange{userID: userID, event: ev})
+	}
+	return known, changes, nil
+}
+
+// freshTelemetrySamples keeps the first sample per timestamp among those whose
+// timestamps were claimed
+func freshTelemetrySamples(inputs []TelemetryInput, claimed map[int64]bool) []TelemetryInput {
+	fresh := make([]TelemetryInput, 0, len(inputs))
+	for _, input := range inputs {
+		if claimed[input.Timestamp] {
+			fresh = append(fresh, input)
+			delete(claimed, input.Timestamp)
+		}
+	}
+	return fresh
+}
+
+// claimTelemetrySamples records the sample timestamps of an instance within tx
+// and returns the samples that were not recorded before. A sample is keyed on
+// its timestamp, so an engine retrying an upload is not counted twice.
+func claimTelemetrySamples(ctx context.Context, tx pgx.Tx, licenseID uuid.UUID, hardwareID string, inputs []TelemetryInput) ([]TelemetryInput, error) {
+	timestamps := make([]time.Time, len(inputs))
+	for i, input := range inputs {
+		timestamps[i] = time.Unix(input.Timestamp, 0).UTC()
+	}
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO telemetry_receipts (license_id, hardware_id, timestamp)
+		SELECT $1, $2, unnest($3::timestamptz[])
+		ON CONFLICT DO NOTHING
+		RETURNING timestamp
+	`, licenseID, hardwareID, timestamps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claimed := make(map[int64]bool)
+	for rows.Next() {
+		var ts time.Time
+		if err := rows.Scan(&ts); err != nil {
+			return nil, err
+		}
+		claimed[ts.Unix()] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return freshTelemetrySamples(inputs, claimed), nil
+}
+
+// storeTelemetrySamples records the samples of one instance and the runtime
+// stats of their pipelines in a single transaction. Samples already recorded
+// are skipped.
+func (s *TelemetryService) storeTelemetrySamples(ctx context.Context, licenseID uuid.UUID, hardwareID string, inputs []TelemetryInput) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	fresh, err := claimTelemetrySamples(ctx, tx, licenseID, hardwareID, inputs)
+	if err != nil {
+		return fmt.Errorf("failed to claim samples: %w", err)
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	known, changes, err := s.applyPipelineSamples(ctx, tx, licenseID, hardwareID, fresh)
+	if err != nil {
+		return fmt.Errorf("failed to update pipeline stats: %w", err)
+	}
+
+	rows := make([][]interface{}, 0, len(fresh))
+	for _, input := range fresh {
+		rows = append(rows, instanceTelemetryRow(licenseID, input))
+		rows = append(rows, pipelineTelemetryRows(licenseID, input, known)...)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"telemetry"}, telemetryCopyColumns, pgx.CopyFromRows(rows)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		s.pipelineService.PublishPipelineStats(ctx, c.userID, c.event)
+	}
+	return nil
+}
+
+// PruneTelemetryReceipts forgets recorded sample timestamps older than
+// telemetryReceiptRetention
+func (s *TelemetryService) PruneTelemetryReceipts(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := s.db.Pool().Exec(ctx, `
+		DELETE FROM telemetry_receipts WHERE received_at < $1
+	`, now.Add(-telemetryReceiptRetention))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePipelineSamples(t *testing.T) {
+	licenseID := uuid.New()
+	orders, users := uuid.New(), uuid.New()
+
+	inputs := []TelemetryInput{
+		{Timestamp: 200, Pipelines: []PipelineSample{
+			{PipelineID: orders.String(), EventsProcessed: 5, BytesProcessed: 50, LagMs: 10, State: "running", LastEventAt: 190},
+		}},
+		// Older sample arriving later in the batch must not override lag and state
+		{Timestamp: 100, Pipelines: []PipelineSample{
+			{PipelineID: orders.String(), EventsProcessed: 3, BytesProcessed: 30, LagMs: 900, State: "error", ErrorMessage: "boom", LastEventAt: 95},
+			{PipelineID: users.String(), EventsProcessed: 1, State: "paused"},
+			{PipelineID: "not-a-uuid", EventsProcessed: 100},
+		}},
+	}
+
+	updates := mergePipelineSamples(licenseID, "hw-1", inputs)
+	assert.Len(t, updates, 2)
+
+	o := updates[0]
+	assert.Equal(t, orders, o.PipelineID)
+	assert.Equal(t, licenseID, o.LicenseID)
+	assert.Equal(t, "hw-1", o.HardwareID)
+	assert.Equal(t, int64(8), o.EventsProcessed)
+	assert.Equal(t, int64(80), o.BytesProcessed)
+	assert.Equal(t, int64(10), o.LagMs)
+	assert.Equal(t, "running", o.State)
+	assert.Empty(t, o.ErrorMessage)
+	assert.Equal(t, time.Unix(190, 0).UTC(), *o.LastEventAt)
+
+	u := updates[1]
+	assert.Equal(t, users, u.PipelineID)
+	assert.Equal(t, "paused", u.State)
+	assert.Nil(t, u.LastEventAt)
+}
+
+func TestPipelineTelemetryRows(t *testing.T) {
+	licenseID := uuid.New()
+	known, unknown := uuid.New(), uuid.New()
+	input := TelemetryInput{
+		HardwareID: "hw-1",
+		Timestamp:  1735689600,
+		Version:    "1.2.0",
+		Pipelines: []PipelineSample{
+			{PipelineID: known.String(), EventsProcessed: 7, LagMs: 42},
+			{PipelineID: unknown.String(), EventsProcessed: 9},
+		},
+	}
+
+	rows := pipelineTelemetryRows(licenseID, input, map[uuid.UUID]bool{known: true})
+	assert.Len(t, rows, 1)
+	assert.Len(t, rows[0], len(telemetryCopyColumns))
+	assert.Equal(t, int64(7), rows[0][4])
+	assert.Equal(t, known, rows[0][13])
+	assert.Equal(t, int64(42), rows[0][14])
+
+	instance := instanceTelemetryRow(licenseID, input)
+	assert.Len(t, instance, len(telemetryCopyColumns))
+	assert.Nil(t, instance[13])
+}
+
+func TestFreshTelemetrySamples(t *testing.T) {
+	inputs := []TelemetryInput{
+		{Timestamp: 100, EventsProcessed: 1},
+		{Timestamp: 200, EventsProcessed: 2},
+		{Timestamp: 100, EventsProcessed: 3}, // same sample sent twice in one batch
+		{Timestamp: 300, EventsProcessed: 4},
+	}
+
+	fresh := freshTelemetrySamples(inputs, map[int64]bool{100: true, 300: true})
+	assert.Len(t, fresh, 2)
+	assert.Equal(t, int64(1), fresh[0].EventsProcessed)
+	assert.Equal(t, int64(4), fresh[1].EventsProcessed)
+
+	assert.Empty(t, freshTelemetrySamples(inputs, map[int64]bool{}))
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// telemetryPartitionsAhead is how many future monthly partitions are kept ready
+	telemetryPartitionsAhead = 2
+	// telemetryRollupLookback is how far back rollups are recomputed on each run.
+	// Batched samples older than this are rejected so rollups never miss them.
+	telemetryRollupLookback = 48 * time.Hour
+
+	// telemetryReceiptRetention is how long recorded sample timestamps are
+	// kept to recognise retried uploads. It is well past the rollup lookback,
+	// beyond which batched samples are rejected anyway.
+	telemetryReceiptRetention = 7 * 24 * time.Hour
+	// usageRollupThresholdDays is the longest usage history served from raw telemetry
+	usageRollupThresholdDays = 7
+)
+
+// SetRetention sets how many months of raw telemetry partitions are kept
+func (s *TelemetryService) SetRetention(months int) {
+	s.retentionMonths = months
+}
+
+// telemetryPartitionName returns the name of the partition holding the given month
+func telemetryPartitionName(month time.Time) string {
+	return fmt.Sprintf("telemetry_y%04dm%02d", month.Year(), int(month.Month()))
+}
+
+// parseTelemetryPartitionName returns the month a partition holds, or false for
+// tables that aren't monthly partitions (like the default partition)
+func parseTelemetryPartitionName(name string) (time.Time, bool) {
+	var year, month int
+	if n, err := fmt.Sscanf(name, "telemetry_y%04dm%02d", &year, &month); err != nil || n != 2 {
+		return time.Time{}, false
+	}
+	if month < 1 || month > 12 || name != telemetryPartitionName(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)) {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// startOfMonth returns midnight UTC on the first day of t's month
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// upcomingPartitionMonths returns the current month and the ones after it that need partitions
+func upcomingPartitionMonths(now time.Time, ahead int) []time.Time {
+	start := startOfMonth(now)
+	months := make([]time.Time, 0, ahead+1)
+	for i := 0; i <= ahead; i++ {
+		months = append(months, start.AddDate(0, i, 0))
+	}
+	return months
+}
+
+// retentionCutoff returns the start of the oldest month still retained
+func retentionCutoff(now time.Time, months int) time.Time {
+	return startOfMonth(now).AddDate(0, -months, 0)
+}
+
+// expiredPartitions returns the monthly partitions that lie entirely before the cutoff
+func expiredPartitions(names []string, cutoff time.Time) []string {
+	var expired []string
+	for _, name := range names {
+		month, ok := parseTelemetryPartitionName(name)
+		if !ok {
+			continue
+		}
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	return expired
+}
+
+// EnsureTelemetryPartitions creates the monthly partitions for the current and upcoming months
+func (s *TelemetryService) EnsureTelemetryPartitions(ctx context.Context, now time.Time) error {
+	for _, month := range upcomingPartitionMonths(now, telemetryPartitionsAhead) {
+		name := pgx.Identifier{telemetryPartitionName(month)}.Sanitize()
+		_, err := s.db.Pool().Exec(ctx, fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF telemetry FOR VALUES FROM ('%s') TO ('%s')`,
+			name, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339)))
+		if err != nil {
+			return fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// DropExpiredTelemetry drops raw telemetry partitions and hourly rollups past retention.
+// Daily rollups are kept.
+func (s *TelemetryService) DropExpiredTelemetry(ctx context.Context, now time.Time) error {
+	if s.retentionMonths <= 0 {
+		return nil
+	}
+	cutoff := retentionCutoff(now, s.retentionMonths)
+
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'telemetry'
+	`)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range expiredPartitions(names, cutoff) {
+		if _, err := s.db.Pool().Exec(ctx, "DROP TABLE IF EXISTS "+pgx.Identifier{name}.Sanitize()); err != nil {
+			return fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		log.Printf("Dropped expired telemetry partition %s", name)
+	}
+
+	if _, err := s.db.Pool().Exec(ctx, `DELETE FROM telemetry_default WHERE timestamp < $1`, cutoff); err != nil {
+		return err
+	}
+	_, err = s.db.Pool().Exec(ctx, `DELETE FROM telemetry_hourly WHERE bucket < $1`, cutoff)
+	return err
+}
+
+// RollupTelemetry recomputes hourly rollups from raw telemetry and daily rollups
+// from the hourly ones for the lookback window, and the daily per-pipeline
+// usage that statements are built from.
+func (s *TelemetryService) RollupTelemetry(ctx context.Context, now time.Time) error {
+	since := now.UTC().Add(-telemetryRollupLookback).Truncate(time.Hour)
+
+	_, err := s.db.Pool().Exec(ctx, `
+		INSERT INTO telemetry_hourly (license_id, hardware_id, bucket, events_processed, bytes_processed,
+			error_count, avg_latency_ms, uptime_hours, sample_count, source_type)
+		SELECT license_id, hardware_id, date_trunc('hour', timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+			SUM(events_processed), SUM(bytes_processed), SUM(error_count),
+			AVG(avg_latency_ms), SUM(uptime_hours), COUNT(*), MAX(COALESCE(source_type, ''))
+		FROM telemetry
+		WHERE timestamp >= $1 AND pipeline_id IS NULL
+		GROUP BY 1, 2, 3
+		ON CONFLICT (license_id, hardware_id, bucket) DO UPDATE SET
+			events_processed = EXCLUDED.events_processed,
+			bytes_processed = EXCLUDED.bytes_processed,
+			error_count = EXCLUDED.error_count,
+			avg_latency_ms = EXCLUDED.avg_latency_ms,
+			uptime_hours = EXCLUDED.uptime_hours,
+			sample_count = EXCLUDED.sample_count,
+			source_type = EXCLUDED.source_type
+	`, since)
+	if err != nil {
+		return fmt.Errorf("failed to roll up hourly telemetry: %w", err)
+	}
+
+	// Recompute whole days so a day's total always covers all of its hours
+	day := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC)
+	_, err = s.db.Pool().Exec(ctx, `
+		INSERT INTO telemetry_daily (license_id, hardware_id, bucket, events_processed, bytes_processed,
+			error_count, avg_latency_ms, uptime_hours, sample_count, source_type)
+		SELECT license_id, hardware_id, (bucket AT TIME ZONE 'UTC')::date,
+			SUM(events_processed), SUM(bytes_processed), SUM(error_count),
+			COALESCE(SUM(avg_latency_ms * sample_count) / NULLIF(SUM(sample_count), 0), 0),
+			SUM(uptime_hours), SUM(sample_count), MAX(source_type)
+		FROM telemetry_hourly
+		WHERE bucket >= $1
+		GROUP BY 1, 2, 3
+		ON CONFLICT (license_id, hardware_id, bucket) DO UPDATE SET
+			events_processed = EXCLUDED.events_processed,
+			bytes_processed = EXCLUDED.bytes_processed,
+			error_count = EXCLUDED.error_count,
+			avg_latency_ms = EXCLUDED.avg_latency_ms,
+			uptime_hours = EXCLUDED.uptime_hours,
+			sample_count = EXCLUDED.sample_count,
+			source_type = EXCLUDED.source_type
+	`, day)
+	if err != nil {
+		return fmt.Errorf("failed to roll up daily telemetry: %w", err)
+	}
+
+	_, err = s.db.Pool().Exec(ctx, `
+		INSERT INTO telemetry_pipeline_daily (license_id, hardware_id, pipeline_id, bucket, events_processed,
+			bytes_processed, error_count, uptime_hours, source_type)
+		SELECT license_id, hardware_id, pipeline_id, (timestamp AT TIME ZONE 'UTC')::date,
+			SUM(events_processed), SUM(bytes_processed), SUM(error_count), SUM(uptime_hours),
+			MAX(COALESCE(source_type, ''))
+		FROM telemetry
+		WHERE timestamp >= $1 AND pipeline_id IS NOT NULL
+		GROUP BY 1, 2, 3, 4
+		ON CONFLICT (license_id, hardware_id, pipeline_id, bucket) DO UPDATE SET
+			events_processed = EXCLUDED.events_processed,
+			bytes_processed = EXCLUDED.bytes_processed,
+			error_count = EXCLUDED.error_count,
+			uptime_hours = EXCLUDED.uptime_hours,
+			source_type = EXCLUDED.source_type
+	`, day)
+	if err != nil {
+		return fmt.Errorf("failed to roll up daily pipeline telemetry: %w", err)
+	}
+	return nil
+}
+
+// MaintainStorage creates upcoming partitions, refreshes rollups and applies
+// retention. A partition that can't be created is logged, not fatal.
+func (s *TelemetryService) MaintainStorage(ctx context.Context) error {
+	now := time.Now()
+	// Samples already in the default partition can block creating a month;
+	// that must not stop rollups and retention
+	if err := s.EnsureTelemetryPartitions(ctx, now); err != nil {
+		log.Printf("Failed to create telemetry partitions: %v", err)
+	}
+	if err := s.RollupTelemetry(ctx, now); err != nil {
+		return err
+	}
+	if _, err := s.PruneQuarantinedTelemetry(ctx, now); err != nil {
+		return fmt.Errorf("failed to prune quarantined telemetry: %w", err)
+	}
+	if _, err := s.PruneTelemetryReceipts(ctx, now); err != nil {
+		return fmt.Errorf("failed to prune telemetry receipts: %w", err)
+	}
+	return s.DropExpiredTelemetry(ctx, now)
+}
+
+// Start runs telemetry storage maintenance until ctx is cancelled
+func (s *TelemetryService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.MaintainStorage(ctx); err != nil {
+			log.Printf("Telemetry storage maintenance failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
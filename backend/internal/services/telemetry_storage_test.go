@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelemetryPartitionName(t *testing.T) {
+	month := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "telemetry_y2025m03", telemetryPartitionName(month))
+
+	parsed, ok := parseTelemetryPartitionName("telemetry_y2025m03")
+	assert.True(t, ok)
+	assert.Equal(t, month, parsed)
+
+	for _, name := range []string{"telemetry_default", "telemetry_y2025m13", "telemetry_y2025m3", "telemetry_hourly"} {
+		_, ok := parseTelemetryPartitionName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestUpcomingPartitionMonths(t *testing.T) {
+	months := upcomingPartitionMonths(time.Date(2025, 11, 20, 15, 0, 0, 0, time.UTC), 2)
+	assert.Equal(t, []time.Time{
+		time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, months)
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	now := time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC)
+	cutoff := retentionCutoff(now, 3)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), cutoff)
+
+	expired := expiredPartitions([]string{
+		"telemetry_default",
+		"telemetry_y2024m12",
+		"telemetry_y2025m02",
+		"telemetry_y2025m03",
+		"telemetry_y2025m06",
+	}, cutoff)
+	assert.Equal(t, []string{"telemetry_y2024m12", "telemetry_y2025m02"}, expired)
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/savegress/platform/backend/internal/repository"
+)
+
+var ErrInvalidStatementPeriod = errors.New("invalid statement period, expected YYYY-MM")
+
+// UsageStatementLine is the usage of one license/instance/pipeline/source type combination
+type UsageStatementLine struct {
+	LicenseID       uuid.UUID  `json:"license_id"`
+	LicenseTier     string     `json:"license_tier"`
+	HardwareID      string     `json:"hardware_id"`
+	PipelineID      *uuid.UUID `json:"pipeline_id,omitempty"`
+	PipelineName    string     `json:"pipeline_name,omitempty"`
+	SourceType      string     `json:"source_type"`
+	EventsProcessed int64      `json:"events_processed"`
+	BytesProcessed  int64      `json:"bytes_processed"`
+	ErrorCount      int64      `json:"error_count"`
+	UptimeHours     float64    `json:"uptime_hours"`
+}
+
+// UsageStatementTotals sums up a usage statement
+type UsageStatementTotals struct {
+	EventsProcessed int64   `json:"events_processed"`
+	BytesProcessed  int64   `json:"bytes_processed"`
+	ErrorCount      int64   `json:"error_count"`
+	UptimeHours     float64 `json:"uptime_hours"`
+	Licenses        int     `json:"licenses"`
+	Instances       int     `json:"instances"`
+	Pipelines       int     `json:"pipelines"`
+}
+
+// UsageStatement is the monthly usage of an account
+type UsageStatement struct {
+	UserID      uuid.UUID            `json:"user_id"`
+	Period      string               `json:"period"` // YYYY-MM
+	PeriodStart time.Time            `json:"period_start"`
+	PeriodEnd   time.Time            `json:"period_end"` // exclusive
+	GeneratedAt time.Time            `json:"generated_at"`
+	Totals      UsageStatementTotals `json:"totals"`
+	Lines       []UsageStatementLine `json:"lines"`
+}
+
+// UsageStatementService builds monthly usage statements and emails them to
+// accounts that opted in.
+type UsageStatementService struct {
+	db           *repository.PostgresDB
+	emailService *EmailService
+}
+
+// NewUsageStatementService creates a new usage statement service
+func NewUsageStatementService(db *repository.PostgresDB, emailService *EmailService) *UsageStatementService {
+	return &UsageStatementService{db: db, emailService: emailService}
+}
+
+// ParseStatementPeriod parses a YYYY-MM period into its UTC start and (exclusive) end
+func ParseStatementPeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidStatementPeriod
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// previousPeriod returns the YYYY-MM period of the month before now
+func previousPeriod(now time.Time) string {
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return firstOfMonth.AddDate(0, -1, 0).Format("2006-01")
+}
+
+// statementTotals sums the lines of a statement
+func statementTotals(lines []UsageStatementLine) UsageStatementTotals {
+	var totals UsageStatementTotals
+	licenses := make(map[uuid.UUID]bool)
+	instances := make(map[string]bool)
+	pipelines := make(map[uuid.UUID]bool)
+	for _, line := range lines {
+		totals.EventsProcessed += line.EventsProcessed
+		totals.BytesProcessed += line.BytesProcessed
+		totals.ErrorCount += line.ErrorCount
+		totals.UptimeHours += line.UptimeHours
+		licenses[line.LicenseID] = true
+		instances[line.LicenseID.String()+"/"+line.HardwareID] = true
+		if line.PipelineID != nil {
+			pipelines[*line.PipelineID] = true
+		}
+	}
+	totals.Licenses = len(licenses)
+	totals.Instances = len(instances)
+	totals.Pipelines = len(pipelines)
+	return totals
+}
+
+// statementLines completes the per-pipeline lines of a statement with the
+// usage of each instance that isn't attributed to any of its pipelines, from
+// engines that don't report a breakdown and for uptime, which only instances
+// report. Instance totals come from instanceLines.
+func statementLines(pipelineLines, instanceLines []UsageStatementLine) []UsageStatementLine {
+	type instanceKey struct {
+		licenseID  uuid.UUID
+		hardwareID string
+		sourceType string
+	}
+	attributed := make(map[instanceKey]UsageStatementLine)
+	for _, line := range pipelineLines {
+		key := instanceKey{line.LicenseID, line.HardwareID, line.SourceType}
+		sum := attributed[key]
+		sum.EventsProcessed += line.EventsProcessed
+		sum.BytesProcessed += line.BytesProcessed
+		sum.ErrorCount += line.ErrorCount
+		sum.UptimeHours += line.UptimeHours
+		attributed[key] = sum
+	}
+
+	lines := append([]UsageStatementLine{}, pipelineLines...)
+	for _, inst := range instanceLines {
+		sum := attributed[instanceKey{inst.LicenseID, inst.HardwareID, inst.SourceType}]
+		rest := inst
+		rest.EventsProcessed = max(inst.EventsProcessed-sum.EventsProcessed, 0)
+		rest.BytesProcessed = max(inst.BytesProcessed-sum.BytesProcessed, 0)
+		rest.ErrorCount = max(inst.ErrorCount-sum.ErrorCount, 0)
+		rest.UptimeHours = max(inst.UptimeHours-sum.UptimeHours, 0)
+		if rest.EventsProcessed > 0 || rest.BytesProcessed > 0 || rest.ErrorCount > 0 || rest.UptimeHours > 0 {
+			lines = append(lines, rest)
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if a.LicenseID != b.LicenseID {
+			return a.LicenseID.String() < b.LicenseID.String()
+		}
+		if a.HardwareID != b.HardwareID {
+			return a.HardwareID < b.HardwareID
+		}
+		if (a.PipelineID == nil) != (b.PipelineID == nil) {
+			return b.PipelineID == nil
+		}
+		if a.PipelineName != b.PipelineName {
+			return a.PipelineName < b.PipelineName
+		}
+		return a.SourceType < b.SourceType
+	})
+	return lines
+}
+
+// queryStatementLines runs a statement query for a user ($1) and period ($2, $3)
+func (s *UsageStatementService) queryStatementLines(ctx context.Context, query string, userID uuid.UUID, start, end time.Time) ([]UsageStatementLine, error) {
+	rows, err := s.db.Pool().Query(ctx, query, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]UsageStatementLine, 0)
+	for rows.Next() {
+		var line UsageStatementLine
+		if err := rows.Scan(&line.LicenseID, &line.LicenseTier, &line.HardwareID, &line.PipelineID,
+			&line.PipelineName, &line.SourceType, &line.EventsProcessed, &line.BytesProcessed,
+			&line.ErrorCount, &line.UptimeHours); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// GetStatement builds the usage statement of a user for a YYYY-MM period from
+// the daily rollups, which outlive raw telemetry. Lines break usage down per
+// pipeline; totals are the instance totals.
+func (s *UsageStatementService) GetStatement(ctx context.Context, userID uuid.UUID, period string) (*UsageStatement, error) {
+	start, end, err := ParseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelineLines, err := s.queryStatementLines(ctx, `
+		SELECT d.license_id, l.tier, d.hardware_id, d.pipeline_id, COALESCE(p.name, ''), d.source_type,
+			SUM(d.events_processed), SUM(d.bytes_processed), SUM(d.error_count), SUM(d.uptime_hours)
+		FROM telemetry_pipeline_daily d
+		JOIN licenses l ON d.license_id = l.id
+		JOIN pipelines p ON d.pipeline_id = p.id
+		WHERE l.user_id = $1 AND d.bucket >= ($2::timestamptz AT TIME ZONE 'UTC')::date
+			AND d.bucket < ($3::timestamptz AT TIME ZONE 'UTC')::date
+		GROUP BY d.license_id, l.tier, d.hardware_id, d.pipeline_id, p.name, d.source_type
+	`, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceLines, err := s.queryStatementLines(ctx, `
+		SELECT d.license_id, l.tier, d.hardware_id, NULL::uuid, '', d.source_type,
+			SUM(d.events_processed), SUM(d.bytes_processed), SUM(d.error_count), SUM(d.uptime_hours)
+		FROM telemetry_daily d
+		JOIN licenses l ON d.license_id = l.id
+		WHERE l.user_id = $1 AND d.bucket >= ($2::timestamptz AT TIME ZONE 'UTC')::date
+			AND d.bucket < ($3::timestamptz AT TIME ZONE 'UTC')::date
+		GROUP BY d.license_id, l.tier, d.hardware_id, d.source_type
+	`, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := statementTotals(instanceLines)
+	totals.Pipelines = statementTotals(pipelineLines).Pipelines
+
+	return &UsageStatement{
+		UserID:      userID,
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: time.Now().UTC(),
+		Totals:      totals,
+		Lines:       statementLines(pipelineLines, instanceLines),
+	}, nil
+}
+
+// WriteUsageStatementCSV writes one CSV row per statement line
+func WriteUsageStatementCSV(w io.Writer, stmt *UsageStatement) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"period", "license_id", "license_tier", "hardware_id", "pipeline_id", "pipeline_name",
+		"source_type", "events_processed", "bytes_processed", "error_count", "uptime_hours",
+	}); err != nil {
+		return err
+	}
+
+	for _, line := range stmt.Lines {
+		pipelineID := ""
+		if line.PipelineID != nil {
+			pipelineID = line.PipelineID.String()
+		}
+		if err := cw.Write([]string{
+			stmt.Period,
+			line.LicenseID.String(),
+			line.LicenseTier,
+			line.HardwareID,
+			pipelineID,
+			line.PipelineName,
+			line.SourceType,
+			strconv.FormatInt(line.EventsProcessed, 10),
+			strconv.FormatInt(line.BytesProcessed, 10),
+			strconv.FormatInt(line.ErrorCount, 10),
+			strconv.FormatFloat(line.UptimeHours, 'f', 2, 64),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// GetEmailEnabled reports whether a user receives monthly statements by email
+func (s *UsageStatementService) GetEmailEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var enabled bool
+	err := s.db.Pool().QueryRow(ctx, `
+		SELECT COALESCE((SELECT email_enabled FROM usage_statement_settings WHERE user_id = $1), false)
+	`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// SetEmailEnabled turns monthly statement emails on or off for a user
+func (s *UsageStatementService) SetEmailEnabled(ctx context.Context, userID uuid.UUID, enabled bool) error {
+	_, err := s.db.Pool().Exec(ctx, `
+		INSERT INTO usage_statement_settings (user_id, email_enabled) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET email_enabled = EXCLUDED.email_enabled
+	`, userID, enabled)
+	return err
+}
+
+// SendMonthlyStatements emails the statement for period to every account that
+// opted in and has not received it yet. Recipients are the account owner and
+// the invoice emails of their billing profile.
+func (s *UsageStatementService) SendMonthlyStatements(ctx context.Context, period string) error {
+	rows, err := s.db.Pool().Query(ctx, `
+		SELECT u.id, u.name, u.email, COALESCE(bp.invoice_emails, '{}')
+		FROM usage_statement_settings st
+		JOIN users u ON u.id = st.user_id
+		LEFT JOIN billing_profiles bp ON bp.user_id = u.id
+		WHERE st.email_enabled
+		AND NOT EXISTS (
+			SELECT 1 FROM usage_statement_deliveries d WHERE d.user_id = u.id AND d.period = $1
+		)
+	`, period)
+	if err != nil {
+		return err
+	}
+
+	type recipient struct {
+		userID uuid.UUID
+		name   string
+		emails []string
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		var email string
+		var invoiceEmails []string
+		if err := rows.Scan(&r.userID, &r.name, &email, &invoiceEmails); err != nil {
+			rows.Close()
+			return err
+		}
+		r.emails = []string{email}
+		for _, e := range invoiceEmails {
+			if !strings.EqualFold(e, email) {
+				r.emails = append(r.emails, e)
+			}
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, r := range recipients {
+		if err := s.sendStatement(ctx, r.userID, r.name, r.emails, period); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("user %s: %w", r.userID, err)
+		}
+	}
+	return firstErr
+}
+
+func (s *UsageStatementService) sendStatement(ctx context.Context, userID uuid.UUID, name string, emails []string, period string) error {
+	// Claim the delivery before sending, so neither another replica nor a
+	// retry after a failed invoice copy emails the owner again
+	result, err := s.db.Pool().Exec(ctx, `
+		INSERT INTO usage_statement_deliveries (user_id, period) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, period)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return nil
+	}
+
+	stmt, err := s.GetStatement(ctx, userID, period)
+	if err == nil {
+		err = s.emailService.SendUsageStatementEmail(ctx, emails[0], name, stmt)
+	}
+	if err != nil {
+		// Nobody got the statement, so the next run may send it
+		if _, releaseErr := s.db.Pool().Exec(ctx, `
+			DELETE FROM usage_statement_deliveries WHERE user_id = $1 AND period = $2
+		`, userID, period); releaseErr != nil {
+			log.Printf("Failed to release usage statement delivery of user %s: %v", userID, releaseErr)
+		}
+		return fmt.Errorf("failed to send usage statement: %w", err)
+	}
+
+	var firstErr error
+	for _, to := range emails[1:] {
+		if err := s.emailService.SendUsageStatementEmail(ctx, to, name, stmt); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to send usage statement to %s: %w", to, err)
+		}
+	}
+	return firstErr
+}
+
+// statementsDue reports whether the previous month's statements can go out:
+// samples are accepted and rolled up for a while after the hour they cover,
+// so a month is only complete once that window has passed
+func statementsDue(now time.Time) bool {
+	return now.Sub(startOfMonth(now)) >= telemetryRollupLookback+time.Hour
+}
+
+// Start sends the previous month's statements every interval until ctx is
+// canceled. Statements go out once the month's rollups are complete early in
+// the next month, or as soon as the server is back if it was down then.
+func (s *UsageStatementService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UTC()
+		if statementsDue(now) {
+			if err := s.SendMonthlyStatements(ctx, previousPeriod(now)); err != nil {
+				log.Printf("Usage statement delivery failed: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
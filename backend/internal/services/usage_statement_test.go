@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatementPeriod(t *testing.T) {
+	start, end, err := ParseStatementPeriod("2025-12")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	for _, period := range []string{"", "2025-13", "2025-1", "2025/01", "january"} {
+		_, _, err := ParseStatementPeriod(period)
+		assert.Equal(t, ErrInvalidStatementPeriod, err, period)
+	}
+}
+
+func TestPreviousPeriod(t *testing.T) {
+	assert.Equal(t, "2025-02", previousPeriod(time.Date(2025, 3, 1, 0, 30, 0, 0, time.UTC)))
+	assert.Equal(t, "2024-12", previousPeriod(time.Date(2025, 1, 31, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestStatementsDue(t *testing.T) {
+	// Late samples for the last hours of the month are still rolled up early on the first
+	assert.False(t, statementsDue(time.Date(2025, 3, 1, 0, 30, 0, 0, time.UTC)))
+	assert.False(t, statementsDue(time.Date(2025, 3, 2, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, statementsDue(time.Date(2025, 3, 3, 1, 0, 0, 0, time.UTC)))
+}
+
+func TestStatementTotals(t *testing.T) {
+	licenseA, licenseB := uuid.New(), uuid.New()
+	pipeline := uuid.New()
+
+	totals := statementTotals([]UsageStatementLine{
+		{LicenseID: licenseA, HardwareID: "hw-1", PipelineID: &pipeline, EventsProcessed: 100, BytesProcessed: 1000, UptimeHours: 10},
+		{LicenseID: licenseA, HardwareID: "hw-1", SourceType: "mysql", EventsProcessed: 50, BytesProcessed: 500, ErrorCount: 2},
+		{LicenseID: licenseB, HardwareID: "hw-1", PipelineID: &pipeline, EventsProcessed: 10, BytesProcessed: 100, UptimeHours: 1.5},
+	})
+
+	assert.Equal(t, int64(160), totals.EventsProcessed)
+	assert.Equal(t, int64(1600), totals.BytesProcessed)
+	assert.Equal(t, int64(2), totals.ErrorCount)
+	assert.Equal(t, 11.5, totals.UptimeHours)
+	assert.Equal(t, 2, totals.Licenses)
+	assert.Equal(t, 2, totals.Instances) // same hardware ID under two licenses
+	assert.Equal(t, 1, totals.Pipelines)
+}
+
+func TestStatementLines(t *testing.T) {
+	license := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	orders, payments := uuid.New(), uuid.New()
+
+	pipelineLines := []UsageStatementLine{
+		{LicenseID: license, HardwareID: "hw-1", PipelineID: &payments, PipelineName: "payments", SourceType: "postgres", EventsProcessed: 30, BytesProcessed: 300},
+		{LicenseID: license, HardwareID: "hw-1", PipelineID: &orders, PipelineName: "orders", SourceType: "postgres", EventsProcessed: 60, BytesProcessed: 600, ErrorCount: 1},
+	}
+	instanceLines := []UsageStatementLine{
+		{LicenseID: license, HardwareID: "hw-1", SourceType: "postgres", EventsProcessed: 100, BytesProcessed: 900, ErrorCount: 1, UptimeHours: 24},
+		// An engine without a per-pipeline breakdown
+		{LicenseID: license, HardwareID: "hw-2", SourceType: "mysql", EventsProcessed: 5, BytesProcessed: 50},
+	}
+
+	lines := statementLines(pipelineLines, instanceLines)
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "orders", lines[0].PipelineName)
+	assert.Equal(t, "payments", lines[1].PipelineName)
+
+	rest := lines[2]
+	assert.Nil(t, rest.PipelineID)
+	assert.Equal(t, "hw-1", rest.HardwareID)
+	assert.Equal(t, int64(10), rest.EventsProcessed)
+	assert.Equal(t, int64(0), rest.BytesProcessed)
+	assert.Equal(t, int64(0), rest.ErrorCount)
+	assert.Equal(t, 24.0, rest.UptimeHours)
+	assert.Equal(t, "hw-2", lines[3].HardwareID)
+
+	// The lines add up to the instance totals
+	assert.Equal(t, statementTotals(instanceLines).EventsProcessed, statementTotals(lines).EventsProcessed)
+	assert.Equal(t, statementTotals(instanceLines).UptimeHours, statementTotals(lines).UptimeHours)
+}
+
+func TestWriteUsageStatementCSV(t *testing.T) {
+	licenseID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	pipelineID := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	stmt := &UsageStatement{
+		Period: "2025-01",
+		Lines: []UsageStatementLine{
+			{LicenseID: licenseID, LicenseTier: "pro", HardwareID: "hw-1", PipelineID: &pipelineID,
+				PipelineName: "orders, eu", SourceType: "postgres", EventsProcessed: 42, BytesProcessed: 4096, UptimeHours: 1.5},
+			{LicenseID: licenseID, LicenseTier: "pro", HardwareID: "hw-2", SourceType: "mysql", ErrorCount: 3},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteUsageStatementCSV(&buf, stmt))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "period,license_id,license_tier,hardware_id,pipeline_id,pipeline_name,source_type,events_processed,bytes_processed,error_count,uptime_hours", lines[0])
+	assert.Equal(t, `2025-01,11111111-1111-1111-1111-111111111111,pro,hw-1,22222222-2222-2222-2222-222222222222,"orders, eu",postgres,42,4096,0,1.50`, lines[1])
+	assert.Equal(t, "2025-01,11111111-1111-1111-1111-111111111111,pro,hw-2,,,mysql,0,0,3,0.00", lines[2])
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.0 KiB", formatBytes(1024))
+	assert.Equal(t, "1.5 GiB", formatBytes(1536*1024*1024))
+}
@@ -26,10 +26,10 @@ func NewUserService(db *repository.PostgresDB) *UserService {
 func (s *UserService) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), created_at, updated_at, last_login_at
+		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), payment_provider, created_at, updated_at, last_login_at
 		FROM users WHERE id = $1
 	`, id).Scan(&user.ID, &user.Email, &user.Name, &user.Company, &user.Role,
-		&user.EmailVerified, &user.StripeCustomerID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
+		&user.EmailVerified, &user.StripeCustomerID, &user.PaymentProvider, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
@@ -88,7 +88,7 @@ func (s *UserService) ListUsers(ctx context.Context, limit, offset int) ([]model
 	}
 
 	rows, err := s.db.Pool().Query(ctx, `
-		SELECT id, email, name, COALESCE(company, ''), role, email_verified, created_at, updated_at, last_login_at
+		SELECT id, email, name, COALESCE(company, ''), role, email_verified, payment_provider, created_at, updated_at, last_login_at
 		FROM users ORDER BY created_at DESC LIMIT $1 OFFSET $2
 	`, limit, offset)
 	if err != nil {
@@ -100,7 +100,7 @@ func (s *UserService) ListUsers(ctx context.Context, limit, offset int) ([]model
 	for rows.Next() {
 		var u models.User
 		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Company, &u.Role,
-			&u.EmailVerified, &u.CreatedAt, &u.UpdatedAt, &u.LastLoginAt); err != nil {
+			&u.EmailVerified, &u.PaymentProvider, &u.CreatedAt, &u.UpdatedAt, &u.LastLoginAt); err != nil {
 			return nil, 0, err
 		}
 		users = append(users, u)
@@ -123,10 +123,10 @@ func (s *UserService) UpdateUserRole(ctx context.Context, userID uuid.UUID, role
 func (s *UserService) GetByStripeCustomerID(ctx context.Context, stripeCustomerID string) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool().QueryRow(ctx, `
-		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), created_at, updated_at, last_login_at
+		SELECT id, email, name, COALESCE(company, ''), role, email_verified, COALESCE(stripe_customer_id, ''), payment_provider, created_at, updated_at, last_login_at
 		FROM users WHERE stripe_customer_id = $1
 	`, stripeCustomerID).Scan(&user.ID, &user.Email, &user.Name, &user.Company, &user.Role,
-		&user.EmailVerified, &user.StripeCustomerID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
+		&user.EmailVerified, &user.StripeCustomerID, &user.PaymentProvider, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
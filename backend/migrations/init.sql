@@ -18,6 +18,7 @@ CREATE TABLE users (
     role VARCHAR(50) NOT NULL DEFAULT 'user',
     email_verified BOOLEAN NOT NULL DEFAULT false,
     stripe_customer_id VARCHAR(255),
+    payment_provider VARCHAR(50) NOT NULL DEFAULT 'stripe',
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     last_login_at TIMESTAMPTZ
@@ -50,6 +51,23 @@ CREATE TABLE password_resets (
 
 CREATE INDEX idx_password_resets_token ON password_resets(token);
 
+-- API keys for machine access (e.g. Prometheus federation). Only the SHA-256
+-- of the key is stored; the key itself is shown once at creation.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_keys_user ON api_keys(user_id);
+
 -- ============================================
 -- Licenses & Billing
 -- ============================================
@@ -69,7 +87,8 @@ CREATE TABLE licenses (
     issued_at TIMESTAMPTZ NOT NULL,
     expires_at TIMESTAMPTZ NOT NULL,
     revoked_at TIMESTAMPTZ,
-    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
 CREATE INDEX idx_licenses_user ON licenses(user_id);
@@ -86,7 +105,8 @@ CREATE TABLE license_activations (
     ip_address VARCHAR(45),
     activated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    deactivated_at TIMESTAMPTZ
+    deactivated_at TIMESTAMPTZ,
+    telemetry_secret VARCHAR(64) -- HMAC key the instance signs telemetry with
 );
 
 CREATE INDEX idx_activations_license ON license_activations(license_id);
@@ -95,6 +115,8 @@ CREATE INDEX idx_activations_license ON license_activations(license_id);
 CREATE TABLE subscriptions (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    payment_provider VARCHAR(50) NOT NULL DEFAULT 'stripe',
+    -- stripe_* columns hold the provider's IDs for non-Stripe providers too
     stripe_subscription_id VARCHAR(255) UNIQUE NOT NULL,
     stripe_price_id VARCHAR(255) NOT NULL,
     status VARCHAR(50) NOT NULL,
@@ -113,6 +135,10 @@ CREATE TABLE invoices (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     stripe_invoice_id VARCHAR(255) UNIQUE NOT NULL,
+    payment_provider VARCHAR(50) NOT NULL DEFAULT 'stripe',
+    plan VARCHAR(50),
+    subtotal BIGINT NOT NULL DEFAULT 0,
+    tax BIGINT NOT NULL DEFAULT 0,
     amount BIGINT NOT NULL,
     currency VARCHAR(3) NOT NULL DEFAULT 'usd',
     status VARCHAR(50) NOT NULL,
@@ -120,11 +146,98 @@ CREATE TABLE invoices (
     invoice_pdf TEXT,
     period_start TIMESTAMPTZ NOT NULL,
     period_end TIMESTAMPTZ NOT NULL,
+    line_items JSONB NOT NULL DEFAULT '[]',
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
 CREATE INDEX idx_invoices_user ON invoices(user_id);
 
+-- Billing profiles (legal entity invoices are issued to)
+CREATE TABLE billing_profiles (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    legal_name VARCHAR(255) NOT NULL,
+    address_line1 VARCHAR(255) NOT NULL DEFAULT '',
+    address_line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(255) NOT NULL DEFAULT '',
+    state VARCHAR(255) NOT NULL DEFAULT '',
+    postal_code VARCHAR(50) NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL,
+    tax_ids JSONB NOT NULL DEFAULT '[]',
+    invoice_emails TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Contracts (enterprise agreements signed outside the payment providers)
+CREATE TABLE contracts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    po_number VARCHAR(255) NOT NULL DEFAULT '',
+    tier VARCHAR(50) NOT NULL DEFAULT 'enterprise',
+    status VARCHAR(50) NOT NULL DEFAULT 'pending', -- pending, active, expired, terminated
+    start_date TIMESTAMPTZ NOT NULL,
+    end_date TIMESTAMPTZ NOT NULL,
+    -- committed limits; 0 falls back to the tier defaults
+    max_sources INTEGER NOT NULL DEFAULT 0,
+    max_tables INTEGER NOT NULL DEFAULT 0,
+    max_throughput BIGINT NOT NULL DEFAULT 0,
+    contract_value BIGINT NOT NULL DEFAULT 0, -- in cents
+    currency VARCHAR(3) NOT NULL DEFAULT 'usd',
+    auto_renew BOOLEAN NOT NULL DEFAULT false,
+    notes TEXT NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_contracts_user ON contracts(user_id);
+CREATE INDEX idx_contracts_status_end ON contracts(status, end_date);
+
+-- Licenses issued under a contract
+CREATE TABLE contract_licenses (
+    contract_id UUID NOT NULL REFERENCES contracts(id) ON DELETE CASCADE,
+    license_id UUID NOT NULL UNIQUE REFERENCES licenses(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (contract_id, license_id)
+);
+
+-- Renewal reminders already sent, per contract term
+CREATE TABLE contract_reminders (
+    contract_id UUID NOT NULL REFERENCES contracts(id) ON DELETE CASCADE,
+    end_date TIMESTAMPTZ NOT NULL,
+    days_before INTEGER NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (contract_id, end_date, days_before)
+);
+
+-- Advisories admins attach to engine releases
+CREATE TABLE release_advisories (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product VARCHAR(50) NOT NULL DEFAULT 'cdc-engine',
+    version VARCHAR(50) NOT NULL,
+    kind VARCHAR(20) NOT NULL, -- deprecated, security
+    severity VARCHAR(20) NOT NULL DEFAULT 'medium', -- low, medium, high, critical
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    url TEXT,
+    fixed_in VARCHAR(50),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_release_advisories_version ON release_advisories(product, version);
+
+-- Upgrade notices already sent, per account, version and status
+CREATE TABLE fleet_version_notices (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    version VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL, -- outdated, deprecated, vulnerable
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, version, status)
+);
+
 -- ============================================
 -- Connections & Pipelines
 -- ============================================
@@ -140,10 +253,25 @@ CREATE TABLE connections (
     database VARCHAR(255) NOT NULL,
     username VARCHAR(255) NOT NULL,
     password TEXT NOT NULL,
+    password_ref TEXT, -- env:, file: or vault: reference resolved by the engine; password is then empty
     ssl_mode VARCHAR(50) DEFAULT 'prefer',
     options JSONB DEFAULT '{}',
+    -- SSH bastion the database is reached through; no tunnel when ssh_host is NULL
+    ssh_host VARCHAR(255),
+    ssh_port INTEGER,
+    ssh_user VARCHAR(255),
+    ssh_private_key TEXT, -- encrypted like password
+    ssh_host_key_fingerprint VARCHAR(100),
+    -- CA bundle and client certificate, encrypted like password
+    tls_ca_cert TEXT,
+    tls_client_cert TEXT,
+    tls_client_key TEXT,
+    tls_certificates JSONB, -- subjects and validity of the certificates above
+    tls_expires_at TIMESTAMPTZ,
+    tls_expiry_notified_at TIMESTAMPTZ,
     last_tested_at TIMESTAMPTZ,
     test_status VARCHAR(50),
+    test_error TEXT,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
@@ -151,6 +279,21 @@ CREATE TABLE connections (
 CREATE INDEX idx_connections_user ON connections(user_id);
 CREATE UNIQUE INDEX idx_connections_name_user ON connections(user_id, name);
 
+-- Connection health history: manual, scheduled and engine-reported tests
+CREATE TABLE connection_tests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    connection_id UUID NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL, -- success, failed
+    trigger VARCHAR(50) NOT NULL, -- manual, scheduled, engine
+    latency_ms BIGINT,
+    category VARCHAR(50), -- error category of a failed test
+    message TEXT,
+    tested_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_connection_tests_connection ON connection_tests(connection_id, tested_at DESC);
+CREATE INDEX idx_connection_tests_tested_at ON connection_tests(tested_at);
+
 -- Pipelines
 CREATE TABLE pipelines (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -195,11 +338,14 @@ CREATE INDEX idx_pipeline_logs_timestamp ON pipeline_logs(timestamp);
 -- Telemetry & Analytics
 -- ============================================
 
--- Telemetry
+-- Telemetry (raw samples, partitioned by month; the API creates upcoming
+-- partitions and drops the ones past retention). Rows without a pipeline_id
+-- are instance totals; rows with one are the per-pipeline breakdown, which
+-- goes with its pipeline so it never turns into an instance total.
 CREATE TABLE telemetry (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
     license_id UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
-    pipeline_id UUID REFERENCES pipelines(id) ON DELETE SET NULL,
+    pipeline_id UUID REFERENCES pipelines(id) ON DELETE CASCADE,
     hardware_id VARCHAR(255) NOT NULL,
     timestamp TIMESTAMPTZ NOT NULL,
     events_processed BIGINT NOT NULL DEFAULT 0,
@@ -210,13 +356,125 @@ CREATE TABLE telemetry (
     error_count BIGINT NOT NULL DEFAULT 0,
     uptime_hours DOUBLE PRECISION NOT NULL DEFAULT 0,
     compression_ratio DOUBLE PRECISION DEFAULT 1.0,
+    lag_ms BIGINT NOT NULL DEFAULT 0,
     version VARCHAR(50),
-    source_type VARCHAR(50)
-);
+    source_type VARCHAR(50),
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
 
-CREATE INDEX idx_telemetry_license ON telemetry(license_id);
+-- Catches samples outside the monthly partitions so inserts never fail
+CREATE TABLE telemetry_default PARTITION OF telemetry DEFAULT;
+
+CREATE INDEX idx_telemetry_license ON telemetry(license_id, timestamp);
 CREATE INDEX idx_telemetry_timestamp ON telemetry(timestamp);
-CREATE INDEX idx_telemetry_pipeline ON telemetry(pipeline_id);
+CREATE INDEX idx_telemetry_pipeline ON telemetry(pipeline_id, timestamp);
+
+-- Samples already recorded per instance, so a retried upload is not counted twice
+CREATE TABLE telemetry_receipts (
+    license_id UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    hardware_id VARCHAR(255) NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (license_id, hardware_id, timestamp)
+);
+
+CREATE INDEX idx_telemetry_receipts_received ON telemetry_receipts(received_at);
+
+-- Hourly telemetry rollups, one row per instance per hour
+CREATE TABLE telemetry_hourly (
+    license_id UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    hardware_id VARCHAR(255) NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    events_processed BIGINT NOT NULL DEFAULT 0,
+    bytes_processed BIGINT NOT NULL DEFAULT 0,
+    error_count BIGINT NOT NULL DEFAULT 0,
+    avg_latency_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+    uptime_hours DOUBLE PRECISION NOT NULL DEFAULT 0,
+    sample_count INTEGER NOT NULL DEFAULT 0,
+    source_type VARCHAR(50) NOT NULL DEFAULT '',
+    PRIMARY KEY (license_id, hardware_id, bucket)
+);
+
+CREATE INDEX idx_telemetry_hourly_bucket ON telemetry_hourly(bucket);
+
+-- Daily telemetry rollups built from the hourly ones, kept indefinitely
+CREATE TABLE telemetry_daily (
+    license_id UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    hardware_id VARCHAR(255) NOT NULL,
+    bucket DATE NOT NULL,
+    events_processed BIGINT NOT NULL DEFAULT 0,
+    bytes_processed BIGINT NOT NULL DEFAULT 0,
+    error_count BIGINT NOT NULL DEFAULT 0,
+    avg_latency_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+    uptime_hours DOUBLE PRECISION NOT NULL DEFAULT 0,
+    sample_count INTEGER NOT NULL DEFAULT 0,
+    source_type VARCHAR(50) NOT NULL DEFAULT '',
+    PRIMARY KEY (license_id, hardware_id, bucket)
+);
+
+CREATE INDEX idx_telemetry_daily_bucket ON telemetry_daily(bucket);
+
+-- Daily per-pipeline usage, kept like the daily rollups so usage statements
+-- outlive raw telemetry
+CREATE TABLE telemetry_pipeline_daily (
+    license_id UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    hardware_id VARCHAR(255) NOT NULL,
+    pipeline_id UUID NOT NULL REFERENCES pipelines(id) ON DELETE CASCADE,
+    bucket DATE NOT NULL,
+    events_processed BIGINT NOT NULL DEFAULT 0,
+    bytes_processed BIGINT NOT NULL DEFAULT 0,
+    error_count BIGINT NOT NULL DEFAULT 0,
+    uptime_hours DOUBLE PRECISION NOT NULL DEFAULT 0,
+    source_type VARCHAR(50) NOT NULL DEFAULT '',
+    PRIMARY KEY (license_id, hardware_id, pipeline_id, bucket)
+);
+
+CREATE INDEX idx_telemetry_pipeline_daily_bucket ON telemetry_pipeline_daily(bucket);
+
+-- Telemetry submissions rejected as suspicious, kept for review
+CREATE TABLE telemetry_quarantine (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id VARCHAR(255) NOT NULL DEFAULT '', -- as submitted, may not be a valid UUID
+    hardware_id VARCHAR(255) NOT NULL DEFAULT '',
+    reason VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    remote_ip VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_telemetry_quarantine_created ON telemetry_quarantine(created_at);
+
+-- Seasonal baselines of pipeline telemetry: mean and deviation of the hourly
+-- value of each metric per hour of week (0 = Monday 00:00 UTC)
+CREATE TABLE pipeline_baselines (
+    pipeline_id UUID NOT NULL REFERENCES pipelines(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL, -- throughput, latency, error_rate
+    hour_of_week SMALLINT NOT NULL CHECK (hour_of_week BETWEEN 0 AND 167),
+    mean DOUBLE PRECISION NOT NULL,
+    stddev DOUBLE PRECISION NOT NULL,
+    samples INTEGER NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (pipeline_id, metric, hour_of_week)
+);
+
+-- Deviations of pipeline telemetry from its baseline
+CREATE TABLE pipeline_anomalies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pipeline_id UUID NOT NULL REFERENCES pipelines(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL, -- throughput_drop, latency_spike, error_rate_jump
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, resolved
+    observed DOUBLE PRECISION NOT NULL,
+    expected DOUBLE PRECISION NOT NULL,
+    stddev DOUBLE PRECISION NOT NULL,
+    score DOUBLE PRECISION NOT NULL, -- deviations from the expected value
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_pipeline_anomalies_open ON pipeline_anomalies(pipeline_id, kind) WHERE status = 'open';
+CREATE INDEX idx_pipeline_anomalies_user ON pipeline_anomalies(user_id, detected_at DESC);
 
 -- License usage (aggregated telemetry for billing/analytics)
 CREATE TABLE license_usage (
@@ -236,6 +494,21 @@ CREATE INDEX idx_license_usage_license ON license_usage(license_id);
 CREATE INDEX idx_license_usage_recorded ON license_usage(recorded_at);
 CREATE INDEX idx_license_usage_license_time ON license_usage(license_id, recorded_at);
 
+-- Monthly usage statements: opt-in for email delivery and what was already sent
+CREATE TABLE usage_statement_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_enabled BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE usage_statement_deliveries (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    period VARCHAR(7) NOT NULL, -- YYYY-MM
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, period)
+);
+
 -- Early access requests
 CREATE TABLE early_access_requests (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -267,6 +540,63 @@ CREATE TABLE audit_log (
 CREATE INDEX idx_audit_user ON audit_log(user_id);
 CREATE INDEX idx_audit_action ON audit_log(action);
 
+-- ============================================
+-- Alerting
+-- ============================================
+
+-- Where alert notifications go: email address, generic webhook or Slack-compatible webhook
+CREATE TABLE alert_channels (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL, -- email, webhook, slack
+    target TEXT NOT NULL, -- email address or webhook URL
+    secret VARCHAR(255), -- signs generic webhook payloads
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_alert_channels_user ON alert_channels(user_id);
+
+-- User-defined alert rules evaluated on a schedule
+CREATE TABLE alert_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    scope VARCHAR(20) NOT NULL, -- pipeline, instance, license
+    scope_id VARCHAR(255), -- one pipeline/instance/license, or NULL for all of them
+    metric VARCHAR(50) NOT NULL,
+    operator VARCHAR(5) NOT NULL, -- gt, gte, lt, lte
+    threshold DOUBLE PRECISION NOT NULL,
+    duration_seconds INTEGER NOT NULL DEFAULT 0, -- how long the condition must hold before firing
+    channel_ids UUID[] NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_alert_rules_user ON alert_rules(user_id);
+
+-- Alert state per rule and subject (pipeline, instance or license)
+CREATE TABLE alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    rule_id UUID NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subject VARCHAR(255) NOT NULL,
+    subject_name VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL, -- pending, firing, resolved
+    value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL, -- when the condition started holding
+    fired_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- At most one open alert per rule and subject
+CREATE UNIQUE INDEX idx_alerts_open ON alerts(rule_id, subject) WHERE status IN ('pending', 'firing');
+CREATE INDEX idx_alerts_user ON alerts(user_id, started_at DESC);
+
 -- ============================================
 -- Functions & Triggers
 -- ============================================
@@ -282,15 +612,36 @@ $$ LANGUAGE plpgsql;
 CREATE TRIGGER users_updated_at BEFORE UPDATE ON users
     FOR EACH ROW EXECUTE FUNCTION update_updated_at();
 
+CREATE TRIGGER licenses_updated_at BEFORE UPDATE ON licenses
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
 CREATE TRIGGER subscriptions_updated_at BEFORE UPDATE ON subscriptions
     FOR EACH ROW EXECUTE FUNCTION update_updated_at();
 
+CREATE TRIGGER billing_profiles_updated_at BEFORE UPDATE ON billing_profiles
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER contracts_updated_at BEFORE UPDATE ON contracts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER release_advisories_updated_at BEFORE UPDATE ON release_advisories
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER usage_statement_settings_updated_at BEFORE UPDATE ON usage_statement_settings
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
 CREATE TRIGGER connections_updated_at BEFORE UPDATE ON connections
     FOR EACH ROW EXECUTE FUNCTION update_updated_at();
 
 CREATE TRIGGER pipelines_updated_at BEFORE UPDATE ON pipelines
     FOR EACH ROW EXECUTE FUNCTION update_updated_at();
 
+CREATE TRIGGER alert_channels_updated_at BEFORE UPDATE ON alert_channels
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER alert_rules_updated_at BEFORE UPDATE ON alert_rules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
 -- ============================================
 -- Initial Data
 -- ============================================